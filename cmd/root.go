@@ -26,21 +26,25 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/fwiedmann/differ/pkg/analyzing"
 	"github.com/fwiedmann/differ/pkg/monitoring"
+	"github.com/fwiedmann/differ/pkg/receiving"
+	"github.com/fwiedmann/differ/pkg/serving"
 
 	"k8s.io/client-go/kubernetes"
 
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
-	"k8s.io/client-go/informers"
-
+	"github.com/fwiedmann/differ/pkg/notifying"
 	"github.com/fwiedmann/differ/pkg/observing"
 
 	"github.com/fwiedmann/differ/pkg/config"
@@ -50,6 +54,8 @@ import (
 
 	"github.com/fwiedmann/differ/pkg/differentiating"
 
+	"github.com/fwiedmann/differ/pkg/storage/bolt"
+	"github.com/fwiedmann/differ/pkg/storage/crd"
 	"github.com/fwiedmann/differ/pkg/storage/memory"
 
 	_ "net/http/pprof"
@@ -83,54 +89,142 @@ var rootCmd = cobra.Command{
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
-		kubernetesAPIClient, err := kubernetes_client.InitKubernetesAPIClient(isDevMode)
+		clusters, err := kubernetes_client.InitKubernetesAPIClient(isDevMode, conf.Clusters, conf.Namespace)
 		if err != nil {
 			return err
 		}
 
-		if err := checkKubernetesAPIPermissions(ctx, kubernetesAPIClient, conf.Namespace); err != nil {
+		for _, cluster := range clusters {
+			if err := checkKubernetesAPIPermissions(ctx, cluster.Client, cluster.Namespace); err != nil {
+				return fmt.Errorf("differ error: cluster %s: %w", cluster.Name, err)
+			}
+		}
+
+		storage, state, closeStorage, err := newStorage(ctx, conf, clusters)
+		if err != nil {
 			return err
 		}
+		defer func() {
+			if err := closeStorage(); err != nil {
+				log.Error(err)
+			}
+		}()
 
-		storage := memory.NewMemoryStorage()
+		webhookSources := newWebhookSources(conf)
+		snoozes, err := newSnoozes(conf)
+		if err != nil {
+			return err
+		}
 
-		service := differentiating.NewOCIRegistryService(ctx, storage, conf.ParsedRegistryRequestSleepDuration, func(c http.Client, img registry.OciImage) differentiating.OciRegistryAPIClient {
+		service := differentiating.NewOCIRegistryService(ctx, storage, differentiating.OCIRegistryServiceOptions{
+			Scheduler: differentiating.SchedulerOptions{
+				Interval:            conf.ParsedRegistryRequestSleepDuration,
+				Jitter:              conf.Scheduler.Jitter,
+				Fetchers:            conf.Scheduler.Fetchers,
+				RegistryConcurrency: conf.Scheduler.RegistryConcurrency,
+				RegistryIntervals:   newSafetyNetIntervals(webhookSources, conf.Webhooks.ParsedSafetyNetInterval),
+			},
+			RateLimits:       newRateLimits(conf),
+			TagPolicies:      newTagPolicies(conf),
+			ReminderInterval: conf.ParsedNotificationReminderInterval,
+			Snoozes:          snoozes,
+			State:            state,
+			History:          newHistory(storage),
+			HistoryRetention: conf.Storage.ParsedHistoryRetention,
+			Subscription: differentiating.SubscriptionOptions{
+				BufferSize:   conf.NotificationDelivery.BufferSize,
+				Policy:       differentiating.DeliveryPolicy(conf.NotificationDelivery.Policy),
+				BlockTimeout: conf.NotificationDelivery.ParsedBlockTimeout,
+			},
+		}, func(c http.Client, img registry.OciImage) differentiating.OciRegistryAPIClient {
 			return &registry.OciAPIClient{
 				Image:  img,
 				Client: c,
 			}
 		})
 		event := make(chan differentiating.NotificationEvent)
-		service.Notify(event)
+		service.Notify("log", event)
 
-		sharedInformerFactory := informers.NewSharedInformerFactoryWithOptions(kubernetesAPIClient, 0, informers.WithNamespace(conf.Namespace))
-		appv1DaemonSetInformer := sharedInformerFactory.Apps().V1().DaemonSets().Informer()
-		err = observing.StartKubernetesObserverService(ctx, kubernetesAPIClient, appv1DaemonSetInformer, conf.Namespace, observing.NewKubernetesAPPV1DaemonSetSerializer, service)
+		deadLetters, err := notifying.NewDeadLetterLog(conf.Notifiers.DeadLetterLog)
 		if err != nil {
 			return err
 		}
+		defer func() {
+			if err := deadLetters.Close(); err != nil {
+				log.Error(err)
+			}
+		}()
+		// the checks and the subscribers are stopped before the dead letter log and the storage are closed, so that
+		// their last writes are not lost
+		var subscribers sync.WaitGroup
+		defer func() {
+			cancel()
+			service.Wait()
+			subscribers.Wait()
+		}()
+		runSubscriber := func(f func()) {
+			subscribers.Add(1)
+			go func() {
+				defer subscribers.Done()
+				f()
+			}()
+		}
 
-		appv1DeploymentInformer := sharedInformerFactory.Apps().V1().Deployments().Informer()
-		err = observing.StartKubernetesObserverService(ctx, kubernetesAPIClient, appv1DeploymentInformer, conf.Namespace, observing.NewKubernetesAPPV1DeploymentSerializer, service)
+		notifiers, err := newNotifiers(conf, deadLetters)
+		if err != nil {
+			return err
+		}
+		for _, notifier := range notifiers {
+			// each notifier reads its own queue, so that retries of one notifier do not delay the others
+			notifierEvents := make(chan differentiating.NotificationEvent)
+			service.Notify(notifier.Name(), notifierEvents)
+			notifier := notifier
+			runSubscriber(func() { notifying.Run(ctx, notifier, notifierEvents) })
+		}
+		digests, err := newDigests(conf, service)
 		if err != nil {
 			return err
 		}
+		for _, digest := range digests {
+			digest := digest
+			runSubscriber(func() { digest.Run(ctx) })
+		}
+
+		if reports, ok := storage.(*crd.Storage); ok {
+			// the report status must not miss transitions, the writes are batched anyway
+			subscription := service.Subscribe(differentiating.SubscriptionOptions{Name: "image-reports", Policy: differentiating.DeliveryBlock})
+			runSubscriber(func() { reports.SyncStatus(subscription) })
+		}
 
-		appv1StatefulSetInformer := sharedInformerFactory.Apps().V1().StatefulSets().Informer()
-		err = observing.StartKubernetesObserverService(ctx, kubernetesAPIClient, appv1StatefulSetInformer, conf.Namespace, observing.NewKubernetesAPPV1StatefulSetSerializer, service)
+		reconciler := observing.NewReconciler(service, conf.ParsedReconcileInterval)
+		for _, cluster := range clusters {
+			observers, err := observing.StartKubernetesObserverServices(ctx, cluster.Name, cluster.Client, cluster.Namespace, service)
+			if err != nil {
+				return err
+			}
+			reconciler.Register(observers...)
+		}
+		go reconciler.Run(ctx)
+
+		webhookHandler, err := receiving.NewWebhookHandler(service, webhookSources)
 		if err != nil {
 			return err
 		}
 
 		mux := http.NewServeMux()
 		mux.Handle("/metrics", monitoring.MetricsHandler())
+		mux.Handle(receiving.WebhookPathPrefix, webhookHandler)
+		// the API also serves the admin endpoints of the workers, e.g. POST /api/v1/workers/<registry>/<image>/check,
+		// which require the API token
+		mux.Handle(serving.APIPathPrefix, serving.NewAPI(service, conf.API.Token))
 
 		server := http.Server{
 			Addr:              ":8080",
 			Handler:           mux,
 			ReadTimeout:       time.Second * 10,
 			ReadHeaderTimeout: 0,
-			WriteTimeout:      time.Second,
+			// on-demand checks respond after the registry request, which times out after 10 seconds
+			WriteTimeout: time.Second * 15,
 		}
 
 		go func() {
@@ -145,7 +239,12 @@ var rootCmd = cobra.Command{
 		for {
 			select {
 			case e := <-event:
-				log.Debugf("%+v", e)
+				encoded, err := json.Marshal(e)
+				if err != nil {
+					log.Error(err)
+					continue
+				}
+				log.Debugf("%s", encoded)
 			case <-ctx.Done():
 				return nil
 			case osSignal := <-osNotifyChan:
@@ -157,13 +256,206 @@ var rootCmd = cobra.Command{
 				}
 
 				shutdownCtxCancel()
-				cancel()
+				// the deferred functions stop the checks and the subscribers and close the storage afterwards
 				return nil
 			}
 		}
 	},
 }
 
+// newStorage creates the repository of the configured backend. Only the bolt backend returns a state repository.
+func newStorage(ctx context.Context, conf *config.ControllerConfig, clusters []kubernetes_client.Cluster) (differentiating.Repository, differentiating.StateRepository, func() error, error) {
+	switch conf.Storage.Backend {
+	case "bolt":
+		storage, err := bolt.NewBoltStorage(conf.Storage.Path)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return storage, storage, storage.Close, nil
+	case "kubernetes":
+		cluster, err := storageCluster(conf.Storage.Cluster, clusters)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		storage, err := crd.NewCRDStorage(ctx, cluster.Dynamic, crd.Options{
+			Namespace:     conf.Storage.Namespace,
+			FlushInterval: conf.Storage.ParsedFlushInterval,
+		})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return storage, nil, storage.Close, nil
+	default:
+		return memory.NewMemoryStorage(), nil, func() error { return nil }, nil
+	}
+}
+
+// newHistory returns the storage if it keeps the history, otherwise the history is kept in memory
+func newHistory(storage differentiating.Repository) differentiating.HistoryRepository {
+	if history, ok := storage.(differentiating.HistoryRepository); ok {
+		return history
+	}
+	return memory.NewMemoryStorage()
+}
+
+// storageCluster returns the cluster with the name or the first cluster if no name is set
+func storageCluster(name string, clusters []kubernetes_client.Cluster) (kubernetes_client.Cluster, error) {
+	for _, cluster := range clusters {
+		if name == "" || cluster.Name == name {
+			return cluster, nil
+		}
+	}
+	return kubernetes_client.Cluster{}, fmt.Errorf("differ error: storage cluster %s is not configured", name)
+}
+
+func newSnoozes(conf *config.ControllerConfig) (*differentiating.Snoozes, error) {
+	snoozes := make([]differentiating.Snooze, 0, len(conf.Snoozes))
+	for i, snooze := range conf.Snoozes {
+		snoozes = append(snoozes, differentiating.Snooze{
+			ID:        fmt.Sprintf("config-%d", i),
+			Image:     snooze.Image,
+			Tag:       snooze.Tag,
+			Until:     snooze.ParsedUntil,
+			Namespace: snooze.Namespace,
+			Workload:  snooze.Workload,
+			Container: snooze.Container,
+			Reason:    snooze.Reason,
+		})
+	}
+	return differentiating.NewSnoozes(snoozes)
+}
+
+func newWebhookSources(conf *config.ControllerConfig) []receiving.Source {
+	sources := make([]receiving.Source, 0, len(conf.Webhooks.Sources))
+	for _, source := range conf.Webhooks.Sources {
+		sources = append(sources, receiving.Source{
+			Name:     source.Name,
+			Type:     receiving.SourceType(source.Type),
+			Registry: source.Registry,
+			Secret:   source.Secret,
+		})
+	}
+	return sources
+}
+
+func newNotifiers(conf *config.ControllerConfig, deadLetters *notifying.DeadLetterLog) ([]notifying.Notifier, error) {
+	notifiers := make([]notifying.Notifier, 0, len(conf.Notifiers.Webhooks)+len(conf.Notifiers.Slack))
+	for _, webhook := range conf.Notifiers.Webhooks {
+		notifier, err := notifying.NewWebhook(notifying.WebhookOptions{
+			Name:            webhook.Name,
+			URL:             webhook.URL,
+			Method:          webhook.Method,
+			Headers:         webhook.Headers,
+			Template:        webhook.Template,
+			Secret:          webhook.Secret,
+			SignatureHeader: webhook.SignatureHeader,
+			Timeout:         webhook.ParsedTimeout,
+			Retries:         webhook.Retries,
+			Backoff:         webhook.ParsedBackoff,
+			DeadLetters:     deadLetters,
+		})
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	for _, slack := range conf.Notifiers.Slack {
+		notifier, err := notifying.NewSlack(notifying.SlackOptions{
+			Name:              slack.Name,
+			Token:             slack.Token,
+			WebhookURL:        slack.WebhookURL,
+			APIURL:            slack.APIURL,
+			Channel:           slack.Channel,
+			NamespaceChannels: slack.NamespaceChannels,
+			MessagesPerSecond: slack.MessagesPerSecond,
+			Timeout:           slack.ParsedTimeout,
+			Retries:           slack.Retries,
+			Backoff:           slack.ParsedBackoff,
+			DeadLetters:       deadLetters,
+		})
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	return notifiers, nil
+}
+
+func newDigests(conf *config.ControllerConfig, service differentiating.Service) ([]*notifying.Digest, error) {
+	digests := make([]*notifying.Digest, 0, len(conf.Notifiers.Digests))
+	for _, digest := range conf.Notifiers.Digests {
+		schedule, err := notifying.ParseSchedule(digest.Schedule, digest.ParsedLocation)
+		if err != nil {
+			return nil, err
+		}
+		notifier, err := notifying.NewDigest(notifying.DigestOptions{
+			Name:     digest.Name,
+			Service:  service,
+			Schedule: schedule,
+			SMTP: notifying.SMTPOptions{
+				Address:  digest.SMTP.Address,
+				Username: digest.SMTP.Username,
+				Password: digest.SMTP.Password,
+				StartTLS: notifying.StartTLSPolicy(digest.SMTP.StartTLS),
+				Timeout:  digest.SMTP.ParsedTimeout,
+			},
+			From:                digest.From,
+			Subject:             digest.Subject,
+			Recipients:          digest.Recipients,
+			NamespaceRecipients: digest.NamespaceRecipients,
+			IncludeSnoozed:      digest.IncludeSnoozed,
+			SendEmpty:           digest.SendEmpty,
+		})
+		if err != nil {
+			return nil, err
+		}
+		digests = append(digests, notifier)
+	}
+	return digests, nil
+}
+
+// newSafetyNetIntervals replaces the poll interval of registries which send push webhooks
+func newSafetyNetIntervals(sources []receiving.Source, safetyNetInterval time.Duration) map[string]time.Duration {
+	intervals := make(map[string]time.Duration)
+	for _, source := range sources {
+		intervals[source.RegistryURL()] = safetyNetInterval
+	}
+	return intervals
+}
+
+func newRateLimits(conf *config.ControllerConfig) differentiating.RateLimits {
+	rateLimits := differentiating.RateLimits{
+		Default:    newRateLimit(conf.RateLimits.Default),
+		Registries: make(map[string]differentiating.RateLimit),
+	}
+	for _, registryLimit := range conf.RateLimits.Registries {
+		rateLimits.Registries[registryLimit.Registry] = newRateLimit(registryLimit.RateLimit)
+	}
+	return rateLimits
+}
+
+func newRateLimit(limit config.RateLimit) differentiating.RateLimit {
+	return differentiating.RateLimit{
+		RequestsPerSecond: limit.RequestsPerSecond,
+		Quota:             limit.Quota,
+		QuotaWindow:       limit.ParsedQuotaWindow,
+	}
+}
+
+func newTagPolicies(conf *config.ControllerConfig) differentiating.TagPolicies {
+	policies := differentiating.TagPolicies{
+		Default: analyzing.Policy{PreRelease: conf.ParsedPreReleasePolicy, Variant: conf.ParsedVariantPolicy, OrderedClasses: conf.ParsedTagClasses},
+		Rules:   make([]differentiating.TagPolicyRule, 0, len(conf.Images)),
+	}
+	for _, img := range conf.Images {
+		policies.Rules = append(policies.Rules, differentiating.TagPolicyRule{
+			Pattern: img.Pattern,
+			Policy:  analyzing.Policy{PreRelease: img.ParsedPreReleasePolicy, Variant: img.ParsedVariantPolicy, Constraint: img.ParsedConstraint, OrderedClasses: img.ParsedTagClasses, DateLayouts: img.DateLayouts},
+		})
+	}
+	return policies
+}
+
 func initOSNotifyChan() <-chan os.Signal {
 	notifyChan := make(chan os.Signal, 3)
 	signal.Notify(notifyChan, syscall.SIGTERM, syscall.SIGINT)
@@ -0,0 +1,145 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/fwiedmann/differ/pkg/analyzing"
+	"github.com/fwiedmann/differ/pkg/scanning"
+)
+
+func init() {
+	scanCmd.Flags().StringSliceP("filename", "f", []string{}, "Manifest files or directories to scan. Use \"-\" to read from stdin, which is the default if no filename is given")
+	scanCmd.Flags().StringP("output", "o", scanning.FormatTable, "Report format, one of table, json or sarif")
+	scanCmd.Flags().String("fail-on", "low", "Exit with a non zero code if an outdated image has at least this severity, one of none, low, medium or high")
+	scanCmd.Flags().String("pre-release-policy", string(analyzing.PreReleaseToStable), "Offer stable and pre-release SemVer tags as upgrade for each other, one of same-channel, to-stable or any")
+	scanCmd.Flags().String("variant-policy", string(analyzing.VariantFloat), "How the variant version of tags like 1.19.3-alpine3.12 may change, one of fixed, float or track")
+	scanCmd.Flags().StringSlice("ordered-tag-classes", []string{}, "Compare tags of classes which are not orderable by default, any of git-sha, branch or mutable")
+	scanCmd.Flags().Duration("timeout", time.Minute*5, "Timeout for the whole scan")
+	scanCmd.Flags().Duration("registry-timeout", time.Second*10, "Timeout for each registry request")
+	rootCmd.AddCommand(&scanCmd)
+}
+
+var scanCmd = cobra.Command{
+	Use:   "scan",
+	Short: "Scan kubernetes manifests offline for outdated images",
+	Long: `Scan reads kubernetes manifests from files, directories or stdin, e.g. the output of "kustomize build" or "helm template",
+and checks the images of all Deployments, DaemonSets and StatefulSets against their registries.`,
+	Example: `  differ scan -f ./k8s
+  helm template ./chart | differ scan -o sarif --fail-on medium`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sources, err := cmd.Flags().GetStringSlice("filename")
+		if err != nil {
+			return err
+		}
+		if len(sources) == 0 {
+			sources = []string{"-"}
+		}
+
+		format, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+
+		failOn, err := cmd.Flags().GetString("fail-on")
+		if err != nil {
+			return err
+		}
+		threshold, err := scanning.ParseSeverity(failOn)
+		if err != nil {
+			return err
+		}
+
+		unparsedPreReleasePolicy, err := cmd.Flags().GetString("pre-release-policy")
+		if err != nil {
+			return err
+		}
+		preReleasePolicy, err := analyzing.ParsePreReleasePolicy(unparsedPreReleasePolicy)
+		if err != nil {
+			return err
+		}
+
+		unparsedVariantPolicy, err := cmd.Flags().GetString("variant-policy")
+		if err != nil {
+			return err
+		}
+		variantPolicy, err := analyzing.ParseVariantPolicy(unparsedVariantPolicy)
+		if err != nil {
+			return err
+		}
+
+		unparsedTagClasses, err := cmd.Flags().GetStringSlice("ordered-tag-classes")
+		if err != nil {
+			return err
+		}
+		var tagClasses []analyzing.TagClass
+		for _, name := range unparsedTagClasses {
+			class, err := analyzing.ParseTagClass(name)
+			if err != nil {
+				return err
+			}
+			tagClasses = append(tagClasses, class)
+		}
+
+		timeout, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			return err
+		}
+
+		registryTimeout, err := cmd.Flags().GetDuration("registry-timeout")
+		if err != nil {
+			return err
+		}
+
+		manifests, err := scanning.ReadManifests(sources, os.Stdin)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		report, err := scanning.NewScanner(scanning.NewRegistryTagLister(registryTimeout), analyzing.Policy{PreRelease: preReleasePolicy, Variant: variantPolicy, OrderedClasses: tagClasses}).Scan(ctx, manifests)
+		if err != nil {
+			return err
+		}
+
+		if err := scanning.WriteReport(cmd.OutOrStdout(), report, format, rootCmd.Version); err != nil {
+			return err
+		}
+
+		if report.ExceedsThreshold(threshold) {
+			return fmt.Errorf("differ scan: found outdated images with severity %s or higher", threshold)
+		}
+		return nil
+	},
+}
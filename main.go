@@ -25,6 +25,8 @@
 package main
 
 import (
+	"os"
+
 	"github.com/fwiedmann/differ/cmd"
 )
 
@@ -32,6 +34,6 @@ var version string
 
 func main() {
 	if err := cmd.Execute(version); err != nil {
-		panic(err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,218 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package analyzing
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+)
+
+const semVerExpression = "semver"
+
+// Result of the analysis of a running tag against all available tags
+type Result struct {
+	Tag string
+	// Latest is the newest tag which satisfies the constraint of the policy or the running tag if there is no newer one
+	Latest string
+	// LatestUnconstrained is the newest tag regardless of the constraint of the policy
+	LatestUnconstrained string
+	// Expression describes how the tags were compared. It is the exact regex expression of the tag or the name of the used comparator.
+	// It is empty if the class of the tag is not compared.
+	Expression string
+	Class      TagClass
+	// LatestVariant is the newest tag with the application version of Latest and a newer variant version, e.g. 1.19.4-alpine3.13
+	// for the latest tag 1.19.4-alpine3.12. It is only set for the VariantTrack policy.
+	LatestVariant string
+	// Age is the time between the release dates of the running and the latest tag. It is zero if the tags contain no dates.
+	Age time.Duration
+	// Bump classifies the change from the running to the latest tag
+	Bump BumpType
+	// Candidates are all tags newer than the running tag which satisfy the constraint, sorted ascending
+	Candidates []string
+}
+
+// IsOutdated reports if a newer tag than the running one is available within the constraint
+func (r Result) IsOutdated() bool {
+	return r.Latest != "" && r.Latest != r.Tag
+}
+
+// IsBlockedByConstraint reports if a newer tag than the latest one is only prevented by the constraint of the policy
+func (r Result) IsBlockedByConstraint() bool {
+	return r.LatestUnconstrained != "" && r.LatestUnconstrained != r.Latest
+}
+
+// HasVariantUpdate reports if a newer variant version is available for the latest tag
+func (r Result) HasVariantUpdate() bool {
+	return r.LatestVariant != ""
+}
+
+// Analyze determines the latest tag for the running tag. Tags which parse as SemVer are compared by SemVer precedence,
+// tags which contain a date by their release date, tags with a variant like 1.19.3-alpine3.12 by their application version
+// and variant version and all other tags by the digits of all tags of the same TagClass matching the exact regex expression
+// of the running tag.
+// Tags of classes which are not orderable are only compared if the policy orders them, otherwise the running tag is the latest.
+func Analyze(tag string, tags []string, p Policy) (Result, error) {
+	class := ClassifyTag(tag)
+	if !p.orders(class) {
+		return Result{Tag: tag, Latest: tag, LatestUnconstrained: tag, Class: class}, nil
+	}
+
+	if current, err := ParseSemVer(tag); class == TagClassSemVer && err == nil && current.hasKnownPreRelease() {
+		return newResult(tag, class, newerSemVerTags(current, tags, p), semVerExpression, p), nil
+	}
+
+	if current, err := ParseDateTag(tag, p.DateLayouts); err == nil {
+		newer, dates := newerDateTags(current, tags, p)
+		r := newResult(tag, class, newer, calVerExpression, p)
+		if r.IsOutdated() {
+			r.Age = dates[r.Latest].Time.Sub(current.Time)
+		}
+		return r, nil
+	}
+
+	if current, err := ParseVariantTag(tag); err == nil {
+		r := newResult(tag, class, newerVariantTags(current, tags, p.Variant), variantExpression, p)
+		if p.Variant == VariantTrack {
+			r.LatestVariant = latestVariantTag(r.Latest, tags)
+		}
+		return r, nil
+	}
+
+	tagExpr, err := GetExactRegexExprForTag(tag)
+	if err != nil {
+		return Result{}, fmt.Errorf("analyzing error: could not get a tag expression for tag %s: %w", tag, err)
+	}
+
+	newer, err := newerRegexExprTags(tag, tagsOfClass(class, tags), tagExpr)
+	if err != nil {
+		return Result{}, err
+	}
+	return newResult(tag, class, newer, tagExpr.String(), p), nil
+}
+
+// newResult selects the latest tags from the newer tags, which have to be sorted ascending
+func newResult(tag string, class TagClass, newer []string, expression string, p Policy) Result {
+	r := Result{Tag: tag, Latest: tag, LatestUnconstrained: tag, Expression: expression, Class: class}
+	if len(newer) == 0 {
+		return r
+	}
+
+	r.LatestUnconstrained = newer[len(newer)-1]
+	for _, t := range newer {
+		if p.Constraint.Check(t) {
+			r.Candidates = append(r.Candidates, t)
+		}
+	}
+	if len(r.Candidates) == 0 {
+		return r
+	}
+
+	r.Latest = r.Candidates[len(r.Candidates)-1]
+	if expression == calVerExpression {
+		r.Bump = BumpDate
+	} else {
+		r.Bump = ClassifyBump(tag, r.Latest)
+	}
+	return r
+}
+
+type semVerTag struct {
+	version SemVer
+	tag     string
+}
+
+func newerSemVerTags(current SemVer, tags []string, p Policy) []string {
+	var candidates []semVerTag
+	for _, candidate := range tags {
+		version, err := ParseSemVer(candidate)
+		if err != nil || !version.hasKnownPreRelease() || version.Prefix != current.Prefix || !p.PreRelease.allows(current, version) {
+			continue
+		}
+		if version.Compare(current) > 0 {
+			candidates = append(candidates, semVerTag{version: version, tag: candidate})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].version.Compare(candidates[j].version) < 0
+	})
+
+	newer := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		newer = append(newer, c.tag)
+	}
+	return newer
+}
+
+func newerDateTags(current DateTag, tags []string, p Policy) ([]string, map[string]DateTag) {
+	dates := make(map[string]DateTag)
+	newer := make([]string, 0)
+	for _, candidate := range tags {
+		date, err := ParseDateTag(candidate, p.DateLayouts)
+		if err != nil || !current.isComparable(date) || date.Compare(current) <= 0 {
+			continue
+		}
+		dates[candidate] = date
+		newer = append(newer, candidate)
+	}
+
+	sort.SliceStable(newer, func(i, j int) bool {
+		return dates[newer[i]].Compare(dates[newer[j]]) < 0
+	})
+	return newer, dates
+}
+
+// tagsOfClass filters the tags by their class, so that e.g. the date tag 20201012 is not offered as upgrade for the numeric tag 123
+func tagsOfClass(class TagClass, tags []string) []string {
+	filtered := make([]string, 0, len(tags))
+	for _, t := range tags {
+		if ClassifyTag(t) == class {
+			filtered = append(filtered, t)
+		}
+	}
+	return filtered
+}
+
+func newerRegexExprTags(tag string, tags []string, tagExpr *regexp.Regexp) ([]string, error) {
+	sorted := sortTagsWithRegexExpr(tags, tagExpr)
+	if sorted == nil {
+		return nil, fmt.Errorf("analyzing: could not find any valid tags with pattern %s from tags %s", tagExpr.String(), tags)
+	}
+
+	currentDigits, err := getDigitsFromString(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	var newer []string
+	for _, t := range sorted {
+		if (sorter{tagInfo{digits: currentDigits}, t}).Less(0, 1) {
+			newer = append(newer, t.complete)
+		}
+	}
+	return newer, nil
+}
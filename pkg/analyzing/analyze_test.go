@@ -0,0 +1,235 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package analyzing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnalyze(t *testing.T) {
+	type args struct {
+		tag    string
+		tags   []string
+		policy Policy
+	}
+	tests := []struct {
+		name              string
+		args              args
+		want              string
+		wantExpression    string
+		wantBlocked       string
+		wantAge           time.Duration
+		wantLatestVariant string
+		wantErr           bool
+	}{
+		{
+			name:           "StableToStable",
+			args:           args{tag: "1.2.3", tags: []string{"1.2.3", "1.2.4", "1.3.0-rc1", "v2.0.0"}},
+			want:           "1.2.4",
+			wantExpression: semVerExpression,
+		},
+		{
+			name:           "ReleaseCandidateToStable",
+			args:           args{tag: "1.2.3-rc1", tags: []string{"1.2.3-rc1", "1.2.3-rc4", "1.2.3"}},
+			want:           "1.2.3",
+			wantExpression: semVerExpression,
+		},
+		{
+			name:           "ReleaseCandidateSameChannel",
+			args:           args{tag: "1.2.3-rc1", tags: []string{"1.2.3-rc1", "1.2.3-rc4", "1.2.3"}, policy: Policy{PreRelease: PreReleaseSameChannel}},
+			want:           "1.2.3-rc4",
+			wantExpression: semVerExpression,
+		},
+		{
+			name:           "StableToReleaseCandidate",
+			args:           args{tag: "1.2.3", tags: []string{"1.2.3", "1.2.4", "1.3.0-beta.1"}, policy: Policy{PreRelease: PreReleaseAny}},
+			want:           "1.3.0-beta.1",
+			wantExpression: semVerExpression,
+		},
+		{
+			name:           "AlphaToBeta",
+			args:           args{tag: "v1.0.0-alpha", tags: []string{"v1.0.0-alpha", "v1.0.0-beta", "1.0.0-rc1"}},
+			want:           "v1.0.0-beta",
+			wantExpression: semVerExpression,
+		},
+		{
+			name:           "BuildMetadataIgnored",
+			args:           args{tag: "1.0.0+build.1", tags: []string{"1.0.0+build.2", "1.0.0+build.1"}},
+			want:           "1.0.0+build.1",
+			wantExpression: semVerExpression,
+		},
+		{
+			name:           "VariantFloat",
+			args:           args{tag: "1.19.3-alpine3.12", tags: []string{"1.19.3-alpine3.12", "1.19.4-alpine3.12", "1.19.3-alpine3.13", "1.19.5"}},
+			want:           "1.19.4-alpine3.12",
+			wantExpression: variantExpression,
+		},
+		{
+			name:           "VariantFloatBaseBump",
+			args:           args{tag: "1.19.3-alpine3.12", tags: []string{"1.19.3-alpine3.12", "1.19.4-alpine3.12", "1.19.4-alpine3.13", "1.19.3-alpine3.14"}},
+			want:           "1.19.4-alpine3.13",
+			wantExpression: variantExpression,
+		},
+		{
+			name:           "VariantFixed",
+			args:           args{tag: "1.19.3-alpine3.12", tags: []string{"1.19.3-alpine3.12", "1.19.4-alpine3.12", "1.19.4-alpine3.13"}, policy: Policy{Variant: VariantFixed}},
+			want:           "1.19.4-alpine3.12",
+			wantExpression: variantExpression,
+		},
+		{
+			name:              "VariantTrack",
+			args:              args{tag: "1.19.3-alpine3.12", tags: []string{"1.19.3-alpine3.12", "1.19.4-alpine3.12", "1.19.4-alpine3.13", "1.19.4-alpine3.14", "1.19.3-alpine3.15"}, policy: Policy{Variant: VariantTrack}},
+			want:              "1.19.4-alpine3.12",
+			wantExpression:    variantExpression,
+			wantLatestVariant: "1.19.4-alpine3.14",
+		},
+		{
+			name:              "VariantTrackOnlyVariantUpdate",
+			args:              args{tag: "1.19.3-alpine3.12", tags: []string{"1.19.3-alpine3.12", "1.19.3-alpine3.13"}, policy: Policy{Variant: VariantTrack}},
+			want:              "1.19.3-alpine3.12",
+			wantExpression:    variantExpression,
+			wantLatestVariant: "1.19.3-alpine3.13",
+		},
+		{
+			name:           "VariantWithMultipleVersions",
+			args:           args{tag: "8.5-jdk14-openjdk-oracle", tags: []string{"8.5-jdk14-openjdk-oracle", "8.6-jdk14-openjdk-oracle", "8.5-jdk15-openjdk-oracle"}},
+			want:           "8.6-jdk14-openjdk-oracle",
+			wantExpression: variantExpression,
+		},
+		{
+			name:           "ConstraintBlocksMajor",
+			args:           args{tag: "1.2.3", tags: []string{"1.2.3", "1.2.4", "1.3.0", "2.0.0"}, policy: Policy{Constraint: mustParseConstraint(t, "~1.2")}},
+			want:           "1.2.4",
+			wantExpression: semVerExpression,
+			wantBlocked:    "2.0.0",
+		},
+		{
+			name:           "ConstraintWithRegex",
+			args:           args{tag: "12.1", tags: []string{"12.1", "12.4", "13.0"}, policy: Policy{Constraint: mustParseConstraint(t, "~12")}},
+			want:           "12.4",
+			wantExpression: `^\d+.\d+$`,
+			wantBlocked:    "13.0",
+		},
+		{
+			name:           "ConstraintWithoutNewerTag",
+			args:           args{tag: "1.2.3", tags: []string{"1.2.3", "2.0.0"}, policy: Policy{Constraint: mustParseConstraint(t, "^1")}},
+			want:           "1.2.3",
+			wantExpression: semVerExpression,
+			wantBlocked:    "2.0.0",
+		},
+		{
+			name: "GitSHANotCompared",
+			args: args{tag: "a1b2c3d", tags: []string{"a1b2c3d", "f9e8d7c", "1.4.2"}},
+			want: "a1b2c3d",
+		},
+		{
+			name: "BranchNotCompared",
+			args: args{tag: "main-20201012", tags: []string{"main-20201012", "main-20201013", "pr-123"}},
+			want: "main-20201012",
+		},
+		{
+			name:           "BranchOrderedByPolicy",
+			args:           args{tag: "main-20201012", tags: []string{"main-20201012", "main-20201013", "pr-123"}, policy: Policy{OrderedClasses: []TagClass{TagClassBranch}}},
+			want:           "main-20201013",
+			wantExpression: calVerExpression,
+			wantAge:        24 * time.Hour,
+		},
+		{
+			name: "MutableNotCompared",
+			args: args{tag: "latest", tags: []string{"latest", "1.4.2"}},
+			want: "latest",
+		},
+		{
+			name:           "OtherClassesIgnored",
+			args:           args{tag: "123", tags: []string{"123", "124", "20201012"}},
+			want:           "124",
+			wantExpression: `^\d+$`,
+		},
+		{
+			name:           "DateStamped",
+			args:           args{tag: "focal-20201008", tags: []string{"focal-20201008", "focal-20201105", "bionic-20201119", "focal"}},
+			want:           "focal-20201105",
+			wantExpression: calVerExpression,
+			wantAge:        28 * 24 * time.Hour,
+		},
+		{
+			name:           "TimestampLayoutChanged",
+			args:           args{tag: "RELEASE.2020-10-09T22-55-05Z", tags: []string{"RELEASE.2020-10-09T22-55-05Z", "RELEASE.2020-10-12T21-53-21Z", "RELEASE.20201011"}},
+			want:           "RELEASE.2020-10-12T21-53-21Z",
+			wantExpression: calVerExpression,
+			wantAge:        time.Date(2020, time.October, 12, 21, 53, 21, 0, time.UTC).Sub(time.Date(2020, time.October, 9, 22, 55, 5, 0, time.UTC)),
+		},
+		{
+			name:           "CalVerMicro",
+			args:           args{tag: "2020.10.1", tags: []string{"2020.10.1", "2020.10.12", "2020.9.30"}},
+			want:           "2020.10.12",
+			wantExpression: calVerExpression,
+		},
+		{
+			name:           "ConfiguredDateLayout",
+			args:           args{tag: "build-09.10.2020", tags: []string{"build-09.10.2020", "build-01.11.2020", "build-30.09.2020"}, policy: Policy{DateLayouts: []string{"02.01.2006"}}},
+			want:           "build-01.11.2020",
+			wantExpression: calVerExpression,
+			wantAge:        23 * 24 * time.Hour,
+		},
+		{
+			name:    "NoValidTags",
+			args:    args{tag: "1.8", tags: []string{"latest"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Analyze(tt.args.tag, tt.args.tags, tt.args.policy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Analyze() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.Latest != tt.want {
+				t.Errorf("Analyze() latest = %v, want %v", got.Latest, tt.want)
+			}
+			if got.IsBlockedByConstraint() != (tt.wantBlocked != "") || (tt.wantBlocked != "" && got.LatestUnconstrained != tt.wantBlocked) {
+				t.Errorf("Analyze() latest unconstrained = %v, want %v", got.LatestUnconstrained, tt.wantBlocked)
+			}
+			if got.LatestVariant != tt.wantLatestVariant {
+				t.Errorf("Analyze() latest variant = %v, want %v", got.LatestVariant, tt.wantLatestVariant)
+			}
+			if got.Age != tt.wantAge {
+				t.Errorf("Analyze() age = %v, want %v", got.Age, tt.wantAge)
+			}
+			if got.Expression != tt.wantExpression {
+				t.Errorf("Analyze() expression = %v, want %v", got.Expression, tt.wantExpression)
+			}
+		})
+	}
+}
+
+func mustParseConstraint(t *testing.T, expression string) *Constraint {
+	c, err := ParseConstraint(expression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
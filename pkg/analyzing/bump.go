@@ -0,0 +1,105 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package analyzing
+
+// BumpType describes which part of the version changes between two tags
+type BumpType string
+
+const (
+	BumpNone       BumpType = ""
+	BumpMajor      BumpType = "major"
+	BumpMinor      BumpType = "minor"
+	BumpPatch      BumpType = "patch"
+	BumpPreRelease BumpType = "prerelease"
+	// BumpVariant is a change of the variant version only, e.g. from 1.19.3-alpine3.12 to 1.19.3-alpine3.13
+	BumpVariant BumpType = "variant"
+	// BumpDate is a newer date-stamped or CalVer tag, which has no notion of major or minor releases
+	BumpDate BumpType = "date"
+	// BumpUnknown is a change which could not be classified, e.g. between tags without digits
+	BumpUnknown BumpType = "unknown"
+)
+
+// ClassifyBump determines the bump from one tag to another. SemVer tags are compared by their major, minor, patch and
+// pre-release parts, tags with a variant by their application version first and all other tags by the position of the
+// first differing digit group.
+func ClassifyBump(from, to string) BumpType {
+	if from == to || to == "" {
+		return BumpNone
+	}
+
+	fromSemVer, fromErr := ParseSemVer(from)
+	toSemVer, toErr := ParseSemVer(to)
+	if fromErr == nil && toErr == nil && fromSemVer.hasKnownPreRelease() && toSemVer.hasKnownPreRelease() {
+		switch {
+		case fromSemVer.Major != toSemVer.Major:
+			return BumpMajor
+		case fromSemVer.Minor != toSemVer.Minor:
+			return BumpMinor
+		case fromSemVer.Patch != toSemVer.Patch:
+			return BumpPatch
+		case comparePreRelease(fromSemVer.PreRelease, toSemVer.PreRelease) != 0:
+			return BumpPreRelease
+		default:
+			return BumpNone
+		}
+	}
+
+	fromVariant, fromErr := ParseVariantTag(from)
+	toVariant, toErr := ParseVariantTag(to)
+	if fromErr == nil && toErr == nil {
+		if bump := bumpOfDigits(fromVariant.Version, toVariant.Version); bump != BumpNone {
+			return bump
+		}
+		return BumpVariant
+	}
+
+	fromDigits, fromErr := getDigitsFromString(from)
+	toDigits, toErr := getDigitsFromString(to)
+	if fromErr != nil || toErr != nil || len(fromDigits) == 0 || len(toDigits) == 0 {
+		return BumpUnknown
+	}
+	if bump := bumpOfDigits(fromDigits, toDigits); bump != BumpNone {
+		return bump
+	}
+	return BumpUnknown
+}
+
+// bumpOfDigits maps the first differing digit group to the major, minor and patch position
+func bumpOfDigits(from, to []int) BumpType {
+	for i := 0; i < len(from) || i < len(to); i++ {
+		if i < len(from) && i < len(to) && from[i] == to[i] {
+			continue
+		}
+		switch i {
+		case 0:
+			return BumpMajor
+		case 1:
+			return BumpMinor
+		default:
+			return BumpPatch
+		}
+	}
+	return BumpNone
+}
@@ -0,0 +1,84 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package analyzing
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClassifyBump(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want BumpType
+	}{
+		{name: "Same", from: "1.2.3", to: "1.2.3", want: BumpNone},
+		{name: "SemVerMajor", from: "v1.9.0", to: "v2.0.0", want: BumpMajor},
+		{name: "SemVerMinor", from: "1.2.3", to: "1.3.0", want: BumpMinor},
+		{name: "SemVerPatch", from: "1.2.3", to: "1.2.4", want: BumpPatch},
+		{name: "SemVerPreRelease", from: "2.0.0-rc1", to: "2.0.0", want: BumpPreRelease},
+		{name: "VariantApplicationVersion", from: "1.19.3-alpine3.12", to: "1.20.0-alpine3.12", want: BumpMinor},
+		{name: "VariantVersion", from: "1.19.3-alpine3.12", to: "1.19.3-alpine3.13", want: BumpVariant},
+		{name: "Digits", from: "12", to: "13", want: BumpMajor},
+		{name: "LongerDigits", from: "1.2", to: "1.2.1", want: BumpPatch},
+		{name: "NoDigits", from: "latest", to: "stable", want: BumpUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyBump(tt.from, tt.to); got != tt.want {
+				t.Errorf("ClassifyBump() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyze_BumpAndCandidates(t *testing.T) {
+	constraint, err := ParseConstraint("^1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := []string{"1.0.0", "1.1.0", "1.1.1", "2.0.0", "20201012", "20201224"}
+
+	got, err := Analyze("1.0.0", tags, Policy{Constraint: constraint})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Bump != BumpMinor {
+		t.Errorf("Analyze() bump = %v, want %v", got.Bump, BumpMinor)
+	}
+	if want := []string{"1.1.0", "1.1.1"}; !reflect.DeepEqual(got.Candidates, want) {
+		t.Errorf("Analyze() candidates = %v, want %v", got.Candidates, want)
+	}
+
+	got, err = Analyze("20201012", tags, Policy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Bump != BumpDate {
+		t.Errorf("Analyze() bump = %v, want %v", got.Bump, BumpDate)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package analyzing
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const calVerExpression = "calver"
+
+// dateLayout is a recognised date or timestamp layout. The regex captures the text before the date, the date and the text after it.
+type dateLayout struct {
+	regex  *regexp.Regexp
+	layout string
+}
+
+var (
+	// dateLayouts are ordered from the most to the least specific layout
+	dateLayouts = []dateLayout{
+		{regex: regexp.MustCompile(`^(|.*\D)((?:19|20)\d{2}-\d{2}-\d{2}T\d{2}-\d{2}-\d{2}Z)(|\D.*)$`), layout: "2006-01-02T15-04-05Z"},
+		{regex: regexp.MustCompile(`^(|.*\D)((?:19|20)\d{12})(|\D.*)$`), layout: "20060102150405"},
+		{regex: regexp.MustCompile(`^(|.*\D)((?:19|20)\d{10})(|\D.*)$`), layout: "200601021504"},
+		{regex: regexp.MustCompile(`^(|.*\D)((?:19|20)\d{6})(|\D.*)$`), layout: "20060102"},
+		{regex: regexp.MustCompile(`^(|.*\D)((?:19|20)\d{2}-\d{2}-\d{2})(|\D.*)$`), layout: "2006-01-02"},
+	}
+
+	// calVerDottedRegex matches the CalVer scheme YYYY.MM with an optional micro version, e.g. 2020.10.1
+	calVerDottedRegex = regexp.MustCompile(`^(|.*[^\d.])((?:19|20)\d{2}\.\d{1,2})(?:\.(\d+))?(|[^\d.].*)$`)
+)
+
+// DateTag is a tag which contains a release date. CalVer tags like 2020.10.1 have a micro version, which orders
+// releases of the same month.
+type DateTag struct {
+	Prefix string
+	Time   time.Time
+	Micro  uint64
+	Suffix string
+	Layout string
+}
+
+// ParseDateTag parses the date of the given tag with the given Go time layouts or with the recognised layouts.
+// A given layout has to match the whole tag after an optional prefix which ends with "-", "_" or ".".
+func ParseDateTag(tag string, layouts []string) (DateTag, error) {
+	for _, layout := range layouts {
+		for i := 0; i < len(tag); i++ {
+			if i > 0 && !strings.ContainsRune("-_.", rune(tag[i-1])) {
+				continue
+			}
+			if t, err := time.Parse(layout, tag[i:]); err == nil {
+				return DateTag{Prefix: tag[:i], Time: t, Layout: layout}, nil
+			}
+		}
+	}
+
+	for _, l := range dateLayouts {
+		matches := l.regex.FindStringSubmatch(tag)
+		if matches == nil {
+			continue
+		}
+		if t, err := time.Parse(l.layout, matches[2]); err == nil {
+			return DateTag{Prefix: matches[1], Time: t, Suffix: matches[3], Layout: l.layout}, nil
+		}
+	}
+
+	if matches := calVerDottedRegex.FindStringSubmatch(tag); matches != nil {
+		t, err := time.Parse("2006.1", matches[2])
+		if err == nil {
+			var micro uint64
+			if matches[3] != "" {
+				if micro, err = strconv.ParseUint(matches[3], 10, 64); err != nil {
+					return DateTag{}, fmt.Errorf("analyzing/calver error: tag %s: %w", tag, err)
+				}
+			}
+			return DateTag{Prefix: matches[1], Time: t, Micro: micro, Suffix: matches[4], Layout: "2006.1"}, nil
+		}
+	}
+	return DateTag{}, fmt.Errorf("analyzing/calver error: tag %s does not contain a known date layout", tag)
+}
+
+// ValidateDateLayout checks if the Go time layout contains at least a year and can parse its own output
+func ValidateDateLayout(layout string) error {
+	if !strings.Contains(layout, "2006") && !strings.Contains(layout, "06") {
+		return fmt.Errorf("analyzing/calver error: date layout %s does not contain a year", layout)
+	}
+	reference := time.Date(2020, time.October, 9, 22, 55, 5, 0, time.UTC)
+	if _, err := time.Parse(layout, reference.Format(layout)); err != nil {
+		return fmt.Errorf("analyzing/calver error: invalid date layout %s: %w", layout, err)
+	}
+	return nil
+}
+
+// isComparable reports if both tags belong to the same series, e.g. focal-20201008 and focal-20201105 but not bionic-20201008
+func (d DateTag) isComparable(o DateTag) bool {
+	return d.Prefix == o.Prefix && d.Suffix == o.Suffix
+}
+
+// Compare returns -1, 0 or 1 if the tag is older, as old as or newer than the other tag
+func (d DateTag) Compare(o DateTag) int {
+	switch {
+	case d.Time.Before(o.Time):
+		return -1
+	case d.Time.After(o.Time):
+		return 1
+	default:
+		return compareUint(d.Micro, o.Micro)
+	}
+}
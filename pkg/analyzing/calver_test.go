@@ -0,0 +1,106 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package analyzing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDateTag(t *testing.T) {
+	tests := []struct {
+		name    string
+		tag     string
+		layouts []string
+		want    DateTag
+		wantErr bool
+	}{
+		{
+			name: "Ubuntu",
+			tag:  "focal-20201008",
+			want: DateTag{Prefix: "focal-", Time: time.Date(2020, time.October, 8, 0, 0, 0, 0, time.UTC), Layout: "20060102"},
+		},
+		{
+			name: "MinIO",
+			tag:  "RELEASE.2020-10-09T22-55-05Z",
+			want: DateTag{Prefix: "RELEASE.", Time: time.Date(2020, time.October, 9, 22, 55, 5, 0, time.UTC), Layout: "2006-01-02T15-04-05Z"},
+		},
+		{
+			name: "CalVerWithMicro",
+			tag:  "2020.10.1",
+			want: DateTag{Time: time.Date(2020, time.October, 1, 0, 0, 0, 0, time.UTC), Micro: 1, Layout: "2006.1"},
+		},
+		{
+			name: "CalVerWithSuffix",
+			tag:  "2020.9-alpine",
+			want: DateTag{Time: time.Date(2020, time.September, 1, 0, 0, 0, 0, time.UTC), Suffix: "-alpine", Layout: "2006.1"},
+		},
+		{
+			name:    "ConfiguredLayout",
+			tag:     "build-09.10.2020",
+			layouts: []string{"02.01.2006"},
+			want:    DateTag{Prefix: "build-", Time: time.Date(2020, time.October, 9, 0, 0, 0, 0, time.UTC), Layout: "02.01.2006"},
+		},
+		{
+			name:    "InvalidDate",
+			tag:     "20201399",
+			wantErr: true,
+		},
+		{
+			name:    "NoDate",
+			tag:     "1.4.2",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDateTag(tt.tag, tt.layouts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDateTag() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseDateTag() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDateLayout(t *testing.T) {
+	tests := []struct {
+		layout  string
+		wantErr bool
+	}{
+		{layout: "20060102", wantErr: false},
+		{layout: "RELEASE.2006-01-02T15-04-05Z", wantErr: false},
+		{layout: "01.02", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.layout, func(t *testing.T) {
+			if err := ValidateDateLayout(tt.layout); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateDateLayout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package analyzing
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TagClass describes the naming scheme of a tag and decides how it is compared with other tags
+type TagClass string
+
+const (
+	// TagClassSemVer tags are semantic versions, e.g. 1.4.2 or v1.4.2-rc1
+	TagClassSemVer TagClass = "semver"
+	// TagClassCalVer tags contain a release date, e.g. 2020.10.1, focal-20201008 or RELEASE.2020-10-09T22-55-05Z
+	TagClassCalVer TagClass = "calver"
+	// TagClassNumeric tags start with a version number which is no semantic version, e.g. 12.4, 3 or 8.5-jdk14
+	TagClassNumeric TagClass = "numeric"
+	// TagClassGitSHA tags are abbreviated or full commit hashes, e.g. a1b2c3d or sha-a1b2c3d
+	TagClassGitSHA TagClass = "git-sha"
+	// TagClassBranch tags are named after a branch or pull request, e.g. main, main-20201012 or pr-123
+	TagClassBranch TagClass = "branch"
+	// TagClassMutable tags are moved to every new release, e.g. latest or stable
+	TagClassMutable TagClass = "mutable"
+	// TagClassUnknown tags match none of the other classes. They are compared by the exact regex expression of the tag.
+	TagClassUnknown TagClass = "unknown"
+)
+
+var (
+	gitSHARegex    = regexp.MustCompile(`^(?i)(?:(?:sha|git|commit|g)[\-_]?)?([0-9a-f]{7,40})$`)
+	hexLetterRegex = regexp.MustCompile(`[a-fA-F]`)
+	branchRegex    = regexp.MustCompile(`^(?i)(main|master|develop|development|dev|trunk|feature|feat|fix|bugfix|hotfix|pr|mr|branch)(?:[\-_/.].*)?$`)
+	calVerRegex    = regexp.MustCompile(`(?:^|[a-zA-Z][\-_.]?)(?:19|20)\d{2}(?:(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])(?:\d{4}|\d{6})?|[\-_.](?:0?[1-9]|1[0-2]))(?:\D|$)`)
+	numericRegex   = regexp.MustCompile(`^v?\d+(?:\.\d+)*(?:[\-_+.].*)?$`)
+
+	mutableTags = map[string]bool{
+		"latest":   true,
+		"stable":   true,
+		"edge":     true,
+		"nightly":  true,
+		"lts":      true,
+		"current":  true,
+		"mainline": true,
+		"rolling":  true,
+		"testing":  true,
+		"unstable": true,
+	}
+)
+
+// ParseTagClass parses the name of a tag class
+func ParseTagClass(name string) (TagClass, error) {
+	switch class := TagClass(name); class {
+	case TagClassSemVer, TagClassCalVer, TagClassNumeric, TagClassGitSHA, TagClassBranch, TagClassMutable, TagClassUnknown:
+		return class, nil
+	default:
+		return "", fmt.Errorf("analyzing/classify error: unknown tag class \"%s\"", name)
+	}
+}
+
+// ClassifyTag determines the class of the given tag
+func ClassifyTag(tag string) TagClass {
+	switch {
+	case mutableTags[strings.ToLower(tag)]:
+		return TagClassMutable
+	case isGitSHA(tag):
+		return TagClassGitSHA
+	case branchRegex.MatchString(tag):
+		return TagClassBranch
+	case calVerRegex.MatchString(tag):
+		return TagClassCalVer
+	case semVerRegex.MatchString(tag):
+		return TagClassSemVer
+	case numericRegex.MatchString(tag):
+		return TagClassNumeric
+	default:
+		return TagClassUnknown
+	}
+}
+
+// IsOrderable reports if tags of the class describe an order of releases. Commit hashes, branch names and mutable
+// tags can only be compared if it is explicitly configured in the Policy.
+func (c TagClass) IsOrderable() bool {
+	switch c {
+	case TagClassGitSHA, TagClassBranch, TagClassMutable:
+		return false
+	default:
+		return true
+	}
+}
+
+// isGitSHA reports if the tag is a commit hash. Hashes which consist only of digits are not distinguishable from
+// numeric tags and are therefore not classified as commit hashes.
+func isGitSHA(tag string) bool {
+	matches := gitSHARegex.FindStringSubmatch(tag)
+	return matches != nil && hexLetterRegex.MatchString(matches[1])
+}
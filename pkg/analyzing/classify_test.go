@@ -0,0 +1,60 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package analyzing
+
+import "testing"
+
+func TestClassifyTag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want TagClass
+	}{
+		{tag: "1.4.2", want: TagClassSemVer},
+		{tag: "v1.4.2-rc1", want: TagClassSemVer},
+		{tag: "1.19.3-alpine3.12", want: TagClassSemVer},
+		{tag: "2020.10.1", want: TagClassCalVer},
+		{tag: "focal-20201008", want: TagClassCalVer},
+		{tag: "20201008", want: TagClassCalVer},
+		{tag: "RELEASE.2020-10-09T22-55-05Z", want: TagClassCalVer},
+		{tag: "12.4", want: TagClassNumeric},
+		{tag: "3", want: TagClassNumeric},
+		{tag: "8.5-jdk14-openjdk-oracle", want: TagClassNumeric},
+		{tag: "a1b2c3d", want: TagClassGitSHA},
+		{tag: "sha-a1b2c3d4e5f60718293a4b5c6d7e8f9012345678", want: TagClassGitSHA},
+		{tag: "main", want: TagClassBranch},
+		{tag: "main-20201012", want: TagClassBranch},
+		{tag: "pr-123", want: TagClassBranch},
+		{tag: "latest", want: TagClassMutable},
+		{tag: "Stable", want: TagClassMutable},
+		{tag: "alpine3.12", want: TagClassUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			if got := ClassifyTag(tt.tag); got != tt.want {
+				t.Errorf("ClassifyTag() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package analyzing
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	constraintOr     = "||"
+	constraintHyphen = " - "
+)
+
+var (
+	// versionRegex parses partial versions like "1", "1.2", "v1.2.3" and wildcards like "1.x" or "1.2.*"
+	versionRegex = regexp.MustCompile(`^v?(\d+|[xX*])(?:\.(\d+|[xX*]))?(?:\.(\d+|[xX*]))?(?:-([0-9A-Za-z\-\.]+))?(?:\+[0-9A-Za-z\-\.]+)?$`)
+
+	// tagVersionRegex extracts the version of a tag which is not a strict SemVer, e.g. "12.4" or "8.5-jdk14-openjdk-oracle"
+	tagVersionRegex = regexp.MustCompile(`^v?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:[\-\+_\.](.*))?$`)
+
+	comparatorRegex = regexp.MustCompile(`^(\^|~|>=|<=|>|<|=)?\s*(.+)$`)
+
+	operatorWhitespaceRegex = regexp.MustCompile(`(\^|~|>=|<=|>|<|=)\s+`)
+)
+
+// Constraint is a version range expression in the npm/cargo style, e.g. "^1.2", "~12", ">=2.3 <3" or "1.x || 2.x"
+type Constraint struct {
+	expression string
+	groups     []comparatorGroup
+}
+
+type comparator struct {
+	operator string
+	version  SemVer
+}
+
+// partialVersion is a parsed version of a constraint with the count of given components, e.g. 2 for "1.2" or "1.2.x"
+type partialVersion struct {
+	version    SemVer
+	components int
+}
+
+// ParseConstraint parses a constraint expression. Alternatives are separated by "||", the comparators of an alternative by whitespace or comma.
+func ParseConstraint(expression string) (*Constraint, error) {
+	c := &Constraint{expression: expression}
+	for _, alternative := range strings.Split(expression, constraintOr) {
+		group, err := parseComparatorGroup(strings.TrimSpace(alternative))
+		if err != nil {
+			return nil, fmt.Errorf("analyzing/constraint error: invalid constraint \"%s\": %w", expression, err)
+		}
+		c.groups = append(c.groups, group)
+	}
+	return c, nil
+}
+
+// String implements the stringer interface
+func (c *Constraint) String() string {
+	if c == nil {
+		return ""
+	}
+	return c.expression
+}
+
+// Check reports if the version of the tag satisfies the constraint. A nil constraint is satisfied by every tag.
+func (c *Constraint) Check(tag string) bool {
+	if c == nil {
+		return true
+	}
+
+	version, err := parseTagVersion(tag)
+	if err != nil {
+		return false
+	}
+
+	for _, group := range c.groups {
+		if group.check(version) {
+			return true
+		}
+	}
+	return false
+}
+
+type comparatorGroup []comparator
+
+func (g comparatorGroup) check(v SemVer) bool {
+	for _, c := range g {
+		if !c.check(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c comparator) check(v SemVer) bool {
+	compared := v.Compare(c.version)
+	switch c.operator {
+	case ">":
+		return compared > 0
+	case ">=":
+		return compared >= 0
+	case "<":
+		return compared < 0
+	case "<=":
+		return compared <= 0
+	default:
+		return compared == 0
+	}
+}
+
+func parseComparatorGroup(expression string) (comparatorGroup, error) {
+	if expression == "" || expression == "*" || strings.EqualFold(expression, "x") {
+		return comparatorGroup{}, nil
+	}
+
+	if strings.Contains(expression, constraintHyphen) {
+		return parseHyphenRange(expression)
+	}
+
+	var group comparatorGroup
+	for _, field := range strings.FieldsFunc(normalizeOperators(expression), func(r rune) bool { return r == ' ' || r == ',' }) {
+		comparators, err := parseComparator(field)
+		if err != nil {
+			return nil, err
+		}
+		group = append(group, comparators...)
+	}
+	return group, nil
+}
+
+// normalizeOperators removes the whitespace between an operator and its version, e.g. ">= 2.3" to ">=2.3"
+func normalizeOperators(expression string) string {
+	return operatorWhitespaceRegex.ReplaceAllString(expression, "$1")
+}
+
+func parseHyphenRange(expression string) (comparatorGroup, error) {
+	bounds := strings.SplitN(expression, constraintHyphen, 2)
+	lower, err := parsePartialVersion(strings.TrimSpace(bounds[0]))
+	if err != nil {
+		return nil, err
+	}
+	upper, err := parsePartialVersion(strings.TrimSpace(bounds[1]))
+	if err != nil {
+		return nil, err
+	}
+
+	group := comparatorGroup{{operator: ">=", version: lower.version}}
+	if upper.components == 0 {
+		return group, nil
+	}
+	if upper.components < 3 {
+		return append(group, comparator{operator: "<", version: upper.nextBreaking(upper.components)}), nil
+	}
+	return append(group, comparator{operator: "<=", version: upper.version}), nil
+}
+
+func parseComparator(expression string) (comparatorGroup, error) {
+	matches := comparatorRegex.FindStringSubmatch(expression)
+	if matches == nil {
+		return nil, fmt.Errorf("invalid comparator \"%s\"", expression)
+	}
+
+	operator := matches[1]
+	v, err := parsePartialVersion(matches[2])
+	if err != nil {
+		return nil, err
+	}
+
+	if v.components == 0 {
+		if operator == "<" || operator == ">" {
+			return nil, fmt.Errorf("comparator \"%s\" can never be satisfied", expression)
+		}
+		return comparatorGroup{}, nil
+	}
+
+	switch operator {
+	case "^":
+		return comparatorGroup{{operator: ">=", version: v.version}, {operator: "<", version: v.nextCaret()}}, nil
+	case "~":
+		components := v.components
+		if components > 2 {
+			components = 2
+		}
+		return comparatorGroup{{operator: ">=", version: v.version}, {operator: "<", version: v.nextBreaking(components)}}, nil
+	case ">":
+		if v.components < 3 {
+			return comparatorGroup{{operator: ">=", version: v.nextBreaking(v.components)}}, nil
+		}
+		return comparatorGroup{{operator: ">", version: v.version}}, nil
+	case "<=":
+		if v.components < 3 {
+			return comparatorGroup{{operator: "<", version: v.nextBreaking(v.components)}}, nil
+		}
+		return comparatorGroup{{operator: "<=", version: v.version}}, nil
+	case "<":
+		if v.components < 3 {
+			return comparatorGroup{{operator: "<", version: lowestPreRelease(v.version.Major, v.version.Minor, v.version.Patch)}}, nil
+		}
+		return comparatorGroup{{operator: "<", version: v.version}}, nil
+	case ">=":
+		return comparatorGroup{{operator: ">=", version: v.version}}, nil
+	default:
+		if v.components < 3 {
+			return comparatorGroup{{operator: ">=", version: v.version}, {operator: "<", version: v.nextBreaking(v.components)}}, nil
+		}
+		return comparatorGroup{{operator: "=", version: v.version}}, nil
+	}
+}
+
+func parsePartialVersion(expression string) (partialVersion, error) {
+	matches := versionRegex.FindStringSubmatch(expression)
+	if matches == nil {
+		return partialVersion{}, fmt.Errorf("invalid version \"%s\"", expression)
+	}
+
+	var numbers [3]uint64
+	var components int
+	for i, match := range matches[1:4] {
+		if match == "" || strings.ContainsAny(match, "xX*") {
+			break
+		}
+		number, err := strconv.ParseUint(match, 10, 64)
+		if err != nil {
+			return partialVersion{}, err
+		}
+		numbers[i] = number
+		components++
+	}
+
+	v := SemVer{Major: numbers[0], Minor: numbers[1], Patch: numbers[2]}
+	if components == 3 && matches[4] != "" {
+		v.PreRelease = strings.Split(matches[4], ".")
+	}
+	return partialVersion{version: v, components: components}, nil
+}
+
+// nextBreaking returns the lowest version which is not covered by the first given components anymore, e.g. "<1.3.0-0" for "1.2" and 2 components
+func (p partialVersion) nextBreaking(components int) SemVer {
+	switch components {
+	case 1:
+		return lowestPreRelease(p.version.Major+1, 0, 0)
+	case 2:
+		return lowestPreRelease(p.version.Major, p.version.Minor+1, 0)
+	default:
+		return lowestPreRelease(p.version.Major, p.version.Minor, p.version.Patch+1)
+	}
+}
+
+// nextCaret returns the upper bound of a caret range, which allows changes that do not modify the left-most non-zero component
+func (p partialVersion) nextCaret() SemVer {
+	switch {
+	case p.version.Major > 0 || p.components == 1:
+		return p.nextBreaking(1)
+	case p.version.Minor > 0 || p.components == 2:
+		return p.nextBreaking(2)
+	default:
+		return p.nextBreaking(3)
+	}
+}
+
+func lowestPreRelease(major, minor, patch uint64) SemVer {
+	return SemVer{Major: major, Minor: minor, Patch: patch, PreRelease: []string{"0"}}
+}
+
+// parseTagVersion parses the version of a tag. Suffixes which are no well known pre-release, e.g. variants like "-alpine", are ignored.
+func parseTagVersion(tag string) (SemVer, error) {
+	if v, err := ParseSemVer(tag); err == nil && v.hasKnownPreRelease() {
+		return v, nil
+	}
+
+	matches := tagVersionRegex.FindStringSubmatch(tag)
+	if matches == nil {
+		return SemVer{}, fmt.Errorf("analyzing/constraint error: tag %s does not contain a version", tag)
+	}
+
+	var numbers [3]uint64
+	for i, match := range matches[1:4] {
+		if match == "" {
+			break
+		}
+		number, err := strconv.ParseUint(match, 10, 64)
+		if err != nil {
+			return SemVer{}, err
+		}
+		numbers[i] = number
+	}
+	return SemVer{Major: numbers[0], Minor: numbers[1], Patch: numbers[2]}, nil
+}
@@ -0,0 +1,72 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package analyzing
+
+import "testing"
+
+func TestConstraint_Check(t *testing.T) {
+	tests := []struct {
+		name        string
+		constraint  string
+		satisfied   []string
+		unsatisfied []string
+		wantErr     bool
+	}{
+		{name: "Caret", constraint: "^1.2", satisfied: []string{"1.2.0", "1.9.9", "v1.2.3"}, unsatisfied: []string{"1.1.9", "2.0.0", "2.0.0-rc1"}},
+		{name: "CaretZeroMajor", constraint: "^0.2.3", satisfied: []string{"0.2.3", "0.2.9"}, unsatisfied: []string{"0.3.0", "0.2.2"}},
+		{name: "CaretZeroMinor", constraint: "^0.0.3", satisfied: []string{"0.0.3"}, unsatisfied: []string{"0.0.4"}},
+		{name: "TildeMajor", constraint: "~12", satisfied: []string{"12", "12.4", "12.4-alpine"}, unsatisfied: []string{"13.0", "11.9"}},
+		{name: "TildeMinor", constraint: "~1.2.3", satisfied: []string{"1.2.3", "1.2.10"}, unsatisfied: []string{"1.3.0", "1.2.2"}},
+		{name: "Range", constraint: ">=2.3 <3", satisfied: []string{"2.3.0", "2.9.1"}, unsatisfied: []string{"2.2.9", "3.0.0", "3.0.0-rc1"}},
+		{name: "RangeWithWhitespace", constraint: ">= 2.3, < 3", satisfied: []string{"2.3.0"}, unsatisfied: []string{"3.1"}},
+		{name: "GreaterThanPartial", constraint: ">1.2", satisfied: []string{"1.3.0"}, unsatisfied: []string{"1.2.9"}},
+		{name: "LessOrEqualPartial", constraint: "<=1.2", satisfied: []string{"1.2.9"}, unsatisfied: []string{"1.3.0"}},
+		{name: "Wildcard", constraint: "1.x", satisfied: []string{"1.0.0", "1.99"}, unsatisfied: []string{"2.0"}},
+		{name: "Or", constraint: "1.2.x || >=3.1", satisfied: []string{"1.2.7", "3.1.0", "4"}, unsatisfied: []string{"1.3.0", "3.0.9"}},
+		{name: "Hyphen", constraint: "1.2 - 2.3", satisfied: []string{"1.2.0", "2.3.9"}, unsatisfied: []string{"2.4.0", "1.1.0"}},
+		{name: "Exact", constraint: "=1.2.3", satisfied: []string{"1.2.3", "v1.2.3"}, unsatisfied: []string{"1.2.4"}},
+		{name: "Any", constraint: "*", satisfied: []string{"1.2.3"}, unsatisfied: []string{"latest"}},
+		{name: "Invalid", constraint: ">=foo", wantErr: true},
+		{name: "NeverSatisfied", constraint: "<x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseConstraint(tt.constraint)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseConstraint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, tag := range tt.satisfied {
+				if !c.Check(tag) {
+					t.Errorf("Check(%s) = false, want true for constraint %s", tag, tt.constraint)
+				}
+			}
+			for _, tag := range tt.unsatisfied {
+				if c.Check(tag) {
+					t.Errorf("Check(%s) = true, want false for constraint %s", tag, tt.constraint)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package analyzing
+
+import (
+	"sort"
+	"strings"
+)
+
+// CompareTags orders two arbitrary tags and returns -1, 0 or 1 if a is older, equal or newer than b. SemVer tags are
+// compared by precedence, date-stamped tags by their date and all other tags by their digit groups. Tags which can not
+// be ordered by their versions are compared lexically.
+func CompareTags(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	semVerA, errA := ParseSemVer(a)
+	semVerB, errB := ParseSemVer(b)
+	if errA == nil && errB == nil && semVerA.hasKnownPreRelease() && semVerB.hasKnownPreRelease() {
+		if c := semVerA.Compare(semVerB); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	}
+
+	dateA, errA := ParseDateTag(a, nil)
+	dateB, errB := ParseDateTag(b, nil)
+	if errA == nil && errB == nil && dateA.isComparable(dateB) {
+		if c := dateA.Compare(dateB); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	}
+
+	digitsA, errA := getDigitsFromString(a)
+	digitsB, errB := getDigitsFromString(b)
+	if errA == nil && errB == nil && len(digitsA) > 0 && len(digitsB) > 0 {
+		if c := compareDigits(digitsA, digitsB); c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// SortTags sorts the tags ascending by CompareTags
+func SortTags(tags []string) {
+	sort.SliceStable(tags, func(i, j int) bool {
+		return CompareTags(tags[i], tags[j]) < 0
+	})
+}
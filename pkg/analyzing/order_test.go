@@ -0,0 +1,51 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package analyzing
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortTags(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+		want []string
+	}{
+		{name: "SemVer", tags: []string{"1.10.0", "1.2.0", "2.0.0-rc1", "2.0.0", "1.9.3"}, want: []string{"1.2.0", "1.9.3", "1.10.0", "2.0.0-rc1", "2.0.0"}},
+		{name: "Date", tags: []string{"20201224", "20200101", "20201012"}, want: []string{"20200101", "20201012", "20201224"}},
+		{name: "Digits", tags: []string{"1.19-alpine", "1.9-alpine", "1.18-alpine"}, want: []string{"1.9-alpine", "1.18-alpine", "1.19-alpine"}},
+		{name: "Lexical", tags: []string{"stable", "latest", "edge"}, want: []string{"edge", "latest", "stable"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SortTags(tt.tags)
+			if !reflect.DeepEqual(tt.tags, tt.want) {
+				t.Errorf("SortTags() = %v, want %v", tt.tags, tt.want)
+			}
+		})
+	}
+}
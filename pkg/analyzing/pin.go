@@ -0,0 +1,82 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package analyzing
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+var (
+	// floatingVersionRegex matches tags with a major or major.minor version and an optional variant, e.g. 3, 3.12 or 1.19-alpine
+	floatingVersionRegex = regexp.MustCompile(`^(v?)(\d+(?:\.\d+)?)([\-_].*)?$`)
+	plainVersionRegex    = regexp.MustCompile(`^v?\d+(?:\.\d+)*$`)
+)
+
+// PinCandidates returns all tags which may be the concrete version behind the floating tag, e.g. 1.19.3 for latest or
+// 3.12.1 for 3. The candidates are sorted from the most specific to the least specific and from the newest to the oldest
+// version. It returns nil if the tag is not a floating tag.
+func PinCandidates(tag string, tags []string) []string {
+	var matches func(candidate string) bool
+	switch {
+	case ClassifyTag(tag) == TagClassMutable:
+		matches = plainVersionRegex.MatchString
+	case floatingVersionRegex.MatchString(tag):
+		parts := floatingVersionRegex.FindStringSubmatch(tag)
+		candidateRegex := regexp.MustCompile(fmt.Sprintf(`^%s%s(?:\.\d+)+%s$`, regexp.QuoteMeta(parts[1]), regexp.QuoteMeta(parts[2]), regexp.QuoteMeta(parts[3])))
+		matches = candidateRegex.MatchString
+	default:
+		return nil
+	}
+
+	var candidates []tagInfo
+	for _, candidate := range tags {
+		if candidate == tag || !matches(candidate) {
+			continue
+		}
+		digits, err := getDigitsFromString(candidate)
+		if err != nil {
+			continue
+		}
+		candidates = append(candidates, tagInfo{digits: digits, complete: candidate})
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if len(candidates[i].digits) != len(candidates[j].digits) {
+			return len(candidates[i].digits) > len(candidates[j].digits)
+		}
+		return compareDigits(candidates[i].digits, candidates[j].digits) > 0
+	})
+
+	pinCandidates := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		pinCandidates = append(pinCandidates, c.complete)
+	}
+	return pinCandidates
+}
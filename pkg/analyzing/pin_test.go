@@ -0,0 +1,53 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package analyzing
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPinCandidates(t *testing.T) {
+	tags := []string{"latest", "3", "3.11", "3.12", "3.11.6", "3.12.0", "3.12.1", "3.12.1-alpine", "3-alpine", "4.0.0-rc1", "a1b2c3d"}
+	tests := []struct {
+		name string
+		tag  string
+		want []string
+	}{
+		{name: "Mutable", tag: "latest", want: []string{"3.12.1", "3.12.0", "3.11.6", "3.12", "3.11", "3"}},
+		{name: "Major", tag: "3", want: []string{"3.12.1", "3.12.0", "3.11.6", "3.12", "3.11"}},
+		{name: "Minor", tag: "3.12", want: []string{"3.12.1", "3.12.0"}},
+		{name: "Variant", tag: "3-alpine", want: []string{"3.12.1-alpine"}},
+		{name: "NotFloating", tag: "a1b2c3d", want: nil},
+		{name: "NoCandidates", tag: "3.11.6", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PinCandidates(tt.tag, tags); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PinCandidates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
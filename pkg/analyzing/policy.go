@@ -0,0 +1,91 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package analyzing
+
+import "fmt"
+
+// PreReleasePolicy decides if stable and pre-release SemVer tags are offered as upgrade for each other
+type PreReleasePolicy string
+
+const (
+	// PreReleaseSameChannel offers only stable tags for stable tags and only pre-release tags for pre-release tags
+	PreReleaseSameChannel PreReleasePolicy = "same-channel"
+	// PreReleaseToStable additionally offers stable tags for pre-release tags. This is the default policy.
+	PreReleaseToStable PreReleasePolicy = "to-stable"
+	// PreReleaseAny offers stable and pre-release tags for every tag
+	PreReleaseAny PreReleasePolicy = "any"
+)
+
+// ParsePreReleasePolicy parses the policy name. An empty name returns the default PreReleaseToStable policy.
+func ParsePreReleasePolicy(name string) (PreReleasePolicy, error) {
+	switch PreReleasePolicy(name) {
+	case "":
+		return PreReleaseToStable, nil
+	case PreReleaseSameChannel, PreReleaseToStable, PreReleaseAny:
+		return PreReleasePolicy(name), nil
+	default:
+		return "", fmt.Errorf("analyzing/policy error: unknown pre-release policy \"%s\", valid policies are %s, %s and %s", name, PreReleaseSameChannel, PreReleaseToStable, PreReleaseAny)
+	}
+}
+
+// allows reports if a candidate tag may be offered as upgrade for the current tag
+func (p PreReleasePolicy) allows(current, candidate SemVer) bool {
+	switch {
+	case current.IsPreRelease() == candidate.IsPreRelease():
+		return true
+	case p == PreReleaseAny:
+		return true
+	case p == PreReleaseToStable || p == "":
+		return current.IsPreRelease() && !candidate.IsPreRelease()
+	default:
+		return false
+	}
+}
+
+// Policy configures how the latest tag for a running tag is determined
+type Policy struct {
+	PreRelease PreReleasePolicy
+	Variant    VariantPolicy
+	// Constraint limits the tags which are offered as upgrade. Nil allows all tags.
+	Constraint *Constraint
+	// OrderedClasses are tag classes which are not orderable by default, but should be compared by the exact regex
+	// expression of the tag anyway, e.g. TagClassBranch for tags like main-20201012.
+	OrderedClasses []TagClass
+	// DateLayouts are Go time layouts for date-stamped tags, which are tried before the recognised layouts
+	DateLayouts []string
+}
+
+// orders reports if tags of the given class are compared with each other
+func (p Policy) orders(class TagClass) bool {
+	if class.IsOrderable() {
+		return true
+	}
+	for _, ordered := range p.OrderedClasses {
+		if ordered == class {
+			return true
+		}
+	}
+	return false
+}
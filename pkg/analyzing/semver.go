@@ -0,0 +1,176 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package analyzing
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	semVerRegex = regexp.MustCompile(`^(v?)(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+
+	// preReleaseIdentifierRegex matches the first identifier of well known pre-release naming schemes. Suffixes like "alpine3.12" are
+	// valid SemVer pre-releases as well, but in tags they describe a variant of the image and not an unstable release.
+	preReleaseIdentifierRegex = regexp.MustCompile(`(?i)^(\d+|(alpha|beta|rc|pre|preview|dev|snapshot|canary|nightly|next|a|b|m)[\-]?\d*)$`)
+
+	numberedIdentifierRegex = regexp.MustCompile(`^([a-zA-Z\-]+)(\d+)$`)
+)
+
+// SemVer is a semantic version 2.0.0 with an optional leading "v"
+type SemVer struct {
+	Prefix     string
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	PreRelease []string
+	Build      string
+}
+
+// ParseSemVer parses the given tag as semantic version
+func ParseSemVer(tag string) (SemVer, error) {
+	matches := semVerRegex.FindStringSubmatch(tag)
+	if matches == nil {
+		return SemVer{}, fmt.Errorf("analyzing/semver error: tag %s is not a semantic version", tag)
+	}
+
+	var numbers [3]uint64
+	for i, match := range matches[2:5] {
+		number, err := strconv.ParseUint(match, 10, 64)
+		if err != nil {
+			return SemVer{}, fmt.Errorf("analyzing/semver error: tag %s: %w", tag, err)
+		}
+		numbers[i] = number
+	}
+
+	var preRelease []string
+	if matches[5] != "" {
+		preRelease = strings.Split(matches[5], ".")
+	}
+
+	return SemVer{
+		Prefix:     matches[1],
+		Major:      numbers[0],
+		Minor:      numbers[1],
+		Patch:      numbers[2],
+		PreRelease: preRelease,
+		Build:      matches[6],
+	}, nil
+}
+
+// IsPreRelease reports if the version has pre-release identifiers
+func (v SemVer) IsPreRelease() bool {
+	return len(v.PreRelease) > 0
+}
+
+// hasKnownPreRelease reports if the version is stable or if the pre-release identifiers follow a well known scheme like "rc1" or "beta.2"
+func (v SemVer) hasKnownPreRelease() bool {
+	return !v.IsPreRelease() || preReleaseIdentifierRegex.MatchString(v.PreRelease[0])
+}
+
+// Compare returns -1, 0 or 1 if v has a lower, equal or higher precedence than o. The prefix and build metadata are ignored.
+func (v SemVer) Compare(o SemVer) int {
+	if c := compareUint(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+	return comparePreRelease(v.PreRelease, o.PreRelease)
+}
+
+// String implements the stringer interface
+func (v SemVer) String() string {
+	s := fmt.Sprintf("%s%d.%d.%d", v.Prefix, v.Major, v.Minor, v.Patch)
+	if v.IsPreRelease() {
+		s += "-" + strings.Join(v.PreRelease, ".")
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// comparePreRelease follows SemVer 2.0.0 §11: a version without pre-release has a higher precedence, identifiers are compared
+// from left to right, numeric identifiers numerically and lower than alphanumeric ones, which are compared lexically.
+func comparePreRelease(a, b []string) int {
+	switch {
+	case len(a) == 0 && len(b) == 0:
+		return 0
+	case len(a) == 0:
+		return 1
+	case len(b) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := comparePreReleaseIdentifier(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return compareUint(uint64(len(a)), uint64(len(b)))
+}
+
+// comparePreReleaseIdentifier deviates from the lexical comparison for identifiers with the same alphabetic prefix and a numeric
+// suffix, because tags in the wild use "rc9" and "rc10" instead of "rc.9" and "rc.10".
+func comparePreReleaseIdentifier(a, b string) int {
+	aNumber, aErr := strconv.ParseUint(a, 10, 64)
+	bNumber, bErr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aErr == nil && bErr == nil:
+		return compareUint(aNumber, bNumber)
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+
+	aMatches := numberedIdentifierRegex.FindStringSubmatch(a)
+	bMatches := numberedIdentifierRegex.FindStringSubmatch(b)
+	if aMatches != nil && bMatches != nil && aMatches[1] == bMatches[1] {
+		aNumber, aErr = strconv.ParseUint(aMatches[2], 10, 64)
+		bNumber, bErr = strconv.ParseUint(bMatches[2], 10, 64)
+		if aErr == nil && bErr == nil {
+			return compareUint(aNumber, bNumber)
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
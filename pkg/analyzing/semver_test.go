@@ -0,0 +1,90 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package analyzing
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSemVer(t *testing.T) {
+	tests := []struct {
+		name    string
+		tag     string
+		want    SemVer
+		wantErr bool
+	}{
+		{name: "Stable", tag: "1.2.3", want: SemVer{Major: 1, Minor: 2, Patch: 3}},
+		{name: "LeadingV", tag: "v10.20.30", want: SemVer{Prefix: "v", Major: 10, Minor: 20, Patch: 30}},
+		{name: "PreRelease", tag: "1.2.3-rc.1", want: SemVer{Major: 1, Minor: 2, Patch: 3, PreRelease: []string{"rc", "1"}}},
+		{name: "PreReleaseAndBuild", tag: "1.0.0-alpha+001", want: SemVer{Major: 1, PreRelease: []string{"alpha"}, Build: "001"}},
+		{name: "Build", tag: "1.0.0+20130313144700", want: SemVer{Major: 1, Build: "20130313144700"}},
+		{name: "MissingPatch", tag: "1.2", wantErr: true},
+		{name: "LeadingZero", tag: "01.2.3", wantErr: true},
+		{name: "NoVersion", tag: "latest", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSemVer(tt.tag)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSemVer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSemVer() got = %+v, want %+v", got, tt.want)
+			}
+			if !tt.wantErr && got.String() != tt.tag {
+				t.Errorf("String() got = %s, want %s", got.String(), tt.tag)
+			}
+		})
+	}
+}
+
+func TestSemVer_Compare(t *testing.T) {
+	// ordered by SemVer 2.0.0 §11 precedence
+	ordered := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc1", "1.0.0-rc9", "1.0.0-rc10", "1.0.0", "1.0.1", "1.1.0", "v2.0.0"}
+	for i := range ordered {
+		for j := range ordered {
+			a, err := ParseSemVer(ordered[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ParseSemVer(ordered[j])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := compareUint(uint64(i), uint64(j))
+			if got := a.Compare(b); got != want {
+				t.Errorf("Compare(%s, %s) = %d, want %d", ordered[i], ordered[j], got, want)
+			}
+		}
+	}
+
+	a, _ := ParseSemVer("1.0.0+build.1")
+	b, _ := ParseSemVer("1.0.0+build.2")
+	if a.Compare(b) != 0 {
+		t.Errorf("Compare() build metadata must be ignored")
+	}
+}
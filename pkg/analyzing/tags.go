@@ -54,6 +54,15 @@ func GetRegexExprForTag(tag string) (*regexp.Regexp, error) {
 
 // GetLatestTagWithRegexExpr filters valid tags for the given expression and sort those. The latest valid tag will be returned
 func GetLatestTagWithRegexExpr(tags []string, regx *regexp.Regexp) (string, error) {
+	tagsToSort := sortTagsWithRegexExpr(tags, regx)
+	if tagsToSort == nil {
+		return "", fmt.Errorf("analyzing: could not find any valid tags with pattern %s from tags %s", regx.String(), tags)
+	}
+	return tagsToSort[len(tagsToSort)-1].complete, nil
+}
+
+// sortTagsWithRegexExpr filters valid tags for the given expression and sorts them ascending by their digits
+func sortTagsWithRegexExpr(tags []string, regx *regexp.Regexp) sorter {
 	var tagsToSort sorter
 	for _, tag := range tags {
 		if regx.MatchString(tag) {
@@ -69,10 +78,7 @@ func GetLatestTagWithRegexExpr(tags []string, regx *regexp.Regexp) (string, erro
 		}
 	}
 	sort.Sort(tagsToSort)
-	if tagsToSort == nil {
-		return "", fmt.Errorf("analyzing: could not find any valid tags with pattern %s from tags %s", regx.String(), tags)
-	}
-	return tagsToSort[len(tagsToSort)-1].complete, nil
+	return tagsToSort
 }
 
 func getDigitsFromString(str string) ([]int, error) {
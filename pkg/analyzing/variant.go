@@ -0,0 +1,188 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package analyzing
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+const variantExpression = "variant"
+
+// VariantPolicy decides how the version of a tag variant like alpine3.12 may change between the running and the latest tag
+type VariantPolicy string
+
+const (
+	// VariantFixed offers only tags with exactly the same variant, e.g. 1.19.4-alpine3.12 for 1.19.3-alpine3.12
+	VariantFixed VariantPolicy = "fixed"
+	// VariantFloat offers tags with any version of the variant. The application version takes precedence over the
+	// variant version. This is the default policy.
+	VariantFloat VariantPolicy = "float"
+	// VariantTrack offers tags with the same variant like VariantFixed and additionally reports the newest variant
+	// version for the latest application version as a separate update.
+	VariantTrack VariantPolicy = "track"
+)
+
+var variantTagRegex = regexp.MustCompile(`^(v?)(\d+(?:\.\d+)*)([\-_+.][^a-zA-Z]*[a-zA-Z].*)$`)
+
+// ParseVariantPolicy parses the policy name. An empty name returns the default VariantFloat policy.
+func ParseVariantPolicy(name string) (VariantPolicy, error) {
+	switch VariantPolicy(name) {
+	case "":
+		return VariantFloat, nil
+	case VariantFixed, VariantFloat, VariantTrack:
+		return VariantPolicy(name), nil
+	default:
+		return "", fmt.Errorf("analyzing/variant error: unknown variant policy \"%s\", valid policies are %s, %s and %s", name, VariantFixed, VariantFloat, VariantTrack)
+	}
+}
+
+// VariantTag splits a tag like 1.19.3-alpine3.12 into the application version 1.19.3 and the variant -alpine3.12
+type VariantTag struct {
+	Prefix  string
+	Version []int
+	Variant string
+	// shape is the variant with all digits replaced, e.g. -alpine\d+.\d+
+	shape          string
+	variantVersion []int
+}
+
+// ParseVariantTag parses a tag which starts with an application version followed by a variant containing letters
+func ParseVariantTag(tag string) (VariantTag, error) {
+	matches := variantTagRegex.FindStringSubmatch(tag)
+	if matches == nil {
+		return VariantTag{}, fmt.Errorf("analyzing/variant error: tag %s has no application version and variant", tag)
+	}
+
+	version, err := getDigitsFromString(matches[2])
+	if err != nil {
+		return VariantTag{}, err
+	}
+	variantVersion, err := getDigitsFromString(matches[3])
+	if err != nil {
+		return VariantTag{}, err
+	}
+
+	return VariantTag{
+		Prefix:         matches[1],
+		Version:        version,
+		Variant:        matches[3],
+		shape:          numberRegex.ReplaceAllString(matches[3], onlyDigits),
+		variantVersion: variantVersion,
+	}, nil
+}
+
+// isComparable reports if the candidate may be offered as upgrade with the given policy
+func (v VariantTag) isComparable(candidate VariantTag, p VariantPolicy) bool {
+	if v.Prefix != candidate.Prefix {
+		return false
+	}
+	if p == VariantFloat || p == "" {
+		return v.shape == candidate.shape
+	}
+	return v.Variant == candidate.Variant
+}
+
+// compareVersion compares only the application versions
+func (v VariantTag) compareVersion(o VariantTag) int {
+	return compareDigits(v.Version, o.Version)
+}
+
+// Compare orders by the application version first and by the variant version second
+func (v VariantTag) Compare(o VariantTag) int {
+	if c := v.compareVersion(o); c != 0 {
+		return c
+	}
+	return compareDigits(v.variantVersion, o.variantVersion)
+}
+
+type variantCandidate struct {
+	version VariantTag
+	tag     string
+}
+
+// newerVariantTags returns all tags which are newer than the current tag and comparable with the policy sorted ascending
+func newerVariantTags(current VariantTag, tags []string, p VariantPolicy) []string {
+	var candidates []variantCandidate
+	for _, candidate := range tags {
+		version, err := ParseVariantTag(candidate)
+		if err != nil || !current.isComparable(version, p) || version.Compare(current) <= 0 {
+			continue
+		}
+		candidates = append(candidates, variantCandidate{version: version, tag: candidate})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].version.Compare(candidates[j].version) < 0
+	})
+
+	newer := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		newer = append(newer, c.tag)
+	}
+	return newer
+}
+
+// latestVariantTag returns the tag with the newest variant version for the application version of the latest tag,
+// or an empty string if there is no newer variant
+func latestVariantTag(latest string, tags []string) string {
+	latestVersion, err := ParseVariantTag(latest)
+	if err != nil {
+		return ""
+	}
+
+	var newest variantCandidate
+	for _, candidate := range tags {
+		version, err := ParseVariantTag(candidate)
+		if err != nil || !latestVersion.isComparable(version, VariantFloat) || version.compareVersion(latestVersion) != 0 {
+			continue
+		}
+		if version.Compare(latestVersion) > 0 && (newest.tag == "" || version.Compare(newest.version) > 0) {
+			newest = variantCandidate{version: version, tag: candidate}
+		}
+	}
+	return newest.tag
+}
+
+// compareDigits compares two digit groups element-wise. A shorter group which is a prefix of the other is older.
+func compareDigits(a, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	default:
+		return 0
+	}
+}
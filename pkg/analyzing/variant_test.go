@@ -0,0 +1,68 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package analyzing
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseVariantTag(t *testing.T) {
+	tests := []struct {
+		tag         string
+		wantVersion []int
+		wantVariant string
+		wantErr     bool
+	}{
+		{tag: "1.19.3-alpine3.12", wantVersion: []int{1, 19, 3}, wantVariant: "-alpine3.12"},
+		{tag: "8.5-jdk14-openjdk-oracle", wantVersion: []int{8, 5}, wantVariant: "-jdk14-openjdk-oracle"},
+		{tag: "v2-slim", wantVersion: []int{2}, wantVariant: "-slim"},
+		{tag: "12.4", wantErr: true},
+		{tag: "alpine3.12", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			got, err := ParseVariantTag(tt.tag)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseVariantTag() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got.Version, tt.wantVersion) || got.Variant != tt.wantVariant {
+				t.Errorf("ParseVariantTag() = %v %v, want %v %v", got.Version, got.Variant, tt.wantVersion, tt.wantVariant)
+			}
+		})
+	}
+}
+
+func TestParseVariantPolicy(t *testing.T) {
+	if got, err := ParseVariantPolicy(""); err != nil || got != VariantFloat {
+		t.Errorf("ParseVariantPolicy() = %v, %v, want %v", got, err, VariantFloat)
+	}
+	if _, err := ParseVariantPolicy("pinned"); err == nil {
+		t.Errorf("ParseVariantPolicy() expected an error for an unknown policy")
+	}
+}
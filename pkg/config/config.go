@@ -25,12 +25,15 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
 	"sync"
 	"time"
 
 	"github.com/go-playground/validator/v10"
 
+	"github.com/fwiedmann/differ/pkg/analyzing"
+
 	nested "github.com/antonfisher/nested-logrus-formatter"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
@@ -49,16 +52,234 @@ type GitRemote struct {
 	CustomURL      string `yaml:"customURL,omitempty"`
 }
 
+// KubeconfigSecret references a secret in the cluster differ is running in, which contains the kubeconfig of a remote cluster
+type KubeconfigSecret struct {
+	Namespace string `yaml:"namespace" validate:"required"`
+	Name      string `yaml:"name" validate:"required"`
+	Key       string `yaml:"key,omitempty"`
+}
+
+// Cluster describes an observed kubernetes cluster. The client is created from the kubeconfig secret, the in-cluster config
+// or the given kubeconfig file and context in this order. The namespace defaults to the global namespace.
+type Cluster struct {
+	Name             string            `yaml:"name" validate:"required"`
+	InCluster        bool              `yaml:"inCluster,omitempty"`
+	Kubeconfig       string            `yaml:"kubeconfig,omitempty"`
+	Context          string            `yaml:"context,omitempty"`
+	KubeconfigSecret *KubeconfigSecret `yaml:"kubeconfigSecret,omitempty"`
+	Namespace        string            `yaml:"namespace,omitempty"`
+}
+
+// ImagePolicy overrides the tag analysis for all images whose name with or without registry matches the glob pattern.
+// The first matching policy is used, empty fields fall back to the global configuration.
+type ImagePolicy struct {
+	Pattern                string                     `yaml:"pattern" validate:"required"`
+	Constraint             string                     `yaml:"constraint,omitempty"`
+	PreReleasePolicy       string                     `yaml:"preReleasePolicy,omitempty"`
+	VariantPolicy          string                     `yaml:"variantPolicy,omitempty"`
+	OrderedTagClasses      []string                   `yaml:"orderedTagClasses,omitempty"`
+	DateLayouts            []string                   `yaml:"dateLayouts,omitempty"`
+	ParsedConstraint       *analyzing.Constraint      `yaml:"-"`
+	ParsedPreReleasePolicy analyzing.PreReleasePolicy `yaml:"-"`
+	ParsedVariantPolicy    analyzing.VariantPolicy    `yaml:"-"`
+	ParsedTagClasses       []analyzing.TagClass       `yaml:"-"`
+}
+
+// Scheduler configures how often and how many image checks run concurrently. The interval between two checks of the
+// same image is the registryRequestSleepDuration.
+type Scheduler struct {
+	Fetchers            int     `yaml:"fetchers,omitempty" validate:"min=0"`
+	RegistryConcurrency int     `yaml:"registryConcurrency,omitempty" validate:"min=0"`
+	Jitter              float64 `yaml:"jitter,omitempty" validate:"min=0,max=1"`
+}
+
+// NotificationDelivery configures the queue of each notification subscriber. A full queue drops the newest or the
+// oldest event or blocks the delivery up to the block timeout, which defaults to 10s. A blocked delivery delays the
+// delivery to all other subscribers, so the block timeout must not be disabled.
+type NotificationDelivery struct {
+	BufferSize         int           `yaml:"bufferSize,omitempty" validate:"min=0"`
+	Policy             string        `yaml:"policy,omitempty" validate:"omitempty,oneof=drop-newest drop-oldest block"`
+	BlockTimeout       string        `yaml:"blockTimeout,omitempty"`
+	ParsedBlockTimeout time.Duration `yaml:"-"`
+}
+
+// Webhooks configure the registries which send push webhooks to trigger immediate checks. The checks of images from
+// these registries only poll with the safety net interval, which defaults to 6h.
+type Webhooks struct {
+	SafetyNetInterval       string          `yaml:"safetyNetInterval,omitempty"`
+	Sources                 []WebhookSource `yaml:"sources,omitempty" validate:"unique=Name,dive"`
+	ParsedSafetyNetInterval time.Duration   `yaml:"-"`
+}
+
+// WebhookSource receives the webhooks of a registry on /webhooks/<name>
+type WebhookSource struct {
+	Name     string `yaml:"name" validate:"required"`
+	Type     string `yaml:"type" validate:"required,oneof=harbor dockerhub quay gitlab nexus"`
+	Registry string `yaml:"registry,omitempty"`
+	Secret   string `yaml:"secret" validate:"required"`
+}
+
+// Notifiers deliver the notification events to external systems. Events which could not be delivered after all retries
+// are appended as JSON lines to the dead letter log, without dead letter log they are only logged.
+type Notifiers struct {
+	DeadLetterLog string            `yaml:"deadLetterLog,omitempty"`
+	Webhooks      []WebhookNotifier `yaml:"webhooks,omitempty" validate:"unique=Name,dive"`
+	Slack         []SlackNotifier   `yaml:"slack,omitempty" validate:"unique=Name,dive"`
+	Digests       []DigestNotifier  `yaml:"digests,omitempty" validate:"unique=Name,dive"`
+}
+
+// NotifierDelivery configures the requests of a notifier. Failed requests are retried with an exponential backoff,
+// which defaults to 3 retries after 1s. Zero retries disable retrying.
+type NotifierDelivery struct {
+	Timeout       string        `yaml:"timeout,omitempty"`
+	Retries       *int          `yaml:"retries,omitempty" validate:"omitempty,min=0"`
+	Backoff       string        `yaml:"backoff,omitempty"`
+	ParsedTimeout time.Duration `yaml:"-"`
+	ParsedBackoff time.Duration `yaml:"-"`
+}
+
+// WebhookNotifier sends each event to the URL. The body is the JSON encoded event or the rendered Go template of the
+// event. With a secret the body is signed with HMAC-SHA256 in the signature header, which defaults to
+// X-Differ-Signature.
+type WebhookNotifier struct {
+	Name             string            `yaml:"name" validate:"required"`
+	URL              string            `yaml:"url" validate:"required,url"`
+	Method           string            `yaml:"method,omitempty" validate:"omitempty,oneof=POST PUT"`
+	Headers          map[string]string `yaml:"headers,omitempty"`
+	Template         string            `yaml:"template,omitempty"`
+	Secret           string            `yaml:"secret,omitempty"`
+	SignatureHeader  string            `yaml:"signatureHeader,omitempty"`
+	NotifierDelivery `yaml:",inline"`
+}
+
+// SlackNotifier posts the events as Block Kit messages. With a bot token the messages are posted to the channel of the
+// namespace or the default channel, events of the same image are threaded and the first message is updated when the
+// image is resolved. Incoming webhooks post each event into the channel of the webhook. The messages are limited per
+// channel, which defaults to one message per second.
+type SlackNotifier struct {
+	Name              string            `yaml:"name" validate:"required"`
+	Token             string            `yaml:"token,omitempty" validate:"required_without=WebhookURL"`
+	WebhookURL        string            `yaml:"webhookURL,omitempty" validate:"omitempty,url"`
+	APIURL            string            `yaml:"apiURL,omitempty" validate:"omitempty,url"`
+	Channel           string            `yaml:"channel,omitempty" validate:"required_with=Token"`
+	NamespaceChannels map[string]string `yaml:"namespaceChannels,omitempty"`
+	MessagesPerSecond int               `yaml:"messagesPerSecond,omitempty" validate:"min=0"`
+	NotifierDelivery  `yaml:",inline"`
+}
+
+// DigestNotifier mails the outdated images grouped by namespace and owner annotation on a cron schedule like
+// "0 8 * * mon" or "@weekly", which is evaluated in the timezone. The images of namespaces without namespace recipients
+// are sent to the recipients.
+type DigestNotifier struct {
+	Name                string              `yaml:"name" validate:"required"`
+	Schedule            string              `yaml:"schedule" validate:"required"`
+	Timezone            string              `yaml:"timezone,omitempty"`
+	SMTP                SMTPServer          `yaml:"smtp"`
+	From                string              `yaml:"from" validate:"required,email"`
+	Subject             string              `yaml:"subject,omitempty"`
+	Recipients          []string            `yaml:"recipients,omitempty" validate:"required_without=NamespaceRecipients,dive,email"`
+	NamespaceRecipients map[string][]string `yaml:"namespaceRecipients,omitempty" validate:"dive,dive,email"`
+	IncludeSnoozed      bool                `yaml:"includeSnoozed,omitempty"`
+	SendEmpty           bool                `yaml:"sendEmpty,omitempty"`
+	ParsedLocation      *time.Location      `yaml:"-"`
+}
+
+// SMTPServer receives the digests. The connection is upgraded with STARTTLS, which defaults to required. The username
+// and password are sent with PLAIN auth.
+type SMTPServer struct {
+	Address       string        `yaml:"address" validate:"required,hostname_port"`
+	Username      string        `yaml:"username,omitempty"`
+	Password      string        `yaml:"password,omitempty"`
+	StartTLS      string        `yaml:"startTLS,omitempty" validate:"omitempty,oneof=required opportunistic disabled"`
+	Timeout       string        `yaml:"timeout,omitempty"`
+	ParsedTimeout time.Duration `yaml:"-"`
+}
+
+// Snooze acknowledges an update of the images matching the glob pattern up to the tag or until the date, which is
+// formatted as YYYY-MM-DD or RFC3339. The namespace, workload and container optionally restrict the snooze.
+type Snooze struct {
+	Image       string     `yaml:"image" validate:"required"`
+	Tag         string     `yaml:"tag,omitempty" validate:"required_without=Until"`
+	Until       string     `yaml:"until,omitempty"`
+	Namespace   string     `yaml:"namespace,omitempty"`
+	Workload    string     `yaml:"workload,omitempty"`
+	Container   string     `yaml:"container,omitempty"`
+	Reason      string     `yaml:"reason,omitempty"`
+	ParsedUntil *time.Time `yaml:"-"`
+}
+
+// Storage selects the backend of the images and the state. The memory backend, which is the default, loses everything
+// on restart. The bolt backend persists it in the database file of the path, which defaults to differ.db. The kubernetes
+// backend persists the images as ImageReport custom resources in the namespace of the cluster, which default to the
+// global namespace and the first cluster. Its writes are batched within the flush interval. The history of the tag
+// changes is kept for the history retention, which defaults to 720h. The kubernetes backend keeps the history in memory.
+type Storage struct {
+	Backend                string        `yaml:"backend,omitempty" validate:"omitempty,oneof=memory bolt kubernetes"`
+	Path                   string        `yaml:"path,omitempty"`
+	Cluster                string        `yaml:"cluster,omitempty"`
+	Namespace              string        `yaml:"namespace,omitempty"`
+	FlushInterval          string        `yaml:"flushInterval,omitempty"`
+	HistoryRetention       string        `yaml:"historyRetention,omitempty"`
+	ParsedFlushInterval    time.Duration `yaml:"-"`
+	ParsedHistoryRetention time.Duration `yaml:"-"`
+}
+
+// RateLimit of a registry. The quota is spread evenly across the quota window, which defaults to 24h.
+type RateLimit struct {
+	RequestsPerSecond int           `yaml:"requestsPerSecond,omitempty" validate:"min=0"`
+	Quota             int           `yaml:"quota,omitempty" validate:"min=0"`
+	QuotaWindow       string        `yaml:"quotaWindow,omitempty"`
+	ParsedQuotaWindow time.Duration `yaml:"-"`
+}
+
+// RegistryRateLimit overrides the default rate limit for the registry URL. Unset requestsPerSecond fall back to the default.
+type RegistryRateLimit struct {
+	Registry  string `yaml:"registry" validate:"required"`
+	RateLimit `yaml:",inline"`
+}
+
+// RateLimits configures the requests against OCI registries
+type RateLimits struct {
+	Default    RateLimit           `yaml:"default,omitempty"`
+	Registries []RegistryRateLimit `yaml:"registries,omitempty" validate:"unique=Registry,dive"`
+}
+
+// API configures the HTTP API. The endpoints which change the state, e.g. snoozes and on-demand checks, require the
+// token as bearer token and are disabled without token.
+type API struct {
+	Token string `yaml:"token,omitempty"`
+}
+
 // ControllerConfig holds required controller configuration
 type ControllerConfig struct {
-	Namespace                            string          `yaml:"namespace"`
-	UnparsedRegistryRequestSleepDuration string          `yaml:"registryRequestSleepDuration,omitempty"`
-	GitRemotes                           []GitRemote     `yaml:"remotes,omitempty" validate:"dive,required"`
-	Metrics                              MetricsEndpoint `yaml:"metrics"  validate:"required,dive,required"`
-	LogLevel                             string          `yaml:"loglevel,omitempty"`
-	ParsedRegistryRequestSleepDuration   time.Duration   `yaml:"-"`
-	configPath                           string          `yaml:"-"`
-	Version                              string          `yaml:"-"`
+	Namespace                            string                     `yaml:"namespace"`
+	Clusters                             []Cluster                  `yaml:"clusters,omitempty" validate:"unique=Name,dive"`
+	UnparsedRegistryRequestSleepDuration string                     `yaml:"registryRequestSleepDuration,omitempty"`
+	Scheduler                            Scheduler                  `yaml:"scheduler,omitempty"`
+	UnparsedNotificationReminderInterval string                     `yaml:"notificationReminderInterval,omitempty"`
+	UnparsedReconcileInterval            string                     `yaml:"reconcileInterval,omitempty"`
+	NotificationDelivery                 NotificationDelivery       `yaml:"notificationDelivery,omitempty"`
+	Webhooks                             Webhooks                   `yaml:"webhooks,omitempty"`
+	Notifiers                            Notifiers                  `yaml:"notifiers,omitempty"`
+	API                                  API                        `yaml:"api,omitempty"`
+	Snoozes                              []Snooze                   `yaml:"snoozes,omitempty" validate:"dive"`
+	RateLimits                           RateLimits                 `yaml:"rateLimits,omitempty"`
+	Storage                              Storage                    `yaml:"storage,omitempty"`
+	GitRemotes                           []GitRemote                `yaml:"remotes,omitempty" validate:"dive,required"`
+	Metrics                              MetricsEndpoint            `yaml:"metrics"  validate:"required,dive,required"`
+	LogLevel                             string                     `yaml:"loglevel,omitempty"`
+	PreReleasePolicy                     string                     `yaml:"preReleasePolicy,omitempty"`
+	VariantPolicy                        string                     `yaml:"variantPolicy,omitempty"`
+	OrderedTagClasses                    []string                   `yaml:"orderedTagClasses,omitempty"`
+	Images                               []ImagePolicy              `yaml:"images,omitempty" validate:"dive"`
+	ParsedRegistryRequestSleepDuration   time.Duration              `yaml:"-"`
+	ParsedNotificationReminderInterval   time.Duration              `yaml:"-"`
+	ParsedReconcileInterval              time.Duration              `yaml:"-"`
+	ParsedPreReleasePolicy               analyzing.PreReleasePolicy `yaml:"-"`
+	ParsedVariantPolicy                  analyzing.VariantPolicy    `yaml:"-"`
+	ParsedTagClasses                     []analyzing.TagClass       `yaml:"-"`
+	configPath                           string                     `yaml:"-"`
+	Version                              string                     `yaml:"-"`
 }
 
 type Config struct {
@@ -107,6 +328,9 @@ func initConfig(configPath string) (*ControllerConfig, error) {
 		Metrics: MetricsEndpoint{
 			Port: 9100,
 			Path: "/metrics",
+		},
+		RateLimits: RateLimits{
+			Default: RateLimit{RequestsPerSecond: 1},
 		}}
 
 	configFile, err := ioutil.ReadFile(configPath)
@@ -134,6 +358,121 @@ func initConfig(configPath string) (*ControllerConfig, error) {
 	}
 	config.ParsedRegistryRequestSleepDuration = dur
 
+	if config.UnparsedNotificationReminderInterval != "" {
+		reminderInterval, err := time.ParseDuration(config.UnparsedNotificationReminderInterval)
+		if err != nil {
+			return nil, err
+		}
+		config.ParsedNotificationReminderInterval = reminderInterval
+	}
+
+	if config.UnparsedReconcileInterval == "" {
+		config.UnparsedReconcileInterval = "10m"
+	}
+	reconcileInterval, err := time.ParseDuration(config.UnparsedReconcileInterval)
+	if err != nil {
+		return nil, fmt.Errorf("config error: reconcile interval: %w", err)
+	}
+	config.ParsedReconcileInterval = reconcileInterval
+
+	if err := config.RateLimits.parse(); err != nil {
+		return nil, err
+	}
+
+	if config.NotificationDelivery.Policy == "block" && config.NotificationDelivery.BlockTimeout == "" {
+		config.NotificationDelivery.BlockTimeout = "10s"
+	}
+	if config.NotificationDelivery.BlockTimeout != "" {
+		blockTimeout, err := time.ParseDuration(config.NotificationDelivery.BlockTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("config error: notification delivery: %w", err)
+		}
+		if blockTimeout <= 0 {
+			return nil, fmt.Errorf("config error: notification delivery: block timeout %s has to be greater than zero", blockTimeout)
+		}
+		config.NotificationDelivery.ParsedBlockTimeout = blockTimeout
+	}
+
+	if config.Webhooks.SafetyNetInterval == "" {
+		config.Webhooks.SafetyNetInterval = "6h"
+	}
+	safetyNetInterval, err := time.ParseDuration(config.Webhooks.SafetyNetInterval)
+	if err != nil {
+		return nil, fmt.Errorf("config error: webhooks: %w", err)
+	}
+	config.Webhooks.ParsedSafetyNetInterval = safetyNetInterval
+
+	if config.Storage.Backend == "" {
+		config.Storage.Backend = "memory"
+	}
+	if config.Storage.Backend == "bolt" && config.Storage.Path == "" {
+		config.Storage.Path = "differ.db"
+	}
+	if config.Storage.Namespace == "" {
+		config.Storage.Namespace = config.Namespace
+	}
+	if config.Storage.FlushInterval != "" {
+		flushInterval, err := time.ParseDuration(config.Storage.FlushInterval)
+		if err != nil {
+			return nil, fmt.Errorf("config error: storage: %w", err)
+		}
+		config.Storage.ParsedFlushInterval = flushInterval
+	}
+	if config.Storage.HistoryRetention == "" {
+		config.Storage.HistoryRetention = "720h"
+	}
+	historyRetention, err := time.ParseDuration(config.Storage.HistoryRetention)
+	if err != nil {
+		return nil, fmt.Errorf("config error: storage: %w", err)
+	}
+	config.Storage.ParsedHistoryRetention = historyRetention
+
+	for i := range config.Notifiers.Webhooks {
+		if err := config.Notifiers.Webhooks[i].parse(); err != nil {
+			return nil, err
+		}
+	}
+	for i := range config.Notifiers.Slack {
+		if err := config.Notifiers.Slack[i].parse(); err != nil {
+			return nil, err
+		}
+	}
+	for i := range config.Notifiers.Digests {
+		if err := config.Notifiers.Digests[i].parse(); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range config.Snoozes {
+		if err := config.Snoozes[i].parse(); err != nil {
+			return nil, err
+		}
+	}
+
+	preReleasePolicy, err := analyzing.ParsePreReleasePolicy(config.PreReleasePolicy)
+	if err != nil {
+		return nil, err
+	}
+	config.ParsedPreReleasePolicy = preReleasePolicy
+
+	variantPolicy, err := analyzing.ParseVariantPolicy(config.VariantPolicy)
+	if err != nil {
+		return nil, err
+	}
+	config.ParsedVariantPolicy = variantPolicy
+
+	tagClasses, err := parseTagClasses(config.OrderedTagClasses)
+	if err != nil {
+		return nil, err
+	}
+	config.ParsedTagClasses = tagClasses
+
+	for i := range config.Images {
+		if err := config.Images[i].parse(); err != nil {
+			return nil, err
+		}
+	}
+
 	if err = setLoglevel(config.LogLevel); err != nil {
 		return nil, err
 	}
@@ -142,6 +481,145 @@ func initConfig(configPath string) (*ControllerConfig, error) {
 
 }
 
+func (i *ImagePolicy) parse() error {
+	if i.Constraint != "" {
+		constraint, err := analyzing.ParseConstraint(i.Constraint)
+		if err != nil {
+			return fmt.Errorf("config error: image policy %s: %w", i.Pattern, err)
+		}
+		i.ParsedConstraint = constraint
+	}
+
+	if i.PreReleasePolicy != "" {
+		preReleasePolicy, err := analyzing.ParsePreReleasePolicy(i.PreReleasePolicy)
+		if err != nil {
+			return fmt.Errorf("config error: image policy %s: %w", i.Pattern, err)
+		}
+		i.ParsedPreReleasePolicy = preReleasePolicy
+	}
+
+	if i.VariantPolicy != "" {
+		variantPolicy, err := analyzing.ParseVariantPolicy(i.VariantPolicy)
+		if err != nil {
+			return fmt.Errorf("config error: image policy %s: %w", i.Pattern, err)
+		}
+		i.ParsedVariantPolicy = variantPolicy
+	}
+
+	tagClasses, err := parseTagClasses(i.OrderedTagClasses)
+	if err != nil {
+		return fmt.Errorf("config error: image policy %s: %w", i.Pattern, err)
+	}
+	i.ParsedTagClasses = tagClasses
+
+	for _, layout := range i.DateLayouts {
+		if err := analyzing.ValidateDateLayout(layout); err != nil {
+			return fmt.Errorf("config error: image policy %s: %w", i.Pattern, err)
+		}
+	}
+	return nil
+}
+
+func (s *Snooze) parse() error {
+	if s.Until == "" {
+		return nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if until, err := time.Parse(layout, s.Until); err == nil {
+			s.ParsedUntil = &until
+			return nil
+		}
+	}
+	return fmt.Errorf("config error: snooze of image %s: invalid until date %s, expected YYYY-MM-DD or RFC3339", s.Image, s.Until)
+}
+
+func (d *NotifierDelivery) parse() error {
+	for _, duration := range []struct {
+		value  string
+		parsed *time.Duration
+	}{{value: d.Timeout, parsed: &d.ParsedTimeout}, {value: d.Backoff, parsed: &d.ParsedBackoff}} {
+		if duration.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(duration.value)
+		if err != nil {
+			return err
+		}
+		*duration.parsed = parsed
+	}
+	return nil
+}
+
+func (w *WebhookNotifier) parse() error {
+	if err := w.NotifierDelivery.parse(); err != nil {
+		return fmt.Errorf("config error: webhook notifier %s: %w", w.Name, err)
+	}
+	return nil
+}
+
+func (s *SlackNotifier) parse() error {
+	if err := s.NotifierDelivery.parse(); err != nil {
+		return fmt.Errorf("config error: slack notifier %s: %w", s.Name, err)
+	}
+	return nil
+}
+
+func (d *DigestNotifier) parse() error {
+	location, err := time.LoadLocation(d.Timezone)
+	if err != nil {
+		return fmt.Errorf("config error: digest notifier %s: %w", d.Name, err)
+	}
+	d.ParsedLocation = location
+
+	if d.SMTP.Timeout != "" {
+		timeout, err := time.ParseDuration(d.SMTP.Timeout)
+		if err != nil {
+			return fmt.Errorf("config error: digest notifier %s: SMTP timeout: %w", d.Name, err)
+		}
+		d.SMTP.ParsedTimeout = timeout
+	}
+	return nil
+}
+
+func (r *RateLimits) parse() error {
+	if err := r.Default.parse(); err != nil {
+		return fmt.Errorf("config error: default rate limit: %w", err)
+	}
+	for i := range r.Registries {
+		if err := r.Registries[i].parse(); err != nil {
+			return fmt.Errorf("config error: rate limit of registry %s: %w", r.Registries[i].Registry, err)
+		}
+		if r.Registries[i].RequestsPerSecond == 0 {
+			r.Registries[i].RequestsPerSecond = r.Default.RequestsPerSecond
+		}
+	}
+	return nil
+}
+
+func (r *RateLimit) parse() error {
+	if r.QuotaWindow == "" {
+		return nil
+	}
+	window, err := time.ParseDuration(r.QuotaWindow)
+	if err != nil {
+		return err
+	}
+	r.ParsedQuotaWindow = window
+	return nil
+}
+
+func parseTagClasses(names []string) ([]analyzing.TagClass, error) {
+	var classes []analyzing.TagClass
+	for _, name := range names {
+		class, err := analyzing.ParseTagClass(name)
+		if err != nil {
+			return nil, err
+		}
+		classes = append(classes, class)
+	}
+	return classes, nil
+}
+
 func setLoglevel(level string) error {
 	if level == "" {
 		level = "info"
@@ -24,7 +24,13 @@
 
 package differentiating
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/analyzing"
+)
 
 type PullSecret struct {
 	Username string
@@ -40,11 +46,32 @@ func (p *PullSecret) GetPassword() string {
 }
 
 type Image struct {
-	ID       string
-	Registry string
-	Name     string
-	Tag      string
-	Auth     []*PullSecret
+	ID       string `json:"id"`
+	Registry string `json:"registry"`
+	Name     string `json:"name"`
+	Tag      string `json:"tag"`
+	// Auth is never encoded, so that events can be shipped to external systems
+	Auth []*PullSecret `json:"-"`
+	// Constraint is an optional analyzing.Constraint expression of the workload, which overrides the configured constraint
+	Constraint string `json:"constraint,omitempty"`
+	// Snooze is an optional snooze expression of the workload, see ParseSnoozeExpression
+	Snooze string `json:"snooze,omitempty"`
+	// Owner is an optional team or person of the workload, which is responsible for updates
+	Owner    string   `json:"owner,omitempty"`
+	Workload Workload `json:"workload"`
+}
+
+// Workload describes the kubernetes object and container which runs the image
+type Workload struct {
+	Cluster    string `json:"cluster"`
+	Namespace  string `json:"namespace"`
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	UID        string `json:"uid"`
+	Container  string `json:"container"`
+	// Labels of the kubernetes object, which can be selected by ListOptions.LabelSelector
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 func (i Image) GetNameWithoutRegistry() string {
@@ -59,12 +86,84 @@ func (i Image) GetRegistryURL() string {
 	return i.Registry
 }
 
-type ListOptions struct {
-	ImageName string
-	Registry  string
-}
+// EventType describes the state transition of an image, which triggered the NotificationEvent
+type EventType string
+
+const (
+	// EventTypeOutdated is sent once when a newer tag becomes available for an image
+	EventTypeOutdated EventType = "outdated"
+	// EventTypeChanged is sent when the newer tags of an outdated image change, e.g. because an even newer tag was released
+	EventTypeChanged EventType = "changed"
+	// EventTypeResolved is sent when an outdated image was updated to the latest tag
+	EventTypeResolved EventType = "resolved"
+	// EventTypeReminder is sent periodically for images which are still outdated, if reminders are enabled
+	EventTypeReminder EventType = "reminder"
+	// EventTypeRecommendation is sent when the pinned version of a floating tag changes
+	EventTypeRecommendation EventType = "recommendation"
+)
 
 type NotificationEvent struct {
-	Image  Image
-	NewTag string
+	Type  EventType `json:"type"`
+	Image Image     `json:"image"`
+	// OldTag is the running tag of the image. For resolved events it is the tag which was outdated before.
+	OldTag string `json:"oldTag"`
+	// NewTag is the newest tag within the constraint of the image. It equals the running tag if only LatestTag is newer.
+	NewTag string `json:"newTag,omitempty"`
+	// LatestTag is the newest tag regardless of the constraint
+	LatestTag string `json:"latestTag,omitempty"`
+	// NewVariantTag is the newest tag with the application version of NewTag and a newer variant version. It is only set
+	// if variants are tracked as separate update.
+	NewVariantTag string `json:"newVariantTag,omitempty"`
+	// Bump classifies the change from OldTag to NewTag
+	Bump analyzing.BumpType `json:"bump,omitempty"`
+	// Candidates are all tags within the constraint which are newer than OldTag, sorted ascending
+	Candidates []string `json:"candidates,omitempty"`
+	// Age is the time between the release dates of the running tag and NewTag, if both are date-stamped
+	Age time.Duration `json:"-"`
+	// Pin is set for recommendation events, which suggest to pin a floating tag like latest to a concrete version
+	Pin *PinRecommendation `json:"pin,omitempty"`
+}
+
+// MarshalJSON encodes the event with a stable schema, the age is encoded in seconds
+func (e NotificationEvent) MarshalJSON() ([]byte, error) {
+	type event NotificationEvent
+	return json.Marshal(struct {
+		event
+		AgeSeconds int64 `json:"ageSeconds,omitempty"`
+	}{
+		event:      event(e),
+		AgeSeconds: int64(e.Age / time.Second),
+	})
+}
+
+// UnmarshalJSON decodes the schema of MarshalJSON, the age is decoded from seconds
+func (e *NotificationEvent) UnmarshalJSON(data []byte) error {
+	type event NotificationEvent
+	decoded := struct {
+		*event
+		AgeSeconds int64 `json:"ageSeconds,omitempty"`
+	}{
+		event: (*event)(e),
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	e.Age = time.Duration(decoded.AgeSeconds) * time.Second
+	return nil
+}
+
+// OutdatedImage is an image for which the last check found a newer tag
+type OutdatedImage struct {
+	// Event is the last outdated event of the image with its newer tags
+	Event NotificationEvent `json:"event"`
+	// Snoozed updates are not notified
+	Snoozed bool `json:"snoozed"`
+	// OutdatedSince is the time of the first outdated notification, it is only known if the history is enabled
+	OutdatedSince *time.Time `json:"outdatedSince,omitempty"`
+}
+
+// PinRecommendation is the most specific tag which currently has the same manifest digest as a floating tag
+type PinRecommendation struct {
+	Tag    string `json:"tag"`
+	Digest string `json:"digest"`
 }
@@ -0,0 +1,75 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/analyzing"
+)
+
+func TestNotificationEvent_MarshalJSON(t *testing.T) {
+	event := NotificationEvent{
+		Type: EventTypeOutdated,
+		Image: Image{
+			ID:       "id",
+			Registry: "docker.io",
+			Name:     "library/nginx",
+			Tag:      "1.18.0",
+			Auth:     []*PullSecret{{Username: "user", Password: "secret"}},
+			Workload: Workload{Cluster: "prod", Namespace: "web", APIVersion: "apps/v1", Kind: "Deployment", Name: "nginx", UID: "uid", Container: "nginx"},
+		},
+		OldTag:     "1.18.0",
+		NewTag:     "1.19.1",
+		LatestTag:  "1.19.1",
+		Bump:       analyzing.BumpMinor,
+		Candidates: []string{"1.19.0", "1.19.1"},
+		Age:        time.Hour,
+	}
+
+	got, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"type":"outdated","image":{"id":"id","registry":"docker.io","name":"library/nginx","tag":"1.18.0",` +
+		`"workload":{"cluster":"prod","namespace":"web","apiVersion":"apps/v1","kind":"Deployment","name":"nginx","uid":"uid","container":"nginx"}},` +
+		`"oldTag":"1.18.0","newTag":"1.19.1","latestTag":"1.19.1","bump":"minor","candidates":["1.19.0","1.19.1"],"ageSeconds":3600}`
+	if string(got) != want {
+		t.Errorf("MarshalJSON() = %s, want %s", got, want)
+	}
+
+	var decoded NotificationEvent
+	if err := json.Unmarshal(got, &decoded); err != nil {
+		t.Fatalf("UnmarshalJSON() error = %v", err)
+	}
+	event.Image.Auth = nil
+	if !reflect.DeepEqual(decoded, event) {
+		t.Errorf("UnmarshalJSON() = %+v, want %+v", decoded, event)
+	}
+}
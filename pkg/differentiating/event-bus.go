@@ -0,0 +1,230 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/monitoring"
+)
+
+// DeliveryPolicy defines how the EventBus handles a subscription whose queue is full
+type DeliveryPolicy string
+
+const (
+	// DeliveryDropNewest drops the published event if the queue is full
+	DeliveryDropNewest DeliveryPolicy = "drop-newest"
+	// DeliveryDropOldest removes the oldest queued event to make room for the published one
+	DeliveryDropOldest DeliveryPolicy = "drop-oldest"
+	// DeliveryBlock waits until the subscriber reads from the queue. The event is dropped if the block timeout exceeds.
+	DeliveryBlock DeliveryPolicy = "block"
+)
+
+const (
+	defaultSubscriptionBufferSize = 100
+	defaultSubscriptionName       = "default"
+)
+
+// SubscriptionOptions configure the queue of a subscription
+type SubscriptionOptions struct {
+	// Name identifies the subscription in the dropped events metric
+	Name string
+	// BufferSize is the capacity of the queue, defaults to 100
+	BufferSize int
+	Policy     DeliveryPolicy
+	// BlockTimeout limits the wait of the DeliveryBlock policy, zero waits until the subscription is closed. Only
+	// subscribers which read their queue without delay, e.g. without retries, should wait without timeout.
+	BlockTimeout time.Duration
+}
+
+func (o SubscriptionOptions) withDefaults() SubscriptionOptions {
+	if o.Name == "" {
+		o.Name = defaultSubscriptionName
+	}
+	if o.BufferSize <= 0 {
+		o.BufferSize = defaultSubscriptionBufferSize
+	}
+	if o.Policy == "" {
+		o.Policy = DeliveryDropNewest
+	}
+	return o
+}
+
+// Subscription receives the events published on the EventBus until it is unsubscribed or the bus is closed
+type Subscription struct {
+	opts      SubscriptionOptions
+	events    chan NotificationEvent
+	done      chan struct{}
+	closeOnce sync.Once
+	bus       *EventBus
+}
+
+// Events returns the queue of the subscription, which is closed on unsubscribe or when the bus is closed
+func (s *Subscription) Events() <-chan NotificationEvent {
+	return s.events
+}
+
+// Unsubscribe removes the subscription from the bus and closes its queue
+func (s *Subscription) Unsubscribe() {
+	s.bus.unsubscribe(s)
+}
+
+// stop releases all publishers blocked on the subscription
+func (s *Subscription) stop() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+// deliver has to be called with the read locked bus mutex, so that the queue is not closed concurrently
+func (s *Subscription) deliver(event NotificationEvent) {
+	switch s.opts.Policy {
+	case DeliveryBlock:
+		s.deliverBlocking(event)
+	case DeliveryDropOldest:
+		for {
+			select {
+			case s.events <- event:
+				return
+			default:
+			}
+			select {
+			case <-s.events:
+				s.dropped()
+			default:
+			}
+		}
+	default:
+		select {
+		case s.events <- event:
+		default:
+			s.dropped()
+		}
+	}
+}
+
+func (s *Subscription) deliverBlocking(event NotificationEvent) {
+	var timeout <-chan time.Time
+	if s.opts.BlockTimeout > 0 {
+		timer := time.NewTimer(s.opts.BlockTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case s.events <- event:
+	case <-timeout:
+		s.dropped()
+	case <-s.done:
+		s.dropped()
+	}
+}
+
+func (s *Subscription) dropped() {
+	monitoring.EventBusDroppedEventsMetric.WithLabelValues(s.opts.Name, string(s.opts.Policy)).Inc()
+}
+
+// EventBus fans out published events to the queues of all subscriptions one after another. A slow subscriber with a
+// dropping DeliveryPolicy only affects its own queue. A full queue of a DeliveryBlock subscription blocks Publish and
+// with it the delivery to all other subscriptions up to the block timeout.
+type EventBus struct {
+	mutex         sync.RWMutex
+	subscriptions map[*Subscription]struct{}
+	closed        bool
+}
+
+// NewEventBus creates an open bus without subscriptions
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscriptions: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe adds a subscription. Subscribing to a closed bus returns a subscription with a closed queue.
+func (b *EventBus) Subscribe(opts SubscriptionOptions) *Subscription {
+	opts = opts.withDefaults()
+	s := &Subscription{
+		opts:   opts,
+		events: make(chan NotificationEvent, opts.BufferSize),
+		done:   make(chan struct{}),
+		bus:    b,
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		s.stop()
+		close(s.events)
+		return s
+	}
+	b.subscriptions[s] = struct{}{}
+	return s
+}
+
+// Publish delivers the event to all subscriptions, events published on a closed bus are discarded
+func (b *EventBus) Publish(event NotificationEvent) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	if b.closed {
+		return
+	}
+	for s := range b.subscriptions {
+		s.deliver(event)
+	}
+}
+
+// Close closes the queues of all subscriptions. Publishers blocked by a subscription are released first.
+func (b *EventBus) Close() {
+	b.mutex.RLock()
+	for s := range b.subscriptions {
+		s.stop()
+	}
+	b.mutex.RUnlock()
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for s := range b.subscriptions {
+		s.stop()
+		close(s.events)
+		delete(b.subscriptions, s)
+	}
+}
+
+func (b *EventBus) unsubscribe(s *Subscription) {
+	s.stop()
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if _, ok := b.subscriptions[s]; !ok {
+		return
+	}
+	delete(b.subscriptions, s)
+	close(s.events)
+}
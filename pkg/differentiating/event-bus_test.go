@@ -0,0 +1,118 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEventBus_Publish(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    SubscriptionOptions
+		publish []string
+		want    []string
+	}{
+		{name: "DropNewest", opts: SubscriptionOptions{BufferSize: 2, Policy: DeliveryDropNewest}, publish: []string{"1", "2", "3"}, want: []string{"1", "2"}},
+		{name: "DropOldest", opts: SubscriptionOptions{BufferSize: 2, Policy: DeliveryDropOldest}, publish: []string{"1", "2", "3"}, want: []string{"2", "3"}},
+		{name: "BlockTimeout", opts: SubscriptionOptions{BufferSize: 2, Policy: DeliveryBlock, BlockTimeout: time.Millisecond}, publish: []string{"1", "2", "3"}, want: []string{"1", "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := NewEventBus()
+			subscription := bus.Subscribe(tt.opts)
+			for _, tag := range tt.publish {
+				bus.Publish(NotificationEvent{NewTag: tag})
+			}
+			bus.Close()
+
+			var got []string
+			for event := range subscription.Events() {
+				got = append(got, event.NewTag)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Publish() delivered %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventBus_SlowSubscriber(t *testing.T) {
+	bus := NewEventBus()
+	slow := bus.Subscribe(SubscriptionOptions{BufferSize: 1, Policy: DeliveryBlock})
+	fast := bus.Subscribe(SubscriptionOptions{BufferSize: 1})
+	bus.Publish(NotificationEvent{NewTag: "1"})
+
+	published := make(chan struct{})
+	go func() {
+		bus.Publish(NotificationEvent{NewTag: "2"})
+		close(published)
+	}()
+
+	<-fast.Events()
+	slow.Unsubscribe()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("Publish() is still blocked by an unsubscribed subscription")
+	}
+
+	if _, ok := <-slow.Events(); !ok {
+		t.Errorf("Unsubscribe() discarded the queued event")
+	}
+	if _, ok := <-slow.Events(); ok {
+		t.Errorf("Unsubscribe() did not close the queue")
+	}
+	if event := <-fast.Events(); event.NewTag != "2" {
+		t.Errorf("Publish() delivered %s to the fast subscription, want 2", event.NewTag)
+	}
+}
+
+func TestEventBus_Close(t *testing.T) {
+	bus := NewEventBus()
+	blocking := bus.Subscribe(SubscriptionOptions{BufferSize: 1, Policy: DeliveryBlock})
+	bus.Publish(NotificationEvent{})
+
+	published := make(chan struct{})
+	go func() {
+		bus.Publish(NotificationEvent{})
+		close(published)
+	}()
+
+	bus.Close()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("Close() did not release the blocked publisher")
+	}
+
+	bus.Publish(NotificationEvent{})
+	if _, ok := <-bus.Subscribe(SubscriptionOptions{}).Events(); ok {
+		t.Errorf("Subscribe() on a closed bus returned an open queue")
+	}
+	blocking.Unsubscribe()
+}
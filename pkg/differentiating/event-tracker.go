@@ -0,0 +1,305 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/analyzing"
+	"github.com/fwiedmann/differ/pkg/monitoring"
+	log "github.com/sirupsen/logrus"
+)
+
+// EventTracker remembers the last notified state of each image, so that events are only sent on state transitions
+// instead of on every check. Snoozed updates are tracked without events. It owns the newer tag available and pin
+// recommendation metrics of the images.
+type EventTracker struct {
+	reminderInterval time.Duration
+	snoozes          *Snoozes
+	mutex            sync.Mutex
+	states           map[string]*trackedState
+	now              func() time.Time
+	// state persists the tracked states if set, see restore
+	state StateRepository
+}
+
+type trackedState struct {
+	event        *NotificationEvent
+	snoozed      bool
+	metricLabels []string
+	notifiedAt   time.Time
+	pin          *PinRecommendation
+	pinLabels    []string
+}
+
+// NewEventTracker creates a tracker. If the reminder interval is greater than zero, outdated images are notified again
+// after each interval. The snoozes are optional.
+func NewEventTracker(reminderInterval time.Duration, snoozes *Snoozes) *EventTracker {
+	return &EventTracker{
+		reminderInterval: reminderInterval,
+		snoozes:          snoozes,
+		states:           make(map[string]*trackedState),
+		now:              time.Now,
+	}
+}
+
+// Track compares the result of a check with the last notified state of the image. Outdated events have to contain the
+// newer tags. It returns the event which has to be sent, if any. The state of a returned event is only persisted by
+// Notified. The snoozed label value is appended to the metric labels.
+func (t *EventTracker) Track(img Image, outdated NotificationEvent, isOutdated bool, metricLabels []string) (NotificationEvent, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	state := t.states[img.ID]
+	now := t.now()
+
+	if !isOutdated {
+		if state == nil || state.event == nil {
+			return NotificationEvent{}, false
+		}
+		monitoring.OciImageNewerTagAvailableMetric.DeleteLabelValues(state.metricLabels...)
+		resolved := NotificationEvent{Type: EventTypeResolved, Image: img, OldTag: state.event.Image.Tag, NewTag: img.Tag, LatestTag: img.Tag, Bump: analyzing.ClassifyBump(state.event.Image.Tag, img.Tag)}
+		wasSnoozed := state.snoozed
+		state.event = nil
+		state.snoozed = false
+		state.metricLabels = nil
+		t.removeEmptyState(img.ID, state)
+		// the update of a snoozed image was never notified
+		if wasSnoozed {
+			t.persist(img.ID)
+			return NotificationEvent{}, false
+		}
+		return resolved, true
+	}
+
+	snoozed := t.snoozes.IsSnoozed(outdated)
+	metricLabels = append(metricLabels[:len(metricLabels):len(metricLabels)], strconv.FormatBool(snoozed))
+
+	if state == nil {
+		state = &trackedState{}
+		t.states[img.ID] = state
+	}
+
+	labelsChanged := !reflect.DeepEqual(state.metricLabels, metricLabels)
+	if labelsChanged {
+		if state.metricLabels != nil {
+			monitoring.OciImageNewerTagAvailableMetric.DeleteLabelValues(state.metricLabels...)
+		}
+		monitoring.OciImageNewerTagAvailableMetric.WithLabelValues(metricLabels...).Set(1)
+		state.metricLabels = metricLabels
+	}
+
+	if snoozed {
+		changed := labelsChanged || !state.snoozed || state.event.Image.Tag != img.Tag || !sameNewerTags(*state.event, outdated)
+		state.event = &outdated
+		state.snoozed = true
+		if changed {
+			t.persist(img.ID)
+		}
+		return NotificationEvent{}, false
+	}
+
+	switch {
+	case state.event == nil || state.snoozed:
+		outdated.Type = EventTypeOutdated
+	case state.event.Image.Tag != img.Tag || !sameNewerTags(*state.event, outdated):
+		outdated.Type = EventTypeChanged
+	case t.reminderInterval > 0 && now.Sub(state.notifiedAt) >= t.reminderInterval:
+		outdated.Type = EventTypeReminder
+	default:
+		if labelsChanged {
+			t.persist(img.ID)
+		}
+		return NotificationEvent{}, false
+	}
+
+	state.event = &outdated
+	state.snoozed = false
+	state.notifiedAt = now
+	return outdated, true
+}
+
+// TrackPin returns a recommendation event if the pinned version of the floating tag of the image changed. Like for
+// Track, the state is only persisted by Notified.
+func (t *EventTracker) TrackPin(img Image, pin PinRecommendation, metricLabels []string) (NotificationEvent, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	state := t.states[img.ID]
+	if state == nil {
+		state = &trackedState{}
+		t.states[img.ID] = state
+	}
+
+	if state.pin != nil && *state.pin == pin && reflect.DeepEqual(state.pinLabels, metricLabels) {
+		return NotificationEvent{}, false
+	}
+
+	if state.pinLabels != nil {
+		monitoring.OciImagePinRecommendationMetric.DeleteLabelValues(state.pinLabels...)
+	}
+	monitoring.OciImagePinRecommendationMetric.WithLabelValues(metricLabels...).Set(1)
+	state.pin = &pin
+	state.pinLabels = metricLabels
+	return NotificationEvent{Type: EventTypeRecommendation, Image: img, OldTag: img.Tag, Pin: &pin}, true
+}
+
+// Notified persists the state of the image once the event returned by Track or TrackPin was sent. An event which was
+// not sent, e.g. because of a shutdown, is sent again after a restart.
+func (t *EventTracker) Notified(img Image) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.persist(img.ID)
+}
+
+// ClearPin removes the pin recommendation and its metric of an image, e.g. if its tag is no longer floating or no tag
+// with the digest of the floating tag exists anymore
+func (t *EventTracker) ClearPin(img Image) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	state, ok := t.states[img.ID]
+	if !ok || state.pin == nil {
+		return
+	}
+	if state.pinLabels != nil {
+		monitoring.OciImagePinRecommendationMetric.DeleteLabelValues(state.pinLabels...)
+	}
+	state.pin = nil
+	state.pinLabels = nil
+	t.removeEmptyState(img.ID, state)
+	t.persist(img.ID)
+}
+
+// HasNewerTag reports if the last check of the image found a newer tag, including snoozed updates
+func (t *EventTracker) HasNewerTag(img Image) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	state, ok := t.states[img.ID]
+	return ok && state.event != nil
+}
+
+// Outdated returns the last outdated event of the image, if the last check found a newer tag. Snoozed updates are
+// included.
+func (t *EventTracker) Outdated(img Image) (OutdatedImage, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	state, ok := t.states[img.ID]
+	if !ok || state.event == nil {
+		return OutdatedImage{}, false
+	}
+	return OutdatedImage{Event: *state.event, Snoozed: state.snoozed}, true
+}
+
+// Forget removes the state and metrics of a deleted image without sending an event
+func (t *EventTracker) Forget(img Image) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	state, ok := t.states[img.ID]
+	if !ok {
+		return
+	}
+	if state.metricLabels != nil {
+		monitoring.OciImageNewerTagAvailableMetric.DeleteLabelValues(state.metricLabels...)
+	}
+	if state.pinLabels != nil {
+		monitoring.OciImagePinRecommendationMetric.DeleteLabelValues(state.pinLabels...)
+	}
+	delete(t.states, img.ID)
+	t.persist(img.ID)
+}
+
+// restore loads the tracked states and their metrics from the repository and persists all further changes
+func (t *EventTracker) restore(ctx context.Context, state StateRepository) error {
+	states, err := state.ListTrackedStates(ctx)
+	if err != nil {
+		return err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, s := range states {
+		restored := &trackedState{
+			event:        s.Event,
+			snoozed:      s.Snoozed,
+			metricLabels: s.MetricLabels,
+			notifiedAt:   s.NotifiedAt,
+			pin:          s.Pin,
+			pinLabels:    s.PinLabels,
+		}
+		if restored.metricLabels != nil {
+			monitoring.OciImageNewerTagAvailableMetric.WithLabelValues(restored.metricLabels...).Set(1)
+		}
+		if restored.pinLabels != nil {
+			monitoring.OciImagePinRecommendationMetric.WithLabelValues(restored.pinLabels...).Set(1)
+		}
+		t.states[s.ImageID] = restored
+	}
+	t.state = state
+	return nil
+}
+
+// persist saves or deletes the state of the image and has to be called with the locked mutex. Errors are only logged,
+// because the in-memory state stays valid.
+func (t *EventTracker) persist(id string) {
+	if t.state == nil {
+		return
+	}
+
+	s, ok := t.states[id]
+	var err error
+	if !ok {
+		err = t.state.DeleteTrackedState(context.Background(), id)
+	} else {
+		err = t.state.SaveTrackedState(context.Background(), TrackedState{
+			ImageID:      id,
+			Event:        s.event,
+			Snoozed:      s.snoozed,
+			MetricLabels: s.metricLabels,
+			NotifiedAt:   s.notifiedAt,
+			Pin:          s.pin,
+			PinLabels:    s.pinLabels,
+		})
+	}
+	if err != nil {
+		log.Warnf("differentiate/event-tracker error: could not persist the state of image with ID %s: %s", id, err)
+	}
+}
+
+// removeEmptyState has to be called with the locked mutex
+func (t *EventTracker) removeEmptyState(id string, state *trackedState) {
+	if state.event == nil && state.pin == nil {
+		delete(t.states, id)
+	}
+}
+
+func sameNewerTags(a, b NotificationEvent) bool {
+	return a.NewTag == b.NewTag && a.LatestTag == b.LatestTag && a.NewVariantTag == b.NewVariantTag
+}
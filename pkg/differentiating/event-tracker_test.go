@@ -0,0 +1,282 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEventTracker_Track(t *testing.T) {
+	img := Image{ID: "id", Registry: "docker.io", Name: "library/nginx", Tag: "1.18.0"}
+	updated := img
+	updated.Tag = "1.19.0"
+	latest := img
+	latest.Tag = "1.20.0"
+
+	steps := []struct {
+		name       string
+		img        Image
+		newTag     string
+		isOutdated bool
+		elapsed    time.Duration
+		wantType   EventType
+		wantSend   bool
+	}{
+		{name: "BecomesOutdated", img: img, newTag: "1.19.0", isOutdated: true, wantType: EventTypeOutdated, wantSend: true},
+		{name: "Unchanged", img: img, newTag: "1.19.0", isOutdated: true, elapsed: time.Minute},
+		{name: "NewerTagChanged", img: img, newTag: "1.20.0", isOutdated: true, wantType: EventTypeChanged, wantSend: true},
+		{name: "ImageUpdatedButStillOutdated", img: updated, newTag: "1.20.0", isOutdated: true, wantType: EventTypeChanged, wantSend: true},
+		{name: "Reminder", img: updated, newTag: "1.20.0", isOutdated: true, elapsed: time.Hour, wantType: EventTypeReminder, wantSend: true},
+		{name: "Resolved", img: latest, wantType: EventTypeResolved, wantSend: true},
+		{name: "StillResolved", img: latest},
+	}
+
+	tracker := NewEventTracker(time.Hour, nil)
+	now := time.Now()
+	tracker.now = func() time.Time { return now }
+	for _, step := range steps {
+		now = now.Add(step.elapsed)
+		labels := []string{step.img.Workload.Cluster, step.img.GetNameWithRegistry(), step.img.GetRegistryURL(), step.img.Tag, step.newTag, step.newTag, "", "", "semver"}
+		event, send := tracker.Track(step.img, NotificationEvent{Image: step.img, NewTag: step.newTag, LatestTag: step.newTag}, step.isOutdated, labels)
+		if send != step.wantSend {
+			t.Fatalf("%s: Track() send = %v, want %v", step.name, send, step.wantSend)
+		}
+		if send && event.Type != step.wantType {
+			t.Errorf("%s: Track() type = %s, want %s", step.name, event.Type, step.wantType)
+		}
+		if send && event.Type == EventTypeResolved && event.OldTag != updated.Tag {
+			t.Errorf("%s: Track() old tag = %s, want %s", step.name, event.OldTag, updated.Tag)
+		}
+	}
+
+	if len(tracker.states) != 0 {
+		t.Errorf("Track() kept state of resolved image: %+v", tracker.states)
+	}
+}
+
+func TestEventTracker_TrackSnoozed(t *testing.T) {
+	img := Image{ID: "id", Registry: "docker.io", Name: "library/postgres", Tag: "12.4"}
+	snoozes, err := NewSnoozes([]Snooze{{Image: "library/postgres", Tag: "13.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := NewEventTracker(0, snoozes)
+
+	steps := []struct {
+		name        string
+		newTag      string
+		isOutdated  bool
+		wantType    EventType
+		wantSend    bool
+		wantSnoozed bool
+	}{
+		{name: "Snoozed", newTag: "13.1", isOutdated: true, wantSnoozed: true},
+		{name: "SnoozeEndsWithNewerTag", newTag: "13.2", isOutdated: true, wantType: EventTypeOutdated, wantSend: true},
+		{name: "Resolved", wantType: EventTypeResolved, wantSend: true},
+		{name: "SnoozedAgain", newTag: "13.1", isOutdated: true, wantSnoozed: true},
+		{name: "SnoozedResolved"},
+	}
+	for _, step := range steps {
+		labels := []string{img.Workload.Cluster, img.GetNameWithRegistry(), img.GetRegistryURL(), img.Tag, step.newTag, step.newTag, "", "", "semver"}
+		event, send := tracker.Track(img, NotificationEvent{Image: img, NewTag: step.newTag, LatestTag: step.newTag}, step.isOutdated, labels)
+		if send != step.wantSend {
+			t.Fatalf("%s: Track() send = %v, want %v", step.name, send, step.wantSend)
+		}
+		if send && event.Type != step.wantType {
+			t.Errorf("%s: Track() type = %s, want %s", step.name, event.Type, step.wantType)
+		}
+		outdated, ok := tracker.Outdated(img)
+		if ok != step.isOutdated || outdated.Snoozed != step.wantSnoozed || outdated.Event.NewTag != step.newTag {
+			t.Errorf("%s: Outdated() = %+v, %v, want new tag %q, snoozed %v", step.name, outdated, ok, step.newTag, step.wantSnoozed)
+		}
+	}
+}
+
+func TestEventTracker_TrackPin(t *testing.T) {
+	img := Image{ID: "id", Registry: "docker.io", Name: "library/nginx", Tag: "latest"}
+	tracker := NewEventTracker(0, nil)
+	labels := func(pin PinRecommendation) []string {
+		return []string{img.Workload.Cluster, img.GetNameWithRegistry(), img.GetRegistryURL(), img.Tag, pin.Tag, pin.Digest}
+	}
+
+	pins := []struct {
+		pin      PinRecommendation
+		wantSend bool
+	}{
+		{pin: PinRecommendation{Tag: "1.19.3", Digest: "sha256:a"}, wantSend: true},
+		{pin: PinRecommendation{Tag: "1.19.3", Digest: "sha256:a"}},
+		{pin: PinRecommendation{Tag: "1.19.4", Digest: "sha256:b"}, wantSend: true},
+	}
+	for i, p := range pins {
+		event, send := tracker.TrackPin(img, p.pin, labels(p.pin))
+		if send != p.wantSend {
+			t.Fatalf("TrackPin() %d send = %v, want %v", i, send, p.wantSend)
+		}
+		if send && (event.Type != EventTypeRecommendation || *event.Pin != p.pin) {
+			t.Errorf("TrackPin() %d event = %+v", i, event)
+		}
+	}
+
+	tracker.Forget(img)
+	if _, send := tracker.TrackPin(img, pins[2].pin, labels(pins[2].pin)); !send {
+		t.Errorf("TrackPin() after Forget() did not send the recommendation again")
+	}
+
+	tracker.ClearPin(img)
+	if _, ok := tracker.states[img.ID]; ok {
+		t.Errorf("ClearPin() kept the state of an image without event and pin")
+	}
+	if _, send := tracker.TrackPin(img, pins[2].pin, labels(pins[2].pin)); !send {
+		t.Errorf("TrackPin() after ClearPin() did not send the recommendation again")
+	}
+}
+
+// stateRepositoryMock keeps the persisted state in memory
+type stateRepositoryMock struct {
+	mutex   sync.Mutex
+	tags    map[string]ImageTags
+	states  map[string]TrackedState
+	snoozes map[string]Snooze
+}
+
+func newStateRepositoryMock() *stateRepositoryMock {
+	return &stateRepositoryMock{
+		tags:    make(map[string]ImageTags),
+		states:  make(map[string]TrackedState),
+		snoozes: make(map[string]Snooze),
+	}
+}
+
+func (s *stateRepositoryMock) SaveTags(_ context.Context, tags ImageTags) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tags[tags.Image] = tags
+	return nil
+}
+
+func (s *stateRepositoryMock) ListTags(_ context.Context) ([]ImageTags, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var list []ImageTags
+	for _, tags := range s.tags {
+		list = append(list, tags)
+	}
+	return list, nil
+}
+
+func (s *stateRepositoryMock) SaveTrackedState(_ context.Context, state TrackedState) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.states[state.ImageID] = state
+	return nil
+}
+
+func (s *stateRepositoryMock) DeleteTrackedState(_ context.Context, imageID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.states, imageID)
+	return nil
+}
+
+func (s *stateRepositoryMock) ListTrackedStates(_ context.Context) ([]TrackedState, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var list []TrackedState
+	for _, state := range s.states {
+		list = append(list, state)
+	}
+	return list, nil
+}
+
+func (s *stateRepositoryMock) SaveSnooze(_ context.Context, snooze Snooze) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.snoozes[snooze.ID] = snooze
+	return nil
+}
+
+func (s *stateRepositoryMock) DeleteSnooze(_ context.Context, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.snoozes, id)
+	return nil
+}
+
+func (s *stateRepositoryMock) ListSnoozes(_ context.Context) ([]Snooze, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var list []Snooze
+	for _, snooze := range s.snoozes {
+		list = append(list, snooze)
+	}
+	return list, nil
+}
+
+func TestEventTracker_restore(t *testing.T) {
+	img := Image{ID: "id", Registry: "docker.io", Name: "library/nginx", Tag: "1.18.0"}
+	outdated := NotificationEvent{Image: img, NewTag: "1.19.0", LatestTag: "1.19.0"}
+	labels := []string{img.Workload.Cluster, img.GetNameWithRegistry(), img.GetRegistryURL(), img.Tag, "1.19.0", "1.19.0", "", "", "semver"}
+	state := newStateRepositoryMock()
+
+	before := NewEventTracker(0, nil)
+	if err := before.restore(context.Background(), state); err != nil {
+		t.Fatal(err)
+	}
+	if _, send := before.Track(img, outdated, true, labels); !send {
+		t.Fatal("Track() did not send the outdated event")
+	}
+	if _, ok := state.states[img.ID]; ok {
+		t.Fatal("Track() persisted the state before the event was sent")
+	}
+	before.Notified(img)
+	if _, ok := state.states[img.ID]; !ok {
+		t.Fatal("Notified() did not persist the state")
+	}
+
+	// the restarted tracker knows the notified update
+	after := NewEventTracker(0, nil)
+	if err := after.restore(context.Background(), state); err != nil {
+		t.Fatal(err)
+	}
+	if event, send := after.Track(img, outdated, true, labels); send {
+		t.Errorf("Track() after restore sent %+v again", event)
+	}
+
+	updated := img
+	updated.Tag = "1.19.0"
+	if event, send := after.Track(updated, NotificationEvent{}, false, nil); !send || event.Type != EventTypeResolved {
+		t.Errorf("Track() after restore = %+v, %v, want the resolved event", event, send)
+	}
+	if _, ok := state.states[img.ID]; !ok {
+		t.Error("Track() deleted the persisted state before the resolved event was sent")
+	}
+	after.Notified(updated)
+	if _, ok := state.states[img.ID]; ok {
+		t.Error("Track() did not delete the persisted state of the resolved image")
+	}
+}
@@ -0,0 +1,254 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/monitoring"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultHistoryRetention = 30 * 24 * time.Hour
+	maxHistoryPruneInterval = time.Hour
+)
+
+// HistoryRecorder records the tag changes of the workload containers and the notifications of the service in the
+// HistoryRepository and observes the time to update metric. Updates of snoozed images are not notified, therefore
+// their newer tags are only recorded once the snooze expired.
+type HistoryRecorder struct {
+	repository HistoryRepository
+	retention  time.Duration
+	now        func() time.Time
+	mutex      sync.Mutex
+	// outdatedSince by image ID of the containers which are notified as outdated
+	outdatedSince map[string]time.Time
+	// discovered newer tags by image name with registry with the time of their entries, see prune
+	discovered map[string]map[string]time.Time
+}
+
+// NewHistoryRecorder creates a recorder, which keeps the entries for the retention. The retention defaults to 30 days.
+func NewHistoryRecorder(repository HistoryRepository, retention time.Duration) *HistoryRecorder {
+	if retention <= 0 {
+		retention = defaultHistoryRetention
+	}
+	return &HistoryRecorder{
+		repository:    repository,
+		retention:     retention,
+		now:           time.Now,
+		outdatedSince: make(map[string]time.Time),
+		discovered:    make(map[string]map[string]time.Time),
+	}
+}
+
+// since returns the time of the first outdated notification of the image, if it is outdated
+func (h *HistoryRecorder) since(imageID string) *time.Time {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	since, ok := h.outdatedSince[imageID]
+	if !ok {
+		return nil
+	}
+	return &since
+}
+
+// restore replays the entries of the repository, so that tag changes after a restart still close the outdated entries
+// and newer tags are not recorded twice. The open outdated entries are not pruned, see prune.
+func (h *HistoryRecorder) restore(ctx context.Context) error {
+	entries, err := h.repository.ListHistory(ctx, HistoryQuery{})
+	if err != nil {
+		return err
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, entry := range entries {
+		switch entry.Type {
+		case HistoryOutdated:
+			h.outdatedSince[entry.ImageID] = entry.Time
+		case HistoryTagChanged, HistoryResolved:
+			delete(h.outdatedSince, entry.ImageID)
+		case HistoryNewerTag:
+			h.discover(entry.Image, entry.NewTag, entry.Time)
+		}
+	}
+	return nil
+}
+
+// recordEvent records the first outdated notification of a container, its resolution and the newer tags of the event
+func (h *HistoryRecorder) recordEvent(ctx context.Context, event NotificationEvent) {
+	if event.Type == EventTypeRecommendation {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	now := h.now()
+	img := event.Image
+
+	switch event.Type {
+	case EventTypeOutdated:
+		if _, ok := h.outdatedSince[img.ID]; !ok {
+			h.outdatedSince[img.ID] = now
+			h.add(ctx, newContainerEntry(HistoryOutdated, now, img, img.Tag, event.NewTag))
+		}
+	case EventTypeResolved:
+		since, ok := h.outdatedSince[img.ID]
+		if !ok {
+			return
+		}
+		delete(h.outdatedSince, img.ID)
+		entry := newContainerEntry(HistoryResolved, now, img, event.OldTag, img.Tag)
+		entry.OutdatedSince = &since
+		h.add(ctx, entry)
+		return
+	}
+
+	for _, tag := range []string{event.NewTag, event.LatestTag, event.NewVariantTag} {
+		if tag == "" || tag == img.Tag || !h.discover(img.GetNameWithRegistry(), tag, now) {
+			continue
+		}
+		h.add(ctx, HistoryEntry{Type: HistoryNewerTag, Time: now, Image: img.GetNameWithRegistry(), NewTag: tag})
+	}
+}
+
+// recordTagChange records the changed tag of the container. If the container was outdated, the time to update is
+// observed.
+func (h *HistoryRecorder) recordTagChange(ctx context.Context, previous, img Image) {
+	if previous.Tag == img.Tag {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	entry := newContainerEntry(HistoryTagChanged, h.now(), img, previous.Tag, img.Tag)
+	if since, ok := h.outdatedSince[img.ID]; ok {
+		delete(h.outdatedSince, img.ID)
+		entry.OutdatedSince = &since
+		duration, _ := entry.TimeToUpdate()
+		monitoring.ImageTimeToUpdateMetric.WithLabelValues(img.Workload.Cluster, img.Workload.Namespace).Observe(duration.Seconds())
+	}
+	h.add(ctx, entry)
+}
+
+// forget the outdated state of a deleted container, its entries are kept until they expire
+func (h *HistoryRecorder) forget(img Image) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	delete(h.outdatedSince, img.ID)
+}
+
+// run prunes the expired entries until the context is done
+func (h *HistoryRecorder) run(ctx context.Context) {
+	interval := h.retention
+	if interval > maxHistoryPruneInterval {
+		interval = maxHistoryPruneInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	h.prune(ctx)
+	for {
+		select {
+		case <-ticker.C:
+			h.prune(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// prune deletes the expired entries and forgets their discovered newer tags. The outdated entries of containers which
+// are still outdated are kept until their tag change or resolution is recorded, otherwise the time to update of long
+// outdated containers would be under-reported after a restart.
+func (h *HistoryRecorder) prune(ctx context.Context) {
+	h.mutex.Lock()
+	cutoff := h.now().Add(-h.retention)
+	open := make(map[string]time.Time, len(h.outdatedSince))
+	for id, since := range h.outdatedSince {
+		open[id] = since
+	}
+	for image, tags := range h.discovered {
+		for tag, discovered := range tags {
+			if discovered.Before(cutoff) {
+				delete(tags, tag)
+			}
+		}
+		if len(tags) == 0 {
+			delete(h.discovered, image)
+		}
+	}
+	h.mutex.Unlock()
+
+	pruned, err := h.repository.PruneHistory(ctx, cutoff, func(entry HistoryEntry) bool {
+		since, ok := open[entry.ImageID]
+		return entry.Type == HistoryOutdated && ok && since.Equal(entry.Time)
+	})
+	if err != nil {
+		log.Errorf("differentiate/history error: could not prune expired entries: %s", err)
+		return
+	}
+	if pruned > 0 {
+		log.Debugf("Pruned %d expired history entries", pruned)
+	}
+}
+
+// discover reports if the tag of the image was not discovered yet and has to be called with the locked mutex
+func (h *HistoryRecorder) discover(image, tag string, at time.Time) bool {
+	tags, ok := h.discovered[image]
+	if !ok {
+		tags = make(map[string]time.Time)
+		h.discovered[image] = tags
+	}
+	if _, ok := tags[tag]; ok {
+		return false
+	}
+	tags[tag] = at
+	return true
+}
+
+// add has to be called with the locked mutex. Errors are only logged, because the history must not block the checks.
+func (h *HistoryRecorder) add(ctx context.Context, entry HistoryEntry) {
+	if err := h.repository.AddHistoryEntry(ctx, entry); err != nil {
+		log.Warnf("differentiate/history error: could not record %s entry of image %s: %s", entry.Type, entry.Image, err)
+	}
+}
+
+func newContainerEntry(entryType HistoryEntryType, now time.Time, img Image, oldTag, newTag string) HistoryEntry {
+	workload := img.Workload
+	workload.Labels = nil
+	return HistoryEntry{
+		Type:     entryType,
+		Time:     now,
+		Image:    img.GetNameWithRegistry(),
+		ImageID:  img.ID,
+		Workload: &workload,
+		OldTag:   oldTag,
+		NewTag:   newTag,
+	}
+}
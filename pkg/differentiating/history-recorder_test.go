@@ -0,0 +1,196 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type historyRepositoryMock struct {
+	mutex   sync.Mutex
+	entries []HistoryEntry
+}
+
+func (h *historyRepositoryMock) AddHistoryEntry(_ context.Context, entry HistoryEntry) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.entries = append(h.entries, entry)
+	return nil
+}
+
+func (h *historyRepositoryMock) ListHistory(_ context.Context, query HistoryQuery) ([]HistoryEntry, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return query.Apply(h.entries)
+}
+
+func (h *historyRepositoryMock) PruneHistory(_ context.Context, before time.Time, keep func(HistoryEntry) bool) (int, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	var kept []HistoryEntry
+	for _, entry := range h.entries {
+		if !entry.Time.Before(before) || (keep != nil && keep(entry)) {
+			kept = append(kept, entry)
+		}
+	}
+	pruned := len(h.entries) - len(kept)
+	h.entries = kept
+	return pruned, nil
+}
+
+func (h *historyRepositoryMock) types() []HistoryEntryType {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	types := make([]HistoryEntryType, 0, len(h.entries))
+	for _, entry := range h.entries {
+		types = append(types, entry.Type)
+	}
+	return types
+}
+
+func newTestHistoryRecorder(repository HistoryRepository, now *time.Time) *HistoryRecorder {
+	recorder := NewHistoryRecorder(repository, time.Hour*24)
+	recorder.now = func() time.Time {
+		return *now
+	}
+	return recorder
+}
+
+func TestHistoryRecorder(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2020, 12, 1, 8, 0, 0, 0, time.UTC)
+	outdatedAt := now
+	repository := &historyRepositoryMock{}
+	recorder := newTestHistoryRecorder(repository, &now)
+
+	web := Image{ID: "1", Registry: "docker.io", Name: "library/nginx", Tag: "1.18.0", Workload: Workload{Namespace: "web", Kind: "Deployment", Name: "frontend", Container: "nginx", Labels: map[string]string{"app": "frontend"}}}
+	admin := Image{ID: "2", Registry: "docker.io", Name: "library/nginx", Tag: "1.18.0", Workload: Workload{Namespace: "admin", Kind: "Deployment", Name: "frontend", Container: "nginx"}}
+
+	recorder.recordEvent(ctx, NotificationEvent{Type: EventTypeOutdated, Image: web, OldTag: web.Tag, NewTag: "1.19.0", LatestTag: "1.19.0"})
+	recorder.recordEvent(ctx, NotificationEvent{Type: EventTypeOutdated, Image: admin, OldTag: admin.Tag, NewTag: "1.19.0", LatestTag: "1.19.0"})
+	now = now.Add(time.Minute)
+	recorder.recordEvent(ctx, NotificationEvent{Type: EventTypeReminder, Image: web, OldTag: web.Tag, NewTag: "1.19.0", LatestTag: "1.19.0"})
+	recorder.recordEvent(ctx, NotificationEvent{Type: EventTypeChanged, Image: web, OldTag: web.Tag, NewTag: "1.19.0", LatestTag: "1.20.0"})
+
+	now = now.Add(time.Hour)
+	updated := web
+	updated.Tag = "1.19.0"
+	recorder.recordTagChange(ctx, web, updated)
+	recorder.recordTagChange(ctx, updated, updated)
+	recorder.recordEvent(ctx, NotificationEvent{Type: EventTypeResolved, Image: updated, OldTag: web.Tag})
+	recorder.recordEvent(ctx, NotificationEvent{Type: EventTypeResolved, Image: admin, OldTag: admin.Tag})
+
+	wantTypes := []HistoryEntryType{HistoryOutdated, HistoryNewerTag, HistoryOutdated, HistoryNewerTag, HistoryTagChanged, HistoryResolved}
+	if got := repository.types(); !reflect.DeepEqual(got, wantTypes) {
+		t.Fatalf("recorded entries %v, want %v", got, wantTypes)
+	}
+
+	changed := repository.entries[4]
+	if changed.OldTag != "1.18.0" || changed.NewTag != "1.19.0" || changed.ImageID != "1" {
+		t.Errorf("tag changed entry = %+v, want the change of image 1 from 1.18.0 to 1.19.0", changed)
+	}
+	if changed.Workload == nil || changed.Workload.Labels != nil {
+		t.Errorf("tag changed entry workload = %+v, want the workload without labels", changed.Workload)
+	}
+	if duration, ok := changed.TimeToUpdate(); !ok || duration != now.Sub(outdatedAt) {
+		t.Errorf("TimeToUpdate() = %s, %t, want %s", duration, ok, now.Sub(outdatedAt))
+	}
+	if resolved := repository.entries[5]; resolved.ImageID != "2" || resolved.OutdatedSince == nil || !resolved.OutdatedSince.Equal(outdatedAt) {
+		t.Errorf("resolved entry = %+v, want the resolution of image 2 outdated since %s", resolved, outdatedAt)
+	}
+	if newer := repository.entries[3]; newer.NewTag != "1.20.0" || newer.Image != "docker.io/library/nginx" || newer.Workload != nil {
+		t.Errorf("newer tag entry = %+v, want 1.20.0 of the image", newer)
+	}
+}
+
+func TestHistoryRecorder_restore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2020, 12, 1, 8, 0, 0, 0, time.UTC)
+	img := Image{ID: "1", Registry: "docker.io", Name: "library/nginx", Tag: "1.18.0"}
+	repository := &historyRepositoryMock{}
+	newTestHistoryRecorder(repository, &now).recordEvent(ctx, NotificationEvent{Type: EventTypeOutdated, Image: img, OldTag: img.Tag, NewTag: "1.19.0"})
+
+	// the recorder after a restart
+	now = now.Add(time.Hour)
+	recorder := newTestHistoryRecorder(repository, &now)
+	if err := recorder.restore(ctx); err != nil {
+		t.Fatal(err)
+	}
+	recorder.recordEvent(ctx, NotificationEvent{Type: EventTypeOutdated, Image: img, OldTag: img.Tag, NewTag: "1.19.0"})
+	updated := img
+	updated.Tag = "1.19.0"
+	recorder.recordTagChange(ctx, img, updated)
+
+	wantTypes := []HistoryEntryType{HistoryOutdated, HistoryNewerTag, HistoryTagChanged}
+	if got := repository.types(); !reflect.DeepEqual(got, wantTypes) {
+		t.Fatalf("recorded entries %v, want %v", got, wantTypes)
+	}
+	if duration, ok := repository.entries[2].TimeToUpdate(); !ok || duration != time.Hour {
+		t.Errorf("TimeToUpdate() = %s, %t, want the restored outdated time", duration, ok)
+	}
+}
+
+func TestHistoryRecorder_prune(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2020, 12, 1, 8, 0, 0, 0, time.UTC)
+	outdatedAt := now.Add(-time.Hour * 25)
+	img := Image{ID: "1", Registry: "docker.io", Name: "library/nginx", Tag: "1.18.0"}
+	repository := &historyRepositoryMock{entries: []HistoryEntry{
+		{Type: HistoryNewerTag, Time: now.Add(-time.Hour * 26), Image: "docker.io/library/nginx", NewTag: "1.19.0"},
+		{Type: HistoryOutdated, Time: now.Add(-time.Hour * 26), Image: "docker.io/library/nginx", ImageID: "2", OldTag: "1.18.0", NewTag: "1.19.0"},
+		{Type: HistoryOutdated, Time: outdatedAt, Image: "docker.io/library/nginx", ImageID: "1", OldTag: "1.18.0", NewTag: "1.19.0"},
+		{Type: HistoryTagChanged, Time: now.Add(-time.Hour * 25), Image: "docker.io/library/nginx", ImageID: "2", OldTag: "1.18.0", NewTag: "1.19.0"},
+		{Type: HistoryNewerTag, Time: now.Add(-time.Hour), Image: "docker.io/library/nginx", NewTag: "1.20.0"},
+	}}
+	recorder := newTestHistoryRecorder(repository, &now)
+	if err := recorder.restore(ctx); err != nil {
+		t.Fatal(err)
+	}
+	recorder.prune(ctx)
+
+	wantTypes := []HistoryEntryType{HistoryOutdated, HistoryNewerTag}
+	if got := repository.types(); !reflect.DeepEqual(got, wantTypes) || repository.entries[0].ImageID != "1" {
+		t.Fatalf("prune() kept %+v, want the open outdated entry and the entries within the retention", repository.entries)
+	}
+	if tags := recorder.discovered["docker.io/library/nginx"]; len(tags) != 1 {
+		t.Errorf("prune() kept the discovered tags %v, want only 1.20.0", tags)
+	}
+
+	// the recorder after a restart still knows since when the image is outdated
+	recorder = newTestHistoryRecorder(repository, &now)
+	if err := recorder.restore(ctx); err != nil {
+		t.Fatal(err)
+	}
+	updated := img
+	updated.Tag = "1.20.0"
+	recorder.recordTagChange(ctx, img, updated)
+	if duration, ok := repository.entries[2].TimeToUpdate(); !ok || duration != now.Sub(outdatedAt) {
+		t.Errorf("TimeToUpdate() = %s, %t, want %s since the outdated entry beyond the retention", duration, ok, now.Sub(outdatedAt))
+	}
+}
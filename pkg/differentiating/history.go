@@ -0,0 +1,219 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrHistoryDisabled is returned by the history queries of a service without HistoryRepository
+var ErrHistoryDisabled = errors.New("history is disabled")
+
+// HistoryEntryType describes the observation recorded by a HistoryEntry
+type HistoryEntryType string
+
+const (
+	// HistoryTagChanged is recorded when the tag of a workload container changed
+	HistoryTagChanged HistoryEntryType = "tag-changed"
+	// HistoryOutdated is recorded when a workload container was notified as outdated for the first time
+	HistoryOutdated HistoryEntryType = "outdated"
+	// HistoryResolved is recorded when an outdated workload container became up to date without a tag change, e.g.
+	// because the newer tag was deleted from the registry or the constraint changed
+	HistoryResolved HistoryEntryType = "resolved"
+	// HistoryNewerTag is recorded when a newer tag of an image was discovered for the first time
+	HistoryNewerTag HistoryEntryType = "newer-tag"
+)
+
+// HistoryRepository stores the history entries until they are pruned by the retention policy
+type HistoryRepository interface {
+	AddHistoryEntry(ctx context.Context, entry HistoryEntry) error
+	// ListHistory returns the entries matching the query, see HistoryQuery.Apply
+	ListHistory(ctx context.Context, query HistoryQuery) ([]HistoryEntry, error)
+	// PruneHistory deletes all entries recorded before the time, except for the entries to keep if keep is set, and
+	// returns the number of deleted entries
+	PruneHistory(ctx context.Context, before time.Time, keep func(HistoryEntry) bool) (int, error)
+}
+
+// HistoryEntry is a timestamped observation of a workload container or, for newer tags, of an image
+type HistoryEntry struct {
+	Type HistoryEntryType `json:"type"`
+	Time time.Time        `json:"time"`
+	// Image is the name with registry
+	Image string `json:"image"`
+	// ImageID and Workload are empty for newer tag entries
+	ImageID  string    `json:"imageID,omitempty"`
+	Workload *Workload `json:"workload,omitempty"`
+	// OldTag is the running tag before a tag change or while the container was outdated
+	OldTag string `json:"oldTag,omitempty"`
+	// NewTag is the running tag after a tag change or the newer tag
+	NewTag string `json:"newTag,omitempty"`
+	// OutdatedSince is the time of the outdated entry, which was closed by this tag change or resolved entry
+	OutdatedSince *time.Time `json:"outdatedSince,omitempty"`
+}
+
+// TimeToUpdate returns the duration between the outdated notification and the tag change of the container
+func (e HistoryEntry) TimeToUpdate() (time.Duration, bool) {
+	if e.Type != HistoryTagChanged || e.OutdatedSince == nil {
+		return 0, false
+	}
+	return e.Time.Sub(*e.OutdatedSince), true
+}
+
+// HistoryQuery filters the history entries. Empty filters match all entries.
+type HistoryQuery struct {
+	Type         HistoryEntryType
+	Image        string
+	ImageID      string
+	Cluster      string
+	Namespace    string
+	WorkloadKind string
+	WorkloadName string
+	Container    string
+	// Since and Until limit the entries to the time range, Until is exclusive
+	Since time.Time
+	Until time.Time
+	// Limit keeps the newest entries, zero returns all
+	Limit int
+}
+
+// Validate the type, the time range and the limit
+func (q HistoryQuery) Validate() error {
+	switch q.Type {
+	case "", HistoryTagChanged, HistoryOutdated, HistoryResolved, HistoryNewerTag:
+	default:
+		return fmt.Errorf("differentiate/history error: invalid entry type %q", q.Type)
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Until.After(q.Since) {
+		return fmt.Errorf("differentiate/history error: until %s has to be after since %s", q.Until, q.Since)
+	}
+	if q.Limit < 0 {
+		return fmt.Errorf("differentiate/history error: limit must not be negative")
+	}
+	return nil
+}
+
+// Apply filters the entries and returns them sorted by time. Repositories, which can not query their backend with all
+// filters, apply the query to the entries of a broader query. The entries are not modified.
+func (q HistoryQuery) Apply(entries []HistoryEntry) ([]HistoryEntry, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	matched := make([]HistoryEntry, 0, len(entries))
+	for _, entry := range entries {
+		if q.matches(entry) {
+			matched = append(matched, entry)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].Time.Before(matched[j].Time)
+	})
+
+	if q.Limit > 0 && q.Limit < len(matched) {
+		matched = matched[len(matched)-q.Limit:]
+	}
+	return matched, nil
+}
+
+func (q HistoryQuery) matches(entry HistoryEntry) bool {
+	if !matchesFilter(string(q.Type), string(entry.Type)) ||
+		!matchesFilter(q.Image, entry.Image) ||
+		!matchesFilter(q.ImageID, entry.ImageID) ||
+		(!q.Since.IsZero() && entry.Time.Before(q.Since)) ||
+		(!q.Until.IsZero() && !entry.Time.Before(q.Until)) {
+		return false
+	}
+
+	var workload Workload
+	if entry.Workload != nil {
+		workload = *entry.Workload
+	}
+	return matchesFilter(q.Cluster, workload.Cluster) &&
+		matchesFilter(q.Namespace, workload.Namespace) &&
+		matchesFilter(q.WorkloadKind, workload.Kind) &&
+		matchesFilter(q.WorkloadName, workload.Name) &&
+		matchesFilter(q.Container, workload.Container)
+}
+
+// TimeToUpdate aggregates the durations between the outdated notifications and the tag changes of the containers of a
+// namespace
+type TimeToUpdate struct {
+	Cluster     string  `json:"cluster"`
+	Namespace   string  `json:"namespace"`
+	Updates     int     `json:"updates"`
+	MeanSeconds float64 `json:"meanSeconds"`
+	MaxSeconds  float64 `json:"maxSeconds"`
+}
+
+// MeanTimeToUpdate aggregates the tag changes of outdated containers by namespace sorted by cluster and namespace
+func MeanTimeToUpdate(entries []HistoryEntry) []TimeToUpdate {
+	type key struct{ cluster, namespace string }
+	type sum struct {
+		count int
+		total time.Duration
+		max   time.Duration
+	}
+
+	sums := make(map[key]*sum)
+	for _, entry := range entries {
+		duration, ok := entry.TimeToUpdate()
+		if !ok || entry.Workload == nil {
+			continue
+		}
+		k := key{cluster: entry.Workload.Cluster, namespace: entry.Workload.Namespace}
+		s, ok := sums[k]
+		if !ok {
+			s = &sum{}
+			sums[k] = s
+		}
+		s.count++
+		s.total += duration
+		if duration > s.max {
+			s.max = duration
+		}
+	}
+
+	result := make([]TimeToUpdate, 0, len(sums))
+	for k, s := range sums {
+		result = append(result, TimeToUpdate{
+			Cluster:     k.cluster,
+			Namespace:   k.namespace,
+			Updates:     s.count,
+			MeanSeconds: (s.total / time.Duration(s.count)).Seconds(),
+			MaxSeconds:  s.max.Seconds(),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Cluster != result[j].Cluster {
+			return result[i].Cluster < result[j].Cluster
+		}
+		return result[i].Namespace < result[j].Namespace
+	})
+	return result
+}
@@ -0,0 +1,79 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMeanTimeToUpdate(t *testing.T) {
+	start := time.Date(2020, 12, 1, 8, 0, 0, 0, time.UTC)
+	changed := func(cluster, namespace string, outdatedFor time.Duration) HistoryEntry {
+		entry := HistoryEntry{Type: HistoryTagChanged, Time: start.Add(outdatedFor), Workload: &Workload{Cluster: cluster, Namespace: namespace}}
+		if outdatedFor > 0 {
+			entry.OutdatedSince = &start
+		}
+		return entry
+	}
+
+	tests := []struct {
+		name    string
+		entries []HistoryEntry
+		want    []TimeToUpdate
+	}{
+		{name: "Empty", want: []TimeToUpdate{}},
+		{
+			name: "ByNamespace",
+			entries: []HistoryEntry{
+				changed("prod", "web", time.Hour),
+				changed("prod", "web", 3*time.Hour),
+				changed("dev", "web", 2*time.Hour),
+				changed("prod", "cache", 30*time.Minute),
+			},
+			want: []TimeToUpdate{
+				{Cluster: "dev", Namespace: "web", Updates: 1, MeanSeconds: 7200, MaxSeconds: 7200},
+				{Cluster: "prod", Namespace: "cache", Updates: 1, MeanSeconds: 1800, MaxSeconds: 1800},
+				{Cluster: "prod", Namespace: "web", Updates: 2, MeanSeconds: 7200, MaxSeconds: 10800},
+			},
+		},
+		{
+			name: "IgnoresChangesOfUpToDateContainers",
+			entries: []HistoryEntry{
+				changed("prod", "web", 0),
+				{Type: HistoryResolved, Time: start.Add(time.Hour), OutdatedSince: &start, Workload: &Workload{Cluster: "prod", Namespace: "web"}},
+			},
+			want: []TimeToUpdate{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MeanTimeToUpdate(tt.entries); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MeanTimeToUpdate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fwiedmann/differ/pkg/analyzing"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// SortField orders the images listed by a Repository
+type SortField string
+
+const (
+	// SortByID is the default order
+	SortByID SortField = "id"
+	// SortByName orders by the name with registry
+	SortByName SortField = "name"
+	// SortByNamespace orders by the namespace and the name of the workload
+	SortByNamespace SortField = "namespace"
+	// SortByWorkload orders by the kind and the name of the workload
+	SortByWorkload SortField = "workload"
+	// SortByTag orders by the tag, see analyzing.CompareTags
+	SortByTag SortField = "tag"
+)
+
+// ListOptions filter, sort and paginate the images of a Repository. Empty filters match all images.
+type ListOptions struct {
+	ImageName    string
+	Registry     string
+	Namespace    string
+	WorkloadKind string
+	WorkloadName string
+	Container    string
+	Tag          string
+	// HasNewerTag filters by the result of the last check. Repositories only store the images, so it is applied by the
+	// Service and ignored by repositories.
+	HasNewerTag *bool
+	// LabelSelector of the workload labels, e.g. "app=nginx,tier!=cache"
+	LabelSelector string
+	SortBy        SortField
+	Descending    bool
+	// Offset skips the first images of the sorted result
+	Offset int
+	// Limit of the returned images, zero returns all
+	Limit int
+}
+
+// Validate the sort field, the pagination and the label selector
+func (o ListOptions) Validate() error {
+	switch o.SortBy {
+	case "", SortByID, SortByName, SortByNamespace, SortByWorkload, SortByTag:
+	default:
+		return fmt.Errorf("differentiate/list-options error: invalid sort field %q", o.SortBy)
+	}
+	if o.Offset < 0 || o.Limit < 0 {
+		return fmt.Errorf("differentiate/list-options error: offset %d and limit %d must not be negative", o.Offset, o.Limit)
+	}
+	if _, err := labels.Parse(o.LabelSelector); err != nil {
+		return fmt.Errorf("differentiate/list-options error: invalid label selector: %w", err)
+	}
+	return nil
+}
+
+// Apply filters, sorts and paginates the images. Repositories, which can not query their backend with all options,
+// apply the options to the images of a broader query. The images are not modified.
+func (o ListOptions) Apply(images []Image) ([]Image, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	selector, _ := labels.Parse(o.LabelSelector)
+
+	matched := make([]Image, 0, len(images))
+	for _, img := range images {
+		if o.matches(img) && selector.Matches(labels.Set(img.Workload.Labels)) {
+			matched = append(matched, img)
+		}
+	}
+
+	o.sort(matched)
+
+	if o.Offset >= len(matched) {
+		return []Image{}, nil
+	}
+	matched = matched[o.Offset:]
+	if o.Limit > 0 && o.Limit < len(matched) {
+		matched = matched[:o.Limit]
+	}
+	return matched, nil
+}
+
+func (o ListOptions) matches(img Image) bool {
+	return matchesFilter(o.ImageName, img.Name) &&
+		matchesFilter(o.Registry, img.Registry) &&
+		matchesFilter(o.Namespace, img.Workload.Namespace) &&
+		matchesFilter(o.WorkloadKind, img.Workload.Kind) &&
+		matchesFilter(o.WorkloadName, img.Workload.Name) &&
+		matchesFilter(o.Container, img.Workload.Container) &&
+		matchesFilter(o.Tag, img.Tag)
+}
+
+func matchesFilter(filter, value string) bool {
+	return filter == "" || filter == value
+}
+
+// sort orders the images by the sort field with the ID as tie-breaker, so that pages are stable
+func (o ListOptions) sort(images []Image) {
+	compare := func(a, b Image) int {
+		switch o.SortBy {
+		case SortByName:
+			return strings.Compare(a.GetNameWithRegistry(), b.GetNameWithRegistry())
+		case SortByNamespace:
+			if c := strings.Compare(a.Workload.Namespace, b.Workload.Namespace); c != 0 {
+				return c
+			}
+			return strings.Compare(a.Workload.Name, b.Workload.Name)
+		case SortByWorkload:
+			if c := strings.Compare(a.Workload.Kind, b.Workload.Kind); c != 0 {
+				return c
+			}
+			return strings.Compare(a.Workload.Name, b.Workload.Name)
+		case SortByTag:
+			return analyzing.CompareTags(a.Tag, b.Tag)
+		default:
+			return 0
+		}
+	}
+
+	sort.SliceStable(images, func(i, j int) bool {
+		c := compare(images[i], images[j])
+		if c == 0 {
+			c = strings.Compare(images[i].ID, images[j].ID)
+		}
+		if o.Descending {
+			return c > 0
+		}
+		return c < 0
+	})
+}
@@ -0,0 +1,75 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestListOptions_Apply(t *testing.T) {
+	images := []Image{
+		{ID: "b", Name: "library/nginx", Tag: "1.10.0", Workload: Workload{Labels: map[string]string{"app": "web"}}},
+		{ID: "a", Name: "library/nginx", Tag: "1.9.0", Workload: Workload{Labels: map[string]string{"app": "web"}}},
+		{ID: "c", Name: "library/redis", Tag: "6.0.9"},
+	}
+
+	tests := []struct {
+		name    string
+		opts    ListOptions
+		wantIDs []string
+		wantErr bool
+	}{
+		{name: "DefaultOrder", opts: ListOptions{}, wantIDs: []string{"a", "b", "c"}},
+		{name: "SortByTag", opts: ListOptions{ImageName: "library/nginx", SortBy: SortByTag}, wantIDs: []string{"a", "b"}},
+		{name: "LabelSelector", opts: ListOptions{LabelSelector: "app=web", Descending: true}, wantIDs: []string{"b", "a"}},
+		{name: "Page", opts: ListOptions{Offset: 1, Limit: 1}, wantIDs: []string{"b"}},
+		{name: "OffsetBeyondEnd", opts: ListOptions{Offset: 3}, wantIDs: []string{}},
+		{name: "InvalidSortField", opts: ListOptions{SortBy: "size"}, wantErr: true},
+		{name: "NegativeLimit", opts: ListOptions{Limit: -1}, wantErr: true},
+		{name: "InvalidLabelSelector", opts: ListOptions{LabelSelector: "app in (web"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.opts.Apply(images)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			ids := make([]string, 0, len(got))
+			for _, img := range got {
+				ids = append(ids, img.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("Apply() = %v, want %v", ids, tt.wantIDs)
+			}
+			if images[0].ID != "b" {
+				t.Error("Apply() modified the images")
+			}
+		})
+	}
+}
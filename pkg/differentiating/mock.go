@@ -30,6 +30,11 @@ import "context"
 type MockService struct {
 	Add, Delete, Update, ListErr func(i Image) error
 	List                         func(lo ListOptions) ([]Image, error)
+	Check                        func(registry, imageName string) bool
+	Snoozes                      []Snooze
+	Workers                      []WorkerStatus
+	HistoryEntries               []HistoryEntry
+	Outdated                     []OutdatedImage
 	ListResp                     []Image
 }
 
@@ -53,14 +58,128 @@ func (ms MockService) ListImages(_ context.Context, lo ListOptions) ([]Image, er
 	return ms.List(lo)
 }
 
+// OutdatedImages implements the Service interface, the options are applied to the images of the outdated events
+func (ms MockService) OutdatedImages(_ context.Context, lo ListOptions) ([]OutdatedImage, error) {
+	byID := make(map[string]OutdatedImage, len(ms.Outdated))
+	images := make([]Image, 0, len(ms.Outdated))
+	for _, outdated := range ms.Outdated {
+		byID[outdated.Event.Image.ID] = outdated
+		images = append(images, outdated.Event.Image)
+	}
+	lo.HasNewerTag = nil
+	images, err := lo.Apply(images)
+	if err != nil {
+		return nil, err
+	}
+	outdated := make([]OutdatedImage, 0, len(images))
+	for _, img := range images {
+		outdated = append(outdated, byID[img.ID])
+	}
+	return outdated, nil
+}
+
 // Notify implements the Service interface
-func (ms MockService) Notify(event chan<- NotificationEvent) {
+func (ms MockService) Notify(_ string, event chan<- NotificationEvent) {
 	go func() {
 		for _, img := range ms.ListResp {
 			event <- NotificationEvent{
+				Type:   EventTypeOutdated,
 				Image:  img,
 				NewTag: "187",
 			}
 		}
 	}()
 }
+
+// Subscribe implements the Service interface, the subscription receives the same events as Notify
+func (ms MockService) Subscribe(opts SubscriptionOptions) *Subscription {
+	bus := NewEventBus()
+	subscription := bus.Subscribe(opts)
+	go func() {
+		for _, img := range ms.ListResp {
+			bus.Publish(NotificationEvent{
+				Type:   EventTypeOutdated,
+				Image:  img,
+				NewTag: "187",
+			})
+		}
+	}()
+	return subscription
+}
+
+// RequestCheck implements the Service interface
+func (ms MockService) RequestCheck(registry, imageName string) bool {
+	if ms.Check == nil {
+		return false
+	}
+	return ms.Check(registry, imageName)
+}
+
+// AddSnooze implements the Service interface
+func (ms MockService) AddSnooze(snooze Snooze) (Snooze, error) {
+	return snooze, snooze.Validate()
+}
+
+// DeleteSnooze implements the Service interface
+func (ms MockService) DeleteSnooze(id string) error {
+	for _, snooze := range ms.Snoozes {
+		if snooze.ID == id {
+			return nil
+		}
+	}
+	return ErrSnoozeNotFound
+}
+
+// ListSnoozes implements the Service interface
+func (ms MockService) ListSnoozes() []Snooze {
+	return ms.Snoozes
+}
+
+// WorkerStatuses implements the Service interface
+func (ms MockService) WorkerStatuses() []WorkerStatus {
+	return ms.Workers
+}
+
+// WorkerStatus implements the Service interface
+func (ms MockService) WorkerStatus(imageName string) (WorkerStatus, error) {
+	for _, status := range ms.Workers {
+		if status.Image == imageName {
+			return status, nil
+		}
+	}
+	return WorkerStatus{}, ErrWorkerNotFound
+}
+
+// CheckNow implements the Service interface
+func (ms MockService) CheckNow(_ context.Context, imageName string) (WorkerStatus, error) {
+	if ms.Check != nil {
+		for _, status := range ms.Workers {
+			if status.Image == imageName {
+				ms.Check(status.Registry, status.Name)
+			}
+		}
+	}
+	return ms.WorkerStatus(imageName)
+}
+
+// History implements the Service interface, a nil history is disabled
+func (ms MockService) History(_ context.Context, query HistoryQuery) ([]HistoryEntry, error) {
+	if ms.HistoryEntries == nil {
+		return nil, ErrHistoryDisabled
+	}
+	return query.Apply(ms.HistoryEntries)
+}
+
+// TimeToUpdate implements the Service interface
+func (ms MockService) TimeToUpdate(ctx context.Context, query HistoryQuery) ([]TimeToUpdate, error) {
+	query.Type = HistoryTagChanged
+	query.Limit = 0
+	entries, err := ms.History(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return MeanTimeToUpdate(entries), nil
+}
+
+// Wait implements the Service interface
+func (ms MockService) Wait() {}
@@ -26,51 +26,163 @@ package differentiating
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/fwiedmann/differ/pkg/registry"
+	log "github.com/sirupsen/logrus"
 )
 
-func NewOCIRegistryService(ctx context.Context, rp Repository, workerAPIRequestSleepDuration time.Duration, initOCIAPIClientFun func(c http.Client, img registry.OciImage) OciRegistryAPIClient) Service {
+// OCIRegistryServiceOptions configures the checks of the OCIRegistryService
+type OCIRegistryServiceOptions struct {
+	Scheduler   SchedulerOptions
+	RateLimits  RateLimits
+	TagPolicies TagPolicies
+	// ReminderInterval resends the events of images which are still outdated, zero disables reminders
+	ReminderInterval time.Duration
+	// Subscription configures the subscriptions created by Notify
+	Subscription SubscriptionOptions
+	// SkewInterval between two updates of the version skew metric, defaults to 1m
+	SkewInterval time.Duration
+	// Snoozes suppress the notifications of acknowledged updates, defaults to no snoozes
+	Snoozes *Snoozes
+	// State persists the tags, notification states and snoozes beyond restarts, defaults to no persistence
+	State StateRepository
+	// History records the tag changes and notifications, defaults to no history
+	History HistoryRepository
+	// HistoryRetention of the history entries, defaults to 30 days
+	HistoryRetention time.Duration
+}
+
+func NewOCIRegistryService(ctx context.Context, rp Repository, opts OCIRegistryServiceOptions, initOCIAPIClientFun func(c http.Client, img registry.OciImage) OciRegistryAPIClient) Service {
+	limiters := newRateLimiters(opts.RateLimits, ctx.Done())
+	snoozes := opts.Snoozes
+	if snoozes == nil {
+		snoozes, _ = NewSnoozes(nil)
+	}
 	ors := &OCIRegistryService{
-		rp:                              rp,
-		registryAPIRequestSleepDuration: workerAPIRequestSleepDuration,
-		initOCIAPIClientFun:             initOCIAPIClientFun,
-		workerCtx:                       ctx,
-		workerNotification:              make(chan NotificationEvent, 100),
-		workers:                         make(map[string]*Worker),
-	}
-	go ors.multiplexToNotifiers(ctx)
+		rp:                  rp,
+		scheduler:           NewScheduler(opts.Scheduler, limiters.delay),
+		rateLimiters:        limiters,
+		initOCIAPIClientFun: initOCIAPIClientFun,
+		workerCtx:           ctx,
+		workerNotification:  make(chan NotificationEvent, 100),
+		events:              NewEventBus(),
+		subscriptionOptions: opts.Subscription,
+		workers:             make(map[string]*Worker),
+		tagPolicies:         opts.TagPolicies,
+		tracker:             NewEventTracker(opts.ReminderInterval, snoozes),
+		snoozes:             snoozes,
+		state:               opts.State,
+		restoredTags:        make(map[string]ImageTags),
+	}
+	if opts.State != nil {
+		ors.restore(ctx)
+	}
+	if opts.History != nil {
+		ors.history = NewHistoryRecorder(opts.History, opts.HistoryRetention)
+		if err := ors.history.restore(ctx); err != nil {
+			log.Errorf("differentiate/oci-service error: could not restore history: %s", err)
+		}
+		ors.goRun(func() { ors.history.run(ctx) })
+	}
+	ors.scheduler.Start(ctx)
+	ors.goRun(func() { ors.publishWorkerEvents(ctx) })
+	ors.goRun(func() { updateVersionSkewMetrics(ctx, rp, opts.SkewInterval) })
 	return ors
 }
 
 type OCIRegistryService struct {
-	registryAPIRequestSleepDuration time.Duration
-	rp                              Repository
-	workers                         map[string]*Worker
-	notifiers                       []chan<- NotificationEvent
-	workerNotification              chan NotificationEvent
-	workerMtx                       sync.Mutex
-	workerCtx                       context.Context
-	initOCIAPIClientFun             func(c http.Client, img registry.OciImage) OciRegistryAPIClient
+	rp                  Repository
+	scheduler           *Scheduler
+	rateLimiters        *rateLimiters
+	workers             map[string]*Worker
+	events              *EventBus
+	subscriptionOptions SubscriptionOptions
+	workerNotification  chan NotificationEvent
+	workerMtx           sync.Mutex
+	workerCtx           context.Context
+	initOCIAPIClientFun func(c http.Client, img registry.OciImage) OciRegistryAPIClient
+	tagPolicies         TagPolicies
+	tracker             *EventTracker
+	snoozes             *Snoozes
+	state               StateRepository
+	// restoredTags of the last checks before the restart by image name with registry, which are consumed by AddImage
+	restoredTags map[string]ImageTags
+	// history is nil if disabled
+	history *HistoryRecorder
+	// running counts the goroutines besides the scheduler which use the repositories, see Wait
+	running sync.WaitGroup
+}
+
+// goRun runs the function in a goroutine which is awaited by Wait
+func (O *OCIRegistryService) goRun(f func()) {
+	O.running.Add(1)
+	go func() {
+		defer O.running.Done()
+		f()
+	}()
+}
+
+// Wait implements the Service interface
+func (O *OCIRegistryService) Wait() {
+	O.scheduler.Wait()
+	O.running.Wait()
+}
+
+// restore loads the persisted state. Failures are logged, because the service works without it, only notifications may
+// be sent again.
+func (O *OCIRegistryService) restore(ctx context.Context) {
+	if err := O.tracker.restore(ctx, O.state); err != nil {
+		log.Errorf("differentiate/oci-service error: could not restore notification states: %s", err)
+	}
+	if err := O.snoozes.restore(ctx, O.state); err != nil {
+		log.Errorf("differentiate/oci-service error: could not restore snoozes: %s", err)
+	}
+	tags, err := O.state.ListTags(ctx)
+	if err != nil {
+		log.Errorf("differentiate/oci-service error: could not restore tags: %s", err)
+		return
+	}
+	for _, t := range tags {
+		O.restoredTags[t.Image] = t
+	}
 }
 
 func (O *OCIRegistryService) AddImage(ctx context.Context, image Image) error {
 
-	if err := O.rp.AddImage(ctx, image); err != nil {
+	err := O.rp.AddImage(ctx, image)
+	if errors.Is(err, ErrImageExists) {
+		// a persistent repository still contains the image from before the restart
+		err = O.UpdateImage(ctx, image)
+	}
+	if err != nil {
 		return err
 	}
 
-	_, found := O.workers[image.GetNameWithRegistry()]
-	if !found {
-		O.workerMtx.Lock()
+	O.workerMtx.Lock()
+	defer O.workerMtx.Unlock()
+	key := image.GetNameWithRegistry()
+	if _, found := O.workers[key]; !found {
 		httpClient := http.Client{
 			Timeout: time.Second * 10,
 		}
-		O.workers[image.GetNameWithRegistry()] = StartNewImageWorker(O.workerCtx, O.initOCIAPIClientFun(httpClient, image), image.Registry, image.Name, createRateLimitForRegistry(image.Registry), O.workerNotification, O.rp, O.registryAPIRequestSleepDuration)
-		O.workerMtx.Unlock()
+		worker := NewImageWorker(O.initOCIAPIClientFun(httpClient, image), image.Registry, image.Name, O.rateLimiters.forRegistry(image.Registry), O.workerNotification, O.rp, O.tagPolicies, O.tracker)
+		worker.state = O.state
+		O.workers[key] = worker
+
+		restored, ok := O.restoredTags[key]
+		if !ok {
+			O.scheduler.Schedule(key, image.Registry, worker.check)
+			return nil
+		}
+		delete(O.restoredTags, key)
+		worker.restoreStatus(restored)
+		O.scheduler.Resume(key, image.Registry, restored.CheckedAt, worker.check)
 	}
 	return nil
 }
@@ -83,48 +195,269 @@ func (O *OCIRegistryService) DeleteImage(ctx context.Context, image Image) error
 		return err
 	}
 	if len(images) <= 1 {
-		if worker, ok := O.workers[image.GetNameWithRegistry()]; ok {
-			worker.Stop()
-			delete(O.workers, image.GetNameWithRegistry())
+		O.scheduler.Unschedule(image.GetNameWithRegistry())
+		delete(O.workers, image.GetNameWithRegistry())
+		if !O.hasWorkerForRegistry(image.Registry) {
+			O.rateLimiters.release(image.Registry)
 		}
 	}
 	O.workerMtx.Unlock()
 
-	return O.rp.DeleteImage(ctx, image)
+	if err := O.rp.DeleteImage(ctx, image); err != nil {
+		return err
+	}
+	O.tracker.Forget(image)
+	if O.history != nil {
+		O.history.forget(image)
+	}
+	return nil
+}
+
+// RequestCheck moves the check of the worker for the image to the front of the scheduler queue, e.g. after a push
+// webhook of the registry. It reports if the image is watched.
+func (O *OCIRegistryService) RequestCheck(registry, imageName string) bool {
+	return O.scheduler.Trigger(Image{Registry: registry, Name: imageName}.GetNameWithRegistry())
+}
+
+// WorkerStatuses returns the status of all workers sorted by image
+func (O *OCIRegistryService) WorkerStatuses() []WorkerStatus {
+	O.workerMtx.Lock()
+	workers := make([]*Worker, 0, len(O.workers))
+	for _, worker := range O.workers {
+		workers = append(workers, worker)
+	}
+	O.workerMtx.Unlock()
+
+	statuses := make([]WorkerStatus, 0, len(workers))
+	for _, worker := range workers {
+		statuses = append(statuses, O.workerStatus(worker, false))
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Image < statuses[j].Image
+	})
+	return statuses
+}
+
+// WorkerStatus returns the status including the tags of the worker for the image name with registry
+func (O *OCIRegistryService) WorkerStatus(imageName string) (WorkerStatus, error) {
+	worker, err := O.worker(imageName)
+	if err != nil {
+		return WorkerStatus{}, err
+	}
+	return O.workerStatus(worker, true), nil
+}
+
+// CheckNow runs the check of the worker for the image name with registry and returns its status afterwards. A running
+// scheduled check is finished first. The check counts against the concurrency limit and the quota of the registry like
+// scheduled checks, a RegistryBusyError is returned if it has to wait. The check runs with the context of the service,
+// because its events are tracked as notified and must not be dropped with a cancelled request. The context only limits
+// the wait, after it is done the status of the still running check is returned.
+func (O *OCIRegistryService) CheckNow(ctx context.Context, imageName string) (WorkerStatus, error) {
+	worker, err := O.worker(imageName)
+	if err != nil {
+		return WorkerStatus{}, err
+	}
+	release, retryAfter := O.scheduler.Acquire(worker.registry)
+	if release == nil {
+		return WorkerStatus{}, &RegistryBusyError{Registry: worker.registry, RetryAfter: retryAfter}
+	}
+
+	done := make(chan struct{})
+	O.goRun(func() {
+		defer close(done)
+		defer release()
+		worker.check(O.workerCtx)
+	})
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	return O.workerStatus(worker, true), nil
+}
+
+func (O *OCIRegistryService) worker(imageName string) (*Worker, error) {
+	O.workerMtx.Lock()
+	defer O.workerMtx.Unlock()
+	worker, ok := O.workers[imageName]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrWorkerNotFound, imageName)
+	}
+	return worker, nil
+}
+
+func (O *OCIRegistryService) workerStatus(worker *Worker, withTags bool) WorkerStatus {
+	status := worker.Status(withTags)
+	next, running, ok := O.scheduler.NextRun(status.Image)
+	if ok && !next.IsZero() {
+		status.NextCheck = &next
+	}
+	status.Running = status.Running || running
+	return status
+}
+
+// AddSnooze implements the Service interface
+func (O *OCIRegistryService) AddSnooze(snooze Snooze) (Snooze, error) {
+	return O.snoozes.Add(snooze)
+}
+
+// DeleteSnooze implements the Service interface
+func (O *OCIRegistryService) DeleteSnooze(id string) error {
+	return O.snoozes.Delete(id)
+}
+
+// ListSnoozes implements the Service interface
+func (O *OCIRegistryService) ListSnoozes() []Snooze {
+	return O.snoozes.List()
+}
+
+// hasWorkerForRegistry has to be called with the locked worker mutex
+func (O *OCIRegistryService) hasWorkerForRegistry(registry string) bool {
+	for _, worker := range O.workers {
+		if worker.registry == registry {
+			return true
+		}
+	}
+	return false
 }
 
+// UpdateImage of the repository. If the history is enabled, a changed tag is recorded.
 func (O *OCIRegistryService) UpdateImage(ctx context.Context, image Image) error {
-	return O.rp.UpdateImage(ctx, image)
+	if O.history == nil {
+		return O.rp.UpdateImage(ctx, image)
+	}
+
+	previous, found, err := O.storedImage(ctx, image)
+	if err != nil {
+		return err
+	}
+	if err := O.rp.UpdateImage(ctx, image); err != nil {
+		return err
+	}
+	if found {
+		O.history.recordTagChange(ctx, previous, image)
+	}
+	return nil
+}
+
+// storedImage returns the stored version of the image with the same ID
+func (O *OCIRegistryService) storedImage(ctx context.Context, image Image) (Image, bool, error) {
+	images, err := O.rp.ListImages(ctx, ListOptions{ImageName: image.Name, Registry: image.Registry})
+	if err != nil {
+		return Image{}, false, err
+	}
+	for _, img := range images {
+		if img.ID == image.ID {
+			return img, true, nil
+		}
+	}
+	return Image{}, false, nil
 }
 
+// History implements the Service interface
+func (O *OCIRegistryService) History(ctx context.Context, query HistoryQuery) ([]HistoryEntry, error) {
+	if O.history == nil {
+		return nil, ErrHistoryDisabled
+	}
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	return O.history.repository.ListHistory(ctx, query)
+}
+
+// TimeToUpdate implements the Service interface
+func (O *OCIRegistryService) TimeToUpdate(ctx context.Context, query HistoryQuery) ([]TimeToUpdate, error) {
+	query.Type = HistoryTagChanged
+	query.Limit = 0
+	entries, err := O.History(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return MeanTimeToUpdate(entries), nil
+}
+
+// ListImages of the repository. The HasNewerTag option is applied with the results of the last checks, therefore the
+// pagination is applied after it.
 func (O *OCIRegistryService) ListImages(ctx context.Context, opts ListOptions) ([]Image, error) {
-	return O.rp.ListImages(ctx, opts)
+	if opts.HasNewerTag == nil {
+		return O.rp.ListImages(ctx, opts)
+	}
+
+	query := opts
+	query.HasNewerTag = nil
+	query.Offset = 0
+	query.Limit = 0
+	images, err := O.rp.ListImages(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]Image, 0, len(images))
+	for _, img := range images {
+		if O.tracker.HasNewerTag(img) == *opts.HasNewerTag {
+			matched = append(matched, img)
+		}
+	}
+	return ListOptions{SortBy: opts.SortBy, Descending: opts.Descending, Offset: opts.Offset, Limit: opts.Limit}.Apply(matched)
 }
 
-func (O *OCIRegistryService) Notify(event chan<- NotificationEvent) {
-	O.notifiers = append(O.notifiers, event)
+// OutdatedImages lists the images with a newer tag. The events contain the listed images, because the images of the
+// tracked events are only updated on the next check.
+func (O *OCIRegistryService) OutdatedImages(ctx context.Context, opts ListOptions) ([]OutdatedImage, error) {
+	hasNewerTag := true
+	opts.HasNewerTag = &hasNewerTag
+	images, err := O.ListImages(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	outdated := make([]OutdatedImage, 0, len(images))
+	for _, img := range images {
+		// the image may have been resolved in the meantime
+		image, ok := O.tracker.Outdated(img)
+		if !ok {
+			continue
+		}
+		image.Event.Type = EventTypeOutdated
+		image.Event.Image = img
+		if O.history != nil {
+			image.OutdatedSince = O.history.since(img.ID)
+		}
+		outdated = append(outdated, image)
+	}
+	return outdated, nil
 }
 
-func (O *OCIRegistryService) multiplexToNotifiers(ctx context.Context) {
-	notifyContext, cancel := context.WithCancel(ctx)
+// Notify forwards the events of a subscription with the configured SubscriptionOptions to the channel. The name
+// identifies the subscription in the dropped events metric. The channel is closed when the service shuts down.
+func (O *OCIRegistryService) Notify(name string, event chan<- NotificationEvent) {
+	opts := O.subscriptionOptions
+	opts.Name = name
+	subscription := O.events.Subscribe(opts)
+	go func() {
+		for e := range subscription.Events() {
+			event <- e
+		}
+		close(event)
+	}()
+}
+
+// Subscribe implements the Service interface
+func (O *OCIRegistryService) Subscribe(opts SubscriptionOptions) *Subscription {
+	return O.events.Subscribe(opts)
+}
+
+// publishWorkerEvents publishes the events of all workers until the context is done, then the event bus is closed
+func (O *OCIRegistryService) publishWorkerEvents(ctx context.Context) {
 	for {
 		select {
 		case event := <-O.workerNotification:
-			for _, ch := range O.notifiers {
-				go func(ch chan<- NotificationEvent) {
-					ch <- event
-				}(ch)
+			if O.history != nil {
+				O.history.recordEvent(ctx, event)
 			}
-		case <-notifyContext.Done():
-			cancel()
-			closeChannels(O.notifiers)
+			O.events.Publish(event)
+		case <-ctx.Done():
+			O.events.Close()
 			return
 		}
 	}
 }
-
-func closeChannels(c []chan<- NotificationEvent) {
-	for _, ch := range c {
-		close(ch)
-	}
-}
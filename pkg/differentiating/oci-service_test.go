@@ -26,6 +26,7 @@ package differentiating
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
@@ -107,7 +108,7 @@ func TestNewOCIRegistryService(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			svc := NewOCIRegistryService(tt.args.ctx, tt.args.rp, tt.args.dur, tt.args.initOCIAPIClientFun)
+			svc := NewOCIRegistryService(tt.args.ctx, tt.args.rp, OCIRegistryServiceOptions{Scheduler: SchedulerOptions{Interval: tt.args.dur}}, tt.args.initOCIAPIClientFun)
 			_, ok := svc.(*OCIRegistryService)
 			if !ok {
 				t.Errorf("NewOCIRegistryService() = returned service is not the type of OCIRegistryService")
@@ -124,7 +125,6 @@ func TestOCIRegistryService_AddImage(t *testing.T) {
 	type fields struct {
 		rp                  Repository
 		workers             map[string]*Worker
-		notifiers           []chan<- NotificationEvent
 		workerNotification  chan NotificationEvent
 		workerMtx           sync.Mutex
 		workerCtx           context.Context
@@ -150,7 +150,6 @@ func TestOCIRegistryService_AddImage(t *testing.T) {
 			fields: fields{
 				rp:                  rp,
 				workers:             make(map[string]*Worker),
-				notifiers:           make([]chan<- NotificationEvent, 0),
 				workerNotification:  make(chan NotificationEvent),
 				workerMtx:           sync.Mutex{},
 				workerCtx:           workerCtx,
@@ -198,7 +197,6 @@ func TestOCIRegistryService_AddImage(t *testing.T) {
 					addErr: fmt.Errorf("error"),
 				},
 				workers:             make(map[string]*Worker),
-				notifiers:           make([]chan<- NotificationEvent, 0),
 				workerNotification:  make(chan NotificationEvent),
 				workerMtx:           sync.Mutex{},
 				workerCtx:           workerCtx,
@@ -228,11 +226,14 @@ func TestOCIRegistryService_AddImage(t *testing.T) {
 			O := &OCIRegistryService{
 				rp:                  tt.fields.rp,
 				workers:             tt.fields.workers,
-				notifiers:           tt.fields.notifiers,
+				events:              NewEventBus(),
 				workerNotification:  tt.fields.workerNotification,
 				workerMtx:           tt.fields.workerMtx, //nolint
 				workerCtx:           tt.fields.workerCtx,
 				initOCIAPIClientFun: tt.fields.initOCIAPIClientFun,
+				scheduler:           NewScheduler(SchedulerOptions{}, nil),
+				rateLimiters:        newRateLimiters(RateLimits{}, nil),
+				tracker:             NewEventTracker(0, nil),
 			}
 			for _, i := range tt.args.images {
 				if err := O.AddImage(tt.args.ctx, i); (err != nil) != tt.want.err {
@@ -251,7 +252,6 @@ func TestOCIRegistryService_DeleteImage(t *testing.T) {
 	type fields struct {
 		rp                  Repository
 		workers             map[string]*Worker
-		notifiers           []chan<- NotificationEvent
 		workerNotification  chan NotificationEvent
 		workerMtx           sync.Mutex
 		initOCIAPIClientFun func(c http.Client, img registry.OciImage) OciRegistryAPIClient
@@ -276,7 +276,6 @@ func TestOCIRegistryService_DeleteImage(t *testing.T) {
 			name: "RemainWorkerCount",
 			fields: fields{
 				workers:             make(map[string]*Worker),
-				notifiers:           make([]chan<- NotificationEvent, 0),
 				workerNotification:  make(chan NotificationEvent),
 				workerMtx:           sync.Mutex{},
 				initOCIAPIClientFun: initAPIClientFun,
@@ -301,7 +300,6 @@ func TestOCIRegistryService_DeleteImage(t *testing.T) {
 			name: "DecreaseWorkerCount",
 			fields: fields{
 				workers:             make(map[string]*Worker),
-				notifiers:           make([]chan<- NotificationEvent, 0),
 				workerNotification:  make(chan NotificationEvent),
 				workerMtx:           sync.Mutex{},
 				initOCIAPIClientFun: initAPIClientFun,
@@ -326,7 +324,6 @@ func TestOCIRegistryService_DeleteImage(t *testing.T) {
 			name: "RepositoryDeleteError",
 			fields: fields{
 				workers:             make(map[string]*Worker),
-				notifiers:           make([]chan<- NotificationEvent, 0),
 				workerNotification:  make(chan NotificationEvent),
 				workerMtx:           sync.Mutex{},
 				initOCIAPIClientFun: initAPIClientFun,
@@ -351,7 +348,6 @@ func TestOCIRegistryService_DeleteImage(t *testing.T) {
 			name: "RepositoryListError",
 			fields: fields{
 				workers:             make(map[string]*Worker),
-				notifiers:           make([]chan<- NotificationEvent, 0),
 				workerNotification:  make(chan NotificationEvent),
 				workerMtx:           sync.Mutex{},
 				initOCIAPIClientFun: initAPIClientFun,
@@ -380,11 +376,14 @@ func TestOCIRegistryService_DeleteImage(t *testing.T) {
 			O := &OCIRegistryService{
 				rp:                  tt.fields.rp,
 				workers:             tt.fields.workers,
-				notifiers:           tt.fields.notifiers,
+				events:              NewEventBus(),
 				workerNotification:  tt.fields.workerNotification,
 				workerMtx:           tt.fields.workerMtx, //nolint
 				workerCtx:           ctx,
 				initOCIAPIClientFun: tt.fields.initOCIAPIClientFun,
+				scheduler:           NewScheduler(SchedulerOptions{}, nil),
+				rateLimiters:        newRateLimiters(RateLimits{}, nil),
+				tracker:             NewEventTracker(0, nil),
 			}
 
 			for _, i := range ociServiceTestImages {
@@ -401,8 +400,8 @@ func TestOCIRegistryService_DeleteImage(t *testing.T) {
 				t.Errorf("DeleteImage() Missmatch of desired worker count = want %d, got %d", tt.want.workerCount, len(O.workers))
 			}
 
-			for _, w := range O.workers {
-				go w.Stop()
+			if tt.want.workerCount != O.scheduler.Len() {
+				t.Errorf("DeleteImage() Missmatch of desired scheduled checks = want %d, got %d", tt.want.workerCount, O.scheduler.Len())
 			}
 
 			cancel()
@@ -415,7 +414,6 @@ func TestOCIRegistryService_UpdateImage(t *testing.T) {
 	type fields struct {
 		rp                  Repository
 		workers             map[string]*Worker
-		notifiers           []chan<- NotificationEvent
 		workerNotification  chan NotificationEvent
 		workerMtx           sync.Mutex
 		workerCtx           context.Context
@@ -460,11 +458,14 @@ func TestOCIRegistryService_UpdateImage(t *testing.T) {
 			O := &OCIRegistryService{
 				rp:                  tt.fields.rp,
 				workers:             tt.fields.workers,
-				notifiers:           tt.fields.notifiers,
+				events:              NewEventBus(),
 				workerNotification:  tt.fields.workerNotification,
 				workerMtx:           tt.fields.workerMtx, //nolint
 				workerCtx:           tt.fields.workerCtx,
 				initOCIAPIClientFun: tt.fields.initOCIAPIClientFun,
+				scheduler:           NewScheduler(SchedulerOptions{}, nil),
+				rateLimiters:        newRateLimiters(RateLimits{}, nil),
+				tracker:             NewEventTracker(0, nil),
 			}
 			if err := O.UpdateImage(tt.args.ctx, tt.args.image); (err != nil) != tt.wantErr {
 				t.Errorf("UpdateImage() error = %v, wantErr %v", err, tt.wantErr)
@@ -477,7 +478,6 @@ func TestOCIRegistryService_ListImages(t *testing.T) {
 	type fields struct {
 		rp                  Repository
 		workers             map[string]*Worker
-		notifiers           []chan<- NotificationEvent
 		workerNotification  chan NotificationEvent
 		workerMtx           sync.Mutex
 		workerCtx           context.Context
@@ -520,11 +520,14 @@ func TestOCIRegistryService_ListImages(t *testing.T) {
 			O := &OCIRegistryService{
 				rp:                  tt.fields.rp,
 				workers:             tt.fields.workers,
-				notifiers:           tt.fields.notifiers,
+				events:              NewEventBus(),
 				workerNotification:  tt.fields.workerNotification,
 				workerMtx:           tt.fields.workerMtx, //nolint
 				workerCtx:           tt.fields.workerCtx,
 				initOCIAPIClientFun: tt.fields.initOCIAPIClientFun,
+				scheduler:           NewScheduler(SchedulerOptions{}, nil),
+				rateLimiters:        newRateLimiters(RateLimits{}, nil),
+				tracker:             NewEventTracker(0, nil),
 			}
 			got, err := O.ListImages(tt.args.ctx, tt.args.opts)
 			if (err != nil) != tt.wantErr {
@@ -571,8 +574,8 @@ func TestOCIRegistryService_Notify(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ctx, cancel := context.WithCancel(context.Background())
-			ociService := NewOCIRegistryService(ctx, tt.fields.rp, tt.fields.dur, tt.fields.initOCIAPIClientFun)
-			ociService.Notify(tt.args.event)
+			ociService := NewOCIRegistryService(ctx, tt.fields.rp, OCIRegistryServiceOptions{Scheduler: SchedulerOptions{Interval: tt.fields.dur}}, tt.fields.initOCIAPIClientFun)
+			ociService.Notify("test", tt.args.event)
 
 			val, ok := ociService.(*OCIRegistryService)
 			if !ok {
@@ -596,3 +599,179 @@ func TestOCIRegistryService_Notify(t *testing.T) {
 
 	}
 }
+
+func TestOCIRegistryService_RequestCheck(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	svc := NewOCIRegistryService(ctx, repositoryMock{}, OCIRegistryServiceOptions{Scheduler: SchedulerOptions{Interval: time.Hour}}, initAPIClientFun)
+	if err := svc.AddImage(ctx, ociServiceTestImages[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	if !svc.RequestCheck("gitlab.com", "differ") {
+		t.Errorf("RequestCheck() did not find the worker of the added image")
+	}
+	if svc.RequestCheck("gitlab.com", "health") {
+		t.Errorf("RequestCheck() reported an image which is not watched")
+	}
+}
+
+func TestOCIRegistryService_CheckNow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	svc := NewOCIRegistryService(ctx, repositoryMock{images: []Image{ociServiceTestImages[2]}}, OCIRegistryServiceOptions{Scheduler: SchedulerOptions{Interval: time.Hour}}, initAPIClientFun)
+	if err := svc.AddImage(ctx, ociServiceTestImages[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := svc.WorkerStatus("gitlab.com/differ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.LastCheck != nil || status.NextCheck == nil {
+		t.Errorf("WorkerStatus() = %+v, want an unchecked worker with a scheduled check", status)
+	}
+
+	status, err = svc.CheckNow(ctx, "gitlab.com/differ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.LastSuccess == nil || status.TagCount == 0 {
+		t.Errorf("CheckNow() = %+v, want a successful check with tags", status)
+	}
+
+	if statuses := svc.WorkerStatuses(); len(statuses) != 1 || statuses[0].Tags != nil {
+		t.Errorf("WorkerStatuses() = %+v, want one status without tags", statuses)
+	}
+
+	if _, err := svc.CheckNow(ctx, "gitlab.com/health"); !errors.Is(err, ErrWorkerNotFound) {
+		t.Errorf("CheckNow() error = %v, want ErrWorkerNotFound", err)
+	}
+
+	// the check outlives a cancelled request
+	requestCtx, cancelRequest := context.WithCancel(ctx)
+	cancelRequest()
+	lastSuccess := *status.LastSuccess
+	if _, err := svc.CheckNow(requestCtx, "gitlab.com/differ"); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		status, err = svc.WorkerStatus("gitlab.com/differ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.LastSuccess != nil && status.LastSuccess.After(lastSuccess) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("CheckNow() with cancelled context did not finish the check: %+v", status)
+		}
+	}
+}
+
+func TestOCIRegistryService_restore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	state := newStateRepositoryMock()
+	checkedAt := time.Now().Add(-time.Minute)
+	state.tags["gitlab.com/differ"] = ImageTags{Image: "gitlab.com/differ", Tags: []string{"1.0.0", "1.1.0"}, Credential: credentialAnonymous, CheckedAt: checkedAt}
+	state.snoozes["a1"] = Snooze{ID: "a1", Image: "gitlab.com/differ", Tag: "1.1.0"}
+
+	// the persistent repository still contains the image from before the restart
+	rp := repositoryMock{addErr: fmt.Errorf("storage: %w", ErrImageExists)}
+	svc := NewOCIRegistryService(ctx, rp, OCIRegistryServiceOptions{Scheduler: SchedulerOptions{Interval: time.Hour}, State: state}, initAPIClientFun)
+	if err := svc.AddImage(ctx, ociServiceTestImages[2]); err != nil {
+		t.Fatalf("AddImage() of a persisted image error = %v", err)
+	}
+
+	status, err := svc.WorkerStatus("gitlab.com/differ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.TagCount != 2 || status.LastSuccess == nil || !status.LastSuccess.Equal(checkedAt) {
+		t.Errorf("WorkerStatus() = %+v, want the restored tags", status)
+	}
+	if status.NextCheck == nil || time.Until(*status.NextCheck) < time.Minute*30 {
+		t.Errorf("WorkerStatus() next check = %v, want about one interval after the restored check", status.NextCheck)
+	}
+
+	if snoozes := svc.ListSnoozes(); len(snoozes) != 1 || snoozes[0].ID != "a1" {
+		t.Errorf("ListSnoozes() = %+v, want the restored snooze", snoozes)
+	}
+	if err := svc.DeleteSnooze("a1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := state.snoozes["a1"]; ok {
+		t.Error("DeleteSnooze() did not delete the persisted snooze")
+	}
+}
+
+func TestOCIRegistryService_ListImages_HasNewerTag(t *testing.T) {
+	tracker := NewEventTracker(0, nil)
+	outdated := ociServiceTestImages[0]
+	labels := []string{outdated.Workload.Cluster, outdated.GetNameWithRegistry(), outdated.GetRegistryURL(), outdated.Tag, "2.0", "2.0", "", "", "semver"}
+	tracker.Track(outdated, NotificationEvent{Image: outdated, NewTag: "2.0", LatestTag: "2.0"}, true, labels)
+	svc := &OCIRegistryService{rp: repositoryMock{images: ociServiceTestImages}, tracker: tracker}
+
+	yes, no := true, false
+	tests := []struct {
+		name    string
+		opts    ListOptions
+		wantIDs []string
+	}{
+		{name: "HasNewerTag", opts: ListOptions{HasNewerTag: &yes}, wantIDs: []string{"1"}},
+		{name: "HasNoNewerTag", opts: ListOptions{HasNewerTag: &no}, wantIDs: []string{"2", "3", "4"}},
+		{name: "HasNoNewerTagPage", opts: ListOptions{HasNewerTag: &no, Offset: 1, Limit: 1, Descending: true}, wantIDs: []string{"3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images, err := svc.ListImages(context.Background(), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, img := range images {
+				ids = append(ids, img.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("ListImages() = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestOCIRegistryService_UpdateImage_history(t *testing.T) {
+	ctx := context.Background()
+	history := &historyRepositoryMock{}
+	now := time.Now()
+	svc := &OCIRegistryService{
+		rp:      repositoryMock{images: ociServiceTestImages},
+		tracker: NewEventTracker(0, nil),
+		history: newTestHistoryRecorder(history, &now),
+	}
+
+	updated := ociServiceTestImages[0]
+	updated.Tag = "2.0"
+	if err := svc.UpdateImage(ctx, updated); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.UpdateImage(ctx, ociServiceTestImages[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := svc.History(ctx, HistoryQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Type != HistoryTagChanged || entries[0].OldTag != "1.8" || entries[0].NewTag != "2.0" {
+		t.Errorf("History() = %+v, want the tag change of image 1", entries)
+	}
+
+	disabled := &OCIRegistryService{rp: repositoryMock{}}
+	if _, err := disabled.History(ctx, HistoryQuery{}); !errors.Is(err, ErrHistoryDisabled) {
+		t.Errorf("History() without history error = %v, want ErrHistoryDisabled", err)
+	}
+}
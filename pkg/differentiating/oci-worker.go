@@ -29,7 +29,6 @@ import (
 	"errors"
 	"fmt"
 	"sync"
-	"time"
 
 	"github.com/fwiedmann/differ/pkg/monitoring"
 
@@ -42,88 +41,91 @@ import (
 
 type OciRegistryAPIClient interface {
 	GetTagsForImage(ctx context.Context, secret registry.OciPullSecret) ([]string, error)
+	GetDigestForTag(ctx context.Context, secret registry.OciPullSecret, tag string) (string, error)
 }
 
 type ListImagesRepository interface {
 	ListImages(ctx context.Context, opts ListOptions) ([]Image, error)
 }
 
-func StartNewImageWorker(ctx context.Context, client OciRegistryAPIClient, registry, imageName string, rateLimiter ratelimit.Limiter, info chan<- NotificationEvent, repository ListImagesRepository, workerAPIRequestSleepDuration time.Duration) *Worker {
-	newWorker := Worker{
-		client:                  client,
-		registry:                registry,
-		imageName:               imageName,
-		rp:                      repository,
-		mutex:                   sync.RWMutex{},
-		informChan:              info,
-		rateLimiter:             rateLimiter,
-		stop:                    make(chan struct{}),
-		apiRequestSleepDuration: workerAPIRequestSleepDuration,
-	}
-	go newWorker.startRunning(ctx)
-	return &newWorker
+// NewImageWorker creates a worker, which checks all stored images with the given registry and name for newer tags.
+// The checks are triggered by the Scheduler, events are only sent on state transitions recorded by the EventTracker.
+func NewImageWorker(client OciRegistryAPIClient, registry, imageName string, rateLimiter ratelimit.Limiter, info chan<- NotificationEvent, repository ListImagesRepository, tagPolicies TagPolicies, tracker *EventTracker) *Worker {
+	return &Worker{
+		client:      client,
+		registry:    registry,
+		imageName:   imageName,
+		rp:          repository,
+		mutex:       sync.RWMutex{},
+		informChan:  info,
+		rateLimiter: rateLimiter,
+		tagPolicies: tagPolicies,
+		pins:        make(map[string]string),
+		pinMisses:   make(map[string]string),
+		tracker:     tracker,
+	}
 }
 
 type Worker struct {
-	imageName               string
-	registry                string
-	rp                      ListImagesRepository
-	mutex                   sync.RWMutex
-	informChan              chan<- NotificationEvent
-	rateLimiter             ratelimit.Limiter
-	client                  OciRegistryAPIClient
-	stop                    chan struct{}
-	apiRequestSleepDuration time.Duration
-}
-
-func (w *Worker) Stop() {
-	w.stop <- struct{}{}
-	close(w.stop)
+	imageName   string
+	registry    string
+	rp          ListImagesRepository
+	mutex       sync.RWMutex
+	informChan  chan<- NotificationEvent
+	rateLimiter ratelimit.Limiter
+	client      OciRegistryAPIClient
+	tagPolicies TagPolicies
+	// pins caches the pinned tag for the manifest digest of floating tags
+	pins map[string]string
+	// pinMisses caches the newest candidate requested for the digest of floating tags without a pinned tag
+	pinMisses map[string]string
+	pinsMutex sync.Mutex
+	tracker   *EventTracker
+	// status of the last check, see Status
+	status      workerStatus
+	statusMutex sync.RWMutex
+	// state persists the tags of successful checks if set
+	state StateRepository
 }
 
-func (w *Worker) startRunning(ctx context.Context) {
-	imageWorkerCtx, cancel := context.WithCancel(ctx)
+// check requests the tags of the image once and sends events for all stored images with a newer tag. Concurrent checks
+// of the same worker, e.g. a scheduled one and CheckNow, run one after another.
+func (w *Worker) check(ctx context.Context) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
 
-	for {
-		select {
-		case <-imageWorkerCtx.Done():
-			cancel()
-			return
-		case <-w.stop:
-			cancel()
-			return
-		default:
-			time.Sleep(w.apiRequestSleepDuration)
-			images, err := w.rp.ListImages(imageWorkerCtx, ListOptions{
-				ImageName: w.imageName,
-				Registry:  w.registry,
-			})
-
-			if err != nil {
-				log.Error(err)
-				continue
-			}
+	w.startCheck()
+	images, err := w.rp.ListImages(ctx, ListOptions{
+		ImageName: w.imageName,
+		Registry:  w.registry,
+	})
 
-			if len(images) == 0 {
-				continue
-			}
+	if err != nil {
+		w.finishCheck(nil, "", 0, err)
+		log.Error(err)
+		return
+	}
 
-			w.mutex.RLock()
+	if len(images) == 0 {
+		w.finishCheck(nil, "", 0, nil)
+		return
+	}
 
-			tags, err := w.requestTagsFromAPIWithAllStoredObjects(ctx, images)
-			if err != nil {
-				w.updateOCIRegistryMetrics(err)
-				log.Warnf(err.Error())
-				w.mutex.RUnlock()
-				continue
-			}
-			w.sendEventForEachStoredObjectIfNewerTagExits(tags, images)
-			w.mutex.RUnlock()
-		}
+	tags, secret, err := w.requestTagsFromAPIWithAllStoredObjects(ctx, images)
+	if err != nil {
+		w.finishCheck(nil, "", len(images), err)
+		w.updateOCIRegistryMetrics(err)
+		log.Warnf(err.Error())
+		return
 	}
+	w.finishCheck(tags, credentialRef(secret), len(images), nil)
+	w.persistTags(ctx)
+	w.sendEventForEachStoredObjectIfNewerTagExits(ctx, tags, images)
+	w.recommendPinForEachFloatingTag(ctx, tags, images)
 }
 
-func (w *Worker) requestTagsFromAPIWithAllStoredObjects(ctx context.Context, imgs []Image) ([]string, error) {
+// requestTagsFromAPIWithAllStoredObjects returns the tags and the pull secret of the first successful request
+func (w *Worker) requestTagsFromAPIWithAllStoredObjects(ctx context.Context, imgs []Image) ([]string, *PullSecret, error) {
 	var imageName string
 	var latestError error
 	for _, img := range imgs {
@@ -131,33 +133,33 @@ func (w *Worker) requestTagsFromAPIWithAllStoredObjects(ctx context.Context, img
 		if len(img.Auth) == 0 {
 			tags, err := w.requestTagsWithRateLimit(ctx, nil)
 			if err == nil {
-				return tags, nil
+				return tags, nil, nil
 			}
 			latestError = err
 			continue
 		}
 
-		tags, err := w.requestTagsFromAPIWithSecrets(ctx, img.Auth)
+		tags, secret, err := w.requestTagsFromAPIWithSecrets(ctx, img.Auth)
 		if err == nil {
-			return tags, nil
+			return tags, secret, nil
 		}
 		latestError = err
 	}
-	return nil, fmt.Errorf("differentiate/oci-worker error: could not fetch any tags for Image %s, error: %w", imageName, latestError)
+	return nil, nil, fmt.Errorf("differentiate/oci-worker error: could not fetch any tags for Image %s, error: %w", imageName, latestError)
 }
 
-func (w *Worker) requestTagsFromAPIWithSecrets(ctx context.Context, secrets []*PullSecret) ([]string, error) {
+func (w *Worker) requestTagsFromAPIWithSecrets(ctx context.Context, secrets []*PullSecret) ([]string, *PullSecret, error) {
 	for i, secret := range secrets {
 		tags, err := w.requestTagsWithRateLimit(ctx, secret)
 		if err != nil {
 			if i == len(secrets)-1 {
-				return nil, err
+				return nil, nil, err
 			}
 			continue
 		}
-		return tags, nil
+		return tags, secret, nil
 	}
-	return nil, fmt.Errorf("differentiate/oci-worker error: no pull secrets provided to request")
+	return nil, nil, fmt.Errorf("differentiate/oci-worker error: no pull secrets provided to request")
 }
 
 func (w *Worker) requestTagsWithRateLimit(ctx context.Context, s *PullSecret) ([]string, error) {
@@ -165,30 +167,59 @@ func (w *Worker) requestTagsWithRateLimit(ctx context.Context, s *PullSecret) ([
 	return w.client.GetTagsForImage(ctx, s)
 }
 
-func (w *Worker) sendEventForEachStoredObjectIfNewerTagExits(allTagsFromRegistry []string, imgs []Image) {
+// sendEventForEachStoredObjectIfNewerTagExits analyzes and tracks the images one after another within the check, so
+// that the tracked state is complete when the check returns. It stops when the service shuts down.
+func (w *Worker) sendEventForEachStoredObjectIfNewerTagExits(ctx context.Context, allTagsFromRegistry []string, imgs []Image) {
 	for _, img := range imgs {
-		go w.sendEventForStoredObjectIfNewerTagExits(img, allTagsFromRegistry)
+		if ctx.Err() != nil {
+			return
+		}
+		w.sendEventForStoredObjectIfNewerTagExits(ctx, img, allTagsFromRegistry)
 	}
 }
 
-func (w *Worker) sendEventForStoredObjectIfNewerTagExits(img Image, allTagsFromRegistry []string) {
-	tagExpr, err := tagsanalyzer.GetExactRegexExprForTag(img.Tag)
+func (w *Worker) sendEventForStoredObjectIfNewerTagExits(ctx context.Context, img Image, allTagsFromRegistry []string) {
+	policy, err := w.tagPolicies.PolicyFor(img)
 	if err != nil {
-		log.Errorf("differentiate/oci-worker error: could not get a tag expression for Image %s with tag %s", img.GetNameWithRegistry(), img.Tag)
+		log.Error(err)
 		return
 	}
 
-	latestTag, err := tagsanalyzer.GetLatestTagWithRegexExpr(allTagsFromRegistry, tagExpr)
+	result, err := tagsanalyzer.Analyze(img.Tag, allTagsFromRegistry, policy)
 	if err != nil {
-		log.Errorf("differentiate/oci-worker error: %s", err)
+		log.Errorf("differentiate/oci-worker error: could not analyze tags for Image %s with tag %s: %s", img.GetNameWithRegistry(), img.Tag, err)
+		return
 	}
 
-	if img.Tag == latestTag {
+	isOutdated := result.IsOutdated() || result.IsBlockedByConstraint() || result.HasVariantUpdate()
+	labels := []string{img.Workload.Cluster, img.GetNameWithRegistry(), img.GetRegistryURL(), img.Tag, result.Latest, result.LatestUnconstrained, result.LatestVariant, policy.Constraint.String(), result.Expression}
+	event, send := w.tracker.Track(img, NotificationEvent{
+		Image:         img,
+		OldTag:        img.Tag,
+		NewTag:        result.Latest,
+		LatestTag:     result.LatestUnconstrained,
+		NewVariantTag: result.LatestVariant,
+		Bump:          result.Bump,
+		Candidates:    result.Candidates,
+		Age:           result.Age,
+	}, isOutdated, labels)
+	if !send {
 		return
 	}
+	if w.inform(ctx, event) {
+		w.tracker.Notified(img)
+	}
+}
 
-	monitoring.OciImageNewerTagAvailableMetric.WithLabelValues(img.GetNameWithRegistry(), img.GetRegistryURL(), img.Tag, latestTag, tagExpr.String()).Set(1)
-	w.informChan <- NotificationEvent{Image: img, NewTag: latestTag}
+// inform sends the event to the service and reports if it was accepted. Pending events are discarded when the service
+// shuts down.
+func (w *Worker) inform(ctx context.Context, event NotificationEvent) bool {
+	select {
+	case w.informChan <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
 func (w *Worker) updateOCIRegistryMetrics(err error) {
@@ -61,14 +61,26 @@ func (r repositoryMock) ListImages(_ context.Context, _ ListOptions) ([]Image, e
 }
 
 type ociAPIClientMOCK struct {
-	tags []string
-	err  error
+	tags    []string
+	digests map[string]string
+	err     error
 }
 
 func (o ociAPIClientMOCK) GetTagsForImage(_ context.Context, _ registry.OciPullSecret) ([]string, error) {
 	return o.tags, o.err
 }
 
+func (o ociAPIClientMOCK) GetDigestForTag(_ context.Context, _ registry.OciPullSecret, tag string) (string, error) {
+	if o.err != nil {
+		return "", o.err
+	}
+	digest, ok := o.digests[tag]
+	if !ok {
+		return "", fmt.Errorf("registries/api error: 404")
+	}
+	return digest, nil
+}
+
 var (
 	imageRemoteTags  = []string{"1.0.0", "2.0.0", "3.0.0"}
 	imageWithoutAuth = Image{
@@ -104,168 +116,252 @@ var (
 	}
 	rl       = ratelimit.New(5)
 	infoChan = make(chan NotificationEvent)
+	tracker  = NewEventTracker(0, nil)
 )
 
-func TestStartNewImageWorker(t *testing.T) {
-
-	type args struct {
-		client      OciRegistryAPIClient
-		registry    string
-		imageName   string
-		rateLimiter ratelimit.Limiter
-		info        chan NotificationEvent
-		repository  ListImagesRepository
-		dur         time.Duration
+func TestNewImageWorker(t *testing.T) {
+	worker := NewImageWorker(ociAPIMock, imageWithoutAuth.Registry, imageWithoutAuth.Name, rl, infoChan, rpWithoutAuthMockMock, TagPolicies{}, tracker)
+	want := &Worker{
+		imageName:   imageWithoutAuth.Name,
+		registry:    imageWithoutAuth.Registry,
+		rp:          rpWithoutAuthMockMock,
+		mutex:       sync.RWMutex{},
+		informChan:  infoChan,
+		rateLimiter: rl,
+		client:      ociAPIMock,
+		pins:        make(map[string]string),
+		pinMisses:   make(map[string]string),
+		tracker:     tracker,
+	}
+	if !reflect.DeepEqual(worker, want) {
+		t.Errorf("NewImageWorker() = %+v, want %+v", worker, want)
 	}
+}
+
+func TestWorker_check(t *testing.T) {
 	tests := []struct {
-		name string
-		args args
-		want *Worker
+		name       string
+		client     OciRegistryAPIClient
+		repository ListImagesRepository
+		wantEvent  bool
 	}{
 		{
-			name: "ImageWithoutAuth",
-			args: args{
-				client:      ociAPIMock,
-				registry:    imageWithoutAuth.Registry,
-				imageName:   imageWithoutAuth.Name,
-				rateLimiter: rl,
-				info:        infoChan,
-				repository:  rpWithoutAuthMockMock,
-			},
-			want: &Worker{
-				imageName:   imageWithoutAuth.Name,
-				registry:    imageWithoutAuth.Registry,
-				rp:          rpWithoutAuthMockMock,
-				mutex:       sync.RWMutex{},
-				informChan:  infoChan,
-				rateLimiter: rl,
-				client:      ociAPIMock,
-			},
+			name:       "ImageWithoutAuth",
+			client:     ociAPIMock,
+			repository: rpWithoutAuthMockMock,
+			wantEvent:  true,
 		},
 		{
-			name: "ImageWithoutAuthAPIError",
-			args: args{
-				client:      ociAPIErrorMock,
-				registry:    imageWithoutAuth.Registry,
-				imageName:   imageWithoutAuth.Name,
-				rateLimiter: rl,
-				info:        infoChan,
-				repository:  rpWithoutAuthMockMock,
-			},
-			want: &Worker{
-				imageName:   imageWithoutAuth.Name,
-				registry:    imageWithoutAuth.Registry,
-				rp:          rpWithoutAuthMockMock,
-				mutex:       sync.RWMutex{},
-				informChan:  infoChan,
-				rateLimiter: rl,
-				client:      ociAPIErrorMock,
-			},
+			name:       "ImageWithoutAuthAPIError",
+			client:     ociAPIErrorMock,
+			repository: rpWithoutAuthMockMock,
+			wantEvent:  false,
 		},
 		{
-			name: "ImageWithAuth",
-			args: args{
-				client:      ociAPIMock,
-				registry:    imageWithAuth.Registry,
-				imageName:   imageWithAuth.Name,
-				rateLimiter: rl,
-				info:        infoChan,
-				repository:  rpWithAuthMockMock,
-			},
-			want: &Worker{
-				imageName:   imageWithAuth.Name,
-				registry:    imageWithAuth.Registry,
-				rp:          rpWithAuthMockMock,
-				mutex:       sync.RWMutex{},
-				informChan:  infoChan,
-				rateLimiter: rl,
-				client:      ociAPIMock,
-			},
+			name:       "ImageWithAuth",
+			client:     ociAPIMock,
+			repository: rpWithAuthMockMock,
+			wantEvent:  true,
 		},
 		{
-			name: "ImageWithAuthAPIError",
-			args: args{
-				client:      ociAPIErrorMock,
-				registry:    imageWithAuth.Registry,
-				imageName:   imageWithAuth.Name,
-				rateLimiter: rl,
-				info:        infoChan,
-				repository:  rpWithAuthMockMock,
-			},
-			want: &Worker{
-				imageName:   imageWithAuth.Name,
-				registry:    imageWithAuth.Registry,
-				rp:          rpWithAuthMockMock,
-				mutex:       sync.RWMutex{},
-				informChan:  infoChan,
-				rateLimiter: rl,
-				client:      ociAPIErrorMock,
-			},
+			name:       "ImageWithAuthAPIError",
+			client:     ociAPIErrorMock,
+			repository: rpWithAuthMockMock,
+			wantEvent:  false,
+		},
+		{
+			name:       "RepositoryError",
+			client:     ociAPIMock,
+			repository: repositoryMock{listErr: fmt.Errorf("error")},
+			wantEvent:  false,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			ctx, cancel := context.WithCancel(context.Background())
-			worker := StartNewImageWorker(ctx, tt.args.client, tt.args.registry, tt.args.imageName, tt.args.rateLimiter, tt.args.info, tt.args.repository, tt.args.dur)
-			tt.want.stop = worker.stop
-			if !reflect.DeepEqual(worker, tt.want) {
-				t.Errorf("StartNewImageWorker() = %+v, want %+v", worker, tt.want)
+			info := make(chan NotificationEvent, 1)
+			worker := NewImageWorker(tt.client, imageWithoutAuth.Registry, imageWithoutAuth.Name, rl, info, tt.repository, TagPolicies{}, NewEventTracker(0, nil))
+			worker.check(context.Background())
+
+			select {
+			case event := <-info:
+				if !tt.wantEvent {
+					t.Errorf("check() sent unexpected event %+v", event)
+				}
+				if event.NewTag != "3.0.0" {
+					t.Errorf("check() new tag = %s, want 3.0.0", event.NewTag)
+				}
+			case <-time.After(time.Millisecond * 100):
+				if tt.wantEvent {
+					t.Errorf("check() did not send an event")
+				}
 			}
-			<-tt.args.info
-			cancel()
 		})
 	}
 }
 
-func TestWorker_Stop(t *testing.T) {
-	type fields struct {
-		imageName   string
-		registry    string
-		rp          ListImagesRepository
-		mutex       sync.RWMutex
-		informChan  chan<- NotificationEvent
-		rateLimiter ratelimit.Limiter
-		client      OciRegistryAPIClient
-		stop        chan struct{}
+func TestWorker_check_shutdown(t *testing.T) {
+	state := newStateRepositoryMock()
+	tracker := NewEventTracker(0, nil)
+	if err := tracker.restore(context.Background(), state); err != nil {
+		t.Fatal(err)
 	}
-	tests := []struct {
-		name   string
-		fields fields
+	info := make(chan NotificationEvent)
+	worker := NewImageWorker(ociAPIMock, imageWithoutAuth.Registry, imageWithoutAuth.Name, rl, info, rpWithoutAuthMockMock, TagPolicies{}, tracker)
+
+	// nobody reads the event before the shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*50, cancel)
+	worker.check(ctx)
+	if !tracker.HasNewerTag(imageWithoutAuth) {
+		t.Fatal("check() returned before the image was tracked")
+	}
+	if _, ok := state.states[imageWithoutAuth.ID]; ok {
+		t.Fatal("check() persisted the state of an event which was not sent")
+	}
+
+	// the restarted worker sends the event again
+	restarted := NewEventTracker(0, nil)
+	if err := restarted.restore(context.Background(), state); err != nil {
+		t.Fatal(err)
+	}
+	info = make(chan NotificationEvent, 1)
+	worker = NewImageWorker(ociAPIMock, imageWithoutAuth.Registry, imageWithoutAuth.Name, rl, info, rpWithoutAuthMockMock, TagPolicies{}, restarted)
+	worker.check(context.Background())
+	select {
+	case event := <-info:
+		if event.Type != EventTypeOutdated {
+			t.Errorf("check() after restart sent %s event, want %s", event.Type, EventTypeOutdated)
+		}
+	default:
+		t.Fatal("check() after restart did not send the event")
+	}
+	if _, ok := state.states[imageWithoutAuth.ID]; !ok {
+		t.Error("check() did not persist the state of the sent event")
+	}
+}
+
+func TestWorker_check_keepsSlot(t *testing.T) {
+	info := make(chan NotificationEvent)
+	worker := NewImageWorker(ociAPIMock, imageWithoutAuth.Registry, imageWithoutAuth.Name, rl, info, rpWithoutAuthMockMock, TagPolicies{}, NewEventTracker(0, nil))
+
+	// the scheduler releases the slot of the check when it returns, so it must not return before its event was sent
+	done := make(chan struct{})
+	go func() {
+		worker.check(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("check() returned before the event was sent")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	<-info
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("check() did not return after the event was sent")
+	}
+}
+
+func TestWorker_check_transitions(t *testing.T) {
+	client := &ociAPIClientMOCK{tags: []string{"1.0.0", "2.0.0"}}
+	info := make(chan NotificationEvent, 1)
+	worker := NewImageWorker(client, imageWithoutAuth.Registry, imageWithoutAuth.Name, rl, info, rpWithoutAuthMockMock, TagPolicies{}, NewEventTracker(0, nil))
+
+	updated := imageWithoutAuth
+	updated.Tag = "3.0.0"
+	steps := []struct {
+		name     string
+		tags     []string
+		image    Image
+		wantType EventType
+		wantNew  string
 	}{
-		{
-			name: "ValidWorkerStop",
-			fields: fields{
-				imageName:   imageWithoutAuth.Name,
-				registry:    imageWithoutAuth.Registry,
-				rp:          rpWithoutAuthMockMock,
-				mutex:       sync.RWMutex{},
-				informChan:  infoChan,
-				rateLimiter: rl,
-				client:      ociAPIMock,
-				stop:        make(chan struct{}),
-			},
-		},
+		{name: "Outdated", tags: []string{"1.0.0", "2.0.0"}, image: imageWithoutAuth, wantType: EventTypeOutdated, wantNew: "2.0.0"},
+		{name: "Unchanged", tags: []string{"1.0.0", "2.0.0"}, image: imageWithoutAuth},
+		{name: "Changed", tags: []string{"1.0.0", "2.0.0", "3.0.0"}, image: imageWithoutAuth, wantType: EventTypeChanged, wantNew: "3.0.0"},
+		{name: "Resolved", tags: []string{"1.0.0", "2.0.0", "3.0.0"}, image: updated, wantType: EventTypeResolved, wantNew: "3.0.0"},
 	}
-	for _, tt := range tests { //nolint
-		t.Run(tt.name, func(t *testing.T) {
-			w := &Worker{
-				imageName:   tt.fields.imageName,
-				registry:    tt.fields.registry,
-				rp:          tt.fields.rp,
-				mutex:       tt.fields.mutex, //nolint
-				informChan:  tt.fields.informChan,
-				rateLimiter: tt.fields.rateLimiter,
-				client:      tt.fields.client,
-				stop:        tt.fields.stop,
-			}
-			go w.Stop()
+	// each check tracks its images before it returns, so the transitions follow the order of the checks
+	for _, step := range steps {
+		*client = ociAPIClientMOCK{tags: step.tags}
+		worker.rp = repositoryMock{images: []Image{step.image}}
+		worker.check(context.Background())
 
-			select {
-			case <-time.After(time.Second * 5):
-				t.Errorf("Worker did not send stop signal")
-			case <-w.stop:
-				return
+		select {
+		case event := <-info:
+			if step.wantType == "" {
+				t.Fatalf("%s: check() sent unexpected event %+v", step.name, event)
 			}
-		})
+			if event.Type != step.wantType || event.NewTag != step.wantNew {
+				t.Errorf("%s: check() sent %s event with new tag %s, want %s with %s", step.name, event.Type, event.NewTag, step.wantType, step.wantNew)
+			}
+		default:
+			if step.wantType != "" {
+				t.Fatalf("%s: check() did not send the %s event", step.name, step.wantType)
+			}
+		}
+	}
+}
+
+type countingOciAPIClientMOCK struct {
+	ociAPIClientMOCK
+	digestRequests int
+}
+
+func (c *countingOciAPIClientMOCK) GetDigestForTag(ctx context.Context, secret registry.OciPullSecret, tag string) (string, error) {
+	c.digestRequests++
+	return c.ociAPIClientMOCK.GetDigestForTag(ctx, secret, tag)
+}
+
+func TestWorker_resolvePin(t *testing.T) {
+	client := &countingOciAPIClientMOCK{ociAPIClientMOCK: ociAPIClientMOCK{
+		digests: map[string]string{
+			"latest": "sha256:b",
+			"1.19.3": "sha256:b",
+			"1.19.2": "sha256:a",
+			"1.19":   "sha256:b",
+		},
+	}}
+	w := &Worker{client: client, rateLimiter: ratelimit.NewUnlimited(), pins: make(map[string]string), pinMisses: make(map[string]string)}
+	img := Image{Registry: "docker.io", Name: "library/nginx", Tag: "latest"}
+	candidates := []string{"1.19.3", "1.19.2", "1.19"}
+
+	pin, err := w.resolvePin(context.Background(), img, candidates)
+	if err != nil {
+		t.Fatalf("resolvePin() error = %v", err)
+	}
+	if want := (PinRecommendation{Tag: "1.19.3", Digest: "sha256:b"}); *pin != want {
+		t.Errorf("resolvePin() = %+v, want %+v", *pin, want)
+	}
+
+	client.digestRequests = 0
+	if _, err := w.resolvePin(context.Background(), img, candidates); err != nil {
+		t.Fatalf("resolvePin() error = %v", err)
+	}
+	if client.digestRequests != 1 {
+		t.Errorf("resolvePin() requested %d digests for an unchanged floating tag, want 1", client.digestRequests)
+	}
+
+	client.digests["latest"] = "sha256:c"
+	client.digestRequests = 0
+	if pin, err := w.resolvePin(context.Background(), img, candidates); err != nil || pin != nil {
+		t.Errorf("resolvePin() = %v, %v, want no pin if no candidate has the digest of the floating tag", pin, err)
+	}
+	if pin, err := w.resolvePin(context.Background(), img, candidates); err != nil || pin != nil {
+		t.Errorf("resolvePin() = %v, %v, want no pin for a cached miss", pin, err)
+	}
+	if client.digestRequests != len(candidates)+2 {
+		t.Errorf("resolvePin() requested %d digests, want %d for a cached miss", client.digestRequests, len(candidates)+2)
+	}
+
+	client.digests["1.19.4"] = "sha256:c"
+	pin, err = w.resolvePin(context.Background(), img, append([]string{"1.19.4"}, candidates...))
+	if err != nil {
+		t.Fatalf("resolvePin() error = %v", err)
+	}
+	if pin == nil || pin.Tag != "1.19.4" {
+		t.Errorf("resolvePin() = %v, want 1.19.4 once a newer candidate is available", pin)
 	}
 }
@@ -0,0 +1,140 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"context"
+
+	tagsanalyzer "github.com/fwiedmann/differ/pkg/analyzing"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxPinCandidates limits the digest requests to resolve a floating tag, the newest candidates are requested first
+const maxPinCandidates = 20
+
+// recommendPinForEachFloatingTag resolves each distinct floating tag of the stored images once. The recommendation of
+// images without a floating tag or without a pinned tag is cleared, it is kept if the digests could not be requested.
+func (w *Worker) recommendPinForEachFloatingTag(ctx context.Context, allTagsFromRegistry []string, imgs []Image) {
+	resolved := make(map[string]*PinRecommendation)
+	failed := make(map[string]bool)
+	for _, img := range imgs {
+		candidates := tagsanalyzer.PinCandidates(img.Tag, allTagsFromRegistry)
+		if candidates == nil {
+			w.tracker.ClearPin(img)
+			continue
+		}
+
+		pin, ok := resolved[img.Tag]
+		if !ok && !failed[img.Tag] {
+			var err error
+			pin, err = w.resolvePin(ctx, img, candidates)
+			if err != nil {
+				log.Warnf("differentiate/pin-recommendation error: could not resolve floating tag %s of Image %s: %s", img.Tag, img.GetNameWithRegistry(), err)
+				failed[img.Tag] = true
+			} else {
+				resolved[img.Tag] = pin
+			}
+		}
+		if failed[img.Tag] {
+			continue
+		}
+		if pin == nil {
+			w.tracker.ClearPin(img)
+			continue
+		}
+
+		event, send := w.tracker.TrackPin(img, *pin, []string{img.Workload.Cluster, img.GetNameWithRegistry(), img.GetRegistryURL(), img.Tag, pin.Tag, pin.Digest})
+		if !send {
+			continue
+		}
+		if w.inform(ctx, event) {
+			w.tracker.Notified(img)
+		}
+	}
+}
+
+// resolvePin compares the manifest digest of the floating tag with the digests of the candidates. It returns nil if no
+// candidate has the digest. The result for a digest is cached, so an unchanged floating tag costs a single request. A
+// miss is requested again once a newer candidate is available.
+func (w *Worker) resolvePin(ctx context.Context, img Image, candidates []string) (*PinRecommendation, error) {
+	digest, err := w.requestDigestWithRateLimit(ctx, img.Auth, img.Tag)
+	if err != nil {
+		return nil, err
+	}
+
+	w.pinsMutex.Lock()
+	pinned, ok := w.pins[digest]
+	newestMiss, missed := w.pinMisses[digest]
+	w.pinsMutex.Unlock()
+	if ok {
+		return &PinRecommendation{Tag: pinned, Digest: digest}, nil
+	}
+	if missed && newestMiss == candidates[0] {
+		return nil, nil
+	}
+
+	if len(candidates) > maxPinCandidates {
+		candidates = candidates[:maxPinCandidates]
+	}
+	for _, candidate := range candidates {
+		candidateDigest, err := w.requestDigestWithRateLimit(ctx, img.Auth, candidate)
+		if err != nil {
+			return nil, err
+		}
+		if candidateDigest != digest {
+			continue
+		}
+
+		w.pinsMutex.Lock()
+		w.pins[digest] = candidate
+		delete(w.pinMisses, digest)
+		w.pinsMutex.Unlock()
+		return &PinRecommendation{Tag: candidate, Digest: digest}, nil
+	}
+
+	log.Debugf("differentiate/pin-recommendation: no tag of Image %s has the digest %s of floating tag %s", img.GetNameWithRegistry(), digest, img.Tag)
+	w.pinsMutex.Lock()
+	w.pinMisses[digest] = candidates[0]
+	w.pinsMutex.Unlock()
+	return nil, nil
+}
+
+func (w *Worker) requestDigestWithRateLimit(ctx context.Context, secrets []*PullSecret, tag string) (string, error) {
+	if len(secrets) == 0 {
+		w.rateLimiter.Take()
+		return w.client.GetDigestForTag(ctx, nil, tag)
+	}
+
+	var latestError error
+	for _, secret := range secrets {
+		w.rateLimiter.Take()
+		digest, err := w.client.GetDigestForTag(ctx, secret, tag)
+		if err == nil {
+			return digest, nil
+		}
+		latestError = err
+	}
+	return "", latestError
+}
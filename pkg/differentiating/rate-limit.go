@@ -26,23 +26,214 @@ package differentiating
 
 import (
 	"sync"
+	"time"
 
+	"github.com/fwiedmann/differ/pkg/monitoring"
 	"go.uber.org/ratelimit"
 )
 
-var (
-	registryRateLimits    = make(map[string]ratelimit.Limiter)
-	registryRateLimitsMtx = sync.Mutex{}
-)
+// DefaultQuotaWindow is used if a quota is configured without a window
+const DefaultQuotaWindow = time.Hour * 24
+
+// RateLimit of a registry. RequestsPerSecond limits bursts, the optional Quota limits the requests per QuotaWindow.
+// Requests within the quota are spread evenly across the window.
+type RateLimit struct {
+	RequestsPerSecond int
+	Quota             int
+	QuotaWindow       time.Duration
+}
+
+// RateLimits holds the rate limit per registry URL. Registries without an entry use the default.
+type RateLimits struct {
+	Default    RateLimit
+	Registries map[string]RateLimit
+}
+
+func (r RateLimits) forRegistry(registry string) RateLimit {
+	if limit, ok := r.Registries[registry]; ok {
+		return limit
+	}
+	return r.Default
+}
 
-func createRateLimitForRegistry(registry string) ratelimit.Limiter {
-	registryRateLimitsMtx.Lock()
-	if rl, found := registryRateLimits[registry]; found {
-		registryRateLimitsMtx.Unlock()
+// rateLimiters creates one limiter per registry, which is shared by all workers of the registry
+type rateLimiters struct {
+	limits     RateLimits
+	mutex      sync.Mutex
+	registries map[string]*registryLimiter
+	// done ends the waits for the request budgets when the service shuts down
+	done <-chan struct{}
+}
+
+func newRateLimiters(limits RateLimits, done <-chan struct{}) *rateLimiters {
+	return &rateLimiters{
+		limits:     limits,
+		registries: make(map[string]*registryLimiter),
+		done:       done,
+	}
+}
+
+func (r *rateLimiters) forRegistry(registry string) *registryLimiter {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if rl, found := r.registries[registry]; found {
 		return rl
 	}
-	rl := ratelimit.New(1)
-	registryRateLimits[registry] = rl
-	registryRateLimitsMtx.Unlock()
+	rl := newRegistryLimiter(registry, r.limits.forRegistry(registry), r.done)
+	r.registries[registry] = rl
+	return rl
+}
+
+// release removes the limiter of a registry, which is no longer requested by any worker
+func (r *rateLimiters) release(registry string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.registries, registry)
+	monitoring.OciRegistryRequestBudgetRemainingMetric.DeleteLabelValues(registry)
+}
+
+// delay returns how long the next check of the registry has to wait to stay within its quota
+func (r *rateLimiters) delay(registry string) time.Duration {
+	r.mutex.Lock()
+	rl, found := r.registries[registry]
+	r.mutex.Unlock()
+
+	if !found || rl.budget == nil {
+		return 0
+	}
+	return rl.budget.delay(time.Now())
+}
+
+// registryLimiter implements the ratelimit.Limiter interface and consumes the request budget of the registry on each request
+type registryLimiter struct {
+	registry string
+	limiter  ratelimit.Limiter
+	budget   *requestBudget
+	done     <-chan struct{}
+}
+
+func newRegistryLimiter(registry string, limit RateLimit, done <-chan struct{}) *registryLimiter {
+	rl := &registryLimiter{
+		registry: registry,
+		limiter:  ratelimit.NewUnlimited(),
+		done:     done,
+	}
+	if limit.RequestsPerSecond > 0 {
+		rl.limiter = ratelimit.New(limit.RequestsPerSecond)
+	}
+	if limit.Quota > 0 {
+		window := limit.QuotaWindow
+		if window <= 0 {
+			window = DefaultQuotaWindow
+		}
+		rl.budget = newRequestBudget(limit.Quota, window)
+		monitoring.OciRegistryRequestBudgetRemainingMetric.WithLabelValues(registry).Set(float64(limit.Quota))
+	}
 	return rl
 }
+
+// Take blocks until the rate limit and the request budget allow the next request and consumes the request budget. The
+// scheduler delays the checks of a registry with a used up budget, but a single check may send several requests, e.g.
+// per pull secret or for the digests of a floating tag. The wait for the budget ends without consuming it when the
+// service shuts down, the request is cancelled by its context then.
+func (rl *registryLimiter) Take() time.Time {
+	now := rl.limiter.Take()
+	if rl.budget == nil {
+		return now
+	}
+	for {
+		wait, remaining := rl.budget.take(now)
+		if wait <= 0 {
+			monitoring.OciRegistryRequestBudgetRemainingMetric.WithLabelValues(rl.registry).Set(float64(remaining))
+			return now
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case now = <-timer.C:
+		case <-rl.done:
+			timer.Stop()
+			return time.Now()
+		}
+	}
+}
+
+// requestBudget allows quota requests per fixed window. The requests are spaced evenly, so the budget is not used up at
+// the beginning of the window.
+type requestBudget struct {
+	mutex       sync.Mutex
+	quota       int
+	window      time.Duration
+	spacing     time.Duration
+	windowStart time.Time
+	used        int
+	next        time.Time
+}
+
+func newRequestBudget(quota int, window time.Duration) *requestBudget {
+	return &requestBudget{
+		quota:   quota,
+		window:  window,
+		spacing: window / time.Duration(quota),
+	}
+}
+
+// take records a request if it is within the budget and returns the remaining budget of the current window. Otherwise
+// it returns the duration until the request is within the budget, so the quota is never exceeded.
+func (b *requestBudget) take(now time.Time) (time.Duration, int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.resetExpiredWindow(now)
+	if wait := b.delayLocked(now); wait > 0 {
+		return wait, b.remainingLocked()
+	}
+	b.used++
+	if b.next.Before(now) {
+		b.next = now
+	}
+	b.next = b.next.Add(b.spacing)
+	return 0, b.remainingLocked()
+}
+
+// delay returns the duration until the next request is within the budget
+func (b *requestBudget) delay(now time.Time) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.resetExpiredWindow(now)
+	return b.delayLocked(now)
+}
+
+func (b *requestBudget) delayLocked(now time.Time) time.Duration {
+	if b.used >= b.quota {
+		return b.windowStart.Add(b.window).Sub(now)
+	}
+	if b.next.After(now) {
+		return b.next.Sub(now)
+	}
+	return 0
+}
+
+func (b *requestBudget) remaining(now time.Time) int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.resetExpiredWindow(now)
+	return b.remainingLocked()
+}
+
+func (b *requestBudget) remainingLocked() int {
+	if b.used >= b.quota {
+		return 0
+	}
+	return b.quota - b.used
+}
+
+func (b *requestBudget) resetExpiredWindow(now time.Time) {
+	if b.windowStart.IsZero() || !now.Before(b.windowStart.Add(b.window)) {
+		b.windowStart = now
+		b.used = 0
+	}
+}
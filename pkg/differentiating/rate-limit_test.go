@@ -0,0 +1,132 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequestBudget(t *testing.T) {
+	now := time.Date(2020, time.October, 12, 10, 0, 0, 0, time.UTC)
+	b := newRequestBudget(4, time.Hour)
+
+	if d := b.delay(now); d != 0 {
+		t.Errorf("delay() of an unused budget = %v, want 0", d)
+	}
+
+	if wait, remaining := b.take(now); wait != 0 || remaining != 3 {
+		t.Errorf("take() = %v, %d, want 0, 3", wait, remaining)
+	}
+	if d := b.delay(now); d != time.Minute*15 {
+		t.Errorf("delay() after a request = %v, want the spacing of 15m", d)
+	}
+
+	if wait, _ := b.take(now.Add(time.Minute * 5)); wait != time.Minute*10 {
+		t.Errorf("take() before the spacing = %v, want a wait of 10m", wait)
+	}
+	for i := 0; i < 3; i++ {
+		if wait, _ := b.take(now.Add(time.Minute * 15 * time.Duration(i+1))); wait != 0 {
+			t.Errorf("take() %d = %v, want no wait", i, wait)
+		}
+	}
+	if remaining := b.remaining(now.Add(time.Minute * 50)); remaining != 0 {
+		t.Errorf("remaining() of a used up budget = %d, want 0", remaining)
+	}
+	if d := b.delay(now.Add(time.Minute * 50)); d != time.Minute*10 {
+		t.Errorf("delay() of a used up budget = %v, want the end of the window in 10m", d)
+	}
+	if wait, remaining := b.take(now.Add(time.Minute * 50)); wait != time.Minute*10 || remaining != 0 {
+		t.Errorf("take() of a used up budget = %v, %d, want a wait of 10m without consuming", wait, remaining)
+	}
+
+	if remaining := b.remaining(now.Add(time.Hour)); remaining != 4 {
+		t.Errorf("remaining() in a new window = %d, want 4", remaining)
+	}
+}
+
+func TestRateLimiters(t *testing.T) {
+	limiters := newRateLimiters(RateLimits{
+		Default: RateLimit{RequestsPerSecond: 1},
+		Registries: map[string]RateLimit{
+			"docker.io": {RequestsPerSecond: 1, Quota: 100, QuotaWindow: time.Hour * 6},
+		},
+	}, nil)
+
+	harbor := limiters.forRegistry("harbor.internal")
+	if harbor != limiters.forRegistry("harbor.internal") {
+		t.Errorf("forRegistry() created a second limiter for the same registry")
+	}
+	if harbor.budget != nil {
+		t.Errorf("forRegistry() created a budget for a registry without quota")
+	}
+
+	dockerHub := limiters.forRegistry("docker.io")
+	if dockerHub.budget == nil || dockerHub.budget.spacing != time.Second*216 {
+		t.Fatalf("forRegistry() did not spread the quota of 100 requests across 6h")
+	}
+
+	dockerHub.Take()
+	if d := limiters.delay("docker.io"); d <= 0 || d > time.Second*216 {
+		t.Errorf("delay() = %v, want at most the spacing of 216s", d)
+	}
+	if d := limiters.delay("harbor.internal"); d != 0 {
+		t.Errorf("delay() of a registry without quota = %v, want 0", d)
+	}
+
+	limiters.release("docker.io")
+	if _, found := limiters.registries["docker.io"]; found {
+		t.Errorf("release() did not remove the limiter")
+	}
+}
+
+func TestRegistryLimiter_Take(t *testing.T) {
+	rl := newRegistryLimiter("docker.io", RateLimit{Quota: 2, QuotaWindow: time.Millisecond * 200}, nil)
+
+	start := time.Now()
+	rl.Take()
+	rl.Take()
+	if elapsed := time.Since(start); elapsed < time.Millisecond*90 {
+		t.Errorf("Take() of the second request returned after %v, want the spacing of 100ms", elapsed)
+	}
+	// the third request waits for the next window instead of exceeding the quota
+	rl.Take()
+	if elapsed := time.Since(start); elapsed < time.Millisecond*190 {
+		t.Errorf("Take() of a used up budget returned after %v, want the end of the window after 200ms", elapsed)
+	}
+	if used := rl.budget.used; used != 1 {
+		t.Errorf("Take() used %d requests of the new window, want 1", used)
+	}
+
+	done := make(chan struct{})
+	close(done)
+	rl = newRegistryLimiter("docker.io", RateLimit{Quota: 1, QuotaWindow: time.Hour}, done)
+	rl.Take()
+	start = time.Now()
+	rl.Take()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Take() waited %v for the budget after the shutdown", elapsed)
+	}
+}
@@ -24,7 +24,13 @@
 
 package differentiating
 
-import "context"
+import (
+	"context"
+	"errors"
+)
+
+// ErrImageExists is returned by AddImage if an image with the same ID is already stored
+var ErrImageExists = errors.New("image already exists")
 
 type Repository interface {
 	AddImage(ctx context.Context, image Image) error
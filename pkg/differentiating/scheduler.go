@@ -0,0 +1,478 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"container/heap"
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSchedulerFetchers is the default size of the fetcher pool
+	DefaultSchedulerFetchers = 10
+	// DefaultSchedulerRegistryConcurrency is the default limit of concurrent checks per registry
+	DefaultSchedulerRegistryConcurrency = 2
+	// DefaultSchedulerJitter is the default jitter factor of the check interval
+	DefaultSchedulerJitter = 0.1
+
+	// registryBusyDelay is the retry after of Acquire if the registry has reached the concurrency limit
+	registryBusyDelay = time.Millisecond * 250
+)
+
+// SchedulerOptions configures the Scheduler. Zero values are replaced by the defaults.
+type SchedulerOptions struct {
+	// Interval between two checks of the same image
+	Interval time.Duration
+	// Jitter is the factor of the interval by which each check is randomly moved to avoid synchronized request bursts
+	Jitter float64
+	// Fetchers is the number of checks which run concurrently
+	Fetchers int
+	// RegistryConcurrency is the number of checks which run concurrently against the same registry
+	RegistryConcurrency int
+	// RegistryIntervals override the interval per registry, e.g. with a long safety net interval for registries whose
+	// pushes trigger the checks via webhooks
+	RegistryIntervals map[string]time.Duration
+}
+
+func (o SchedulerOptions) withDefaults() SchedulerOptions {
+	if o.Interval <= 0 {
+		o.Interval = time.Second * 5
+	}
+	if o.Jitter <= 0 {
+		o.Jitter = DefaultSchedulerJitter
+	}
+	if o.Fetchers <= 0 {
+		o.Fetchers = DefaultSchedulerFetchers
+	}
+	if o.RegistryConcurrency <= 0 {
+		o.RegistryConcurrency = DefaultSchedulerRegistryConcurrency
+	}
+	return o
+}
+
+// Scheduler runs periodic checks from a priority queue of next check times with a bounded pool of fetchers.
+// Adding and removing checks only mutates the queue, no goroutine is started per check. A check keeps its fetcher and
+// its registry slot until it returns, so it must not leave work running in the background.
+type Scheduler struct {
+	opts     SchedulerOptions
+	delay    func(registry string) time.Duration
+	mutex    sync.Mutex
+	queue    scheduleQueue
+	items    map[string]*scheduleItem
+	inFlight map[string]int
+	// parked holds the due checks per registry which wait for a free slot, see release
+	parked map[string][]*scheduleItem
+	random *rand.Rand
+	wake   chan struct{}
+	jobs   chan *scheduleItem
+	// running counts the dispatcher and the fetchers, see Wait
+	running sync.WaitGroup
+}
+
+type scheduleItem struct {
+	key      string
+	registry string
+	check    func(ctx context.Context)
+	next     time.Time
+	// index in the queue or -1 if the item is dispatched or parked
+	index   int
+	removed bool
+	// parked until a check of the registry finished
+	parked bool
+	// triggered runs the check again right after the running one
+	triggered bool
+}
+
+// NewScheduler creates a scheduler, which has to be started with Start. The optional delay function postpones the checks
+// of a registry, e.g. to spread them across the window of a request quota.
+func NewScheduler(opts SchedulerOptions, delay func(registry string) time.Duration) *Scheduler {
+	return &Scheduler{
+		opts:     opts.withDefaults(),
+		delay:    delay,
+		items:    make(map[string]*scheduleItem),
+		inFlight: make(map[string]int),
+		parked:   make(map[string][]*scheduleItem),
+		random:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		wake:     make(chan struct{}, 1),
+		jobs:     make(chan *scheduleItem),
+	}
+}
+
+// Start the dispatcher and the fetcher pool until the context is done
+func (s *Scheduler) Start(ctx context.Context) {
+	s.running.Add(s.opts.Fetchers + 1)
+	for i := 0; i < s.opts.Fetchers; i++ {
+		go func() {
+			defer s.running.Done()
+			s.fetch(ctx)
+		}()
+	}
+	go func() {
+		defer s.running.Done()
+		s.dispatch(ctx)
+	}()
+}
+
+// Wait blocks until the dispatcher and all running checks returned after the context of Start is done
+func (s *Scheduler) Wait() {
+	s.running.Wait()
+}
+
+// Schedule adds a periodic check for the key. The first check runs within the jitter of the interval. If the key is
+// already scheduled only its check function is replaced.
+func (s *Scheduler) Schedule(key, registry string, check func(ctx context.Context)) {
+	s.Resume(key, registry, time.Time{}, check)
+}
+
+// Resume adds a periodic check like Schedule, but the first check runs one interval after the last run, e.g. before a
+// restart, if that is later than the first check of Schedule.
+func (s *Scheduler) Resume(key, registry string, lastRun time.Time, check func(ctx context.Context)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if item, ok := s.items[key]; ok {
+		item.check = check
+		return
+	}
+
+	next := time.Now().Add(s.randomDuration(s.jitterRange(s.opts.Interval)))
+	if !lastRun.IsZero() {
+		interval := s.interval(registry)
+		jitter := s.jitterRange(interval)
+		if resumed := lastRun.Add(interval + s.randomDuration(2*jitter) - jitter); resumed.After(next) {
+			next = resumed
+		}
+	}
+
+	item := &scheduleItem{
+		key:      key,
+		registry: registry,
+		check:    check,
+		next:     next,
+	}
+	s.items[key] = item
+	heap.Push(&s.queue, item)
+	s.notify()
+}
+
+// Unschedule removes the check for the key. A running check is finished, but not scheduled again.
+func (s *Scheduler) Unschedule(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	item, ok := s.items[key]
+	if !ok {
+		return
+	}
+	item.removed = true
+	delete(s.items, key)
+	if item.index >= 0 {
+		heap.Remove(&s.queue, item.index)
+	}
+	if item.parked {
+		s.unpark(item)
+	}
+	s.notify()
+}
+
+// Trigger moves the check for the key to the front of the queue. If the check is running, it runs again after it
+// finished. It reports if the key is scheduled.
+func (s *Scheduler) Trigger(key string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	item, ok := s.items[key]
+	if !ok {
+		return false
+	}
+	if item.parked {
+		// the check is due already and runs as soon as its registry has a free slot
+		return true
+	}
+	if item.index < 0 {
+		item.triggered = true
+		return true
+	}
+	item.next = time.Now()
+	heap.Fix(&s.queue, item.index)
+	s.notify()
+	return true
+}
+
+// NextRun returns the next check time of the key and if its check is running. A running check has no next check time
+// until it finished, a check which waits for a free slot of its registry returns its past due time. ok reports if the
+// key is scheduled.
+func (s *Scheduler) NextRun(key string) (next time.Time, running bool, ok bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	item, ok := s.items[key]
+	if !ok {
+		return time.Time{}, false, false
+	}
+	if item.index < 0 && !item.parked {
+		return time.Time{}, true, true
+	}
+	return item.next, false, true
+}
+
+// Acquire reserves a slot of the registry for a check outside of the schedule, e.g. an on-demand check, with the same
+// concurrency limit and delay as the scheduled checks. If the registry is busy, it returns the time after which a retry
+// may succeed instead of the release function. The release function has to be called after the check.
+func (s *Scheduler) Acquire(registry string) (release func(), retryAfter time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.delay != nil {
+		if d := s.delay(registry); d > 0 {
+			return nil, d
+		}
+	}
+	if s.inFlight[registry] >= s.opts.RegistryConcurrency {
+		return nil, registryBusyDelay
+	}
+	s.inFlight[registry]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			s.release(registry)
+		})
+	}, 0
+}
+
+// Len returns the number of scheduled checks
+func (s *Scheduler) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.items)
+}
+
+func (s *Scheduler) dispatch(ctx context.Context) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		s.mutex.Lock()
+		wait := time.Hour
+		var due *scheduleItem
+		if len(s.queue) > 0 {
+			if untilNext := time.Until(s.queue[0].next); untilNext > 0 {
+				wait = untilNext
+			} else {
+				due = heap.Pop(&s.queue).(*scheduleItem)
+			}
+		}
+		s.mutex.Unlock()
+
+		if due != nil {
+			select {
+			case s.jobs <- due:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+func (s *Scheduler) fetch(ctx context.Context) {
+	for {
+		select {
+		case item := <-s.jobs:
+			s.run(ctx, item)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, item *scheduleItem) {
+	s.mutex.Lock()
+	if item.removed {
+		s.mutex.Unlock()
+		return
+	}
+	if s.delay != nil {
+		if d := s.delay(item.registry); d > 0 {
+			s.reschedule(item, time.Now().Add(d))
+			s.mutex.Unlock()
+			return
+		}
+	}
+	if s.inFlight[item.registry] >= s.opts.RegistryConcurrency {
+		item.parked = true
+		s.parked[item.registry] = append(s.parked[item.registry], item)
+		s.mutex.Unlock()
+		return
+	}
+	s.inFlight[item.registry]++
+	check := item.check
+	s.mutex.Unlock()
+
+	check(ctx)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.release(item.registry)
+	if item.removed {
+		return
+	}
+	if item.triggered {
+		item.triggered = false
+		s.reschedule(item, time.Now())
+		return
+	}
+	interval := s.interval(item.registry)
+	jitter := s.jitterRange(interval)
+	s.reschedule(item, time.Now().Add(interval+s.randomDuration(2*jitter)-jitter))
+}
+
+// release frees a slot of the registry and moves the longest parked check of the registry back to the front of the
+// queue. It has to be called with the locked mutex.
+func (s *Scheduler) release(registry string) {
+	s.inFlight[registry]--
+	if s.inFlight[registry] <= 0 {
+		delete(s.inFlight, registry)
+	}
+
+	parked := s.parked[registry]
+	if len(parked) == 0 {
+		return
+	}
+	item := parked[0]
+	parked[0] = nil
+	if len(parked) == 1 {
+		delete(s.parked, registry)
+	} else {
+		s.parked[registry] = parked[1:]
+	}
+	item.parked = false
+	s.reschedule(item, item.next)
+}
+
+// unpark removes an unscheduled item from the parked checks and has to be called with the locked mutex
+func (s *Scheduler) unpark(item *scheduleItem) {
+	parked := s.parked[item.registry]
+	for i, p := range parked {
+		if p != item {
+			continue
+		}
+		parked = append(parked[:i], parked[i+1:]...)
+		break
+	}
+	if len(parked) == 0 {
+		delete(s.parked, item.registry)
+	} else {
+		s.parked[item.registry] = parked
+	}
+	item.parked = false
+}
+
+func (s *Scheduler) interval(registry string) time.Duration {
+	if interval, ok := s.opts.RegistryIntervals[registry]; ok && interval > 0 {
+		return interval
+	}
+	return s.opts.Interval
+}
+
+// reschedule has to be called with the locked mutex
+func (s *Scheduler) reschedule(item *scheduleItem, next time.Time) {
+	item.next = next
+	heap.Push(&s.queue, item)
+	s.notify()
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) jitterRange(interval time.Duration) time.Duration {
+	return time.Duration(float64(interval) * s.opts.Jitter)
+}
+
+// randomDuration returns a random duration in [0, max) and has to be called with the locked mutex
+func (s *Scheduler) randomDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(s.random.Int63n(int64(max)))
+}
+
+// scheduleQueue is a min heap of the next check times
+type scheduleQueue []*scheduleItem
+
+func (q scheduleQueue) Len() int {
+	return len(q)
+}
+
+func (q scheduleQueue) Less(i, j int) bool {
+	return q[i].next.Before(q[j].next)
+}
+
+func (q scheduleQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *scheduleQueue) Push(x interface{}) {
+	item := x.(*scheduleItem)
+	item.index = len(*q)
+	*q = append(*q, item)
+}
+
+func (q *scheduleQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	*q = old[:n-1]
+	return item
+}
@@ -0,0 +1,348 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduler_Schedule(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := NewScheduler(SchedulerOptions{Interval: time.Millisecond * 20, Fetchers: 2}, nil)
+	s.Start(ctx)
+
+	var checks int32
+	done := make(chan struct{})
+	s.Schedule("docker.io/library/nginx", "docker.io", func(_ context.Context) {
+		if atomic.AddInt32(&checks, 1) == 3 {
+			close(done)
+		}
+	})
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 2):
+		t.Fatalf("Schedule() check ran %d times, want at least 3", atomic.LoadInt32(&checks))
+	}
+}
+
+func TestScheduler_Unschedule(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := NewScheduler(SchedulerOptions{Interval: time.Millisecond * 10}, nil)
+	s.Start(ctx)
+
+	var checks int32
+	s.Schedule("docker.io/library/nginx", "docker.io", func(_ context.Context) {
+		atomic.AddInt32(&checks, 1)
+	})
+	s.Unschedule("docker.io/library/nginx")
+	time.Sleep(time.Millisecond * 50)
+
+	if got := atomic.LoadInt32(&checks); got > 1 {
+		t.Errorf("Unschedule() check ran %d times after it was unscheduled", got)
+	}
+	if s.Len() != 0 {
+		t.Errorf("Unschedule() scheduled checks = %d, want 0", s.Len())
+	}
+}
+
+func TestScheduler_RegistryConcurrency(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := NewScheduler(SchedulerOptions{Interval: time.Millisecond * 10, Fetchers: 8, RegistryConcurrency: 2}, nil)
+	s.Start(ctx)
+
+	var running, maxRunning, checks int32
+	for i := 0; i < 16; i++ {
+		s.Schedule(fmt.Sprintf("docker.io/image-%d", i), "docker.io", func(_ context.Context) {
+			current := atomic.AddInt32(&running, 1)
+			for {
+				max := atomic.LoadInt32(&maxRunning)
+				if current <= max || atomic.CompareAndSwapInt32(&maxRunning, max, current) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond * 5)
+			atomic.AddInt32(&running, -1)
+			atomic.AddInt32(&checks, 1)
+		})
+	}
+	time.Sleep(time.Millisecond * 300)
+
+	if got := atomic.LoadInt32(&maxRunning); got > 2 {
+		t.Errorf("Scheduler ran %d checks against the same registry concurrently, want at most 2", got)
+	}
+	if atomic.LoadInt32(&checks) == 0 {
+		t.Errorf("Scheduler did not run any check")
+	}
+}
+
+func TestScheduler_ParkBusyChecks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := NewScheduler(SchedulerOptions{Interval: time.Millisecond, RegistryConcurrency: 1}, nil)
+	s.Start(ctx)
+	release, _ := s.Acquire("docker.io")
+
+	checks := make(chan struct{}, 10)
+	s.Schedule("docker.io/library/nginx", "docker.io", func(_ context.Context) {
+		checks <- struct{}{}
+	})
+	s.Schedule("docker.io/library/redis", "docker.io", func(_ context.Context) {})
+	s.Unschedule("docker.io/library/redis")
+	time.Sleep(time.Millisecond * 50)
+
+	s.mutex.Lock()
+	parked, queued := len(s.parked["docker.io"]), len(s.queue)
+	s.mutex.Unlock()
+	if parked != 1 || queued != 0 {
+		t.Fatalf("Scheduler parked %d and queued %d checks of the busy registry, want 1 parked check", parked, queued)
+	}
+	if _, running, _ := s.NextRun("docker.io/library/nginx"); running {
+		t.Errorf("NextRun() reports the parked check as running")
+	}
+
+	release()
+	select {
+	case <-checks:
+	case <-time.After(time.Second):
+		t.Fatal("Scheduler did not run the parked check after the registry was released")
+	}
+}
+
+// BenchmarkScheduler measures the throughput of the fetcher pool for thousands of synthetic images on a few registries
+func BenchmarkScheduler(b *testing.B) {
+	for _, images := range []int{1000, 5000} {
+		b.Run(fmt.Sprintf("%dImages", images), func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			s := NewScheduler(SchedulerOptions{Interval: time.Millisecond, Fetchers: 32, RegistryConcurrency: 8}, nil)
+			var wg sync.WaitGroup
+			wg.Add(b.N)
+			var remaining int64 = int64(b.N)
+			check := func(_ context.Context) {
+				if atomic.AddInt64(&remaining, -1) >= 0 {
+					wg.Done()
+				}
+			}
+			for i := 0; i < images; i++ {
+				s.Schedule(fmt.Sprintf("registry-%d.io/image-%d", i%10, i), fmt.Sprintf("registry-%d.io", i%10), check)
+			}
+
+			b.ResetTimer()
+			s.Start(ctx)
+			wg.Wait()
+		})
+	}
+}
+
+// BenchmarkScheduler_Mutations measures adding and removing thousands of synthetic images
+func BenchmarkScheduler_Mutations(b *testing.B) {
+	s := NewScheduler(SchedulerOptions{Interval: time.Hour}, nil)
+	check := func(_ context.Context) {}
+	keys := make([]string, 5000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("registry-%d.io/image-%d", i%10, i)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := keys[i%len(keys)]
+		s.Schedule(key, "registry.io", check)
+		if i%2 == 1 {
+			s.Unschedule(key)
+		}
+	}
+}
+
+func TestScheduler_Delay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var delayed int32 = 1
+	s := NewScheduler(SchedulerOptions{Interval: time.Millisecond * 10}, func(registry string) time.Duration {
+		if atomic.LoadInt32(&delayed) == 1 {
+			return time.Millisecond * 10
+		}
+		return 0
+	})
+	s.Start(ctx)
+
+	checked := make(chan struct{}, 1)
+	s.Schedule("docker.io/library/nginx", "docker.io", func(_ context.Context) {
+		select {
+		case checked <- struct{}{}:
+		default:
+		}
+	})
+
+	select {
+	case <-checked:
+		t.Fatalf("Scheduler ran a check of a delayed registry")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	atomic.StoreInt32(&delayed, 0)
+	select {
+	case <-checked:
+	case <-time.After(time.Second):
+		t.Errorf("Scheduler did not run the check after the delay")
+	}
+}
+
+func TestScheduler_Acquire(t *testing.T) {
+	delays := map[string]time.Duration{"quay.io": time.Minute}
+	s := NewScheduler(SchedulerOptions{RegistryConcurrency: 1}, func(registry string) time.Duration {
+		return delays[registry]
+	})
+
+	release, retryAfter := s.Acquire("docker.io")
+	if release == nil || retryAfter != 0 {
+		t.Fatalf("Acquire() = %v, want a free slot", retryAfter)
+	}
+	if busy, retryAfter := s.Acquire("docker.io"); busy != nil || retryAfter != registryBusyDelay {
+		t.Errorf("Acquire() at the concurrency limit = %v, want %s", retryAfter, registryBusyDelay)
+	}
+	release()
+	release()
+	if s.inFlight["docker.io"] != 0 {
+		t.Errorf("Acquire() released %d slots, want each slot once", 1-s.inFlight["docker.io"])
+	}
+	again, _ := s.Acquire("docker.io")
+	if again == nil {
+		t.Fatal("Acquire() after release is busy")
+	}
+	again()
+
+	if delayed, retryAfter := s.Acquire("quay.io"); delayed != nil || retryAfter != time.Minute {
+		t.Errorf("Acquire() of a delayed registry = %v, want %s", retryAfter, time.Minute)
+	}
+}
+
+func TestScheduler_Wait(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := NewScheduler(SchedulerOptions{Interval: time.Millisecond}, nil)
+	s.Start(ctx)
+
+	started := make(chan struct{})
+	finished := make(chan struct{})
+	var once sync.Once
+	s.Schedule("docker.io/library/nginx", "docker.io", func(ctx context.Context) {
+		once.Do(func() {
+			close(started)
+			<-ctx.Done()
+			time.Sleep(time.Millisecond * 10)
+			close(finished)
+		})
+	})
+
+	<-started
+	cancel()
+	s.Wait()
+	select {
+	case <-finished:
+	default:
+		t.Error("Wait() returned before the running check finished")
+	}
+}
+
+func TestScheduler_Trigger(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := NewScheduler(SchedulerOptions{Interval: time.Millisecond * 10, RegistryIntervals: map[string]time.Duration{"docker.io": time.Hour}}, nil)
+	s.Start(ctx)
+
+	checks := make(chan struct{}, 10)
+	s.Schedule("docker.io/library/nginx", "docker.io", func(_ context.Context) {
+		checks <- struct{}{}
+	})
+
+	select {
+	case <-checks:
+	case <-time.After(time.Second):
+		t.Fatal("Schedule() first check did not run")
+	}
+	select {
+	case <-checks:
+		t.Fatal("Schedule() registry interval was not applied")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	if !s.Trigger("docker.io/library/nginx") {
+		t.Fatal("Trigger() did not find the scheduled check")
+	}
+	select {
+	case <-checks:
+	case <-time.After(time.Second):
+		t.Error("Trigger() did not run the check")
+	}
+
+	if s.Trigger("docker.io/library/redis") {
+		t.Error("Trigger() reported an unscheduled check")
+	}
+}
+
+func TestScheduler_Resume(t *testing.T) {
+	s := NewScheduler(SchedulerOptions{Interval: time.Hour}, nil)
+	check := func(_ context.Context) {}
+
+	s.Resume("docker.io/library/nginx", "docker.io", time.Now().Add(-time.Minute*30), check)
+	s.Resume("docker.io/library/redis", "docker.io", time.Now().Add(-time.Hour*2), check)
+	s.Schedule("docker.io/library/postgres", "docker.io", check)
+
+	tests := []struct {
+		key      string
+		wantFrom time.Duration
+		wantTo   time.Duration
+	}{
+		{key: "docker.io/library/nginx", wantFrom: time.Minute * 20, wantTo: time.Minute * 40},
+		{key: "docker.io/library/redis", wantFrom: 0, wantTo: time.Minute * 6},
+		{key: "docker.io/library/postgres", wantFrom: 0, wantTo: time.Minute * 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			next, running, ok := s.NextRun(tt.key)
+			if !ok || running {
+				t.Fatalf("NextRun() ok = %v, running = %v, want a scheduled check", ok, running)
+			}
+			if until := time.Until(next); until < tt.wantFrom || until > tt.wantTo {
+				t.Errorf("NextRun() in %s, want between %s and %s", until, tt.wantFrom, tt.wantTo)
+			}
+		})
+	}
+}
@@ -31,5 +31,28 @@ type Service interface {
 	DeleteImage(ctx context.Context, image Image) error
 	UpdateImage(ctx context.Context, image Image) error
 	ListImages(ctx context.Context, opts ListOptions) ([]Image, error)
-	Notify(event chan<- NotificationEvent)
+	// OutdatedImages returns the listed images for which the last check found a newer tag, including snoozed updates
+	OutdatedImages(ctx context.Context, opts ListOptions) ([]OutdatedImage, error)
+	// Notify forwards the events to the channel, the name identifies the subscription in the dropped events metric
+	Notify(name string, event chan<- NotificationEvent)
+	// Subscribe creates a subscription with its own queue, which has to be unsubscribed if it is no longer read
+	Subscribe(opts SubscriptionOptions) *Subscription
+	// RequestCheck schedules an immediate check of the image and reports if the image is watched
+	RequestCheck(registry, imageName string) bool
+	// AddSnooze stores the snooze, a snooze without ID gets a generated one
+	AddSnooze(snooze Snooze) (Snooze, error)
+	DeleteSnooze(id string) error
+	ListSnoozes() []Snooze
+	// WorkerStatuses returns the status of all workers without their tags
+	WorkerStatuses() []WorkerStatus
+	// WorkerStatus returns the status of the worker for the image name with registry or ErrWorkerNotFound
+	WorkerStatus(imageName string) (WorkerStatus, error)
+	// CheckNow runs the check of the worker for the image name with registry and waits until it finished
+	CheckNow(ctx context.Context, imageName string) (WorkerStatus, error)
+	// History returns the recorded entries matching the query or ErrHistoryDisabled
+	History(ctx context.Context, query HistoryQuery) ([]HistoryEntry, error)
+	// TimeToUpdate aggregates the tag changes of outdated containers matching the query by namespace
+	TimeToUpdate(ctx context.Context, query HistoryQuery) ([]TimeToUpdate, error)
+	// Wait blocks until all checks returned and the event bus is closed after the context of the service is done
+	Wait()
 }
@@ -0,0 +1,272 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/analyzing"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrSnoozeNotFound is returned if no snooze with the given ID exists
+var ErrSnoozeNotFound = errors.New("differentiate/snooze error: snooze not found")
+
+// snoozeDateLayouts are the accepted formats of the until date of snooze expressions
+var snoozeDateLayouts = []string{time.RFC3339, "2006-01-02"}
+
+// Snooze acknowledges an outdated image, so that its update is not notified. A snooze with a tag silences all newer
+// tags up to this tag and ends as soon as an even newer tag is available. A snooze with an until date ends at this date.
+type Snooze struct {
+	ID string `json:"id"`
+	// Image is a glob pattern of the image name with or without registry
+	Image string     `json:"image"`
+	Tag   string     `json:"tag,omitempty"`
+	Until *time.Time `json:"until,omitempty"`
+	// Namespace, Workload and Container restrict the snooze to matching workloads if they are set
+	Namespace string `json:"namespace,omitempty"`
+	Workload  string `json:"workload,omitempty"`
+	Container string `json:"container,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Validate checks that the snooze has an image pattern and ends with a newer tag or at a date
+func (s Snooze) Validate() error {
+	if s.Image == "" {
+		return fmt.Errorf("differentiate/snooze error: snooze has no image")
+	}
+	if _, err := path.Match(s.Image, ""); err != nil {
+		return fmt.Errorf("differentiate/snooze error: invalid image pattern %s: %w", s.Image, err)
+	}
+	if s.Tag == "" && s.Until == nil {
+		return fmt.Errorf("differentiate/snooze error: snooze for image %s needs a tag or an until date", s.Image)
+	}
+	return nil
+}
+
+// IsExpired reports if the until date of the snooze has passed
+func (s Snooze) IsExpired(now time.Time) bool {
+	return s.Until != nil && now.After(*s.Until)
+}
+
+// silences reports if the snooze covers the newer tags of the event
+func (s Snooze) silences(event NotificationEvent, now time.Time) bool {
+	if s.IsExpired(now) {
+		return false
+	}
+	if s.Tag == "" {
+		return true
+	}
+	for _, tag := range []string{event.NewTag, event.LatestTag, event.NewVariantTag} {
+		if tag != "" && tag != event.Image.Tag && analyzing.CompareTags(tag, s.Tag) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (s Snooze) matches(img Image) bool {
+	return matchesImageName(s.Image, img) &&
+		(s.Namespace == "" || s.Namespace == img.Workload.Namespace) &&
+		(s.Workload == "" || s.Workload == img.Workload.Name) &&
+		(s.Container == "" || s.Container == img.Workload.Container)
+}
+
+// ParseSnoozeExpression parses the snooze annotation of a workload, e.g. "tag=13.1", "until=2021-06-30" or
+// "tag=13.1,until=2021-06-30". The snooze applies to the annotated image only.
+func ParseSnoozeExpression(expression string) (Snooze, error) {
+	var s Snooze
+	for _, part := range strings.Split(expression, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return Snooze{}, fmt.Errorf("differentiate/snooze error: invalid snooze expression %s, expected key=value pairs", expression)
+		}
+		switch key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]); key {
+		case "tag":
+			s.Tag = value
+		case "until":
+			until, err := parseSnoozeDate(value)
+			if err != nil {
+				return Snooze{}, err
+			}
+			s.Until = &until
+		case "reason":
+			s.Reason = value
+		default:
+			return Snooze{}, fmt.Errorf("differentiate/snooze error: unknown key %s in snooze expression %s", key, expression)
+		}
+	}
+	if s.Tag == "" && s.Until == nil {
+		return Snooze{}, fmt.Errorf("differentiate/snooze error: snooze expression %s needs a tag or an until date", expression)
+	}
+	return s, nil
+}
+
+func parseSnoozeDate(value string) (time.Time, error) {
+	for _, layout := range snoozeDateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("differentiate/snooze error: invalid until date %s, expected YYYY-MM-DD or RFC3339", value)
+}
+
+// Snoozes holds the configured snoozes and the snoozes created via the API
+type Snoozes struct {
+	mutex   sync.RWMutex
+	snoozes map[string]Snooze
+	now     func() time.Time
+	// state persists the snoozes added after restore
+	state StateRepository
+}
+
+// NewSnoozes validates and adds the initial snoozes
+func NewSnoozes(initial []Snooze) (*Snoozes, error) {
+	s := &Snoozes{
+		snoozes: make(map[string]Snooze),
+		now:     time.Now,
+	}
+	for _, snooze := range initial {
+		if _, err := s.Add(snooze); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Add validates the snooze and assigns an ID if it has none. A snooze with an existing ID replaces the stored one.
+func (s *Snoozes) Add(snooze Snooze) (Snooze, error) {
+	if err := snooze.Validate(); err != nil {
+		return Snooze{}, err
+	}
+	if snooze.ID == "" {
+		id, err := newSnoozeID()
+		if err != nil {
+			return Snooze{}, err
+		}
+		snooze.ID = id
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.state != nil {
+		if err := s.state.SaveSnooze(context.Background(), snooze); err != nil {
+			return Snooze{}, fmt.Errorf("differentiate/snooze error: could not persist snooze %s: %w", snooze.ID, err)
+		}
+	}
+	s.snoozes[snooze.ID] = snooze
+	return snooze, nil
+}
+
+// Delete removes the snooze with the given ID
+func (s *Snoozes) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.snoozes[id]; !ok {
+		return ErrSnoozeNotFound
+	}
+	if s.state != nil {
+		if err := s.state.DeleteSnooze(context.Background(), id); err != nil {
+			return fmt.Errorf("differentiate/snooze error: could not delete persisted snooze %s: %w", id, err)
+		}
+	}
+	delete(s.snoozes, id)
+	return nil
+}
+
+// restore adds the persisted snoozes and persists all further changes. The initial snoozes are not persisted, so that
+// they are removed with the configuration.
+func (s *Snoozes) restore(ctx context.Context, state StateRepository) error {
+	persisted, err := state.ListSnoozes(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, snooze := range persisted {
+		s.snoozes[snooze.ID] = snooze
+	}
+	s.state = state
+	return nil
+}
+
+// List returns all snoozes sorted by their ID, including expired ones
+func (s *Snoozes) List() []Snooze {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	list := make([]Snooze, 0, len(s.snoozes))
+	for _, snooze := range s.snoozes {
+		list = append(list, snooze)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// IsSnoozed reports if the update of the event is acknowledged by the snooze annotation of the image or by a stored snooze
+func (s *Snoozes) IsSnoozed(event NotificationEvent) bool {
+	if s == nil {
+		return false
+	}
+	now := s.now()
+	img := event.Image
+
+	if img.Snooze != "" {
+		snooze, err := ParseSnoozeExpression(img.Snooze)
+		if err != nil {
+			log.Warnf("differentiate/snooze error: image %s with ID %s: %s", img.GetNameWithRegistry(), img.ID, err)
+		} else if snooze.silences(event, now) {
+			return true
+		}
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, snooze := range s.snoozes {
+		if snooze.matches(img) && snooze.silences(event, now) {
+			return true
+		}
+	}
+	return false
+}
+
+func newSnoozeID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("differentiate/snooze error: could not generate ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,135 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSnoozeExpression(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		wantTag    string
+		wantUntil  string
+		wantErr    bool
+	}{
+		{name: "Tag", expression: "tag=13.1", wantTag: "13.1"},
+		{name: "Until", expression: "until=2021-06-30", wantUntil: "2021-06-30T00:00:00Z"},
+		{name: "TagAndUntil", expression: "tag=13.1, until=2021-06-30T12:00:00Z, reason=migration pending", wantTag: "13.1", wantUntil: "2021-06-30T12:00:00Z"},
+		{name: "Empty", expression: "reason=later", wantErr: true},
+		{name: "UnknownKey", expression: "tag=13.1,owner=me", wantErr: true},
+		{name: "InvalidDate", expression: "until=30.06.2021", wantErr: true},
+		{name: "NoKeyValue", expression: "13.1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSnoozeExpression(tt.expression)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSnoozeExpression() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Tag != tt.wantTag {
+				t.Errorf("ParseSnoozeExpression() tag = %s, want %s", got.Tag, tt.wantTag)
+			}
+			if tt.wantUntil != "" && (got.Until == nil || got.Until.Format(time.RFC3339) != tt.wantUntil) {
+				t.Errorf("ParseSnoozeExpression() until = %v, want %s", got.Until, tt.wantUntil)
+			}
+		})
+	}
+}
+
+func TestSnoozes_IsSnoozed(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	future := now.Add(time.Hour * 24)
+	past := now.Add(-time.Hour)
+
+	snoozes, err := NewSnoozes([]Snooze{
+		{Image: "library/postgres", Tag: "13.1"},
+		{Image: "docker.io/library/redis", Until: &future, Namespace: "cache"},
+		{Image: "library/nginx", Until: &past},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snoozes.now = func() time.Time { return now }
+
+	image := func(name, tag, namespace string) Image {
+		return Image{Registry: "registry-1.docker.io", Name: name, Tag: tag, Workload: Workload{Namespace: namespace}}
+	}
+	tests := []struct {
+		name  string
+		event NotificationEvent
+		want  bool
+	}{
+		{name: "AcknowledgedTag", event: NotificationEvent{Image: image("library/postgres", "12.4", "db"), NewTag: "13.1", LatestTag: "13.1"}, want: true},
+		{name: "EvenNewerTag", event: NotificationEvent{Image: image("library/postgres", "12.4", "db"), NewTag: "13.2", LatestTag: "13.2"}},
+		{name: "BlockedByConstraint", event: NotificationEvent{Image: image("library/postgres", "12.4", "db"), NewTag: "12.4", LatestTag: "13.1"}, want: true},
+		{name: "UntilDate", event: NotificationEvent{Image: image("library/redis", "5.0.9", "cache"), NewTag: "6.0.9"}, want: true},
+		{name: "OtherNamespace", event: NotificationEvent{Image: image("library/redis", "5.0.9", "web"), NewTag: "6.0.9"}},
+		{name: "Expired", event: NotificationEvent{Image: image("library/nginx", "1.18.0", "web"), NewTag: "1.19.6"}},
+		{name: "Annotation", event: NotificationEvent{Image: Image{Registry: "quay.io", Name: "coreos/etcd", Tag: "v3.3.25", Snooze: "tag=v3.4.14"}, NewTag: "v3.4.14"}, want: true},
+		{name: "InvalidAnnotation", event: NotificationEvent{Image: Image{Registry: "quay.io", Name: "coreos/etcd", Tag: "v3.3.25", Snooze: "v3.4.14"}, NewTag: "v3.4.14"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := snoozes.IsSnoozed(tt.event); got != tt.want {
+				t.Errorf("IsSnoozed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnoozes_AddDelete(t *testing.T) {
+	snoozes, err := NewSnoozes(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := snoozes.Add(Snooze{Image: "library/postgres"}); err == nil {
+		t.Errorf("Add() accepted a snooze without tag and until date")
+	}
+
+	added, err := snoozes.Add(Snooze{Image: "library/postgres", Tag: "13.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.ID == "" {
+		t.Fatal("Add() did not assign an ID")
+	}
+	if list := snoozes.List(); len(list) != 1 || list[0] != added {
+		t.Errorf("List() = %+v, want %+v", list, added)
+	}
+
+	if err := snoozes.Delete(added.ID); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if err := snoozes.Delete(added.ID); err != ErrSnoozeNotFound {
+		t.Errorf("Delete() error = %v, want %v", err, ErrSnoozeNotFound)
+	}
+}
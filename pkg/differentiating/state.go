@@ -0,0 +1,63 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"context"
+	"time"
+)
+
+// StateRepository persists the state of the service besides the images, so that a restart neither re-sends the
+// notifications nor forgets the snoozes created via the API
+type StateRepository interface {
+	SaveTags(ctx context.Context, tags ImageTags) error
+	ListTags(ctx context.Context) ([]ImageTags, error)
+	SaveTrackedState(ctx context.Context, state TrackedState) error
+	DeleteTrackedState(ctx context.Context, imageID string) error
+	ListTrackedStates(ctx context.Context) ([]TrackedState, error)
+	SaveSnooze(ctx context.Context, snooze Snooze) error
+	DeleteSnooze(ctx context.Context, id string) error
+	ListSnoozes(ctx context.Context) ([]Snooze, error)
+}
+
+// ImageTags are the tags of an image seen by the last successful check
+type ImageTags struct {
+	// Image is the name with registry
+	Image      string    `json:"image"`
+	Tags       []string  `json:"tags"`
+	Credential string    `json:"credential,omitempty"`
+	CheckedAt  time.Time `json:"checkedAt"`
+}
+
+// TrackedState is the last notified state of an image, see EventTracker
+type TrackedState struct {
+	ImageID      string             `json:"imageID"`
+	Event        *NotificationEvent `json:"event,omitempty"`
+	Snoozed      bool               `json:"snoozed,omitempty"`
+	MetricLabels []string           `json:"metricLabels,omitempty"`
+	NotifiedAt   time.Time          `json:"notifiedAt"`
+	Pin          *PinRecommendation `json:"pin,omitempty"`
+	PinLabels    []string           `json:"pinLabels,omitempty"`
+}
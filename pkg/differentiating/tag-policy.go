@@ -0,0 +1,116 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/fwiedmann/differ/pkg/analyzing"
+)
+
+// TagPolicyRule applies its policy to all images whose name with or without registry matches the glob pattern
+type TagPolicyRule struct {
+	Pattern string
+	Policy  analyzing.Policy
+}
+
+// TagPolicies resolves the analyzing.Policy of an image. The default policy is overridden by the first matching rule
+// and the constraint by the constraint of the image itself, e.g. from a workload annotation.
+type TagPolicies struct {
+	Default analyzing.Policy
+	Rules   []TagPolicyRule
+}
+
+// PolicyFor returns the policy for the given image
+func (t TagPolicies) PolicyFor(img Image) (analyzing.Policy, error) {
+	policy := t.Default
+	for _, rule := range t.Rules {
+		if !matchesImageName(rule.Pattern, img) {
+			continue
+		}
+		if rule.Policy.PreRelease != "" {
+			policy.PreRelease = rule.Policy.PreRelease
+		}
+		if rule.Policy.Variant != "" {
+			policy.Variant = rule.Policy.Variant
+		}
+		if rule.Policy.Constraint != nil {
+			policy.Constraint = rule.Policy.Constraint
+		}
+		if rule.Policy.OrderedClasses != nil {
+			policy.OrderedClasses = rule.Policy.OrderedClasses
+		}
+		if rule.Policy.DateLayouts != nil {
+			policy.DateLayouts = rule.Policy.DateLayouts
+		}
+		break
+	}
+
+	if img.Constraint != "" {
+		constraint, err := analyzing.ParseConstraint(img.Constraint)
+		if err != nil {
+			return analyzing.Policy{}, fmt.Errorf("differentiate/tag-policy error: image %s with ID %s: %w", img.GetNameWithRegistry(), img.ID, err)
+		}
+		policy.Constraint = constraint
+	}
+	return policy, nil
+}
+
+// dockerHubRegistries are the host names referring to Docker Hub. The observers record Docker Hub images with the
+// registry-1.docker.io registry, users tend to write docker.io.
+var dockerHubRegistries = []string{"docker.io", "index.docker.io", "registry-1.docker.io"}
+
+func matchesImageName(pattern string, img Image) bool {
+	for _, name := range imageNames(img) {
+		if matched, err := path.Match(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// imageNames returns all names an image can be referred to by a pattern
+func imageNames(img Image) []string {
+	names := []string{img.GetNameWithRegistry(), img.GetNameWithoutRegistry()}
+	if !isDockerHub(img.Registry) {
+		return names
+	}
+	for _, registry := range dockerHubRegistries {
+		if registry != img.Registry {
+			names = append(names, registry+"/"+img.Name)
+		}
+	}
+	return names
+}
+
+func isDockerHub(registry string) bool {
+	for _, r := range dockerHubRegistries {
+		if r == registry {
+			return true
+		}
+	}
+	return false
+}
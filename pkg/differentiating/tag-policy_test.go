@@ -0,0 +1,84 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"testing"
+
+	"github.com/fwiedmann/differ/pkg/analyzing"
+)
+
+func TestTagPolicies_PolicyFor(t *testing.T) {
+	major12, err := analyzing.ParseConstraint("^12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	minor1, err := analyzing.ParseConstraint("~1.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policies := TagPolicies{
+		Default: analyzing.Policy{PreRelease: analyzing.PreReleaseToStable},
+		Rules: []TagPolicyRule{
+			{Pattern: "docker.io/library/postgres", Policy: analyzing.Policy{Constraint: major12}},
+			{Pattern: "wiedmannfelix/*", Policy: analyzing.Policy{PreRelease: analyzing.PreReleaseAny, Constraint: minor1}},
+			{Pattern: "wiedmannfelix/*", Policy: analyzing.Policy{PreRelease: analyzing.PreReleaseSameChannel}},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		img            Image
+		wantPreRelease analyzing.PreReleasePolicy
+		wantConstraint string
+		wantErr        bool
+	}{
+		{name: "Default", img: Image{Registry: "registry-1.docker.io", Name: "library/nginx"}, wantPreRelease: analyzing.PreReleaseToStable},
+		{name: "MatchWithRegistry", img: Image{Registry: "registry-1.docker.io", Name: "library/postgres"}, wantPreRelease: analyzing.PreReleaseToStable, wantConstraint: "^12"},
+		{name: "MatchDockerHubAlias", img: Image{Registry: "index.docker.io", Name: "library/postgres"}, wantPreRelease: analyzing.PreReleaseToStable, wantConstraint: "^12"},
+		{name: "NoMatchOtherRegistry", img: Image{Registry: "quay.io", Name: "library/postgres"}, wantPreRelease: analyzing.PreReleaseToStable},
+		{name: "FirstMatchWithoutRegistry", img: Image{Registry: "registry-1.docker.io", Name: "wiedmannfelix/differ"}, wantPreRelease: analyzing.PreReleaseAny, wantConstraint: "~1.2"},
+		{name: "ImageConstraint", img: Image{Registry: "registry-1.docker.io", Name: "library/postgres", Constraint: ">=12.4 <13"}, wantPreRelease: analyzing.PreReleaseToStable, wantConstraint: ">=12.4 <13"},
+		{name: "InvalidImageConstraint", img: Image{Registry: "registry-1.docker.io", Name: "library/postgres", Constraint: "^foo"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := policies.PolicyFor(tt.img)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PolicyFor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.PreRelease != tt.wantPreRelease {
+				t.Errorf("PolicyFor() pre-release policy = %v, want %v", got.PreRelease, tt.wantPreRelease)
+			}
+			if got.Constraint.String() != tt.wantConstraint {
+				t.Errorf("PolicyFor() constraint = %v, want %v", got.Constraint, tt.wantConstraint)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/analyzing"
+	"github.com/fwiedmann/differ/pkg/monitoring"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultSkewInterval is the default interval of the version skew metric updates
+const defaultSkewInterval = time.Minute
+
+// VersionSkew describes the distinct tags of the same image which run across all observed workloads
+type VersionSkew struct {
+	Registry string `json:"registry"`
+	Name     string `json:"name"`
+	// Tags are sorted from the oldest to the newest tag
+	Tags []TagUsage `json:"tags"`
+	// Spread classifies the difference between the oldest and the newest running tag
+	Spread analyzing.BumpType `json:"spread,omitempty"`
+}
+
+// TagUsage lists the workloads which run a tag
+type TagUsage struct {
+	Tag       string     `json:"tag"`
+	Workloads []Workload `json:"workloads"`
+}
+
+// IsSkewed reports if more than one tag of the image is running
+func (s VersionSkew) IsSkewed() bool {
+	return len(s.Tags) > 1
+}
+
+// Oldest returns the oldest running tag
+func (s VersionSkew) Oldest() string {
+	if len(s.Tags) == 0 {
+		return ""
+	}
+	return s.Tags[0].Tag
+}
+
+// Newest returns the newest running tag
+func (s VersionSkew) Newest() string {
+	if len(s.Tags) == 0 {
+		return ""
+	}
+	return s.Tags[len(s.Tags)-1].Tag
+}
+
+// AnalyzeVersionSkew groups the images by registry and name. The groups are sorted by registry and name.
+func AnalyzeVersionSkew(images []Image) []VersionSkew {
+	type group struct {
+		registry, name string
+		tags           map[string][]Workload
+	}
+
+	groups := make(map[string]*group)
+	for _, img := range images {
+		key := img.GetNameWithRegistry()
+		g, ok := groups[key]
+		if !ok {
+			g = &group{registry: img.Registry, name: img.Name, tags: make(map[string][]Workload)}
+			groups[key] = g
+		}
+		g.tags[img.Tag] = append(g.tags[img.Tag], img.Workload)
+	}
+
+	skews := make([]VersionSkew, 0, len(groups))
+	for _, g := range groups {
+		tags := make([]string, 0, len(g.tags))
+		for tag := range g.tags {
+			tags = append(tags, tag)
+		}
+		analyzing.SortTags(tags)
+
+		skew := VersionSkew{Registry: g.registry, Name: g.name, Tags: make([]TagUsage, 0, len(tags))}
+		for _, tag := range tags {
+			skew.Tags = append(skew.Tags, TagUsage{Tag: tag, Workloads: g.tags[tag]})
+		}
+		skew.Spread = analyzing.ClassifyBump(skew.Oldest(), skew.Newest())
+		skews = append(skews, skew)
+	}
+
+	sort.Slice(skews, func(i, j int) bool {
+		if skews[i].Registry != skews[j].Registry {
+			return skews[i].Registry < skews[j].Registry
+		}
+		return skews[i].Name < skews[j].Name
+	})
+	return skews
+}
+
+// updateVersionSkewMetrics replaces the version skew metric with the current images of the repository in each interval
+func updateVersionSkewMetrics(ctx context.Context, rp ListImagesRepository, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultSkewInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			images, err := rp.ListImages(ctx, ListOptions{})
+			if err != nil {
+				log.Errorf("differentiate/version-skew error: could not list images: %s", err)
+				continue
+			}
+			setVersionSkewMetrics(AnalyzeVersionSkew(images))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func setVersionSkewMetrics(skews []VersionSkew) {
+	monitoring.ImageVersionSkewMetric.Reset()
+	for _, skew := range skews {
+		monitoring.ImageVersionSkewMetric.WithLabelValues(Image{Registry: skew.Registry, Name: skew.Name}.GetNameWithRegistry(), skew.Registry, skew.Oldest(), skew.Newest(), string(skew.Spread)).Set(float64(len(skew.Tags)))
+	}
+}
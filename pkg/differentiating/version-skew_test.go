@@ -0,0 +1,72 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fwiedmann/differ/pkg/analyzing"
+)
+
+func TestAnalyzeVersionSkew(t *testing.T) {
+	proxy := func(namespace, tag string) Image {
+		return Image{Registry: "docker.io", Name: "istio/proxyv2", Tag: tag, Workload: Workload{Namespace: namespace, Kind: "Deployment", Name: "app", Container: "istio-proxy"}}
+	}
+	images := []Image{
+		proxy("a", "1.8.1"),
+		proxy("b", "1.7.4"),
+		proxy("c", "1.8.1"),
+		proxy("d", "1.10.0"),
+		{Registry: "docker.io", Name: "fluent/fluent-bit", Tag: "1.6.8", Workload: Workload{Namespace: "logging", Kind: "DaemonSet", Name: "fluent-bit", Container: "fluent-bit"}},
+	}
+
+	got := AnalyzeVersionSkew(images)
+	if len(got) != 2 {
+		t.Fatalf("AnalyzeVersionSkew() returned %d groups, want 2", len(got))
+	}
+
+	fluentBit, istio := got[0], got[1]
+	if fluentBit.IsSkewed() || fluentBit.Spread != analyzing.BumpNone {
+		t.Errorf("AnalyzeVersionSkew() single tag group = %+v, want no skew", fluentBit)
+	}
+
+	if !istio.IsSkewed() {
+		t.Fatalf("AnalyzeVersionSkew() group %s is not skewed", istio.Name)
+	}
+	var tags []string
+	for _, usage := range istio.Tags {
+		tags = append(tags, usage.Tag)
+	}
+	if want := []string{"1.7.4", "1.8.1", "1.10.0"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("AnalyzeVersionSkew() tags = %v, want %v", tags, want)
+	}
+	if len(istio.Tags[1].Workloads) != 2 {
+		t.Errorf("AnalyzeVersionSkew() workloads of tag %s = %d, want 2", istio.Tags[1].Tag, len(istio.Tags[1].Workloads))
+	}
+	if istio.Oldest() != "1.7.4" || istio.Newest() != "1.10.0" || istio.Spread != analyzing.BumpMinor {
+		t.Errorf("AnalyzeVersionSkew() oldest = %s, newest = %s, spread = %s", istio.Oldest(), istio.Newest(), istio.Spread)
+	}
+}
@@ -0,0 +1,176 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrWorkerNotFound is returned if no worker checks the requested image
+var ErrWorkerNotFound = errors.New("differentiate/worker-status error: no worker found for image")
+
+// RegistryBusyError is returned by an on-demand check if the registry is at its concurrency limit or its quota postpones
+// the checks
+type RegistryBusyError struct {
+	Registry string
+	// RetryAfter is the time after which the check may be accepted
+	RetryAfter time.Duration
+}
+
+func (e *RegistryBusyError) Error() string {
+	return fmt.Sprintf("differentiate/worker-status error: registry %s is busy, retry after %s", e.Registry, e.RetryAfter)
+}
+
+// credentialAnonymous is the credential reference of requests without pull secret
+const credentialAnonymous = "anonymous"
+
+// WorkerStatus describes the last check of a Worker and its next scheduled run
+type WorkerStatus struct {
+	// Image is the name with registry, which identifies the worker
+	Image    string `json:"image"`
+	Registry string `json:"registry"`
+	Name     string `json:"name"`
+	// StoredImages is the number of stored images which are checked by the worker
+	StoredImages int        `json:"storedImages"`
+	Running      bool       `json:"running"`
+	LastCheck    *time.Time `json:"lastCheck,omitempty"`
+	LastSuccess  *time.Time `json:"lastSuccess,omitempty"`
+	LastErrorAt  *time.Time `json:"lastErrorAt,omitempty"`
+	LastError    string     `json:"lastError,omitempty"`
+	// NextCheck is unset while the check is running
+	NextCheck *time.Time `json:"nextCheck,omitempty"`
+	TagCount  int        `json:"tagCount"`
+	Tags      []string   `json:"tags,omitempty"`
+	// Credential references the pull secret of the last successful request by its username, it never contains the password
+	Credential string `json:"credential,omitempty"`
+}
+
+type workerStatus struct {
+	running      bool
+	storedImages int
+	lastCheck    time.Time
+	lastSuccess  time.Time
+	lastErrorAt  time.Time
+	lastError    string
+	tags         []string
+	credential   string
+}
+
+func (w *Worker) startCheck() {
+	w.statusMutex.Lock()
+	defer w.statusMutex.Unlock()
+	w.status.running = true
+	w.status.lastCheck = time.Now()
+}
+
+// finishCheck records the result of a check, the tags and credential of the last success are kept on errors
+func (w *Worker) finishCheck(tags []string, credential string, storedImages int, err error) {
+	w.statusMutex.Lock()
+	defer w.statusMutex.Unlock()
+	w.status.running = false
+	w.status.storedImages = storedImages
+	if err != nil {
+		w.status.lastErrorAt = time.Now()
+		w.status.lastError = err.Error()
+		return
+	}
+	w.status.lastSuccess = time.Now()
+	if tags != nil {
+		w.status.tags = tags
+		w.status.credential = credential
+	}
+}
+
+// Status returns the status of the last check. The tags are only included on request, because they can be many.
+func (w *Worker) Status(withTags bool) WorkerStatus {
+	w.statusMutex.RLock()
+	defer w.statusMutex.RUnlock()
+
+	s := WorkerStatus{
+		Image:        Image{Registry: w.registry, Name: w.imageName}.GetNameWithRegistry(),
+		Registry:     w.registry,
+		Name:         w.imageName,
+		StoredImages: w.status.storedImages,
+		Running:      w.status.running,
+		LastCheck:    timeOrNil(w.status.lastCheck),
+		LastSuccess:  timeOrNil(w.status.lastSuccess),
+		LastErrorAt:  timeOrNil(w.status.lastErrorAt),
+		LastError:    w.status.lastError,
+		TagCount:     len(w.status.tags),
+		Credential:   w.status.credential,
+	}
+	if withTags {
+		s.Tags = append([]string(nil), w.status.tags...)
+	}
+	return s
+}
+
+// restoreStatus sets the tags of the last successful check before a restart
+func (w *Worker) restoreStatus(tags ImageTags) {
+	w.statusMutex.Lock()
+	defer w.statusMutex.Unlock()
+	w.status.tags = tags.Tags
+	w.status.credential = tags.Credential
+	w.status.lastSuccess = tags.CheckedAt
+	w.status.lastCheck = tags.CheckedAt
+}
+
+func (w *Worker) persistTags(ctx context.Context) {
+	if w.state == nil {
+		return
+	}
+
+	w.statusMutex.RLock()
+	tags := ImageTags{
+		Image:      Image{Registry: w.registry, Name: w.imageName}.GetNameWithRegistry(),
+		Tags:       w.status.tags,
+		Credential: w.status.credential,
+		CheckedAt:  w.status.lastSuccess,
+	}
+	w.statusMutex.RUnlock()
+
+	if err := w.state.SaveTags(ctx, tags); err != nil {
+		log.Warnf("differentiate/oci-worker error: could not persist the tags of image %s: %s", tags.Image, err)
+	}
+}
+
+func credentialRef(secret *PullSecret) string {
+	if secret == nil {
+		return credentialAnonymous
+	}
+	return "basic:" + secret.GetUsername()
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,115 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package differentiating
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestWorker_Status(t *testing.T) {
+	tests := []struct {
+		name           string
+		client         OciRegistryAPIClient
+		repository     ListImagesRepository
+		wantTags       []string
+		wantCredential string
+		wantError      bool
+		wantStored     int
+	}{
+		{
+			name:           "Anonymous",
+			client:         ociAPIMock,
+			repository:     rpWithoutAuthMockMock,
+			wantTags:       imageRemoteTags,
+			wantCredential: credentialAnonymous,
+			wantStored:     1,
+		},
+		{
+			name:           "PullSecret",
+			client:         ociAPIMock,
+			repository:     rpWithAuthMockMock,
+			wantTags:       imageRemoteTags,
+			wantCredential: "basic:admin",
+			wantStored:     1,
+		},
+		{
+			name:       "APIError",
+			client:     ociAPIErrorMock,
+			repository: rpWithoutAuthMockMock,
+			wantError:  true,
+			wantStored: 1,
+		},
+		{
+			name:       "RepositoryError",
+			client:     ociAPIMock,
+			repository: repositoryMock{listErr: fmt.Errorf("error")},
+			wantError:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			worker := NewImageWorker(tt.client, imageWithoutAuth.Registry, imageWithoutAuth.Name, rl, make(chan NotificationEvent, 10), tt.repository, TagPolicies{}, NewEventTracker(0, nil))
+			worker.check(context.Background())
+
+			got := worker.Status(true)
+			if got.Image != "differ.com/differ" || got.Running || got.LastCheck == nil {
+				t.Errorf("Status() = %+v, want a finished check of differ.com/differ", got)
+			}
+			if (got.LastError != "") != tt.wantError || (got.LastErrorAt != nil) != tt.wantError || (got.LastSuccess != nil) == tt.wantError {
+				t.Errorf("Status() error = %q, success = %v, want error %v", got.LastError, got.LastSuccess, tt.wantError)
+			}
+			if !reflect.DeepEqual(got.Tags, tt.wantTags) || got.TagCount != len(tt.wantTags) {
+				t.Errorf("Status() tags = %v (%d), want %v", got.Tags, got.TagCount, tt.wantTags)
+			}
+			if got.Credential != tt.wantCredential {
+				t.Errorf("Status() credential = %q, want %q", got.Credential, tt.wantCredential)
+			}
+			if got.StoredImages != tt.wantStored {
+				t.Errorf("Status() stored images = %d, want %d", got.StoredImages, tt.wantStored)
+			}
+			if withoutTags := worker.Status(false); withoutTags.Tags != nil || withoutTags.TagCount != len(tt.wantTags) {
+				t.Errorf("Status(false) = %+v, want the tag count without tags", withoutTags)
+			}
+		})
+	}
+}
+
+func TestWorker_Status_keepsLastSuccess(t *testing.T) {
+	worker := NewImageWorker(ociAPIMock, imageWithAuth.Registry, imageWithAuth.Name, rl, make(chan NotificationEvent, 10), rpWithAuthMockMock, TagPolicies{}, NewEventTracker(0, nil))
+	worker.check(context.Background())
+	worker.client = ociAPIErrorMock
+	worker.check(context.Background())
+
+	got := worker.Status(true)
+	if got.LastError == "" || got.LastSuccess == nil {
+		t.Fatalf("Status() = %+v, want the last error and the last success", got)
+	}
+	if got.TagCount != len(imageRemoteTags) || got.Credential != "basic:admin" {
+		t.Errorf("Status() tags = %d, credential = %q, want the tags and credential of the last success", got.TagCount, got.Credential)
+	}
+}
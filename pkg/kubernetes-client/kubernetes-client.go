@@ -25,31 +25,169 @@
 package kubernetes_client
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"time"
 
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/fwiedmann/differ/pkg/config"
 )
 
-func InitKubernetesAPIClient(devMode bool) (kubernetes.Interface, error) {
-	var config *rest.Config
-	var err error
-	if devMode {
-		config, err = initFromKubeConfig()
-	} else {
-		config, err = initInCLusterConfig()
+const (
+	defaultClusterName          = "default"
+	defaultKubeconfigSecretKey  = "kubeconfig"
+	kubeconfigSecretReadTimeout = time.Second * 10
+)
+
+// Cluster is an initialized kubernetes API client for one observed cluster
+type Cluster struct {
+	Name      string
+	Namespace string
+	Client    kubernetes.Interface
+	// Dynamic client for custom resources
+	Dynamic dynamic.Interface
+}
+
+// InitKubernetesAPIClient initializes a kubernetes API client for each configured cluster. If no clusters are configured
+// a single cluster named "default" is observed. Its client is created from the local kubeconfig in dev mode and from the in-cluster config otherwise.
+func InitKubernetesAPIClient(devMode bool, clusters []config.Cluster, defaultNamespace string) ([]Cluster, error) {
+	return newRestConfigLoader().initClusters(devMode, clusters, defaultNamespace)
+}
+
+// restConfigLoader creates the rest configs of the clusters. The in-cluster config and the client of the local cluster,
+// which reads the kubeconfig secrets, can be replaced.
+type restConfigLoader struct {
+	inCluster func() (*rest.Config, error)
+	newClient func(c *rest.Config) (kubernetes.Interface, error)
+}
+
+func newRestConfigLoader() restConfigLoader {
+	return restConfigLoader{
+		inCluster: rest.InClusterConfig,
+		newClient: func(c *rest.Config) (kubernetes.Interface, error) {
+			return kubernetes.NewForConfig(c)
+		},
+	}
+}
+
+func (l restConfigLoader) initClusters(devMode bool, clusters []config.Cluster, defaultNamespace string) ([]Cluster, error) {
+	if len(clusters) == 0 {
+		clusters = []config.Cluster{{Name: defaultClusterName}}
 	}
 
+	var initializedClusters []Cluster
+	for _, cluster := range clusters {
+		restConfig, err := l.restConfig(devMode, cluster)
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes-client error: could not init client for cluster %s: %w", cluster.Name, err)
+		}
+
+		client, err := kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes-client error: could not init client for cluster %s: %w", cluster.Name, err)
+		}
+
+		dynamicClient, err := dynamic.NewForConfig(restConfig)
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes-client error: could not init dynamic client for cluster %s: %w", cluster.Name, err)
+		}
+
+		namespace := cluster.Namespace
+		if namespace == "" {
+			namespace = defaultNamespace
+		}
+
+		initializedClusters = append(initializedClusters, Cluster{
+			Name:      cluster.Name,
+			Namespace: namespace,
+			Client:    client,
+			Dynamic:   dynamicClient,
+		})
+	}
+	return initializedClusters, nil
+}
+
+// restConfig selects the config of the cluster by precedence: kubeconfig secret, in-cluster, kubeconfig file and
+// context, the local kubeconfig in dev mode and finally the in-cluster config
+func (l restConfigLoader) restConfig(devMode bool, cluster config.Cluster) (*rest.Config, error) {
+	switch {
+	case cluster.KubeconfigSecret != nil:
+		return l.fromKubeconfigSecret(devMode, cluster)
+	case cluster.InCluster:
+		return l.inCluster()
+	case cluster.Kubeconfig != "" || cluster.Context != "":
+		return initFromKubeConfigContext(cluster.Kubeconfig, cluster.Context)
+	case devMode:
+		return initFromKubeConfig()
+	default:
+		return l.inCluster()
+	}
+}
+
+// fromKubeconfigSecret reads the kubeconfig of a remote cluster from a secret of the cluster differ is running in
+func (l restConfigLoader) fromKubeconfigSecret(devMode bool, cluster config.Cluster) (*rest.Config, error) {
+	localConfig, err := l.local(devMode)
 	if err != nil {
 		return nil, err
 	}
 
-	if initializedClient, err := kubernetes.NewForConfig(config); err != nil {
+	localClient, err := l.newClient(localConfig)
+	if err != nil {
 		return nil, err
-	} else {
-		return initializedClient, nil
 	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kubeconfigSecretReadTimeout)
+	defer cancel()
+	secret, err := localClient.CoreV1().Secrets(cluster.KubeconfigSecret.Namespace).Get(ctx, cluster.KubeconfigSecret.Name, metaV1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	key := cluster.KubeconfigSecret.Key
+	if key == "" {
+		key = defaultKubeconfigSecretKey
+	}
+
+	kubeconfig, ok := secret.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s does not contain the key %s", secret.Namespace, secret.Name, key)
+	}
+
+	clientConfig, err := clientcmd.NewClientConfigFromBytes(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if cluster.Context == "" {
+		return clientConfig.ClientConfig()
+	}
+
+	rawConfig, err := clientConfig.RawConfig()
+	if err != nil {
+		return nil, err
+	}
+	return clientcmd.NewNonInteractiveClientConfig(rawConfig, cluster.Context, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+}
+
+func (l restConfigLoader) local(devMode bool) (*rest.Config, error) {
+	if devMode {
+		return initFromKubeConfig()
+	}
+	return l.inCluster()
+}
+
+func initFromKubeConfigContext(kubeconfig, kubeContext string) (*rest.Config, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeconfig != "" {
+		loadingRules.ExplicitPath = kubeconfig
+	}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{CurrentContext: kubeContext}).ClientConfig()
 }
 
 func initFromKubeConfig() (*rest.Config, error) {
@@ -59,7 +197,3 @@ func initFromKubeConfig() (*rest.Config, error) {
 	}
 	return clientcmd.BuildConfigFromFlags("", homeDir+"/.kube/config")
 }
-
-func initInCLusterConfig() (*rest.Config, error) {
-	return rest.InClusterConfig()
-}
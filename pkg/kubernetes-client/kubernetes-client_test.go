@@ -0,0 +1,217 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package kubernetes_client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+
+	"github.com/fwiedmann/differ/pkg/config"
+)
+
+const inClusterHost = "https://in-cluster.example.com"
+
+// kubeconfig returns a kubeconfig with a context per server, the first context is the current one
+func kubeconfig(contexts ...string) []byte {
+	content := fmt.Sprintf("apiVersion: v1\nkind: Config\ncurrent-context: %s\nusers:\n- name: differ\n  user:\n    token: token\n", contexts[0])
+	content += "clusters:\n"
+	for _, context := range contexts {
+		content += fmt.Sprintf("- name: %s\n  cluster:\n    server: https://%s.example.com\n", context, context)
+	}
+	content += "contexts:\n"
+	for _, context := range contexts {
+		content += fmt.Sprintf("- name: %s\n  context:\n    cluster: %s\n    user: differ\n", context, context)
+	}
+	return []byte(content)
+}
+
+func testRestConfigLoader() restConfigLoader {
+	secret := &coreV1.Secret{
+		ObjectMeta: metaV1.ObjectMeta{Namespace: "differ", Name: "remote"},
+		Data: map[string][]byte{
+			"kubeconfig": kubeconfig("secret", "secret-staging"),
+			"config":     kubeconfig("secret-key"),
+		},
+	}
+	return restConfigLoader{
+		inCluster: func() (*rest.Config, error) {
+			return &rest.Config{Host: inClusterHost}, nil
+		},
+		newClient: func(c *rest.Config) (kubernetes.Interface, error) {
+			if c.Host != inClusterHost {
+				return nil, fmt.Errorf("secret read with the config of %s, want the in-cluster config", c.Host)
+			}
+			return fake.NewSimpleClientset(secret), nil
+		},
+	}
+}
+
+func TestRestConfigLoader_restConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "differ-kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "kubeconfig")
+	if err := ioutil.WriteFile(file, kubeconfig("file", "file-staging"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "home", ".kube"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "home", ".kube", "config"), kubeconfig("home"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	home := os.Getenv("HOME")
+	defer os.Setenv("HOME", home)
+	if err := os.Setenv("HOME", filepath.Join(dir, "home")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		devMode  bool
+		cluster  config.Cluster
+		wantHost string
+		wantErr  bool
+	}{
+		{
+			name:     "SecretFirst",
+			cluster:  config.Cluster{KubeconfigSecret: &config.KubeconfigSecret{Namespace: "differ", Name: "remote"}, InCluster: true, Kubeconfig: file},
+			wantHost: "https://secret.example.com",
+		},
+		{
+			name:     "SecretWithContext",
+			cluster:  config.Cluster{KubeconfigSecret: &config.KubeconfigSecret{Namespace: "differ", Name: "remote"}, Context: "secret-staging"},
+			wantHost: "https://secret-staging.example.com",
+		},
+		{
+			name:     "SecretWithKey",
+			cluster:  config.Cluster{KubeconfigSecret: &config.KubeconfigSecret{Namespace: "differ", Name: "remote", Key: "config"}},
+			wantHost: "https://secret-key.example.com",
+		},
+		{
+			name:    "SecretWithMissingKey",
+			cluster: config.Cluster{KubeconfigSecret: &config.KubeconfigSecret{Namespace: "differ", Name: "remote", Key: "missing"}},
+			wantErr: true,
+		},
+		{
+			name:    "MissingSecret",
+			cluster: config.Cluster{KubeconfigSecret: &config.KubeconfigSecret{Namespace: "differ", Name: "missing"}},
+			wantErr: true,
+		},
+		{
+			name:     "InClusterBeforeKubeconfig",
+			devMode:  true,
+			cluster:  config.Cluster{InCluster: true, Kubeconfig: file, Context: "file-staging"},
+			wantHost: inClusterHost,
+		},
+		{
+			name:     "KubeconfigWithContext",
+			devMode:  true,
+			cluster:  config.Cluster{Kubeconfig: file, Context: "file-staging"},
+			wantHost: "https://file-staging.example.com",
+		},
+		{
+			name:     "KubeconfigWithCurrentContext",
+			cluster:  config.Cluster{Kubeconfig: file},
+			wantHost: "https://file.example.com",
+		},
+		{
+			name:     "DevModeLocalKubeconfig",
+			devMode:  true,
+			wantHost: "https://home.example.com",
+		},
+		{
+			name:     "InClusterByDefault",
+			wantHost: inClusterHost,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := testRestConfigLoader().restConfig(tt.devMode, tt.cluster)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("restConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Host != tt.wantHost {
+				t.Errorf("restConfig() host = %s, want %s", got.Host, tt.wantHost)
+			}
+		})
+	}
+}
+
+func TestRestConfigLoader_initClusters(t *testing.T) {
+	tests := []struct {
+		name           string
+		clusters       []config.Cluster
+		wantNames      []string
+		wantNamespaces []string
+	}{
+		{
+			name:           "DefaultCluster",
+			wantNames:      []string{defaultClusterName},
+			wantNamespaces: []string{"default-namespace"},
+		},
+		{
+			name:           "NamespaceFallback",
+			clusters:       []config.Cluster{{Name: "production", Namespace: "apps"}, {Name: "staging"}},
+			wantNames:      []string{"production", "staging"},
+			wantNamespaces: []string{"apps", "default-namespace"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clusters, err := testRestConfigLoader().initClusters(false, tt.clusters, "default-namespace")
+			if err != nil {
+				t.Fatalf("initClusters() error = %v", err)
+			}
+			var names, namespaces []string
+			for _, cluster := range clusters {
+				names = append(names, cluster.Name)
+				namespaces = append(namespaces, cluster.Namespace)
+				if cluster.Client == nil || cluster.Dynamic == nil {
+					t.Errorf("initClusters() cluster %s without clients", cluster.Name)
+				}
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) || !reflect.DeepEqual(namespaces, tt.wantNamespaces) {
+				t.Errorf("initClusters() = %v in %v, want %v in %v", names, namespaces, tt.wantNames, tt.wantNamespaces)
+			}
+		})
+	}
+}
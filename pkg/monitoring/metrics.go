@@ -35,15 +35,65 @@ import (
 var (
 	KubernetesObservedContainerMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name:        "differ_kubernetes_observed_container",
-		Help:        "Represents a container in the cluster with meta information about the parent kubernetes object e.g. a Deployment. If a container gets deleted the gauge value will be set to zero.",
+		Help:        "Represents a container in the cluster with meta information about the parent kubernetes object e.g. a Deployment. If a container gets deleted its series is deleted.",
 		ConstLabels: nil,
-	}, []string{"container_name", "registry_url", "image", "image_tag", "namespace", "parent_object_api_version", "parent_object_kind", "parent_object_uid", "parent_object_name"})
+	}, []string{"cluster", "container_name", "registry_url", "image", "image_tag", "namespace", "parent_object_api_version", "parent_object_kind", "parent_object_uid", "parent_object_name"})
 
 	OciImageNewerTagAvailableMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name:        "differ_oci_image_new_tag_available",
-		Help:        "Represents a oci image with the current and the latest available tag",
+		Help:        "Represents a oci image with the current and the latest available tag within the constraint and regardless of it",
 		ConstLabels: nil,
-	}, []string{"image", "registry_url", "image_tag", "latest_tag", "tag_regex_expression"})
+	}, []string{"cluster", "image", "registry_url", "image_tag", "latest_tag", "latest_unconstrained_tag", "latest_variant_tag", "constraint", "tag_regex_expression", "snoozed"})
+
+	OciImagePinRecommendationMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "differ_oci_image_pin_recommendation",
+		Help:        "Represents a oci image running a floating tag with the most specific tag which has the same manifest digest",
+		ConstLabels: nil,
+	}, []string{"cluster", "image", "registry_url", "image_tag", "pinned_tag", "digest"})
+
+	OciRegistryRequestBudgetRemainingMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "differ_oci_registry_request_budget_remaining",
+		Help:        "Remaining requests within the current quota window of a OCI registry with a configured quota",
+		ConstLabels: nil,
+	}, []string{"registry_url"})
+
+	ImageVersionSkewMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "differ_image_version_skew",
+		Help:        "Number of distinct tags of an image which run across all observed workloads with the oldest and newest running tag",
+		ConstLabels: nil,
+	}, []string{"image", "registry_url", "oldest_tag", "newest_tag", "spread"})
+
+	ImageTimeToUpdateMetric = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        "differ_image_time_to_update_seconds",
+		Help:        "Time between the outdated notification of a workload container and the change of its tag. The mean time to update of a namespace is the sum divided by the count.",
+		ConstLabels: nil,
+		// one hour up to 64 days
+		Buckets: prometheus.ExponentialBuckets(3600, 2, 11),
+	}, []string{"cluster", "namespace"})
+
+	ReconciledImagesMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "differ_reconciled_images",
+		Help:        "Images which were added, updated or deleted by the periodic reconciliation with the kubernetes informer caches, because an informer event was missed",
+		ConstLabels: nil,
+	}, []string{"action"})
+
+	EventBusDroppedEventsMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "differ_event_bus_dropped_events",
+		Help:        "Notification events which were dropped because the queue of the subscription was full",
+		ConstLabels: nil,
+	}, []string{"subscription", "delivery_policy"})
+
+	NotificationsMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "differ_notifications",
+		Help:        "Notification events by notifier which were delivered or failed after all retries",
+		ConstLabels: nil,
+	}, []string{"notifier", "result"})
+
+	WebhookRequestsMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "differ_webhook_requests",
+		Help:        "Received registry push webhooks by source and result",
+		ConstLabels: nil,
+	}, []string{"source", "result"})
 
 	OciRegistryUnauthorizedErrorMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name:        "differ_oci_registry_unauthorized_error",
@@ -78,6 +128,6 @@ var (
 
 func MetricsHandler() http.Handler {
 	metricsRegistry := prometheus.NewRegistry()
-	metricsRegistry.MustRegister(prometheus.NewGoCollector(), prometheus.NewBuildInfoCollector(), KubernetesObservedContainerMetric, OciImageNewerTagAvailableMetric, OciRegistryUnauthorizedErrorMetric, OciRegistryForbiddenErrorMetric, OciRegistryAPIErrorMetric, OciRegistryNoTagsFoundMetric, OciRegistryToManyRequestsErrorMetric)
+	metricsRegistry.MustRegister(prometheus.NewGoCollector(), prometheus.NewBuildInfoCollector(), KubernetesObservedContainerMetric, OciImageNewerTagAvailableMetric, OciImagePinRecommendationMetric, OciRegistryRequestBudgetRemainingMetric, ImageVersionSkewMetric, ImageTimeToUpdateMetric, ReconciledImagesMetric, EventBusDroppedEventsMetric, NotificationsMetric, WebhookRequestsMetric, OciRegistryUnauthorizedErrorMetric, OciRegistryForbiddenErrorMetric, OciRegistryAPIErrorMetric, OciRegistryNoTagsFoundMetric, OciRegistryToManyRequestsErrorMetric)
 	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
 }
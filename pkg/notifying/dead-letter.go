@@ -0,0 +1,92 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package notifying
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/differentiating"
+	log "github.com/sirupsen/logrus"
+)
+
+// DeadLetter is an event which could not be delivered after all retries
+type DeadLetter struct {
+	Time     time.Time                         `json:"time"`
+	Notifier string                            `json:"notifier"`
+	Event    differentiating.NotificationEvent `json:"event"`
+	Attempts int                               `json:"attempts"`
+	Error    string                            `json:"error"`
+}
+
+// DeadLetterLog appends the dead letters as JSON lines, so that they can be inspected and delivered again by hand
+type DeadLetterLog struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	closer io.Closer
+}
+
+// NewDeadLetterLog opens the file for appending. Without path the dead letters are only logged.
+func NewDeadLetterLog(path string) (*DeadLetterLog, error) {
+	if path == "" {
+		return &DeadLetterLog{}, nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("notifying/dead-letter error: could not open %s: %w", path, err)
+	}
+	return &DeadLetterLog{writer: file, closer: file}, nil
+}
+
+// Write the dead letter to the log. A nil log only logs the dead letter.
+func (d *DeadLetterLog) Write(letter DeadLetter) {
+	encoded, err := json.Marshal(letter)
+	if err != nil {
+		log.Errorf("notifying/dead-letter error: could not encode dead letter of %s: %s", letter.Notifier, err)
+		return
+	}
+	log.Warnf("notifying/%s: dead letter after %d attempts: %s", letter.Notifier, letter.Attempts, encoded)
+	if d == nil || d.writer == nil {
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if _, err := d.writer.Write(append(encoded, '\n')); err != nil {
+		log.Errorf("notifying/dead-letter error: could not write dead letter of %s: %s", letter.Notifier, err)
+	}
+}
+
+// Close the file of the log
+func (d *DeadLetterLog) Close() error {
+	if d == nil || d.closer == nil {
+		return nil
+	}
+	return d.closer.Close()
+}
@@ -0,0 +1,398 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package notifying
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"net"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/differentiating"
+	"github.com/fwiedmann/differ/pkg/monitoring"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultDigestSubject = "differ digest"
+
+// DigestOptions configure a Digest
+type DigestOptions struct {
+	Name     string
+	Service  differentiating.Service
+	Schedule Schedule
+	SMTP     SMTPOptions
+	From     string
+	// Subject is followed by the number of outdated images, defaults to "differ digest"
+	Subject string
+	// Recipients receive the images of all namespaces without namespace recipients
+	Recipients          []string
+	NamespaceRecipients map[string][]string
+	// IncludeSnoozed lists snoozed updates, which are marked as snoozed
+	IncludeSnoozed bool
+	// SendEmpty sends a digest to all recipients even if none of their images is outdated
+	SendEmpty bool
+}
+
+// Digest periodically mails the outdated images grouped by namespace and owner. It is not subscribed to the events,
+// the images are listed from the service with the newer tags of the last checks.
+type Digest struct {
+	opts DigestOptions
+	now  func() time.Time
+}
+
+// digestReport is the data of the digest templates
+type digestReport struct {
+	Title      string
+	Generated  time.Time
+	Outdated   int
+	Namespaces []digestNamespace
+}
+
+type digestNamespace struct {
+	Name   string
+	Owners []digestOwner
+}
+
+type digestOwner struct {
+	// Name is empty for images without owner annotation
+	Name   string
+	Images []digestImage
+}
+
+type digestImage struct {
+	Workload   string
+	Container  string
+	Image      string
+	CurrentTag string
+	NewTag     string
+	LatestTag  string
+	Bump       string
+	// OutdatedFor is only known if the history is enabled
+	OutdatedFor string
+	Snoozed     bool
+	// CheckError is set if the last check of the image failed, so the newer tags may be outdated themselves
+	CheckError string
+}
+
+// NewDigest validates the recipients of the options
+func NewDigest(opts DigestOptions) (*Digest, error) {
+	if opts.Service == nil {
+		return nil, fmt.Errorf("notifying/digest error: %s: service required", opts.Name)
+	}
+	if opts.From == "" {
+		return nil, fmt.Errorf("notifying/digest error: %s: sender required", opts.Name)
+	}
+	if len(opts.Recipients) == 0 && len(opts.NamespaceRecipients) == 0 {
+		return nil, fmt.Errorf("notifying/digest error: %s: recipients required", opts.Name)
+	}
+	if _, _, err := net.SplitHostPort(opts.SMTP.Address); err != nil {
+		return nil, fmt.Errorf("notifying/digest error: %s: invalid SMTP address %q", opts.Name, opts.SMTP.Address)
+	}
+	switch opts.SMTP.StartTLS {
+	case "", StartTLSRequired, StartTLSOpportunistic, StartTLSDisabled:
+	default:
+		return nil, fmt.Errorf("notifying/digest error: %s: invalid STARTTLS policy %q", opts.Name, opts.SMTP.StartTLS)
+	}
+	if opts.Subject == "" {
+		opts.Subject = defaultDigestSubject
+	}
+	return &Digest{opts: opts, now: time.Now}, nil
+}
+
+// Name of the digest in logs and metrics
+func (d *Digest) Name() string {
+	return d.opts.Name
+}
+
+// Run sends the digest on each time of the schedule until the context is done
+func (d *Digest) Run(ctx context.Context) {
+	for {
+		next := d.opts.Schedule.Next(d.now())
+		if next.IsZero() {
+			log.Errorf("notifying/digest error: %s: schedule has no next time", d.opts.Name)
+			return
+		}
+		log.Debugf("notifying/digest: %s: next digest at %s", d.opts.Name, next)
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err := d.Send(ctx); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// Send mails the current digest to the recipients of each namespace. Namespaces with the same recipients are combined
+// into one mail.
+func (d *Digest) Send(ctx context.Context) error {
+	outdated, err := d.opts.Service.OutdatedImages(ctx, differentiating.ListOptions{SortBy: differentiating.SortByNamespace})
+	if err != nil {
+		return fmt.Errorf("notifying/digest error: %s: could not list outdated images: %w", d.opts.Name, err)
+	}
+
+	groups := d.recipientGroups(outdated)
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var failed []string
+	for _, key := range keys {
+		report := d.report(groups[key])
+		if report.Outdated == 0 && !d.opts.SendEmpty {
+			continue
+		}
+		recipients := strings.Split(key, ",")
+		if err := d.send(ctx, recipients, report); err != nil {
+			monitoring.NotificationsMetric.WithLabelValues(d.opts.Name, "failed").Inc()
+			log.Errorf("notifying/digest error: %s: could not send digest to %s: %s", d.opts.Name, key, err)
+			failed = append(failed, key)
+			continue
+		}
+		monitoring.NotificationsMetric.WithLabelValues(d.opts.Name, "delivered").Inc()
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("notifying/digest error: %s: could not send digest to %s", d.opts.Name, strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// recipientGroups groups the outdated images by the sorted and joined recipients of their namespace. With SendEmpty
+// all configured recipients get a group, even without images.
+func (d *Digest) recipientGroups(outdated []differentiating.OutdatedImage) map[string][]differentiating.OutdatedImage {
+	groups := make(map[string][]differentiating.OutdatedImage)
+	if d.opts.SendEmpty {
+		if key := recipientsKey(d.opts.Recipients); key != "" {
+			groups[key] = nil
+		}
+		for _, recipients := range d.opts.NamespaceRecipients {
+			if key := recipientsKey(recipients); key != "" {
+				groups[key] = nil
+			}
+		}
+	}
+
+	for _, img := range outdated {
+		if img.Snoozed && !d.opts.IncludeSnoozed {
+			continue
+		}
+		recipients, ok := d.opts.NamespaceRecipients[img.Event.Image.Workload.Namespace]
+		if !ok {
+			recipients = d.opts.Recipients
+		}
+		// namespaces without recipients are not reported
+		if key := recipientsKey(recipients); key != "" {
+			groups[key] = append(groups[key], img)
+		}
+	}
+	return groups
+}
+
+func recipientsKey(recipients []string) string {
+	unique := make(map[string]bool, len(recipients))
+	sorted := make([]string, 0, len(recipients))
+	for _, recipient := range recipients {
+		if recipient != "" && !unique[recipient] {
+			unique[recipient] = true
+			sorted = append(sorted, recipient)
+		}
+	}
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// report groups the images by namespace and owner, both sorted by name. Images without owner are listed last.
+func (d *Digest) report(outdated []differentiating.OutdatedImage) digestReport {
+	now := d.now()
+	report := digestReport{Title: d.opts.Subject, Generated: now, Outdated: len(outdated)}
+	checkErrors := make(map[string]string)
+
+	byNamespace := make(map[string]map[string][]digestImage)
+	for _, img := range outdated {
+		image := img.Event.Image
+		owners, ok := byNamespace[image.Workload.Namespace]
+		if !ok {
+			owners = make(map[string][]digestImage)
+			byNamespace[image.Workload.Namespace] = owners
+		}
+		owners[image.Owner] = append(owners[image.Owner], d.digestImage(img, now, checkErrors))
+	}
+
+	for namespace, owners := range byNamespace {
+		entry := digestNamespace{Name: namespace}
+		for owner, images := range owners {
+			sort.SliceStable(images, func(i, j int) bool {
+				if images[i].Workload != images[j].Workload {
+					return images[i].Workload < images[j].Workload
+				}
+				return images[i].Container < images[j].Container
+			})
+			entry.Owners = append(entry.Owners, digestOwner{Name: owner, Images: images})
+		}
+		sort.Slice(entry.Owners, func(i, j int) bool {
+			a, b := entry.Owners[i].Name, entry.Owners[j].Name
+			if a == "" || b == "" {
+				return b == ""
+			}
+			return a < b
+		})
+		report.Namespaces = append(report.Namespaces, entry)
+	}
+	sort.Slice(report.Namespaces, func(i, j int) bool {
+		return report.Namespaces[i].Name < report.Namespaces[j].Name
+	})
+	return report
+}
+
+// digestImage converts the outdated image. The errors of the last checks are cached by image name, because all
+// containers of an image share the worker.
+func (d *Digest) digestImage(img differentiating.OutdatedImage, now time.Time, checkErrors map[string]string) digestImage {
+	event := img.Event
+	image := event.Image
+	workload := image.Workload.Name
+	if image.Workload.Kind != "" {
+		workload = image.Workload.Kind + "/" + workload
+	}
+
+	entry := digestImage{
+		Workload:   workload,
+		Container:  image.Workload.Container,
+		Image:      image.GetNameWithRegistry(),
+		CurrentTag: event.OldTag,
+		NewTag:     event.NewTag,
+		Bump:       string(event.Bump),
+		Snoozed:    img.Snoozed,
+	}
+	if entry.NewTag == entry.CurrentTag {
+		entry.NewTag = ""
+	}
+	if event.LatestTag != event.NewTag && event.LatestTag != event.OldTag {
+		entry.LatestTag = event.LatestTag
+	}
+	if img.OutdatedSince != nil {
+		entry.OutdatedFor = formatAge(now.Sub(*img.OutdatedSince))
+	}
+
+	name := image.GetNameWithRegistry()
+	checkError, ok := checkErrors[name]
+	if !ok {
+		if status, err := d.opts.Service.WorkerStatus(name); err == nil && status.LastError != "" &&
+			(status.LastSuccess == nil || (status.LastErrorAt != nil && status.LastErrorAt.After(*status.LastSuccess))) {
+			checkError = status.LastError
+		}
+		checkErrors[name] = checkError
+	}
+	entry.CheckError = checkError
+	return entry
+}
+
+// formatAge rounds the duration to days or hours
+func formatAge(age time.Duration) string {
+	switch {
+	case age >= 48*time.Hour:
+		return fmt.Sprintf("%d days", int(age/(24*time.Hour)))
+	case age >= 2*time.Hour:
+		return fmt.Sprintf("%d hours", int(age/time.Hour))
+	default:
+		return "less than 2 hours"
+	}
+}
+
+func (d *Digest) send(ctx context.Context, recipients []string, report digestReport) error {
+	var text, html bytes.Buffer
+	if err := digestTextTemplate.Execute(&text, report); err != nil {
+		return err
+	}
+	if err := digestHTMLTemplate.Execute(&html, report); err != nil {
+		return err
+	}
+	return sendMail(ctx, d.opts.SMTP, mailMessage{
+		from:    d.opts.From,
+		to:      recipients,
+		subject: fmt.Sprintf("%s: %d outdated images", d.opts.Subject, report.Outdated),
+		date:    report.Generated,
+		text:    text.Bytes(),
+		html:    html.Bytes(),
+	})
+}
+
+var digestTextTemplate = template.Must(template.New("digest").Parse(`{{ .Title }}
+{{ if .Outdated }}{{ .Outdated }} outdated images{{ else }}All images are up to date.{{ end }}
+{{ range .Namespaces }}
+Namespace {{ .Name }}
+{{ range .Owners }}
+  Owner: {{ if .Name }}{{ .Name }}{{ else }}unknown{{ end }}
+{{- range .Images }}
+  - {{ .Workload }}{{ if .Container }} ({{ .Container }}){{ end }}: {{ .Image }}
+    {{ .CurrentTag }}{{ if .NewTag }} -> {{ .NewTag }}{{ end }}{{ if .Bump }} ({{ .Bump }}){{ end }}{{ if .LatestTag }}, latest {{ .LatestTag }}{{ end }}{{ if .OutdatedFor }}, outdated for {{ .OutdatedFor }}{{ end }}{{ if .Snoozed }}, snoozed{{ end }}
+{{- if .CheckError }}
+    last check failed: {{ .CheckError }}
+{{- end }}
+{{- end }}
+{{ end }}{{ end }}
+Generated by differ at {{ .Generated.Format "2006-01-02 15:04 MST" }}
+`))
+
+var digestHTMLTemplate = htmltemplate.Must(htmltemplate.New("digest").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{ .Title }}</title></head>
+<body style="font-family: sans-serif; color: #24292e;">
+<h1 style="font-size: 20px;">{{ .Title }}</h1>
+<p>{{ if .Outdated }}{{ .Outdated }} outdated images{{ else }}All images are up to date.{{ end }}</p>
+{{- range .Namespaces }}
+<h2 style="font-size: 16px; margin-top: 24px;">Namespace {{ .Name }}</h2>
+{{- range .Owners }}
+<h3 style="font-size: 14px;">Owner: {{ if .Name }}{{ .Name }}{{ else }}unknown{{ end }}</h3>
+<table style="border-collapse: collapse; font-size: 13px;" cellpadding="6">
+<tr style="background: #f6f8fa; text-align: left;"><th>Workload</th><th>Container</th><th>Image</th><th>Current tag</th><th>New tag</th><th>Bump</th><th>Outdated for</th></tr>
+{{- range .Images }}
+<tr style="border-top: 1px solid #e1e4e8;">
+<td>{{ .Workload }}</td>
+<td>{{ .Container }}</td>
+<td>{{ .Image }}{{ if .CheckError }}<br><span style="color: #cb2431;">last check failed: {{ .CheckError }}</span>{{ end }}</td>
+<td><code>{{ .CurrentTag }}</code></td>
+<td><code>{{ .NewTag }}</code>{{ if .LatestTag }}<br>latest <code>{{ .LatestTag }}</code>{{ end }}{{ if .Snoozed }}<br><em>snoozed</em>{{ end }}</td>
+<td>{{ .Bump }}</td>
+<td>{{ .OutdatedFor }}</td>
+</tr>
+{{- end }}
+</table>
+{{- end }}
+{{- end }}
+<p style="color: #6a737d; font-size: 12px; margin-top: 24px;">Generated by differ at {{ .Generated.Format "2006-01-02 15:04 MST" }}</p>
+</body>
+</html>
+`))
@@ -0,0 +1,452 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package notifying
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io/ioutil"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/analyzing"
+	"github.com/fwiedmann/differ/pkg/differentiating"
+)
+
+type smtpMessage struct {
+	from string
+	to   []string
+	data []byte
+	tls  bool
+	auth string
+}
+
+// smtpServer accepts all mails. STARTTLS is only offered with a TLS config.
+type smtpServer struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	mutex     sync.Mutex
+	messages  []smtpMessage
+}
+
+func newSMTPServer(t *testing.T, tlsConfig *tls.Config) *smtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &smtpServer{listener: listener, tlsConfig: tlsConfig}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+	text := textproto.NewConn(conn)
+	_ = text.PrintfLine("220 localhost ESMTP")
+
+	var message smtpMessage
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "EHLO", "HELO":
+			extensions := []string{"localhost", "AUTH PLAIN"}
+			if s.tlsConfig != nil && !message.tls {
+				extensions = append(extensions, "STARTTLS")
+			}
+			for i, extension := range extensions {
+				separator := "-"
+				if i == len(extensions)-1 {
+					separator = " "
+				}
+				_ = text.PrintfLine("250%s%s", separator, extension)
+			}
+		case "STARTTLS":
+			_ = text.PrintfLine("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			text = textproto.NewConn(tlsConn)
+			message.tls = true
+		case "AUTH":
+			credentials, _ := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+			message.auth = string(credentials)
+			_ = text.PrintfLine("235 authenticated")
+		case "MAIL":
+			message.from = strings.Trim(strings.TrimPrefix(strings.ToUpper(fields[1][:5]), "FROM:")+fields[1][5:], "<>")
+			_ = text.PrintfLine("250 ok")
+		case "RCPT":
+			message.to = append(message.to, strings.Trim(fields[1][3:], "<>"))
+			_ = text.PrintfLine("250 ok")
+		case "DATA":
+			_ = text.PrintfLine("354 end data with <CR><LF>.<CR><LF>")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			message.data = data
+			s.mutex.Lock()
+			s.messages = append(s.messages, message)
+			s.mutex.Unlock()
+			message = smtpMessage{tls: message.tls, auth: message.auth}
+			_ = text.PrintfLine("250 queued")
+		case "QUIT":
+			_ = text.PrintfLine("221 bye")
+			return
+		default:
+			_ = text.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+// selfSignedTLS returns the server config and a client config, which trusts the certificate of 127.0.0.1
+func selfSignedTLS(t *testing.T) (*tls.Config, *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "differ test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(certificate)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}, &tls.Config{RootCAs: roots}
+}
+
+type digestMail struct {
+	to      string
+	subject string
+	text    string
+	html    string
+}
+
+func parseDigestMail(t *testing.T, message smtpMessage) digestMail {
+	parsed, err := mail.ReadMessage(bytes.NewReader(message.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := digestMail{to: parsed.Header.Get("To"), subject: subject}
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err != nil {
+			break
+		}
+		content, err := ioutil.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(part.Header.Get("Content-Type"), "text/html") {
+			digest.html = string(content)
+		} else {
+			digest.text = string(content)
+		}
+	}
+	return digest
+}
+
+func outdatedImage(id, namespace, workload, owner, name, tag, newTag string) differentiating.OutdatedImage {
+	return differentiating.OutdatedImage{Event: differentiating.NotificationEvent{
+		Type: differentiating.EventTypeOutdated,
+		Image: differentiating.Image{ID: id, Registry: "registry-1.docker.io", Name: name, Tag: tag, Owner: owner,
+			Workload: differentiating.Workload{Namespace: namespace, Kind: "Deployment", Name: workload, Container: "app"}},
+		OldTag:    tag,
+		NewTag:    newTag,
+		LatestTag: newTag,
+		Bump:      analyzing.ClassifyBump(tag, newTag),
+	}}
+}
+
+func TestDigest_Send(t *testing.T) {
+	now := time.Date(2020, 12, 7, 8, 0, 0, 0, time.UTC)
+	outdatedSince := now.Add(-10 * 24 * time.Hour)
+	lastSuccess, lastError := now.Add(-2*time.Hour), now.Add(-time.Hour)
+
+	frontend := outdatedImage("1", "web", "frontend", "team-web", "library/nginx", "1.18.0", "1.19.0")
+	frontend.OutdatedSince = &outdatedSince
+	cache := outdatedImage("4", "web", "cache", "team-web", "library/memcached", "1.5", "1.6")
+	cache.Snoozed = true
+	service := differentiating.MockService{
+		Outdated: []differentiating.OutdatedImage{
+			frontend,
+			outdatedImage("2", "web", "backend", "", "library/golang", "1.14", "1.15"),
+			outdatedImage("3", "payments", "api", "team-payments", "library/redis", "5.0", "6.0"),
+			cache,
+		},
+		Workers: []differentiating.WorkerStatus{
+			{Image: "registry-1.docker.io/library/nginx", LastSuccess: &lastSuccess, LastErrorAt: &lastError, LastError: "unauthorized"},
+		},
+	}
+
+	serverTLS, clientTLS := selfSignedTLS(t)
+	server := newSMTPServer(t, serverTLS)
+	digest, err := NewDigest(DigestOptions{
+		Name:    "weekly",
+		Service: service,
+		SMTP: SMTPOptions{
+			Address:   server.listener.Addr().String(),
+			Username:  "differ",
+			Password:  "secret",
+			TLSConfig: clientTLS,
+		},
+		From:                "differ@example.com",
+		Subject:             "Weekly image updates",
+		Recipients:          []string{"platform@example.com"},
+		NamespaceRecipients: map[string][]string{"payments": {"payments@example.com", "payments@example.com"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest.now = func() time.Time { return now }
+
+	if err := digest.Send(context.Background()); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if len(server.messages) != 2 {
+		t.Fatalf("Send() sent %d mails, want 2", len(server.messages))
+	}
+	for _, message := range server.messages {
+		if !message.tls || message.auth != "\x00differ\x00secret" || message.from != "differ@example.com" {
+			t.Errorf("Send() sent mail from %s with TLS %v and auth %q, want STARTTLS and PLAIN auth", message.from, message.tls, message.auth)
+		}
+	}
+
+	payments := parseDigestMail(t, server.messages[0])
+	if payments.to != "payments@example.com" || payments.subject != "Weekly image updates: 1 outdated images" {
+		t.Errorf("Send() sent %q to %s, want the payments digest to payments@example.com", payments.subject, payments.to)
+	}
+	if !strings.Contains(payments.text, "Namespace payments") || strings.Contains(payments.text, "Namespace web") {
+		t.Errorf("Send() sent payments digest:\n%s", payments.text)
+	}
+
+	platform := parseDigestMail(t, server.messages[1])
+	if platform.to != "platform@example.com" || platform.subject != "Weekly image updates: 2 outdated images" {
+		t.Errorf("Send() sent %q to %s, want the web digest to platform@example.com", platform.subject, platform.to)
+	}
+	wantText := []string{
+		"Namespace web",
+		"Owner: team-web",
+		"Deployment/frontend (app): registry-1.docker.io/library/nginx",
+		"1.18.0 -> 1.19.0 (minor), outdated for 10 days",
+		"last check failed: unauthorized",
+		"Owner: unknown",
+		"Deployment/backend (app): registry-1.docker.io/library/golang",
+	}
+	position := 0
+	for _, want := range wantText {
+		index := strings.Index(platform.text[position:], want)
+		if index < 0 {
+			t.Fatalf("Send() sent web digest without %q after position %d:\n%s", want, position, platform.text)
+		}
+		position += index + len(want)
+	}
+	if strings.Contains(platform.text, "memcached") || strings.Contains(platform.html, "memcached") {
+		t.Errorf("Send() listed the snoozed image:\n%s", platform.text)
+	}
+	if !strings.Contains(platform.html, "<h2 style=\"font-size: 16px; margin-top: 24px;\">Namespace web</h2>") || !strings.Contains(platform.html, "<code>1.19.0</code>") {
+		t.Errorf("Send() sent web digest HTML:\n%s", platform.html)
+	}
+}
+
+func TestDigest_Send_empty(t *testing.T) {
+	tests := []struct {
+		name      string
+		sendEmpty bool
+		wantMails int
+	}{
+		{name: "Skipped"},
+		{name: "SendEmpty", sendEmpty: true, wantMails: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newSMTPServer(t, nil)
+			digest, err := NewDigest(DigestOptions{
+				Name:                "weekly",
+				Service:             differentiating.MockService{},
+				SMTP:                SMTPOptions{Address: server.listener.Addr().String(), StartTLS: StartTLSDisabled},
+				From:                "differ@example.com",
+				Recipients:          []string{"platform@example.com"},
+				NamespaceRecipients: map[string][]string{"payments": {"payments@example.com"}},
+				SendEmpty:           tt.sendEmpty,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := digest.Send(context.Background()); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			if len(server.messages) != tt.wantMails {
+				t.Fatalf("Send() sent %d mails, want %d", len(server.messages), tt.wantMails)
+			}
+			for _, message := range server.messages {
+				if text := parseDigestMail(t, message).text; !strings.Contains(text, "All images are up to date.") {
+					t.Errorf("Send() sent empty digest:\n%s", text)
+				}
+			}
+		})
+	}
+}
+
+func TestDigest_Send_startTLS(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   StartTLSPolicy
+		wantErr  bool
+		wantTLS  bool
+		offerTLS bool
+	}{
+		{name: "Required", offerTLS: true, wantTLS: true},
+		{name: "RequiredByDefaultButNotOffered", wantErr: true},
+		{name: "ExplicitlyRequiredButNotOffered", policy: StartTLSRequired, wantErr: true},
+		{name: "Opportunistic", policy: StartTLSOpportunistic, offerTLS: true, wantTLS: true},
+		{name: "OpportunisticNotOffered", policy: StartTLSOpportunistic},
+		{name: "Disabled", policy: StartTLSDisabled, offerTLS: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverTLS, clientTLS := selfSignedTLS(t)
+			if !tt.offerTLS {
+				serverTLS = nil
+			}
+			server := newSMTPServer(t, serverTLS)
+			digest, err := NewDigest(DigestOptions{
+				Name:       "weekly",
+				Service:    differentiating.MockService{Outdated: []differentiating.OutdatedImage{outdatedImage("1", "web", "frontend", "", "library/nginx", "1.18.0", "1.19.0")}},
+				SMTP:       SMTPOptions{Address: server.listener.Addr().String(), StartTLS: tt.policy, TLSConfig: clientTLS},
+				From:       "differ@example.com",
+				Recipients: []string{"platform@example.com"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := digest.Send(context.Background()); (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if len(server.messages) != 0 {
+					t.Errorf("Send() sent %d mails without TLS", len(server.messages))
+				}
+				return
+			}
+			if len(server.messages) != 1 || server.messages[0].tls != tt.wantTLS {
+				t.Errorf("Send() sent %+v, want one mail with TLS %v", server.messages, tt.wantTLS)
+			}
+		})
+	}
+}
+
+func TestNewDigest(t *testing.T) {
+	valid := DigestOptions{
+		Service:    differentiating.MockService{},
+		SMTP:       SMTPOptions{Address: "smtp.example.com:587"},
+		From:       "differ@example.com",
+		Recipients: []string{"platform@example.com"},
+	}
+	tests := []struct {
+		name    string
+		modify  func(opts *DigestOptions)
+		wantErr bool
+	}{
+		{name: "Valid", modify: func(opts *DigestOptions) {}},
+		{name: "NamespaceRecipientsOnly", modify: func(opts *DigestOptions) {
+			opts.Recipients = nil
+			opts.NamespaceRecipients = map[string][]string{"web": {"web@example.com"}}
+		}},
+		{name: "MissingService", modify: func(opts *DigestOptions) { opts.Service = nil }, wantErr: true},
+		{name: "MissingSender", modify: func(opts *DigestOptions) { opts.From = "" }, wantErr: true},
+		{name: "MissingRecipients", modify: func(opts *DigestOptions) { opts.Recipients = nil }, wantErr: true},
+		{name: "MissingPort", modify: func(opts *DigestOptions) { opts.SMTP.Address = "smtp.example.com" }, wantErr: true},
+		{name: "InvalidStartTLS", modify: func(opts *DigestOptions) { opts.SMTP.StartTLS = "maybe" }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := valid
+			tt.modify(&opts)
+			if _, err := NewDigest(opts); (err != nil) != tt.wantErr {
+				t.Errorf("NewDigest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+// Package notifying delivers the notification events of the differentiating.Service to external systems
+package notifying
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/fwiedmann/differ/pkg/differentiating"
+	"github.com/fwiedmann/differ/pkg/monitoring"
+	log "github.com/sirupsen/logrus"
+)
+
+// Notifier delivers notification events to an external system
+type Notifier interface {
+	// Name identifies the notifier in logs, metrics and dead letters
+	Name() string
+	// Notify delivers the event and returns after the delivery succeeded or finally failed
+	Notify(ctx context.Context, event differentiating.NotificationEvent) error
+}
+
+// Run delivers the events of the channel one by one to the notifier until the channel is closed. Each notifier should
+// read from its own differentiating.Service.Notify channel, so that a slow notifier does not delay the others.
+func Run(ctx context.Context, notifier Notifier, events <-chan differentiating.NotificationEvent) {
+	for event := range events {
+		if err := notifier.Notify(ctx, event); err != nil {
+			monitoring.NotificationsMetric.WithLabelValues(notifier.Name(), "failed").Inc()
+			log.Errorf("notifying/%s error: could not deliver %s event of image %s: %s", notifier.Name(), event.Type, event.Image.GetNameWithRegistry(), err)
+			continue
+		}
+		monitoring.NotificationsMetric.WithLabelValues(notifier.Name(), "delivered").Inc()
+	}
+}
+
+// templateFuncs are available in all payload templates
+var templateFuncs = template.FuncMap{
+	// json encodes the value, e.g. to quote a string within a JSON payload
+	"json": func(v interface{}) (string, error) {
+		var encoded strings.Builder
+		encoder := json.NewEncoder(&encoded)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(v); err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(encoded.String(), "\n"), nil
+	},
+	// upper and lower accept any value, so typed strings like the event type can be passed directly
+	"upper": func(v interface{}) string {
+		return strings.ToUpper(fmt.Sprint(v))
+	},
+	"lower": func(v interface{}) string {
+		return strings.ToLower(fmt.Sprint(v))
+	},
+}
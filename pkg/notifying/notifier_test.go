@@ -0,0 +1,79 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package notifying
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fwiedmann/differ/pkg/differentiating"
+	"github.com/fwiedmann/differ/pkg/monitoring"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type notifierMock struct {
+	name   string
+	err    error
+	events []differentiating.NotificationEvent
+}
+
+func (n *notifierMock) Name() string {
+	return n.name
+}
+
+func (n *notifierMock) Notify(_ context.Context, event differentiating.NotificationEvent) error {
+	n.events = append(n.events, event)
+	return n.err
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantResult string
+	}{
+		{name: "run-delivered", wantResult: "delivered"},
+		{name: "run-failed", err: errors.New("unreachable"), wantResult: "failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier := &notifierMock{name: tt.name, err: tt.err}
+			events := make(chan differentiating.NotificationEvent, 2)
+			events <- testEvent
+			events <- testEvent
+			close(events)
+
+			Run(context.Background(), notifier, events)
+
+			if len(notifier.events) != 2 {
+				t.Errorf("Run() delivered %d events, want 2", len(notifier.events))
+			}
+			if got := testutil.ToFloat64(monitoring.NotificationsMetric.WithLabelValues(tt.name, tt.wantResult)); got != 2 {
+				t.Errorf("Run() counted %v %s notifications, want 2", got, tt.wantResult)
+			}
+		})
+	}
+}
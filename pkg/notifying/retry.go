@@ -0,0 +1,135 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package notifying
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetries    = 3
+	defaultBackoff    = time.Second
+	defaultMaxBackoff = time.Minute
+)
+
+// deliveryError describes a failed delivery attempt. Errors of other types are retried.
+type deliveryError struct {
+	err        error
+	permanent  bool
+	retryAfter time.Duration
+}
+
+func (e *deliveryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *deliveryError) Unwrap() error {
+	return e.err
+}
+
+// statusError returns nil for 2xx responses. Timeouts, rate limits and server errors are retried, other responses
+// failed permanently.
+func statusError(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	err := &deliveryError{err: fmt.Errorf("unexpected status %s", resp.Status)}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= 500:
+		if seconds, parseErr := strconv.Atoi(resp.Header.Get("Retry-After")); parseErr == nil && seconds > 0 {
+			err.retryAfter = time.Duration(seconds) * time.Second
+		}
+	default:
+		err.permanent = true
+	}
+	return err
+}
+
+// retryPolicy retries failed deliveries with an exponential backoff, which is capped by the max backoff. A longer
+// Retry-After of the response is respected up to the max backoff.
+type retryPolicy struct {
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// newRetryPolicy applies the defaults of 3 retries if the retries are unset and 1s backoff. Zero retries disable retrying.
+func newRetryPolicy(configuredRetries *int, backoff time.Duration) retryPolicy {
+	retries := defaultRetries
+	if configuredRetries != nil && *configuredRetries >= 0 {
+		retries = *configuredRetries
+	}
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+	maxBackoff := defaultMaxBackoff
+	if backoff > maxBackoff {
+		maxBackoff = backoff
+	}
+	return retryPolicy{retries: retries, backoff: backoff, maxBackoff: maxBackoff}
+}
+
+// do runs the delivery until it succeeds, fails permanently or all retries failed and returns the number of attempts
+func (p retryPolicy) do(ctx context.Context, deliver func(ctx context.Context) error) (int, error) {
+	backoff := p.backoff
+	for attempt := 1; ; attempt++ {
+		err := deliver(ctx)
+		if err == nil {
+			return attempt, nil
+		}
+
+		var delivery *deliveryError
+		isDeliveryError := errors.As(err, &delivery)
+		if (isDeliveryError && delivery.permanent) || attempt > p.retries {
+			return attempt, err
+		}
+
+		wait := backoff
+		if isDeliveryError && delivery.retryAfter > wait {
+			wait = delivery.retryAfter
+		}
+		if wait > p.maxBackoff {
+			wait = p.maxBackoff
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		}
+
+		backoff *= 2
+		if backoff > p.maxBackoff {
+			backoff = p.maxBackoff
+		}
+	}
+}
@@ -0,0 +1,65 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package notifying
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_do(t *testing.T) {
+	tests := []struct {
+		name         string
+		retries      *int
+		retryAfter   time.Duration
+		wantAttempts int
+	}{
+		{name: "DefaultRetries", wantAttempts: defaultRetries + 1},
+		{name: "RetriesDisabled", retries: intPtr(0), wantAttempts: 1},
+		{name: "RetryAfterCappedByMaxBackoff", retries: intPtr(1), retryAfter: time.Hour, wantAttempts: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := newRetryPolicy(tt.retries, time.Millisecond)
+			policy.maxBackoff = time.Millisecond * 10
+
+			start := time.Now()
+			attempts, err := policy.do(context.Background(), func(ctx context.Context) error {
+				return &deliveryError{err: errors.New("unavailable"), retryAfter: tt.retryAfter}
+			})
+			if err == nil {
+				t.Fatal("do() expected an error")
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("do() attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("do() waited %s, want the wait capped by the max backoff", elapsed)
+			}
+		})
+	}
+}
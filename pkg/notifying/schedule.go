@@ -0,0 +1,196 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package notifying
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scheduleDescriptors are shortcuts for common schedules
+var scheduleDescriptors = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// scheduleField is a field of a cron expression with its range
+type scheduleField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var scheduleFields = []scheduleField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}},
+	// 7 is an alias of sunday
+	{name: "day of week", min: 0, max: 7, names: map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}},
+}
+
+// Schedule is a parsed cron expression with the fields minute, hour, day of month, month and day of week
+type Schedule struct {
+	minutes, hours, days, months, weekdays map[int]bool
+	// if day of month and day of week are both restricted, a time matches if either of them matches
+	anyDay, anyWeekday bool
+	location           *time.Location
+}
+
+// ParseSchedule parses a cron expression like "0 8 * * mon" or one of the descriptors @hourly, @daily, @weekly and
+// @monthly. The fields support lists, ranges, steps and the names of months and weekdays. The schedule is evaluated in
+// the location, which defaults to UTC.
+func ParseSchedule(expression string, location *time.Location) (Schedule, error) {
+	if descriptor, ok := scheduleDescriptors[strings.ToLower(strings.TrimSpace(expression))]; ok {
+		expression = descriptor
+	}
+	values := strings.Fields(expression)
+	if len(values) != len(scheduleFields) {
+		return Schedule{}, fmt.Errorf("notifying/schedule error: expression %q has %d fields, want %d", expression, len(values), len(scheduleFields))
+	}
+
+	parsed := make([]map[int]bool, len(scheduleFields))
+	for i, field := range scheduleFields {
+		matches, err := field.parse(values[i])
+		if err != nil {
+			return Schedule{}, fmt.Errorf("notifying/schedule error: expression %q: %w", expression, err)
+		}
+		parsed[i] = matches
+	}
+	if parsed[4][7] {
+		parsed[4][0] = true
+	}
+	if location == nil {
+		location = time.UTC
+	}
+	return Schedule{
+		minutes:    parsed[0],
+		hours:      parsed[1],
+		days:       parsed[2],
+		months:     parsed[3],
+		weekdays:   parsed[4],
+		anyDay:     values[2] == "*",
+		anyWeekday: values[4] == "*",
+		location:   location,
+	}, nil
+}
+
+// parse returns the matching values of a comma separated list of values, ranges and steps like "1-5/2"
+func (f scheduleField) parse(value string) (map[int]bool, error) {
+	matches := make(map[int]bool)
+	for _, part := range strings.Split(value, ",") {
+		rangeValue, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rangeValue = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step %q of %s", part[i+1:], f.name)
+			}
+		}
+
+		start, end := f.min, f.max
+		switch {
+		case rangeValue == "*":
+		case strings.Contains(rangeValue, "-"):
+			bounds := strings.SplitN(rangeValue, "-", 2)
+			var err error
+			if start, err = f.value(bounds[0]); err != nil {
+				return nil, err
+			}
+			if end, err = f.value(bounds[1]); err != nil {
+				return nil, err
+			}
+			if start > end {
+				return nil, fmt.Errorf("invalid range %q of %s", rangeValue, f.name)
+			}
+		default:
+			var err error
+			if start, err = f.value(rangeValue); err != nil {
+				return nil, err
+			}
+			// a single value with step, e.g. 5/15, runs until the end of the range
+			if step == 1 {
+				end = start
+			}
+		}
+
+		for v := start; v <= end; v += step {
+			matches[v] = true
+		}
+	}
+	return matches, nil
+}
+
+func (f scheduleField) value(value string) (int, error) {
+	if v, ok := f.names[strings.ToLower(value)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q, want %d-%d", f.name, value, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next returns the first time after the given time, which matches the schedule. It returns the zero time if no time
+// within the next five years matches, e.g. for the 30th of February.
+func (s Schedule) Next(after time.Time) time.Time {
+	t := after.In(s.location).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !s.months[int(t.Month())]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location)
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location)
+		case !s.hours[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.location)
+		case !s.minutes[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s Schedule) matchesDay(t time.Time) bool {
+	day, weekday := s.days[t.Day()], s.weekdays[int(t.Weekday())]
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekday
+	case s.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
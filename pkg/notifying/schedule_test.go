@@ -0,0 +1,99 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package notifying
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule_Next(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Thursday
+	after := time.Date(2020, 12, 3, 10, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		expression string
+		location   *time.Location
+		want       time.Time
+	}{
+		{name: "EveryMinute", expression: "* * * * *", want: time.Date(2020, 12, 3, 10, 31, 0, 0, time.UTC)},
+		{name: "Hourly", expression: "@hourly", want: time.Date(2020, 12, 3, 11, 0, 0, 0, time.UTC)},
+		{name: "Daily", expression: "@daily", want: time.Date(2020, 12, 4, 0, 0, 0, 0, time.UTC)},
+		{name: "Weekly", expression: "@weekly", want: time.Date(2020, 12, 6, 0, 0, 0, 0, time.UTC)},
+		{name: "Monthly", expression: "@monthly", want: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "WeekdayName", expression: "0 8 * * mon", want: time.Date(2020, 12, 7, 8, 0, 0, 0, time.UTC)},
+		{name: "SundayAlias", expression: "0 8 * * 7", want: time.Date(2020, 12, 6, 8, 0, 0, 0, time.UTC)},
+		{name: "SameDay", expression: "45 10 * * thu", want: time.Date(2020, 12, 3, 10, 45, 0, 0, time.UTC)},
+		{name: "List", expression: "0 9,17 * * *", want: time.Date(2020, 12, 3, 17, 0, 0, 0, time.UTC)},
+		{name: "RangeWithStep", expression: "*/20 8-10 * * *", want: time.Date(2020, 12, 3, 10, 40, 0, 0, time.UTC)},
+		{name: "StartWithStep", expression: "5/30 * * * *", want: time.Date(2020, 12, 3, 10, 35, 0, 0, time.UTC)},
+		{name: "MonthName", expression: "0 0 1 mar-apr *", want: time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "DayOfMonthOrWeek", expression: "0 0 15 * fri", want: time.Date(2020, 12, 4, 0, 0, 0, 0, time.UTC)},
+		{name: "LeapDay", expression: "0 0 29 2 *", want: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{name: "Location", expression: "0 8 * * *", location: berlin, want: time.Date(2020, 12, 4, 8, 0, 0, 0, berlin)},
+		{name: "NeverMatches", expression: "0 0 30 2 *"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseSchedule(tt.expression, tt.location)
+			if err != nil {
+				t.Fatalf("ParseSchedule() error = %v", err)
+			}
+			if got := schedule.Next(after); !got.Equal(tt.want) {
+				t.Errorf("Next() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		wantErr    bool
+	}{
+		{name: "Valid", expression: "0 8 * * mon-fri"},
+		{name: "Descriptor", expression: " @Weekly "},
+		{name: "MissingField", expression: "0 8 * *", wantErr: true},
+		{name: "UnknownDescriptor", expression: "@yearly", wantErr: true},
+		{name: "OutOfRange", expression: "60 * * * *", wantErr: true},
+		{name: "DayZero", expression: "0 0 0 * *", wantErr: true},
+		{name: "InvalidRange", expression: "0 17-9 * * *", wantErr: true},
+		{name: "InvalidStep", expression: "*/0 * * * *", wantErr: true},
+		{name: "UnknownName", expression: "0 8 * * monday", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseSchedule(tt.expression, nil); (err != nil) != tt.wantErr {
+				t.Errorf("ParseSchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package notifying
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fwiedmann/differ/pkg/differentiating"
+)
+
+// slackMessage is the body of chat.postMessage, chat.update and incoming webhooks
+type slackMessage struct {
+	Channel string `json:"channel,omitempty"`
+	// TS identifies the message to update
+	TS string `json:"ts,omitempty"`
+	// ThreadTS posts the message as reply to the thread of the parent message
+	ThreadTS string `json:"thread_ts,omitempty"`
+	// Text is shown in notifications and by clients which cannot render blocks
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Fields   []slackText `json:"fields,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func plainText(text string) slackText {
+	return slackText{Type: "plain_text", Text: text}
+}
+
+func markdown(text string) slackText {
+	return slackText{Type: "mrkdwn", Text: text}
+}
+
+// markdownField renders a labeled value of a section, empty values are skipped
+func markdownField(fields []slackText, label, value string) []slackText {
+	if value == "" {
+		return fields
+	}
+	return append(fields, markdown(fmt.Sprintf("*%s*\n%s", label, value)))
+}
+
+// code formats the value as inline code, if it is set
+func code(value string) string {
+	if value == "" {
+		return ""
+	}
+	return "`" + value + "`"
+}
+
+// newSlackMessage renders the event as Block Kit message with a header, the workload and tags as fields and the image
+// as context
+func newSlackMessage(event differentiating.NotificationEvent) slackMessage {
+	img := event.Image
+	currentLabel, newLabel := "Current tag", "New tag"
+	currentTag, newTag := event.OldTag, event.NewTag
+	switch event.Type {
+	case differentiating.EventTypeResolved:
+		currentLabel, newLabel = "Previous tag", "Current tag"
+	case differentiating.EventTypeRecommendation:
+		newLabel = "Pin to"
+		newTag = ""
+		if event.Pin != nil {
+			newTag = event.Pin.Tag
+		}
+	}
+	if newTag == currentTag {
+		newTag = ""
+	}
+
+	var fields []slackText
+	fields = markdownField(fields, "Namespace", code(img.Workload.Namespace))
+	workload := img.Workload.Name
+	if img.Workload.Kind != "" {
+		workload = img.Workload.Kind + "/" + workload
+	}
+	fields = markdownField(fields, "Workload", code(workload))
+	fields = markdownField(fields, "Container", code(img.Workload.Container))
+	fields = markdownField(fields, "Bump", string(event.Bump))
+	fields = markdownField(fields, currentLabel, code(currentTag))
+	fields = markdownField(fields, newLabel, code(newTag))
+	if event.LatestTag != "" && event.LatestTag != event.NewTag && event.LatestTag != currentTag {
+		fields = markdownField(fields, "Latest tag", code(event.LatestTag))
+	}
+	fields = markdownField(fields, "Newer variant", code(event.NewVariantTag))
+
+	contextElements := []slackText{markdown(code(img.GetNameWithRegistry()))}
+	if img.Workload.Cluster != "" {
+		contextElements = append(contextElements, markdown("cluster "+code(img.Workload.Cluster)))
+	}
+
+	title := slackTitle(event)
+	header := plainText(title)
+	return slackMessage{
+		Text: slackFallbackText(title, event, currentTag, newTag),
+		Blocks: []slackBlock{
+			{Type: "header", Text: &header},
+			{Type: "section", Fields: fields},
+			{Type: "context", Elements: contextElements},
+		},
+	}
+}
+
+func slackTitle(event differentiating.NotificationEvent) string {
+	name := event.Image.GetNameWithoutRegistry()
+	switch event.Type {
+	case differentiating.EventTypeOutdated:
+		return "Newer tag available for " + name
+	case differentiating.EventTypeChanged:
+		return "Newer tag changed for " + name
+	case differentiating.EventTypeResolved:
+		return "Updated " + name
+	case differentiating.EventTypeReminder:
+		return "Still outdated: " + name
+	case differentiating.EventTypeRecommendation:
+		return "Pin recommendation for " + name
+	default:
+		return fmt.Sprintf("%s: %s", event.Type, name)
+	}
+}
+
+func slackFallbackText(title string, event differentiating.NotificationEvent, currentTag, newTag string) string {
+	var text strings.Builder
+	text.WriteString(title)
+	fmt.Fprintf(&text, " in %s/%s", event.Image.Workload.Namespace, event.Image.Workload.Name)
+	if newTag != "" {
+		fmt.Fprintf(&text, ": %s -> %s", currentTag, newTag)
+	}
+	if event.Bump != "" {
+		fmt.Fprintf(&text, " (%s)", event.Bump)
+	}
+	return text.String()
+}
@@ -0,0 +1,297 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package notifying
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/differentiating"
+	"go.uber.org/ratelimit"
+)
+
+const (
+	// DefaultSlackAPIURL is the base URL of the Slack Web API
+	DefaultSlackAPIURL = "https://slack.com/api"
+
+	// Slack allows about one message per second and channel
+	defaultSlackMessagesPerSecond = 1
+
+	// maxSlackThreads bounds the threads kept in memory, the least recently used thread is dropped first
+	maxSlackThreads = 10000
+)
+
+// retryableSlackErrors are errors of the Slack Web API, which are answered with status 200 but succeed on retry
+var retryableSlackErrors = map[string]bool{
+	"ratelimited":         true,
+	"internal_error":      true,
+	"fatal_error":         true,
+	"service_unavailable": true,
+	"request_timeout":     true,
+}
+
+// SlackOptions configure a Slack notifier. Either a bot token with the chat:write scope or the URL of an incoming
+// webhook is required. Only with a token events of the same image are threaded and messages are updated, incoming
+// webhooks post each event as new message into the channel of the webhook.
+type SlackOptions struct {
+	Name       string
+	Token      string
+	WebhookURL string
+	// APIURL defaults to DefaultSlackAPIURL
+	APIURL string
+	// Channel receives the events of all namespaces without namespace channel, it is required with a token
+	Channel           string
+	NamespaceChannels map[string]string
+	// MessagesPerSecond limits the messages per channel, defaults to 1
+	MessagesPerSecond int
+	// Timeout of a single request, defaults to 10s
+	Timeout time.Duration
+	// Retries of a failed request, default to 3 if nil with a backoff of 1s, which doubles with each retry. Zero
+	// disables retries.
+	Retries *int
+	Backoff time.Duration
+	// DeadLetters receives the events which could not be delivered, defaults to logging them
+	DeadLetters *DeadLetterLog
+}
+
+// Slack posts the events as Block Kit messages. The first event of an image starts a thread, following events of the
+// image are posted as replies and the resolved event updates the first message. Threads are kept in memory up to
+// maxSlackThreads, after a restart or if the thread was dropped the next event of an image starts a new thread.
+type Slack struct {
+	opts   SlackOptions
+	client *http.Client
+	retry  retryPolicy
+
+	mutex sync.Mutex
+	// limiters by configured channel, see limiter
+	limiters map[string]ratelimit.Limiter
+	// threads holds the element of the first message per image ID in the threadOrder, which is ordered by last use
+	threads     map[string]*list.Element
+	threadOrder *list.List
+	maxThreads  int
+}
+
+type slackThread struct {
+	imageID string
+	// channel is the ID of the channel, which chat.update requires instead of the configured channel name
+	channel string
+	// configuredChannel selects the rate limiter of the thread
+	configuredChannel string
+	ts                string
+}
+
+// slackResponse is the common response of the Slack Web API methods
+type slackResponse struct {
+	OK      bool   `json:"ok"`
+	Error   string `json:"error"`
+	Channel string `json:"channel"`
+	TS      string `json:"ts"`
+}
+
+// NewSlack validates the options and applies the defaults
+func NewSlack(opts SlackOptions) (*Slack, error) {
+	switch {
+	case opts.Token == "" && opts.WebhookURL == "":
+		return nil, fmt.Errorf("notifying/slack error: %s: token or webhook URL required", opts.Name)
+	case opts.Token != "" && opts.WebhookURL != "":
+		return nil, fmt.Errorf("notifying/slack error: %s: token and webhook URL are mutually exclusive", opts.Name)
+	case opts.WebhookURL != "" && !isHTTPURL(opts.WebhookURL):
+		return nil, fmt.Errorf("notifying/slack error: %s: invalid webhook URL", opts.Name)
+	case opts.Token != "" && opts.Channel == "":
+		return nil, fmt.Errorf("notifying/slack error: %s: channel required", opts.Name)
+	}
+	if opts.APIURL == "" {
+		opts.APIURL = DefaultSlackAPIURL
+	}
+	if !isHTTPURL(opts.APIURL) {
+		return nil, fmt.Errorf("notifying/slack error: %s: invalid API URL %q", opts.Name, opts.APIURL)
+	}
+	if opts.MessagesPerSecond <= 0 {
+		opts.MessagesPerSecond = defaultSlackMessagesPerSecond
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultWebhookTimeout
+	}
+
+	return &Slack{
+		opts:        opts,
+		client:      &http.Client{Timeout: opts.Timeout},
+		retry:       newRetryPolicy(opts.Retries, opts.Backoff),
+		limiters:    make(map[string]ratelimit.Limiter),
+		threads:     make(map[string]*list.Element),
+		threadOrder: list.New(),
+		maxThreads:  maxSlackThreads,
+	}, nil
+}
+
+// Name implements the Notifier interface
+func (s *Slack) Name() string {
+	return s.opts.Name
+}
+
+// Notify implements the Notifier interface. Events which could not be delivered after all retries are written to the
+// dead letters.
+func (s *Slack) Notify(ctx context.Context, event differentiating.NotificationEvent) error {
+	attempts, err := s.deliver(ctx, event)
+	if err != nil {
+		err = fmt.Errorf("notifying/slack error: %s: %w", s.opts.Name, err)
+		s.opts.DeadLetters.Write(DeadLetter{Time: time.Now(), Notifier: s.opts.Name, Event: event, Attempts: attempts, Error: err.Error()})
+		return err
+	}
+	return nil
+}
+
+func (s *Slack) deliver(ctx context.Context, event differentiating.NotificationEvent) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	message := newSlackMessage(event)
+	if s.opts.WebhookURL != "" {
+		return s.post(ctx, s.opts.WebhookURL, "", message, nil)
+	}
+
+	thread, threaded := s.thread(event.Image.ID)
+	configuredChannel := s.channel(event.Image.Workload.Namespace)
+	message.Channel = configuredChannel
+	if threaded {
+		configuredChannel = thread.configuredChannel
+		message.Channel = thread.channel
+		message.ThreadTS = thread.ts
+	}
+
+	var posted slackResponse
+	attempts, err := s.post(ctx, s.opts.APIURL+"/chat.postMessage", configuredChannel, message, &posted)
+	if err != nil {
+		return attempts, err
+	}
+
+	switch {
+	case !threaded && event.Type != differentiating.EventTypeResolved:
+		s.addThread(slackThread{imageID: event.Image.ID, channel: posted.Channel, configuredChannel: configuredChannel, ts: posted.TS})
+	case threaded && event.Type == differentiating.EventTypeResolved:
+		s.threadOrder.Remove(s.threads[event.Image.ID])
+		delete(s.threads, event.Image.ID)
+		parent := newSlackMessage(event)
+		parent.Channel = thread.channel
+		parent.TS = thread.ts
+		return s.post(ctx, s.opts.APIURL+"/chat.update", configuredChannel, parent, nil)
+	}
+	return attempts, nil
+}
+
+// thread returns the thread of the image and marks it as used, it has to be called with the locked mutex
+func (s *Slack) thread(imageID string) (slackThread, bool) {
+	element, ok := s.threads[imageID]
+	if !ok {
+		return slackThread{}, false
+	}
+	s.threadOrder.MoveToBack(element)
+	return element.Value.(slackThread), true
+}
+
+// addThread stores the thread and drops the least recently used thread if there are too many, it has to be called
+// with the locked mutex
+func (s *Slack) addThread(thread slackThread) {
+	s.threads[thread.imageID] = s.threadOrder.PushBack(thread)
+	for s.threadOrder.Len() > s.maxThreads {
+		oldest := s.threadOrder.Remove(s.threadOrder.Front()).(slackThread)
+		delete(s.threads, oldest.imageID)
+	}
+}
+
+func (s *Slack) channel(namespace string) string {
+	if channel, ok := s.opts.NamespaceChannels[namespace]; ok {
+		return channel
+	}
+	return s.opts.Channel
+}
+
+// limiter returns the rate limiter of the configured channel. Threads keep the channel of their first message, because
+// the Slack API responds with the channel ID instead of the configured name. Incoming webhooks share the limiter of the
+// empty channel.
+func (s *Slack) limiter(channel string) ratelimit.Limiter {
+	if limiter, ok := s.limiters[channel]; ok {
+		return limiter
+	}
+	limiter := ratelimit.New(s.opts.MessagesPerSecond)
+	s.limiters[channel] = limiter
+	return limiter
+}
+
+// post sends the message with retries and decodes the response of Web API methods into the response
+func (s *Slack) post(ctx context.Context, url, configuredChannel string, message slackMessage, response *slackResponse) (int, error) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return 0, err
+	}
+	limiter := s.limiter(configuredChannel)
+	return s.retry.do(ctx, func(ctx context.Context) error {
+		limiter.Take()
+		return s.send(ctx, url, body, response)
+	})
+}
+
+func (s *Slack) send(ctx context.Context, url string, body []byte, response *slackResponse) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return &deliveryError{err: err, permanent: true}
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("User-Agent", "differ")
+	if s.opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.opts.Token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// incoming webhooks answer with a plain text body
+	if err := statusError(resp); err != nil || s.opts.WebhookURL != "" {
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+		return err
+	}
+
+	var result slackResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&result); err != nil {
+		return fmt.Errorf("could not decode response: %w", err)
+	}
+	if !result.OK {
+		return &deliveryError{err: fmt.Errorf("slack API error %s", result.Error), permanent: !retryableSlackErrors[result.Error]}
+	}
+	if response != nil {
+		*response = result
+	}
+	return nil
+}
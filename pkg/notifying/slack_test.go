@@ -0,0 +1,387 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package notifying
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/analyzing"
+	"github.com/fwiedmann/differ/pkg/differentiating"
+)
+
+type slackRequest struct {
+	method  string
+	token   string
+	message slackMessage
+}
+
+// slackAPI answers chat.postMessage and chat.update like the Slack Web API, the channel names are resolved to IDs by
+// prefixing them with "ID"
+type slackAPI struct {
+	mutex    sync.Mutex
+	errors   []string
+	requests []slackRequest
+}
+
+func (api *slackAPI) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	var message slackMessage
+	if err := json.NewDecoder(req.Body).Decode(&message); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	api.requests = append(api.requests, slackRequest{
+		method:  strings.TrimPrefix(req.URL.Path, "/"),
+		token:   strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "),
+		message: message,
+	})
+
+	response := slackResponse{OK: true, Channel: message.Channel, TS: message.TS}
+	if !strings.HasPrefix(message.Channel, "ID") {
+		response.Channel = "ID" + message.Channel
+	}
+	if response.TS == "" {
+		response.TS = fmt.Sprintf("%d.000100", len(api.requests))
+	}
+	if len(api.errors) > 0 {
+		response = slackResponse{Error: api.errors[0]}
+		api.errors = api.errors[1:]
+	}
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func slackEvent(eventType differentiating.EventType, id, namespace string) differentiating.NotificationEvent {
+	event := testEvent
+	event.Type = eventType
+	event.Image.ID = id
+	event.Image.Workload.Namespace = namespace
+	return event
+}
+
+func TestSlack_Notify(t *testing.T) {
+	type wantRequest struct {
+		method   string
+		channel  string
+		threadTS string
+		ts       string
+	}
+	tests := []struct {
+		name            string
+		events          []differentiating.NotificationEvent
+		errors          []string
+		wantErr         bool
+		wantRequests    []wantRequest
+		wantDeadLetters int
+	}{
+		{
+			name: "Thread",
+			events: []differentiating.NotificationEvent{
+				slackEvent(differentiating.EventTypeOutdated, "1", "web"),
+				slackEvent(differentiating.EventTypeReminder, "1", "web"),
+				slackEvent(differentiating.EventTypeResolved, "1", "web"),
+				slackEvent(differentiating.EventTypeOutdated, "1", "web"),
+			},
+			wantRequests: []wantRequest{
+				{method: "chat.postMessage", channel: "#differ"},
+				{method: "chat.postMessage", channel: "ID#differ", threadTS: "1.000100"},
+				{method: "chat.postMessage", channel: "ID#differ", threadTS: "1.000100"},
+				{method: "chat.update", channel: "ID#differ", ts: "1.000100"},
+				{method: "chat.postMessage", channel: "#differ"},
+			},
+		},
+		{
+			name: "ThreadPerImage",
+			events: []differentiating.NotificationEvent{
+				slackEvent(differentiating.EventTypeOutdated, "1", "web"),
+				slackEvent(differentiating.EventTypeOutdated, "2", "web"),
+				slackEvent(differentiating.EventTypeChanged, "2", "web"),
+			},
+			wantRequests: []wantRequest{
+				{method: "chat.postMessage", channel: "#differ"},
+				{method: "chat.postMessage", channel: "#differ"},
+				{method: "chat.postMessage", channel: "ID#differ", threadTS: "2.000100"},
+			},
+		},
+		{
+			name: "NamespaceChannel",
+			events: []differentiating.NotificationEvent{
+				slackEvent(differentiating.EventTypeOutdated, "1", "payments"),
+			},
+			wantRequests: []wantRequest{
+				{method: "chat.postMessage", channel: "#payments"},
+			},
+		},
+		{
+			name: "ResolvedWithoutThread",
+			events: []differentiating.NotificationEvent{
+				slackEvent(differentiating.EventTypeResolved, "1", "web"),
+				slackEvent(differentiating.EventTypeOutdated, "1", "web"),
+			},
+			wantRequests: []wantRequest{
+				{method: "chat.postMessage", channel: "#differ"},
+				{method: "chat.postMessage", channel: "#differ"},
+			},
+		},
+		{
+			name:   "RetryRateLimited",
+			events: []differentiating.NotificationEvent{slackEvent(differentiating.EventTypeOutdated, "1", "web")},
+			errors: []string{"ratelimited"},
+			wantRequests: []wantRequest{
+				{method: "chat.postMessage", channel: "#differ"},
+				{method: "chat.postMessage", channel: "#differ"},
+			},
+		},
+		{
+			name:            "PermanentError",
+			events:          []differentiating.NotificationEvent{slackEvent(differentiating.EventTypeOutdated, "1", "web")},
+			errors:          []string{"channel_not_found"},
+			wantErr:         true,
+			wantRequests:    []wantRequest{{method: "chat.postMessage", channel: "#differ"}},
+			wantDeadLetters: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &slackAPI{errors: tt.errors}
+			server := httptest.NewServer(api)
+			defer server.Close()
+			deadLetters, path := tempDeadLetterLog(t)
+
+			slack, err := NewSlack(SlackOptions{
+				Name:              "test",
+				Token:             "xoxb-test",
+				APIURL:            server.URL,
+				Channel:           "#differ",
+				NamespaceChannels: map[string]string{"payments": "#payments"},
+				MessagesPerSecond: 1000,
+				Backoff:           time.Millisecond,
+				DeadLetters:       deadLetters,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, event := range tt.events {
+				if err := slack.Notify(context.Background(), event); (err != nil) != tt.wantErr {
+					t.Fatalf("Notify() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			}
+
+			if len(api.requests) != len(tt.wantRequests) {
+				t.Fatalf("Notify() sent %d requests, want %d", len(api.requests), len(tt.wantRequests))
+			}
+			for i, want := range tt.wantRequests {
+				got := api.requests[i]
+				if got.method != want.method || got.message.Channel != want.channel || got.message.ThreadTS != want.threadTS || got.message.TS != want.ts {
+					t.Errorf("Notify() request %d = %s %+v, want %+v", i, got.method, got.message, want)
+				}
+				if got.token != "xoxb-test" {
+					t.Errorf("Notify() request %d was sent with token %q", i, got.token)
+				}
+			}
+			if letters := readDeadLetters(t, path); len(letters) != tt.wantDeadLetters {
+				t.Errorf("Notify() wrote %d dead letters, want %d", len(letters), tt.wantDeadLetters)
+			}
+		})
+	}
+}
+
+func TestSlack_Notify_incomingWebhook(t *testing.T) {
+	receiver := &webhookReceiver{statuses: []int{http.StatusOK}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	slack, err := NewSlack(SlackOptions{Name: "test", WebhookURL: server.URL, MessagesPerSecond: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, eventType := range []differentiating.EventType{differentiating.EventTypeOutdated, differentiating.EventTypeResolved} {
+		if err := slack.Notify(context.Background(), slackEvent(eventType, "1", "web")); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+	}
+
+	if len(receiver.requests) != 2 {
+		t.Fatalf("Notify() sent %d requests, want 2", len(receiver.requests))
+	}
+	for _, request := range receiver.requests {
+		var message slackMessage
+		if err := json.Unmarshal(request.body, &message); err != nil {
+			t.Fatal(err)
+		}
+		if message.Channel != "" || message.ThreadTS != "" || message.TS != "" || len(message.Blocks) == 0 {
+			t.Errorf("Notify() sent %+v, want a message without channel and thread", message)
+		}
+	}
+}
+
+func TestSlack_Notify_rateLimit(t *testing.T) {
+	api := &slackAPI{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	slack, err := NewSlack(SlackOptions{Name: "test", Token: "xoxb-test", APIURL: server.URL, Channel: "#differ", MessagesPerSecond: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	// the reply is posted to the channel ID of the thread and has to share the limiter of the configured channel
+	for _, event := range []differentiating.NotificationEvent{
+		slackEvent(differentiating.EventTypeOutdated, "1", "web"),
+		slackEvent(differentiating.EventTypeReminder, "1", "web"),
+		slackEvent(differentiating.EventTypeOutdated, "2", "web"),
+	} {
+		if err := slack.Notify(context.Background(), event); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Notify() sent 3 messages within %s, want them spaced by 50ms", elapsed)
+	}
+}
+
+func TestSlack_Notify_maxThreads(t *testing.T) {
+	api := &slackAPI{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	slack, err := NewSlack(SlackOptions{Name: "test", Token: "xoxb-test", APIURL: server.URL, Channel: "#differ", MessagesPerSecond: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slack.maxThreads = 2
+	for _, event := range []differentiating.NotificationEvent{
+		slackEvent(differentiating.EventTypeOutdated, "1", "web"),
+		slackEvent(differentiating.EventTypeOutdated, "2", "web"),
+		slackEvent(differentiating.EventTypeReminder, "1", "web"),
+		slackEvent(differentiating.EventTypeOutdated, "3", "web"),
+		slackEvent(differentiating.EventTypeResolved, "3", "web"),
+		slackEvent(differentiating.EventTypeReminder, "1", "web"),
+	} {
+		if err := slack.Notify(context.Background(), event); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+	}
+
+	// the thread of image 2 was dropped as least recently used and the resolved thread of image 3 was removed
+	if _, ok := slack.threads["1"]; !ok || len(slack.threads) != 1 || slack.threadOrder.Len() != 1 {
+		t.Errorf("Notify() kept %d threads, want the thread of image 1", len(slack.threads))
+	}
+	if reminder := api.requests[len(api.requests)-1]; reminder.message.ThreadTS != "1.000100" {
+		t.Errorf("Notify() reply thread = %q, want the recently used thread 1.000100", reminder.message.ThreadTS)
+	}
+}
+
+func TestNewSlack(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    SlackOptions
+		wantErr bool
+	}{
+		{name: "Token", opts: SlackOptions{Token: "xoxb-test", Channel: "#differ"}},
+		{name: "IncomingWebhook", opts: SlackOptions{WebhookURL: "https://hooks.slack.com/services/T/B/X"}},
+		{name: "MissingTokenAndWebhook", opts: SlackOptions{Channel: "#differ"}, wantErr: true},
+		{name: "TokenAndWebhook", opts: SlackOptions{Token: "xoxb-test", Channel: "#differ", WebhookURL: "https://hooks.slack.com/services/T/B/X"}, wantErr: true},
+		{name: "MissingChannel", opts: SlackOptions{Token: "xoxb-test", NamespaceChannels: map[string]string{"web": "#web"}}, wantErr: true},
+		{name: "InvalidWebhookURL", opts: SlackOptions{WebhookURL: "hooks.slack.com"}, wantErr: true},
+		{name: "InvalidAPIURL", opts: SlackOptions{Token: "xoxb-test", Channel: "#differ", APIURL: "slack.com/api"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSlack(tt.opts); (err != nil) != tt.wantErr {
+				t.Errorf("NewSlack() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewSlackMessage(t *testing.T) {
+	outdated := testEvent
+	outdated.Bump = analyzing.BumpMinor
+	outdated.Image.Workload.Kind = "Deployment"
+	outdated.Image.Workload.Container = "nginx"
+
+	resolved := outdated
+	resolved.Type = differentiating.EventTypeResolved
+
+	recommendation := testEvent
+	recommendation.Type = differentiating.EventTypeRecommendation
+	recommendation.OldTag, recommendation.NewTag, recommendation.LatestTag = "latest", "", ""
+	recommendation.Pin = &differentiating.PinRecommendation{Tag: "1.19.3"}
+
+	tests := []struct {
+		name       string
+		event      differentiating.NotificationEvent
+		wantText   string
+		wantFields []string
+	}{
+		{
+			name:       "Outdated",
+			event:      outdated,
+			wantText:   "Newer tag available for library/nginx in web/frontend: 1.18.0 -> 1.19.0 (minor)",
+			wantFields: []string{"*Namespace*\n`web`", "*Workload*\n`Deployment/frontend`", "*Container*\n`nginx`", "*Bump*\nminor", "*Current tag*\n`1.18.0`", "*New tag*\n`1.19.0`"},
+		},
+		{
+			name:       "Resolved",
+			event:      resolved,
+			wantText:   "Updated library/nginx in web/frontend: 1.18.0 -> 1.19.0 (minor)",
+			wantFields: []string{"*Namespace*\n`web`", "*Workload*\n`Deployment/frontend`", "*Container*\n`nginx`", "*Bump*\nminor", "*Previous tag*\n`1.18.0`", "*Current tag*\n`1.19.0`"},
+		},
+		{
+			name:       "Recommendation",
+			event:      recommendation,
+			wantText:   "Pin recommendation for library/nginx in web/frontend: latest -> 1.19.3",
+			wantFields: []string{"*Namespace*\n`web`", "*Workload*\n`frontend`", "*Current tag*\n`latest`", "*Pin to*\n`1.19.3`"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := newSlackMessage(tt.event)
+			if message.Text != tt.wantText {
+				t.Errorf("newSlackMessage() text = %q, want %q", message.Text, tt.wantText)
+			}
+			if len(message.Blocks) != 3 {
+				t.Fatalf("newSlackMessage() has %d blocks, want header, section and context", len(message.Blocks))
+			}
+			var fields []string
+			for _, field := range message.Blocks[1].Fields {
+				fields = append(fields, field.Text)
+			}
+			if strings.Join(fields, "|") != strings.Join(tt.wantFields, "|") {
+				t.Errorf("newSlackMessage() fields = %q, want %q", fields, tt.wantFields)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package notifying
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// StartTLSPolicy configures the upgrade of SMTP connections to TLS
+type StartTLSPolicy string
+
+const (
+	// StartTLSRequired fails if the server does not support STARTTLS
+	StartTLSRequired StartTLSPolicy = "required"
+	// StartTLSOpportunistic upgrades the connection if the server supports STARTTLS
+	StartTLSOpportunistic StartTLSPolicy = "opportunistic"
+	// StartTLSDisabled never upgrades the connection
+	StartTLSDisabled StartTLSPolicy = "disabled"
+
+	defaultSMTPTimeout = 30 * time.Second
+)
+
+// SMTPOptions configure the connection to the SMTP server
+type SMTPOptions struct {
+	// Address of the server as host:port
+	Address string
+	// Username and Password authenticate with PLAIN auth, which is only allowed on TLS connections or on localhost
+	Username string
+	Password string
+	// StartTLS defaults to StartTLSRequired
+	StartTLS StartTLSPolicy
+	// TLSConfig defaults to the system roots with the host of the address as server name
+	TLSConfig *tls.Config
+	// Timeout of the whole SMTP transaction, defaults to 30s
+	Timeout time.Duration
+}
+
+// mailMessage is a multipart/alternative message with a plain text and an HTML part
+type mailMessage struct {
+	from    string
+	to      []string
+	subject string
+	date    time.Time
+	text    []byte
+	html    []byte
+}
+
+// bytes encodes the mail with quoted-printable parts, so that no line exceeds the SMTP line length limit
+func (m mailMessage) bytes() ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{{contentType: "text/plain; charset=utf-8", content: m.text}, {contentType: "text/html; charset=utf-8", content: m.html}} {
+		writer, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoder := quotedprintable.NewWriter(writer)
+		if _, err := encoder.Write(part.content); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var message bytes.Buffer
+	for _, header := range [][2]string{
+		{"From", m.from},
+		{"To", strings.Join(m.to, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", m.subject)},
+		{"Date", m.date.Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", fmt.Sprintf("multipart/alternative; boundary=%q", parts.Boundary())},
+	} {
+		fmt.Fprintf(&message, "%s: %s\r\n", header[0], header[1])
+	}
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+// sendMail delivers the mail to all recipients within one SMTP transaction
+func sendMail(ctx context.Context, opts SMTPOptions, m mailMessage) error {
+	message, err := m.bytes()
+	if err != nil {
+		return err
+	}
+	host, _, err := net.SplitHostPort(opts.Address)
+	if err != nil {
+		return err
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultSMTPTimeout
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", opts.Address)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if opts.StartTLS != StartTLSDisabled {
+		supported, _ := client.Extension("STARTTLS")
+		switch {
+		case supported:
+			tlsConfig := &tls.Config{ServerName: host}
+			if opts.TLSConfig != nil {
+				tlsConfig = opts.TLSConfig.Clone()
+				if tlsConfig.ServerName == "" {
+					tlsConfig.ServerName = host
+				}
+			}
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("STARTTLS failed: %w", err)
+			}
+		case opts.StartTLS != StartTLSOpportunistic:
+			return fmt.Errorf("server %s does not support STARTTLS", opts.Address)
+		}
+	}
+	if opts.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", opts.Username, opts.Password, host)); err != nil {
+			return fmt.Errorf("authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(m.from); err != nil {
+		return err
+	}
+	for _, to := range m.to {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("recipient %s rejected: %w", to, err)
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(message); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,188 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package notifying
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"text/template"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/differentiating"
+)
+
+const (
+	// DefaultSignatureHeader contains the HMAC-SHA256 signature of the body as "sha256=<hex>"
+	DefaultSignatureHeader = "X-Differ-Signature"
+	// EventHeader contains the type of the event
+	EventHeader = "X-Differ-Event"
+
+	defaultWebhookTimeout = 10 * time.Second
+)
+
+// WebhookOptions configure a Webhook
+type WebhookOptions struct {
+	Name string
+	URL  string
+	// Method defaults to POST
+	Method  string
+	Headers map[string]string
+	// Template of the body, which is executed with the differentiating.NotificationEvent. The body defaults to the JSON
+	// encoded event.
+	Template string
+	// Secret signs the body with HMAC-SHA256 in the signature header, no signature is sent without secret
+	Secret string
+	// SignatureHeader defaults to DefaultSignatureHeader
+	SignatureHeader string
+	// Timeout of a single request, defaults to 10s
+	Timeout time.Duration
+	// Retries of a failed delivery, default to 3 if nil with a backoff of 1s, which doubles with each retry. Zero
+	// disables retries.
+	Retries *int
+	Backoff time.Duration
+	// DeadLetters receives the events which could not be delivered, defaults to logging them
+	DeadLetters *DeadLetterLog
+}
+
+// Webhook sends each event as HTTP request to the URL
+type Webhook struct {
+	opts     WebhookOptions
+	client   *http.Client
+	template *template.Template
+	retry    retryPolicy
+}
+
+// NewWebhook validates the URL and parses the template of the options
+func NewWebhook(opts WebhookOptions) (*Webhook, error) {
+	if !isHTTPURL(opts.URL) {
+		return nil, fmt.Errorf("notifying/webhook error: %s: invalid URL %q", opts.Name, opts.URL)
+	}
+	if opts.Method == "" {
+		opts.Method = http.MethodPost
+	}
+	if opts.SignatureHeader == "" {
+		opts.SignatureHeader = DefaultSignatureHeader
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultWebhookTimeout
+	}
+
+	var err error
+	w := &Webhook{
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout},
+		retry:  newRetryPolicy(opts.Retries, opts.Backoff),
+	}
+	if opts.Template != "" {
+		w.template, err = template.New(opts.Name).Funcs(templateFuncs).Option("missingkey=error").Parse(opts.Template)
+		if err != nil {
+			return nil, fmt.Errorf("notifying/webhook error: %s: invalid template: %w", opts.Name, err)
+		}
+	}
+	return w, nil
+}
+
+// Name implements the Notifier interface
+func (w *Webhook) Name() string {
+	return w.opts.Name
+}
+
+// Notify implements the Notifier interface. Events which could not be delivered after all retries are written to the
+// dead letters.
+func (w *Webhook) Notify(ctx context.Context, event differentiating.NotificationEvent) error {
+	body, err := w.body(event)
+	if err != nil {
+		w.opts.DeadLetters.Write(DeadLetter{Time: time.Now(), Notifier: w.opts.Name, Event: event, Error: err.Error()})
+		return err
+	}
+
+	attempts, err := w.retry.do(ctx, func(ctx context.Context) error {
+		return w.send(ctx, event, body)
+	})
+	if err != nil {
+		w.opts.DeadLetters.Write(DeadLetter{Time: time.Now(), Notifier: w.opts.Name, Event: event, Attempts: attempts, Error: err.Error()})
+		return err
+	}
+	return nil
+}
+
+func (w *Webhook) body(event differentiating.NotificationEvent) ([]byte, error) {
+	if w.template == nil {
+		return json.Marshal(event)
+	}
+	var body bytes.Buffer
+	if err := w.template.Execute(&body, event); err != nil {
+		return nil, fmt.Errorf("notifying/webhook error: %s: could not render template: %w", w.opts.Name, err)
+	}
+	return body.Bytes(), nil
+}
+
+func (w *Webhook) send(ctx context.Context, event differentiating.NotificationEvent, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, w.opts.Method, w.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return &deliveryError{err: err, permanent: true}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "differ")
+	req.Header.Set(EventHeader, string(event.Type))
+	for name, value := range w.opts.Headers {
+		req.Header.Set(name, value)
+	}
+	if w.opts.Secret != "" {
+		req.Header.Set(w.opts.SignatureHeader, Sign(w.opts.Secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// drain the body, so that the connection is reused
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+	return statusError(resp)
+}
+
+// isHTTPURL reports if the URL is an absolute http or https URL
+func isHTTPURL(raw string) bool {
+	target, err := url.Parse(raw)
+	return err == nil && (target.Scheme == "http" || target.Scheme == "https") && target.Host != ""
+}
+
+// Sign returns the HMAC-SHA256 signature of the body as "sha256=<hex>", which receivers compare with the signature
+// header
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body) //nolint:errcheck // writing to a hash never fails
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,264 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package notifying
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/differentiating"
+)
+
+var testEvent = differentiating.NotificationEvent{
+	Type:      differentiating.EventTypeOutdated,
+	Image:     differentiating.Image{ID: "1", Registry: "registry-1.docker.io", Name: "library/nginx", Tag: "1.18.0", Workload: differentiating.Workload{Namespace: "web", Name: "frontend"}},
+	OldTag:    "1.18.0",
+	NewTag:    "1.19.0",
+	LatestTag: "1.19.0",
+}
+
+type webhookRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// webhookReceiver responds with the statuses in order and with the last status afterwards
+type webhookReceiver struct {
+	mutex    sync.Mutex
+	statuses []int
+	requests []webhookRequest
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.requests = append(r.requests, webhookRequest{header: req.Header, body: body})
+	status := r.statuses[0]
+	if len(r.statuses) > 1 {
+		r.statuses = r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func tempDeadLetterLog(t *testing.T) (*DeadLetterLog, string) {
+	dir, err := ioutil.TempDir("", "differ-notifying")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+	path := filepath.Join(dir, "dead-letters.jsonl")
+	deadLetters, err := NewDeadLetterLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = deadLetters.Close()
+	})
+	return deadLetters, path
+}
+
+func readDeadLetters(t *testing.T, path string) []DeadLetter {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var letters []DeadLetter
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var letter DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			t.Fatal(err)
+		}
+		letters = append(letters, letter)
+	}
+	return letters
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestWebhook_Notify(t *testing.T) {
+	tests := []struct {
+		name            string
+		opts            WebhookOptions
+		statuses        []int
+		wantErr         bool
+		wantRequests    int
+		wantBody        string
+		wantHeaders     map[string]string
+		wantDeadLetters int
+	}{
+		{
+			name:         "DefaultBody",
+			statuses:     []int{http.StatusNoContent},
+			wantRequests: 1,
+			wantHeaders:  map[string]string{"Content-Type": "application/json", EventHeader: "outdated"},
+		},
+		{
+			name:         "Template",
+			opts:         WebhookOptions{Template: `{"text": {{ printf "%s: %s -> %s" .Image.Name .OldTag .NewTag | json }}, "type": "{{ .Type | upper }}"}`},
+			statuses:     []int{http.StatusOK},
+			wantRequests: 1,
+			wantBody:     `{"text": "library/nginx: 1.18.0 -> 1.19.0", "type": "OUTDATED"}`,
+		},
+		{
+			name:         "HeadersAndSignature",
+			opts:         WebhookOptions{Method: http.MethodPut, Headers: map[string]string{"Authorization": "Bearer token", "Content-Type": "application/vnd.differ+json"}, Secret: "secret", SignatureHeader: "X-Signature", Template: "body"},
+			statuses:     []int{http.StatusOK},
+			wantRequests: 1,
+			wantBody:     "body",
+			wantHeaders:  map[string]string{"Authorization": "Bearer token", "Content-Type": "application/vnd.differ+json", "X-Signature": Sign("secret", []byte("body"))},
+		},
+		{
+			name:         "RetryServerErrors",
+			statuses:     []int{http.StatusBadGateway, http.StatusTooManyRequests, http.StatusOK},
+			wantRequests: 3,
+		},
+		{
+			name:            "RetriesExhausted",
+			opts:            WebhookOptions{Retries: intPtr(2)},
+			statuses:        []int{http.StatusServiceUnavailable},
+			wantErr:         true,
+			wantRequests:    3,
+			wantDeadLetters: 1,
+		},
+		{
+			name:            "RetriesDisabled",
+			opts:            WebhookOptions{Retries: intPtr(0)},
+			statuses:        []int{http.StatusServiceUnavailable},
+			wantErr:         true,
+			wantRequests:    1,
+			wantDeadLetters: 1,
+		},
+		{
+			name:            "PermanentFailure",
+			statuses:        []int{http.StatusBadRequest},
+			wantErr:         true,
+			wantRequests:    1,
+			wantDeadLetters: 1,
+		},
+		{
+			name:            "TemplateError",
+			opts:            WebhookOptions{Template: "{{ .Missing }}"},
+			statuses:        []int{http.StatusOK},
+			wantErr:         true,
+			wantDeadLetters: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := &webhookReceiver{statuses: tt.statuses}
+			server := httptest.NewServer(receiver)
+			defer server.Close()
+			deadLetters, path := tempDeadLetterLog(t)
+
+			opts := tt.opts
+			opts.Name = "test"
+			opts.URL = server.URL
+			opts.Backoff = time.Millisecond
+			opts.DeadLetters = deadLetters
+			webhook, err := NewWebhook(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := webhook.Notify(context.Background(), testEvent); (err != nil) != tt.wantErr {
+				t.Fatalf("Notify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(receiver.requests) != tt.wantRequests {
+				t.Fatalf("Notify() sent %d requests, want %d", len(receiver.requests), tt.wantRequests)
+			}
+			if letters := readDeadLetters(t, path); len(letters) != tt.wantDeadLetters {
+				t.Errorf("Notify() wrote %d dead letters, want %d", len(letters), tt.wantDeadLetters)
+			} else if tt.wantDeadLetters > 0 && (letters[0].Notifier != "test" || letters[0].Event.NewTag != "1.19.0" || letters[0].Attempts != tt.wantRequests) {
+				t.Errorf("Notify() wrote dead letter %+v, want the event after %d attempts", letters[0], tt.wantRequests)
+			}
+			if tt.wantRequests == 0 {
+				return
+			}
+
+			request := receiver.requests[0]
+			wantBody := tt.wantBody
+			if wantBody == "" {
+				encoded, _ := json.Marshal(testEvent)
+				wantBody = string(encoded)
+			}
+			if string(request.body) != wantBody {
+				t.Errorf("Notify() body = %s, want %s", request.body, wantBody)
+			}
+			for name, value := range tt.wantHeaders {
+				if got := request.header.Get(name); got != value {
+					t.Errorf("Notify() header %s = %q, want %q", name, got, value)
+				}
+			}
+			if tt.opts.Secret == "" && request.header.Get(DefaultSignatureHeader) != "" {
+				t.Error("Notify() signed the body without secret")
+			}
+		})
+	}
+}
+
+func TestNewWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    WebhookOptions
+		wantErr bool
+	}{
+		{name: "Valid", opts: WebhookOptions{URL: "https://hooks.example.com/differ", Template: "{{ .Type }}"}},
+		{name: "InvalidURL", opts: WebhookOptions{URL: "hooks.example.com"}, wantErr: true},
+		{name: "InvalidScheme", opts: WebhookOptions{URL: "ftp://hooks.example.com"}, wantErr: true},
+		{name: "InvalidTemplate", opts: WebhookOptions{URL: "https://hooks.example.com/differ", Template: "{{ .Type "}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewWebhook(tt.opts); (err != nil) != tt.wantErr {
+				t.Errorf("NewWebhook() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '{"type":"outdated"}' | openssl dgst -sha256 -hmac secret
+	want := "sha256=0aad0e872850ef7375acf6448c08e9e33d907d3e8c6523da68dbc8e7f33153d0"
+	if got := Sign("secret", []byte(`{"type":"outdated"}`)); got != want {
+		t.Errorf("Sign() = %s, want %s", got, want)
+	}
+}
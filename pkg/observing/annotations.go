@@ -0,0 +1,64 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package observing
+
+const (
+	// AnnotationPrefix of all differ annotations on kubernetes workloads
+	AnnotationPrefix = "differ/"
+	// ConstraintAnnotation contains a version constraint expression for all containers of the workload.
+	// It can be set for a single container with ConstraintAnnotation.<container-name>.
+	ConstraintAnnotation = AnnotationPrefix + "constraint"
+	// SnoozeAnnotation acknowledges the update of all containers of the workload with a snooze expression like
+	// "tag=13.1,until=2021-06-30". It can be set for a single container with SnoozeAnnotation.<container-name>.
+	SnoozeAnnotation = AnnotationPrefix + "snooze"
+	// OwnerAnnotation names the team or person responsible for the updates of all containers of the workload, e.g. in
+	// the email digest. It can be set for a single container with OwnerAnnotation.<container-name>.
+	OwnerAnnotation = AnnotationPrefix + "owner"
+)
+
+// ConstraintForContainer returns the constraint expression for the given container from the workload annotations.
+// A container specific annotation takes precedence over the workload wide one.
+func ConstraintForContainer(annotations map[string]string, container string) string {
+	return annotationForContainer(annotations, ConstraintAnnotation, container)
+}
+
+// SnoozeForContainer returns the snooze expression for the given container from the workload annotations.
+// A container specific annotation takes precedence over the workload wide one.
+func SnoozeForContainer(annotations map[string]string, container string) string {
+	return annotationForContainer(annotations, SnoozeAnnotation, container)
+}
+
+// OwnerForContainer returns the owner of the given container from the workload annotations.
+// A container specific annotation takes precedence over the workload wide one.
+func OwnerForContainer(annotations map[string]string, container string) string {
+	return annotationForContainer(annotations, OwnerAnnotation, container)
+}
+
+func annotationForContainer(annotations map[string]string, key, container string) string {
+	if value, ok := annotations[key+"."+container]; ok {
+		return value
+	}
+	return annotations[key]
+}
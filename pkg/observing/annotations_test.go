@@ -0,0 +1,86 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package observing
+
+import "testing"
+
+func TestConstraintForContainer(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		container   string
+		want        string
+	}{
+		{name: "NoAnnotations", annotations: nil, container: "app", want: ""},
+		{name: "WorkloadWide", annotations: map[string]string{"differ/constraint": "^1.2"}, container: "app", want: "^1.2"},
+		{name: "ContainerSpecific", annotations: map[string]string{"differ/constraint": "^1.2", "differ/constraint.app": "~1.2.3"}, container: "app", want: "~1.2.3"},
+		{name: "OtherContainer", annotations: map[string]string{"differ/constraint": "^1.2", "differ/constraint.sidecar": "~1.2.3"}, container: "app", want: "^1.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ConstraintForContainer(tt.annotations, tt.container); got != tt.want {
+				t.Errorf("ConstraintForContainer() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnoozeForContainer(t *testing.T) {
+	annotations := map[string]string{"differ/snooze": "until=2021-06-30", "differ/snooze.db": "tag=13.1"}
+	tests := []struct {
+		name      string
+		container string
+		want      string
+	}{
+		{name: "WorkloadWide", container: "app", want: "until=2021-06-30"},
+		{name: "ContainerSpecific", container: "db", want: "tag=13.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SnoozeForContainer(annotations, tt.container); got != tt.want {
+				t.Errorf("SnoozeForContainer() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOwnerForContainer(t *testing.T) {
+	annotations := map[string]string{"differ/owner": "team-web", "differ/owner.db": "team-data"}
+	tests := []struct {
+		name      string
+		container string
+		want      string
+	}{
+		{name: "WorkloadWide", container: "app", want: "team-web"},
+		{name: "ContainerSpecific", container: "db", want: "team-data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OwnerForContainer(annotations, tt.container); got != tt.want {
+				t.Errorf("OwnerForContainer() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package observing
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/fwiedmann/differ/pkg/monitoring"
+)
+
+// observedContainers owns the series of the observed container metric
+var observedContainers = &containerSeries{series: make(map[string][]string)}
+
+// containerSeries remembers the label values of the observed container metric by image ID, so that changed and deleted
+// containers do not leave stale series behind
+type containerSeries struct {
+	mutex  sync.Mutex
+	series map[string][]string
+}
+
+// set the series of the image ID and delete its previous series, if the label values changed
+func (c *containerSeries) set(id string, labelValues []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if previous, ok := c.series[id]; ok && !reflect.DeepEqual(previous, labelValues) {
+		monitoring.KubernetesObservedContainerMetric.DeleteLabelValues(previous...)
+	}
+	monitoring.KubernetesObservedContainerMetric.WithLabelValues(labelValues...).Set(1)
+	c.series[id] = labelValues
+}
+
+func (c *containerSeries) delete(id string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if previous, ok := c.series[id]; ok {
+		monitoring.KubernetesObservedContainerMetric.DeleteLabelValues(previous...)
+		delete(c.series, id)
+	}
+}
+
+// retain deletes the series of all image IDs which are not expected and returns the number of deleted series
+func (c *containerSeries) retain(expected map[string]bool) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	deleted := 0
+	for id, labelValues := range c.series {
+		if !expected[id] {
+			monitoring.KubernetesObservedContainerMetric.DeleteLabelValues(labelValues...)
+			delete(c.series, id)
+			deleted++
+		}
+	}
+	return deleted
+}
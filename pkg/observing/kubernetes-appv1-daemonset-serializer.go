@@ -76,3 +76,13 @@ func (daemonSetObjectSerializer KubernetesAPPV1DaemonSetSerializer) GetUID() str
 func (daemonSetObjectSerializer KubernetesAPPV1DaemonSetSerializer) GetNamespace() string {
 	return daemonSetObjectSerializer.convertedDaemonSet.GetNamespace()
 }
+
+// GetAnnotations from the appV1/DaemonSet object metadata
+func (daemonSetObjectSerializer KubernetesAPPV1DaemonSetSerializer) GetAnnotations() map[string]string {
+	return daemonSetObjectSerializer.convertedDaemonSet.GetAnnotations()
+}
+
+// GetLabels from the appV1/DaemonSet object metadata
+func (daemonSetObjectSerializer KubernetesAPPV1DaemonSetSerializer) GetLabels() map[string]string {
+	return daemonSetObjectSerializer.convertedDaemonSet.GetLabels()
+}
@@ -77,3 +77,13 @@ func (deploymentObjectSerializer KubernetesAPPV1DeploymentSerializer) GetUID() s
 func (deploymentObjectSerializer KubernetesAPPV1DeploymentSerializer) GetNamespace() string {
 	return deploymentObjectSerializer.convertedDeployment.GetNamespace()
 }
+
+// GetAnnotations from the appV1/Deployment object metadata
+func (deploymentObjectSerializer KubernetesAPPV1DeploymentSerializer) GetAnnotations() map[string]string {
+	return deploymentObjectSerializer.convertedDeployment.GetAnnotations()
+}
+
+// GetLabels from the appV1/Deployment object metadata
+func (deploymentObjectSerializer KubernetesAPPV1DeploymentSerializer) GetLabels() map[string]string {
+	return deploymentObjectSerializer.convertedDeployment.GetLabels()
+}
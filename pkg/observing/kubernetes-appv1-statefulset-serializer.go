@@ -79,3 +79,13 @@ func (statefulSetObjectSerializer KubernetesAPPV1StatefulSetSerializer) GetUID()
 func (statefulSetObjectSerializer KubernetesAPPV1StatefulSetSerializer) GetNamespace() string {
 	return statefulSetObjectSerializer.convertedStatefulSet.GetNamespace()
 }
+
+// GetAnnotations from the appV1/StatefulSet object metadata
+func (statefulSetObjectSerializer KubernetesAPPV1StatefulSetSerializer) GetAnnotations() map[string]string {
+	return statefulSetObjectSerializer.convertedStatefulSet.GetAnnotations()
+}
+
+// GetLabels from the appV1/StatefulSet object metadata
+func (statefulSetObjectSerializer KubernetesAPPV1StatefulSetSerializer) GetLabels() map[string]string {
+	return statefulSetObjectSerializer.convertedStatefulSet.GetLabels()
+}
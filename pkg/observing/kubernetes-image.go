@@ -26,6 +26,8 @@ package observing
 
 import (
 	"fmt"
+
+	"github.com/fwiedmann/differ/pkg/differentiating"
 )
 
 // imageWithKubernetesMetadata contains unique meta information from scraped resource types
@@ -36,7 +38,44 @@ type imageWithKubernetesMetadata struct {
 
 // GetUID generates a unique ID based of the kubernetes metadata
 func (o imageWithKubernetesMetadata) GetUID() string {
-	return fmt.Sprintf("%s_%s_%s_%s_%s_%s", o.MetaInformation.Namespace, o.MetaInformation.APIVersion, o.MetaInformation.UID, o.MetaInformation.WorkloadName, o.MetaInformation.ResourceType, o.Image.GetContainerName())
+	return fmt.Sprintf("%s_%s_%s_%s_%s_%s_%s", o.MetaInformation.Cluster, o.MetaInformation.Namespace, o.MetaInformation.APIVersion, o.MetaInformation.UID, o.MetaInformation.WorkloadName, o.MetaInformation.ResourceType, o.Image.GetContainerName())
+}
+
+// workload converts the meta information into the structured workload of differentiating.Image
+func (o imageWithKubernetesMetadata) workload() differentiating.Workload {
+	return differentiating.Workload{
+		Cluster:    o.MetaInformation.Cluster,
+		Namespace:  o.MetaInformation.Namespace,
+		APIVersion: o.MetaInformation.APIVersion,
+		Kind:       o.MetaInformation.ResourceType,
+		Name:       o.MetaInformation.WorkloadName,
+		UID:        o.MetaInformation.UID,
+		Container:  o.Image.GetContainerName(),
+		Labels:     o.MetaInformation.Labels,
+	}
+}
+
+// differentiatingImage converts the image with the constraint, snooze and owner annotations of the workload
+func (o imageWithKubernetesMetadata) differentiatingImage(annotations map[string]string) differentiating.Image {
+	ps := make([]*differentiating.PullSecret, 0)
+	for _, p := range o.Image.pullSecrets {
+		ps = append(ps, &differentiating.PullSecret{
+			Username: p.username,
+			Password: p.password,
+		})
+	}
+
+	return differentiating.Image{
+		ID:         o.GetUID(),
+		Registry:   o.Image.GetRegistryURL(),
+		Name:       o.Image.GetNameWithoutRegistry(),
+		Tag:        o.Image.GetTag(),
+		Auth:       ps,
+		Constraint: ConstraintForContainer(annotations, o.Image.GetContainerName()),
+		Snooze:     SnoozeForContainer(annotations, o.Image.GetContainerName()),
+		Owner:      OwnerForContainer(annotations, o.Image.GetContainerName()),
+		Workload:   o.workload(),
+	}
 }
 
 // String implements the stringer interface
@@ -46,14 +85,16 @@ func (o imageWithKubernetesMetadata) String() string {
 
 // kubernetesAPIObjectMetaInformation from the kubernetes API object
 type kubernetesAPIObjectMetaInformation struct {
+	Cluster      string
 	UID          string
 	APIVersion   string
 	ResourceType string
 	Namespace    string
 	WorkloadName string
+	Labels       map[string]string
 }
 
 // String implements the stringer interface
 func (k kubernetesAPIObjectMetaInformation) String() string {
-	return fmt.Sprintf("UID: %s, APIVersion: %s, ResourceType: %s, Namespace: %s, WorkloadName: %s", k.UID, k.APIVersion, k.ResourceType, k.Namespace, k.WorkloadName)
+	return fmt.Sprintf("Cluster: %s, UID: %s, APIVersion: %s, ResourceType: %s, Namespace: %s, WorkloadName: %s", k.Cluster, k.UID, k.APIVersion, k.ResourceType, k.Namespace, k.WorkloadName)
 }
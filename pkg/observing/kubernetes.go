@@ -30,10 +30,9 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/fwiedmann/differ/pkg/monitoring"
-
 	log "github.com/sirupsen/logrus"
 
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/tools/cache"
 
 	"github.com/fwiedmann/differ/pkg/differentiating"
@@ -55,21 +54,53 @@ type KubernetesObjectSerializer interface {
 	GetUID() string
 	GetAPIVersion() string
 	GetNamespace() string
+	GetAnnotations() map[string]string
+	GetLabels() map[string]string
 }
 
 type KubernetesObserverService struct {
 	ds         differentiating.Service
 	client     kubernetes.Interface
+	cluster    string
 	namespace  string
 	serializer func(obj interface{}) (KubernetesObjectSerializer, error)
+	// store is the informer cache of the observed objects, see Reconciler
+	store cache.Store
 }
 
-func StartKubernetesObserverService(ctx context.Context, c kubernetes.Interface, informer cache.SharedInformer, ns string, objSerializer func(obj interface{}) (KubernetesObjectSerializer, error), service differentiating.Service) error {
+// StartKubernetesObserverServices starts an observer for each supported kubernetes object kind of the given cluster.
+// All observers feed the same differentiating service.
+func StartKubernetesObserverServices(ctx context.Context, cluster string, c kubernetes.Interface, ns string, service differentiating.Service) ([]*KubernetesObserverService, error) {
+	sharedInformerFactory := informers.NewSharedInformerFactoryWithOptions(c, 0, informers.WithNamespace(ns))
+
+	observedInformers := []struct {
+		informer   cache.SharedInformer
+		serializer func(obj interface{}) (KubernetesObjectSerializer, error)
+	}{
+		{informer: sharedInformerFactory.Apps().V1().DaemonSets().Informer(), serializer: NewKubernetesAPPV1DaemonSetSerializer},
+		{informer: sharedInformerFactory.Apps().V1().Deployments().Informer(), serializer: NewKubernetesAPPV1DeploymentSerializer},
+		{informer: sharedInformerFactory.Apps().V1().StatefulSets().Informer(), serializer: NewKubernetesAPPV1StatefulSetSerializer},
+	}
+
+	observers := make([]*KubernetesObserverService, 0, len(observedInformers))
+	for _, observed := range observedInformers {
+		observer, err := StartKubernetesObserverService(ctx, cluster, c, observed.informer, ns, observed.serializer, service)
+		if err != nil {
+			return nil, fmt.Errorf("observer/kubernetes error: cluster %s: %w", cluster, err)
+		}
+		observers = append(observers, observer)
+	}
+	return observers, nil
+}
+
+func StartKubernetesObserverService(ctx context.Context, cluster string, c kubernetes.Interface, informer cache.SharedInformer, ns string, objSerializer func(obj interface{}) (KubernetesObjectSerializer, error), service differentiating.Service) (*KubernetesObserverService, error) {
 	kos := &KubernetesObserverService{
 		ds:         service,
 		client:     c,
+		cluster:    cluster,
 		namespace:  ns,
 		serializer: objSerializer,
+		store:      informer.GetStore(),
 	}
 
 	informer.AddEventHandler(kos)
@@ -79,7 +110,7 @@ func StartKubernetesObserverService(ctx context.Context, c kubernetes.Interface,
 	syncCtx, syncCancel := context.WithCancel(ctx)
 	defer syncCancel()
 	if synced := cache.WaitForCacheSync(syncCtx.Done(), informer.HasSynced); !synced {
-		return fmt.Errorf("observer/kubernetes: could sync with shared informer cache")
+		return nil, fmt.Errorf("observer/kubernetes: could sync with shared informer cache")
 	}
 
 	serviceCtx, cancel := context.WithCancel(ctx)
@@ -88,76 +119,99 @@ func StartKubernetesObserverService(ctx context.Context, c kubernetes.Interface,
 		cancel()
 		stop <- struct{}{}
 	}(serviceCtx)
-	return nil
+	return kos, nil
 }
 
 func (k *KubernetesObserverService) OnAdd(obj interface{}) {
-	k.handleInformerEvent(addingOperation, obj, k.ds.AddImage)
+	if err := k.handleInformerEvent(addingOperation, obj, k.ds.AddImage); err != nil {
+		log.Error(err)
+	}
 }
 
 func (k *KubernetesObserverService) OnUpdate(_, newObj interface{}) {
-	k.handleInformerEvent(updateOperation, newObj, k.ds.UpdateImage)
+	if err := k.handleInformerEvent(updateOperation, newObj, k.ds.UpdateImage); err != nil {
+		log.Error(err)
+	}
 }
 
 func (k *KubernetesObserverService) OnDelete(obj interface{}) {
-	k.handleInformerEvent(deleteOperation, obj, k.ds.DeleteImage)
+	// the informer passes a tombstone if the deletion was missed while the watch was disconnected
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if err := k.handleInformerEvent(deleteOperation, obj, k.ds.DeleteImage); err != nil {
+		log.Error(err)
+	}
 }
 
-func (k *KubernetesObserverService) handleInformerEvent(operationKind string, kubernetesObj interface{}, differntiateServiceOperation func(ctx context.Context, i differentiating.Image) error) {
+// handleInformerEvent performs the operation for the images of all containers of the kubernetes object. A failed
+// operation does not stop the operations of the other images, the returned error reports the failed images.
+func (k *KubernetesObserverService) handleInformerEvent(operationKind string, kubernetesObj interface{}, differntiateServiceOperation func(ctx context.Context, i differentiating.Image) error) error {
 	o, err := k.serializer(kubernetesObj)
 	if err != nil {
-		log.Errorf("observing/kubernetes error: %s", err)
-		return
+		return fmt.Errorf("observing/kubernetes error: %w", err)
 	}
 
-	images, err := k.getImagesFromPodSpec(o.GetPodSpec(), kubernetesAPIObjectMetaInformation{
-		UID:          o.GetUID(),
-		APIVersion:   o.GetAPIVersion(),
-		ResourceType: o.GetObjectKind(),
-		Namespace:    o.GetNamespace(),
-		WorkloadName: o.GetName(),
-	})
+	images, err := k.getImagesFromPodSpec(o.GetPodSpec(), k.metaInformation(o))
 	if err != nil {
-		log.Errorf("observing/kubernetes error: %s", err)
-		return
+		return fmt.Errorf("observing/kubernetes error: %w", err)
 	}
 
+	annotations := o.GetAnnotations()
+	var failed int
+	var lastErr error
 	for _, kubernetesImage := range images {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-		err := make(chan error)
+		// buffered, so that the operation does not block forever after the timeout
+		result := make(chan error, 1)
 
 		go func(i imageWithKubernetesMetadata) {
-			ps := make([]*differentiating.PullSecret, 0)
-			for _, p := range i.Image.pullSecrets {
-				ps = append(ps, &differentiating.PullSecret{
-					Username: p.username,
-					Password: p.password,
-				})
-			}
-
-			err <- differntiateServiceOperation(ctx, differentiating.Image{
-				ID:       i.GetUID(),
-				Registry: i.Image.GetRegistryURL(),
-				Name:     i.Image.GetNameWithoutRegistry(),
-				Tag:      i.Image.GetTag(),
-				Auth:     ps,
-			})
+			result <- differntiateServiceOperation(ctx, i.differentiatingImage(annotations))
 		}(kubernetesImage)
 
 		select {
-		case err := <-err:
+		case err := <-result:
 			if err != nil {
-				log.Errorf("observing/kubernetes error: %s", err)
+				failed++
+				lastErr = err
 			}
-
-			cancel()
 			updateMetric(operationKind, kubernetesImage)
-			return
 		case <-ctx.Done():
-			cancel()
-			log.Errorf("observing/kubernetes error: could not perform %s action on differentiate service, timout exceeded", operationKind)
-			return
+			failed++
+			lastErr = fmt.Errorf("could not perform %s action on differentiate service, timout exceeded", operationKind)
 		}
+		cancel()
+	}
+	if failed > 0 {
+		return fmt.Errorf("observing/kubernetes error: %s action failed for %d of %d images of %s %s/%s: %w", operationKind, failed, len(images), o.GetObjectKind(), o.GetNamespace(), o.GetName(), lastErr)
+	}
+	return nil
+}
+
+// observedImages returns the images of all containers of the kubernetes object without their pull secrets
+func (k *KubernetesObserverService) observedImages(kubernetesObj interface{}) ([]differentiating.Image, error) {
+	o, err := k.serializer(kubernetesObj)
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := o.GetAnnotations()
+	var images []differentiating.Image
+	for _, i := range createEventForEachImage(k.extractImagesFromPodSpec(o.GetPodSpec()), k.metaInformation(o)) {
+		images = append(images, i.differentiatingImage(annotations))
+	}
+	return images, nil
+}
+
+func (k *KubernetesObserverService) metaInformation(o KubernetesObjectSerializer) kubernetesAPIObjectMetaInformation {
+	return kubernetesAPIObjectMetaInformation{
+		Cluster:      k.cluster,
+		UID:          o.GetUID(),
+		APIVersion:   o.GetAPIVersion(),
+		ResourceType: o.GetObjectKind(),
+		Namespace:    o.GetNamespace(),
+		WorkloadName: o.GetName(),
+		Labels:       o.GetLabels(),
 	}
 }
 
@@ -276,9 +330,9 @@ func createEventForEachImage(images []image, kubernetesMetaInformation kubernete
 }
 
 func updateMetric(operationKind string, obj imageWithKubernetesMetadata) {
-	var val float64 = 1
 	if operationKind == deleteOperation {
-		val = 0
+		observedContainers.delete(obj.GetUID())
+		return
 	}
-	monitoring.KubernetesObservedContainerMetric.WithLabelValues(obj.Image.GetContainerName(), obj.Image.GetRegistryURL(), obj.Image.GetNameWithRegistry(), obj.Image.GetTag(), obj.MetaInformation.Namespace, obj.MetaInformation.APIVersion, obj.MetaInformation.ResourceType, obj.MetaInformation.UID, obj.MetaInformation.WorkloadName).Set(val)
+	observedContainers.set(obj.GetUID(), []string{obj.MetaInformation.Cluster, obj.Image.GetContainerName(), obj.Image.GetRegistryURL(), obj.Image.GetNameWithRegistry(), obj.Image.GetTag(), obj.MetaInformation.Namespace, obj.MetaInformation.APIVersion, obj.MetaInformation.ResourceType, obj.MetaInformation.UID, obj.MetaInformation.WorkloadName})
 }
@@ -0,0 +1,188 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package observing
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/differentiating"
+	"github.com/fwiedmann/differ/pkg/monitoring"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultReconcileInterval = 10 * time.Minute
+
+// Reconciler periodically compares the containers in the informer caches of all observers with the images of the
+// differentiating service. Informer events can be missed, e.g. during a restart with a persistent storage or a gap of
+// the watch, which would otherwise leave orphaned images, workers and metric series behind forever.
+type Reconciler struct {
+	service   differentiating.Service
+	interval  time.Duration
+	mutex     sync.Mutex
+	observers []*KubernetesObserverService
+}
+
+// ReconcileResult counts the changes of a reconciliation
+type ReconcileResult struct {
+	Added         int
+	Updated       int
+	Deleted       int
+	DeletedSeries int
+}
+
+// NewReconciler creates a reconciler for the service, the interval defaults to 10 minutes
+func NewReconciler(service differentiating.Service, interval time.Duration) *Reconciler {
+	if interval <= 0 {
+		interval = defaultReconcileInterval
+	}
+	return &Reconciler{
+		service:  service,
+		interval: interval,
+	}
+}
+
+// Register the started observers. All observers of all clusters have to be registered before the first reconciliation,
+// otherwise the images of the missing observers are deleted as orphans.
+func (r *Reconciler) Register(observers ...*KubernetesObserverService) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.observers = append(r.observers, observers...)
+}
+
+// Run reconciles in each interval until the context is done
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			result, err := r.Reconcile(ctx)
+			if err != nil {
+				log.Errorf("observing/reconciler error: %s", err)
+				continue
+			}
+			if result != (ReconcileResult{}) {
+				log.Infof("Reconciled images with the informer caches: %d added, %d updated, %d deleted, %d stale metric series deleted", result.Added, result.Updated, result.Deleted, result.DeletedSeries)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Reconcile adds the missing and updates the changed images of the informer caches and deletes the images, which are
+// not in any informer cache. The images of the service are listed before the caches, so that images added in between
+// are not deleted.
+func (r *Reconciler) Reconcile(ctx context.Context) (ReconcileResult, error) {
+	stored, err := r.service.ListImages(ctx, differentiating.ListOptions{})
+	if err != nil {
+		return ReconcileResult{}, err
+	}
+	storedByID := make(map[string]differentiating.Image, len(stored))
+	for _, img := range stored {
+		storedByID[img.ID] = img
+	}
+
+	r.mutex.Lock()
+	observers := r.observers
+	r.mutex.Unlock()
+
+	var result ReconcileResult
+	expected := make(map[string]bool)
+	for _, observer := range observers {
+		for _, obj := range observer.store.List() {
+			images, err := observer.observedImages(obj)
+			if err != nil {
+				log.Errorf("observing/reconciler error: %s", err)
+				continue
+			}
+
+			var added, updated int
+			for _, img := range images {
+				expected[img.ID] = true
+				storedImage, ok := storedByID[img.ID]
+				switch {
+				case !ok:
+					added++
+				case !sameImage(storedImage, img):
+					updated++
+				}
+			}
+			if added+updated == 0 {
+				continue
+			}
+			// adding an existing image updates it, the object is passed again to fetch the pull secrets
+			if err := observer.handleInformerEvent(addingOperation, obj, r.service.AddImage); err != nil {
+				log.Errorf("observing/reconciler error: %s", err)
+				continue
+			}
+			result.Added += added
+			result.Updated += updated
+		}
+	}
+
+	for _, img := range stored {
+		if expected[img.ID] {
+			continue
+		}
+		if err := r.service.DeleteImage(ctx, img); err != nil {
+			log.Errorf("observing/reconciler error: could not delete orphaned image with ID %s: %s", img.ID, err)
+			continue
+		}
+		result.Deleted++
+	}
+	result.DeletedSeries = observedContainers.retain(expected)
+
+	monitoring.ReconciledImagesMetric.WithLabelValues("added").Add(float64(result.Added))
+	monitoring.ReconciledImagesMetric.WithLabelValues("updated").Add(float64(result.Updated))
+	monitoring.ReconciledImagesMetric.WithLabelValues("deleted").Add(float64(result.Deleted))
+	return result, nil
+}
+
+// sameImage compares the observed fields of the images, the pull secrets are ignored
+func sameImage(stored, observed differentiating.Image) bool {
+	storedWorkload, observedWorkload := stored.Workload, observed.Workload
+	storedWorkload.Labels, observedWorkload.Labels = nil, nil
+	return stored.Registry == observed.Registry &&
+		stored.Name == observed.Name &&
+		stored.Tag == observed.Tag &&
+		stored.Constraint == observed.Constraint &&
+		stored.Snooze == observed.Snooze &&
+		stored.Owner == observed.Owner &&
+		reflect.DeepEqual(storedWorkload, observedWorkload) &&
+		sameLabels(stored.Workload.Labels, observed.Workload.Labels)
+}
+
+// sameLabels treats nil and empty labels as equal, because empty labels are not stored by all repositories
+func sameLabels(a, b map[string]string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,210 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package observing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/differentiating"
+	v1 "k8s.io/api/apps/v1"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// imageStore is a differentiating.MockService backed by a map
+type imageStore struct {
+	mutex  sync.Mutex
+	images map[string]differentiating.Image
+}
+
+func (s *imageStore) service() differentiating.MockService {
+	put := func(i differentiating.Image) error {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.images[i.ID] = i
+		return nil
+	}
+	return differentiating.MockService{
+		Add:    put,
+		Update: put,
+		Delete: func(i differentiating.Image) error {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			if _, ok := s.images[i.ID]; !ok {
+				return fmt.Errorf("image %s not found", i.ID)
+			}
+			delete(s.images, i.ID)
+			return nil
+		},
+		List: func(_ differentiating.ListOptions) ([]differentiating.Image, error) {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			images := make([]differentiating.Image, 0, len(s.images))
+			for _, img := range s.images {
+				images = append(images, img)
+			}
+			return images, nil
+		},
+	}
+}
+
+func (s *imageStore) byContainer() map[string]differentiating.Image {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	images := make(map[string]differentiating.Image)
+	for _, img := range s.images {
+		images[img.Workload.Container] = img
+	}
+	return images
+}
+
+func newReconcilerTestDeployment(name string, containers ...coreV1.Container) *v1.Deployment {
+	return &v1.Deployment{
+		ObjectMeta: metaV1.ObjectMeta{Name: name, Namespace: testNamespace, UID: types.UID("uid-" + name)},
+		Spec: v1.DeploymentSpec{
+			Template: coreV1.PodTemplateSpec{Spec: coreV1.PodSpec{Containers: containers}},
+		},
+	}
+}
+
+func TestReconciler_Reconcile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := fake.NewSimpleClientset(
+		newReconcilerTestDeployment("frontend", coreV1.Container{Name: "nginx", Image: "nginx:1.19.0"}, coreV1.Container{Name: "exporter", Image: "nginx/nginx-prometheus-exporter:0.8.0"}),
+		newReconcilerTestDeployment("cache", coreV1.Container{Name: "redis", Image: "redis:6.0.9"}),
+	)
+	store := &imageStore{images: make(map[string]differentiating.Image)}
+	informer := informers.NewSharedInformerFactoryWithOptions(client, 0, informers.WithNamespace(testNamespace)).Apps().V1().Deployments().Informer()
+	observer, err := StartKubernetesObserverService(ctx, "test-cluster", client, informer, testNamespace, NewKubernetesAPPV1DeploymentSerializer, store.service())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// all containers of a workload are added
+	deadline := time.Now().Add(time.Second * 5)
+	for len(store.byContainer()) != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("observer added %d images, want 3", len(store.byContainer()))
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// simulate missed events: a deleted workload, a missed add and a missed tag change
+	images := store.byContainer()
+	store.mutex.Lock()
+	delete(store.images, images["exporter"].ID)
+	redis := images["redis"]
+	redis.Tag = "6.0.8"
+	store.images[redis.ID] = redis
+	orphan := differentiating.Image{ID: "test-cluster_test-name-space_appV1_uid-deleted_deleted_Deployment_app", Registry: "registry-1.docker.io", Name: "library/app", Tag: "1.0", Workload: differentiating.Workload{Cluster: "test-cluster"}}
+	store.images[orphan.ID] = orphan
+	store.mutex.Unlock()
+	observedContainers.set(orphan.ID, []string{"test-cluster", "app", orphan.Registry, orphan.GetNameWithRegistry(), orphan.Tag, testNamespace, "appV1", "Deployment", "uid-deleted", "deleted"})
+
+	reconciler := NewReconciler(store.service(), time.Hour)
+	reconciler.Register(observer)
+	result, err := reconciler.Reconcile(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the series of other tests are deleted as well, because the observer of this test does not know their containers
+	want := ReconcileResult{Added: 1, Updated: 1, Deleted: 1, DeletedSeries: result.DeletedSeries}
+	if result != want || result.DeletedSeries < 1 {
+		t.Errorf("Reconcile() = %+v, want %+v with at least one deleted series", result, want)
+	}
+	observedContainers.mutex.Lock()
+	_, ok := observedContainers.series[orphan.ID]
+	observedContainers.mutex.Unlock()
+	if ok {
+		t.Error("Reconcile() did not delete the series of the orphaned image")
+	}
+	images = store.byContainer()
+	if len(images) != 3 || images["redis"].Tag != "6.0.9" {
+		t.Errorf("Reconcile() left images %+v, want the three observed containers", images)
+	}
+	if _, ok := images["app"]; ok {
+		t.Error("Reconcile() did not delete the orphaned image")
+	}
+
+	result, err = reconciler.Reconcile(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Added != 0 || result.Updated != 0 || result.Deleted != 0 {
+		t.Errorf("Reconcile() of reconciled images = %+v, want no changes", result)
+	}
+
+	// failed operations are not counted
+	store.mutex.Lock()
+	store.images[redis.ID] = redis
+	store.mutex.Unlock()
+	failing := store.service()
+	failing.Add = func(differentiating.Image) error {
+		return fmt.Errorf("storage unavailable")
+	}
+	failingReconciler := NewReconciler(failing, time.Hour)
+	failingReconciler.Register(observer)
+	result, err = failingReconciler.Reconcile(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Updated != 0 {
+		t.Errorf("Reconcile() with a failing service = %+v, want no counted updates", result)
+	}
+}
+
+func TestContainerSeries(t *testing.T) {
+	series := &containerSeries{series: make(map[string][]string)}
+	labels := func(tag string) []string {
+		return []string{"test-cluster", "nginx", "registry-1.docker.io", "registry-1.docker.io/library/nginx", tag, testNamespace, "appV1", "Deployment", "uid", "frontend"}
+	}
+
+	series.set("1", labels("1.18.0"))
+	series.set("1", labels("1.19.0"))
+	series.set("2", labels("1.19.0"))
+	if got := series.series["1"][4]; got != "1.19.0" {
+		t.Errorf("set() kept tag %s, want the updated tag", got)
+	}
+
+	series.delete("2")
+	series.delete("3")
+	if _, ok := series.series["2"]; ok {
+		t.Error("delete() kept the series")
+	}
+
+	series.set("2", labels("1.19.0"))
+	if deleted := series.retain(map[string]bool{"2": true}); deleted != 1 || len(series.series) != 1 {
+		t.Errorf("retain() deleted %d series and kept %v, want only the expected series", deleted, series.series)
+	}
+}
@@ -0,0 +1,228 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package receiving
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// SourceType defines the payload format and the verification of a webhook
+type SourceType string
+
+const (
+	// SourceHarbor verifies the auth header of the Harbor webhook policy
+	SourceHarbor SourceType = "harbor"
+	// SourceDockerHub verifies the token query parameter, Docker Hub does not sign its webhooks
+	SourceDockerHub SourceType = "dockerhub"
+	// SourceQuay verifies the token query parameter, Quay does not sign its notifications
+	SourceQuay SourceType = "quay"
+	// SourceGitLab receives the registry notifications of GitLab and verifies the Authorization header of the notification endpoint
+	SourceGitLab SourceType = "gitlab"
+	// SourceNexus verifies the HMAC-SHA1 signature of the payload
+	SourceNexus SourceType = "nexus"
+)
+
+const dockerHubRegistry = "registry-1.docker.io"
+
+func (t SourceType) defaultRegistry() string {
+	if t == SourceDockerHub {
+		return dockerHubRegistry
+	}
+	return ""
+}
+
+type sourceParser struct {
+	verify func(r *http.Request, payload []byte, secret string) error
+	parse  func(payload []byte) ([]Push, error)
+}
+
+var parsers = map[SourceType]sourceParser{
+	SourceHarbor:    {verify: verifyHeader("Authorization"), parse: parseHarbor},
+	SourceDockerHub: {verify: verifyQueryToken, parse: parseDockerHub},
+	SourceQuay:      {verify: verifyQueryToken, parse: parseQuay},
+	SourceGitLab:    {verify: verifyHeader("Authorization"), parse: parseGitLab},
+	SourceNexus:     {verify: verifyNexusSignature, parse: parseNexus},
+}
+
+func verifyHeader(header string) func(r *http.Request, _ []byte, secret string) error {
+	return func(r *http.Request, _ []byte, secret string) error {
+		if !equalSecret(r.Header.Get(header), secret) {
+			return errUnauthorized
+		}
+		return nil
+	}
+}
+
+func verifyQueryToken(r *http.Request, _ []byte, secret string) error {
+	if !equalSecret(r.URL.Query().Get("token"), secret) {
+		return errUnauthorized
+	}
+	return nil
+}
+
+func verifyNexusSignature(r *http.Request, payload []byte, secret string) error {
+	signature, err := hex.DecodeString(r.Header.Get("X-Nexus-Webhook-Signature"))
+	if err != nil {
+		return errUnauthorized
+	}
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write(payload) //nolint:errcheck // writing to a hash never fails
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return errUnauthorized
+	}
+	return nil
+}
+
+type harborPayload struct {
+	Type      string `json:"type"`
+	EventData struct {
+		Resources []struct {
+			Tag string `json:"tag"`
+		} `json:"resources"`
+		Repository struct {
+			RepoFullName string `json:"repo_full_name"`
+		} `json:"repository"`
+	} `json:"event_data"`
+}
+
+func parseHarbor(payload []byte) ([]Push, error) {
+	var p harborPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, fmt.Errorf("receiving/webhook error: invalid Harbor payload: %w", err)
+	}
+	if p.Type != "PUSH_ARTIFACT" && p.Type != "pushImage" {
+		return nil, nil
+	}
+	if p.EventData.Repository.RepoFullName == "" {
+		return nil, fmt.Errorf("receiving/webhook error: Harbor payload has no repository")
+	}
+
+	pushes := make([]Push, 0, len(p.EventData.Resources))
+	for _, resource := range p.EventData.Resources {
+		pushes = append(pushes, Push{Name: p.EventData.Repository.RepoFullName, Tag: resource.Tag})
+	}
+	return pushes, nil
+}
+
+type dockerHubPayload struct {
+	PushData struct {
+		Tag string `json:"tag"`
+	} `json:"push_data"`
+	Repository struct {
+		RepoName string `json:"repo_name"`
+	} `json:"repository"`
+}
+
+func parseDockerHub(payload []byte) ([]Push, error) {
+	var p dockerHubPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, fmt.Errorf("receiving/webhook error: invalid Docker Hub payload: %w", err)
+	}
+	name := p.Repository.RepoName
+	if name == "" {
+		return nil, fmt.Errorf("receiving/webhook error: Docker Hub payload has no repository")
+	}
+	if !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+	return []Push{{Name: name, Tag: p.PushData.Tag}}, nil
+}
+
+type quayPayload struct {
+	Repository  string   `json:"repository"`
+	UpdatedTags []string `json:"updated_tags"`
+}
+
+func parseQuay(payload []byte) ([]Push, error) {
+	var p quayPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, fmt.Errorf("receiving/webhook error: invalid Quay payload: %w", err)
+	}
+	if p.Repository == "" {
+		return nil, fmt.Errorf("receiving/webhook error: Quay payload has no repository")
+	}
+
+	pushes := make([]Push, 0, len(p.UpdatedTags))
+	for _, tag := range p.UpdatedTags {
+		pushes = append(pushes, Push{Name: p.Repository, Tag: tag})
+	}
+	return pushes, nil
+}
+
+// gitLabPayload is the notification envelope of the docker distribution registry, which is used by GitLab
+type gitLabPayload struct {
+	Events []struct {
+		Action string `json:"action"`
+		Target struct {
+			Repository string `json:"repository"`
+			Tag        string `json:"tag"`
+		} `json:"target"`
+	} `json:"events"`
+}
+
+func parseGitLab(payload []byte) ([]Push, error) {
+	var p gitLabPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, fmt.Errorf("receiving/webhook error: invalid GitLab payload: %w", err)
+	}
+
+	var pushes []Push
+	for _, event := range p.Events {
+		if event.Action != "push" || event.Target.Repository == "" || event.Target.Tag == "" {
+			continue
+		}
+		pushes = append(pushes, Push{Name: event.Target.Repository, Tag: event.Target.Tag})
+	}
+	return pushes, nil
+}
+
+type nexusPayload struct {
+	Action    string `json:"action"`
+	Component struct {
+		Format  string `json:"format"`
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"component"`
+}
+
+func parseNexus(payload []byte) ([]Push, error) {
+	var p nexusPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, fmt.Errorf("receiving/webhook error: invalid Nexus payload: %w", err)
+	}
+	if p.Component.Format != "docker" || (p.Action != "CREATED" && p.Action != "UPDATED") {
+		return nil, nil
+	}
+	if p.Component.Name == "" {
+		return nil, fmt.Errorf("receiving/webhook error: Nexus payload has no component name")
+	}
+	return []Push{{Name: p.Component.Name, Tag: p.Component.Version}}, nil
+}
@@ -0,0 +1,171 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package receiving
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/fwiedmann/differ/pkg/monitoring"
+	log "github.com/sirupsen/logrus"
+)
+
+// WebhookPathPrefix is the path of the webhook handler, each source receives its pushes on WebhookPathPrefix + source name
+const WebhookPathPrefix = "/webhooks/"
+
+// maxPayloadSize limits the request body of a webhook
+const maxPayloadSize = 1 << 20
+
+const (
+	resultAccepted     = "accepted"
+	resultUnauthorized = "unauthorized"
+	resultInvalid      = "invalid"
+	resultUnknown      = "unknown_source"
+)
+
+var errUnauthorized = errors.New("receiving/webhook error: request could not be verified with the secret of the source")
+
+// CheckRequester schedules an immediate check of an image. It reports if the image is watched.
+type CheckRequester interface {
+	RequestCheck(registry, imageName string) bool
+}
+
+// Source is a registry which sends push webhooks
+type Source struct {
+	// Name is the last element of the webhook path
+	Name string
+	Type SourceType
+	// Registry is the registry URL of the pushed images as it is used in the image references of the workloads.
+	// It defaults to the Docker Hub registry for Docker Hub sources.
+	Registry string
+	// Secret verifies the requests of the source, the verification depends on the SourceType
+	Secret string
+}
+
+// RegistryURL returns the configured registry or the default registry of the SourceType
+func (s Source) RegistryURL() string {
+	if s.Registry != "" {
+		return s.Registry
+	}
+	return s.Type.defaultRegistry()
+}
+
+// Push of a tag to a repository of a registry
+type Push struct {
+	Registry string
+	Name     string
+	Tag      string
+}
+
+// WebhookHandler receives push webhooks and requests an immediate check of the pushed images
+type WebhookHandler struct {
+	requester CheckRequester
+	sources   map[string]Source
+}
+
+// NewWebhookHandler validates the sources and creates the handler
+func NewWebhookHandler(requester CheckRequester, sources []Source) (*WebhookHandler, error) {
+	h := &WebhookHandler{
+		requester: requester,
+		sources:   make(map[string]Source),
+	}
+	for _, source := range sources {
+		if _, ok := h.sources[source.Name]; ok {
+			return nil, fmt.Errorf("receiving/webhook error: source %s is configured twice", source.Name)
+		}
+		if _, ok := parsers[source.Type]; !ok {
+			return nil, fmt.Errorf("receiving/webhook error: source %s has the unknown type %s", source.Name, source.Type)
+		}
+		source.Registry = source.RegistryURL()
+		if source.Registry == "" {
+			return nil, fmt.Errorf("receiving/webhook error: source %s has no registry", source.Name)
+		}
+		if source.Secret == "" {
+			return nil, fmt.Errorf("receiving/webhook error: source %s has no secret", source.Name)
+		}
+		h.sources[source.Name] = source
+	}
+	return h, nil
+}
+
+// ServeHTTP implements the http.Handler interface
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, WebhookPathPrefix)
+	source, ok := h.sources[name]
+	if !ok {
+		monitoring.WebhookRequestsMetric.WithLabelValues(name, resultUnknown).Inc()
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	payload, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+	if err != nil {
+		h.reject(w, source, http.StatusBadRequest, resultInvalid, err)
+		return
+	}
+
+	parser := parsers[source.Type]
+	if err := parser.verify(r, payload, source.Secret); err != nil {
+		h.reject(w, source, http.StatusUnauthorized, resultUnauthorized, err)
+		return
+	}
+
+	pushes, err := parser.parse(payload)
+	if err != nil {
+		h.reject(w, source, http.StatusBadRequest, resultInvalid, err)
+		return
+	}
+
+	monitoring.WebhookRequestsMetric.WithLabelValues(source.Name, resultAccepted).Inc()
+	for _, push := range pushes {
+		push.Registry = source.Registry
+		if !h.requester.RequestCheck(push.Registry, push.Name) {
+			log.Debugf("receiving/webhook: ignored push of %s/%s:%s from source %s, the image is not watched", push.Registry, push.Name, push.Tag, source.Name)
+			continue
+		}
+		log.Debugf("receiving/webhook: requested check of %s/%s after push of tag %s", push.Registry, push.Name, push.Tag)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *WebhookHandler) reject(w http.ResponseWriter, source Source, status int, result string, err error) {
+	log.Warnf("receiving/webhook error: rejected request of source %s: %s", source.Name, err)
+	monitoring.WebhookRequestsMetric.WithLabelValues(source.Name, result).Inc()
+	w.WriteHeader(status)
+}
+
+// equalSecret compares the secrets in constant time
+func equalSecret(got, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
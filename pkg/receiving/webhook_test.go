@@ -0,0 +1,209 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package receiving
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type requesterMock struct {
+	mutex     sync.Mutex
+	watched   map[string]bool
+	requested []string
+}
+
+func (r *requesterMock) RequestCheck(registry, imageName string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.requested = append(r.requested, registry+"/"+imageName)
+	return r.watched[registry+"/"+imageName]
+}
+
+func nexusSignature(payload, secret string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(payload)) //nolint
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookHandler_ServeHTTP(t *testing.T) {
+	sources := []Source{
+		{Name: "harbor", Type: SourceHarbor, Registry: "harbor.example.com", Secret: "secret"},
+		{Name: "hub", Type: SourceDockerHub, Secret: "secret"},
+		{Name: "quay", Type: SourceQuay, Registry: "quay.io", Secret: "secret"},
+		{Name: "gitlab", Type: SourceGitLab, Registry: "registry.gitlab.com", Secret: "secret"},
+		{Name: "nexus", Type: SourceNexus, Registry: "nexus.example.com:8443", Secret: "secret"},
+	}
+
+	const nexusPayload = `{"action":"CREATED","component":{"format":"docker","name":"team/api","version":"1.2.0"}}`
+	tests := []struct {
+		name          string
+		method        string
+		target        string
+		header        map[string]string
+		payload       string
+		wantStatus    int
+		wantRequested []string
+	}{
+		{
+			name:          "Harbor",
+			target:        "/webhooks/harbor",
+			header:        map[string]string{"Authorization": "secret"},
+			payload:       `{"type":"PUSH_ARTIFACT","event_data":{"resources":[{"tag":"1.2.0"}],"repository":{"repo_full_name":"library/nginx"}}}`,
+			wantStatus:    http.StatusAccepted,
+			wantRequested: []string{"harbor.example.com/library/nginx"},
+		},
+		{
+			name:       "HarborWrongSecret",
+			target:     "/webhooks/harbor",
+			header:     map[string]string{"Authorization": "wrong"},
+			payload:    `{"type":"PUSH_ARTIFACT"}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "HarborOtherEvent",
+			target:     "/webhooks/harbor",
+			header:     map[string]string{"Authorization": "secret"},
+			payload:    `{"type":"DELETE_ARTIFACT","event_data":{"resources":[{"tag":"1.2.0"}],"repository":{"repo_full_name":"library/nginx"}}}`,
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:          "DockerHubLibrary",
+			target:        "/webhooks/hub?token=secret",
+			payload:       `{"push_data":{"tag":"latest"},"repository":{"repo_name":"nginx"}}`,
+			wantStatus:    http.StatusAccepted,
+			wantRequested: []string{"registry-1.docker.io/library/nginx"},
+		},
+		{
+			name:       "DockerHubWithoutToken",
+			target:     "/webhooks/hub",
+			payload:    `{"push_data":{"tag":"latest"},"repository":{"repo_name":"nginx"}}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:          "Quay",
+			target:        "/webhooks/quay?token=secret",
+			payload:       `{"repository":"coreos/etcd","updated_tags":["v3.4.14"]}`,
+			wantStatus:    http.StatusAccepted,
+			wantRequested: []string{"quay.io/coreos/etcd"},
+		},
+		{
+			name:          "GitLab",
+			target:        "/webhooks/gitlab",
+			header:        map[string]string{"Authorization": "secret"},
+			payload:       `{"events":[{"action":"pull","target":{"repository":"group/app","tag":"1.0.0"}},{"action":"push","target":{"repository":"group/app","tag":"1.1.0"}}]}`,
+			wantStatus:    http.StatusAccepted,
+			wantRequested: []string{"registry.gitlab.com/group/app"},
+		},
+		{
+			name:          "Nexus",
+			target:        "/webhooks/nexus",
+			header:        map[string]string{"X-Nexus-Webhook-Signature": nexusSignature(nexusPayload, "secret")},
+			payload:       nexusPayload,
+			wantStatus:    http.StatusAccepted,
+			wantRequested: []string{"nexus.example.com:8443/team/api"},
+		},
+		{
+			name:       "NexusWrongSignature",
+			target:     "/webhooks/nexus",
+			header:     map[string]string{"X-Nexus-Webhook-Signature": nexusSignature(nexusPayload, "wrong")},
+			payload:    nexusPayload,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "InvalidPayload",
+			target:     "/webhooks/quay?token=secret",
+			payload:    `{`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "UnknownSource",
+			target:     "/webhooks/unknown",
+			payload:    `{}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "MethodNotAllowed",
+			method:     http.MethodGet,
+			target:     "/webhooks/quay?token=secret",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requester := &requesterMock{}
+			h, err := NewWebhookHandler(requester, sources)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			r := httptest.NewRequest(method, tt.target, strings.NewReader(tt.payload))
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("ServeHTTP() status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if !reflect.DeepEqual(requester.requested, tt.wantRequested) {
+				t.Errorf("ServeHTTP() requested checks = %v, want %v", requester.requested, tt.wantRequested)
+			}
+		})
+	}
+}
+
+func TestNewWebhookHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []Source
+		wantErr bool
+	}{
+		{name: "Valid", sources: []Source{{Name: "hub", Type: SourceDockerHub, Secret: "secret"}}},
+		{name: "Duplicate", sources: []Source{{Name: "hub", Type: SourceDockerHub, Secret: "secret"}, {Name: "hub", Type: SourceQuay, Registry: "quay.io", Secret: "secret"}}, wantErr: true},
+		{name: "UnknownType", sources: []Source{{Name: "ecr", Type: "ecr", Registry: "ecr.aws", Secret: "secret"}}, wantErr: true},
+		{name: "MissingRegistry", sources: []Source{{Name: "quay", Type: SourceQuay, Secret: "secret"}}, wantErr: true},
+		{name: "MissingSecret", sources: []Source{{Name: "quay", Type: SourceQuay, Registry: "quay.io"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewWebhookHandler(&requesterMock{}, tt.sources); (err != nil) != tt.wantErr {
+				t.Errorf("NewWebhookHandler() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
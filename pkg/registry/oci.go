@@ -46,6 +46,7 @@ var (
 
 const (
 	httpAuthenticateHeader = "WWW-Authenticate"
+	contentDigestHeader    = "Docker-Content-Digest"
 	bearerRealmRegex       = "^Bearer realm=\"(.*?)\",service=\"(.*?)\"$"
 	dockerRegistryVersion  = "v2"
 )
@@ -57,6 +58,15 @@ type bearerToken struct {
 	IssuedAt    time.Time `json:"issued_at"`
 }
 
+// manifestMediaTypes are accepted when requesting a manifest digest. Multi-arch indexes are preferred, because floating
+// tags usually point to an index and the digest of a platform specific manifest would never match.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
 type tagList struct {
 	Tags []string `json:"tags"`
 }
@@ -104,6 +114,27 @@ func (c *OciAPIClient) GetTagsForImage(ctx context.Context, secret OciPullSecret
 	return tags, err
 }
 
+// GetDigestForTag returns the manifest digest of the given tag. If secret is nil the request will omit the BasicAuth HTTP header
+func (c *OciAPIClient) GetDigestForTag(ctx context.Context, secret OciPullSecret, tag string) (string, error) {
+	if c.bearerToken == "" {
+		err := c.getBearerToken(ctx, secret)
+		if err != nil {
+			return "", err
+		}
+		return c.getDigest(ctx, tag)
+	}
+
+	digest, err := c.getDigest(ctx, tag)
+	if errors.Is(err, StatusUnauthorizedError) || errors.Is(err, StatusForbiddenError) {
+		err := c.getBearerToken(ctx, secret)
+		if err != nil {
+			return "", err
+		}
+		return c.getDigest(ctx, tag)
+	}
+	return digest, err
+}
+
 func (c *OciAPIClient) getBearerToken(ctx context.Context, secret OciPullSecret) error {
 	realmURL, err := c.getRealmURLFromImageRegistry(ctx)
 	if err != nil {
@@ -242,6 +273,41 @@ func (c *OciAPIClient) getTags(ctx context.Context) ([]string, error) {
 	return tags.Tags, nil
 }
 
+func (c *OciAPIClient) getDigest(ctx context.Context, tag string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.generateGetManifestURL(tag), nil)
+	if err != nil {
+		return "", fmt.Errorf("registries/api %w: %s", UnknownAPIResponseError, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.bearerToken)
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("registries/api %w: %s", UnknownAPIResponseError, err)
+	}
+
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}()
+
+	if err := handleResponseCodeOfResponse(resp); err != nil {
+		c.bearerToken = ""
+		return "", err
+	}
+
+	digest := resp.Header.Get(contentDigestHeader)
+	if digest == "" {
+		return "", fmt.Errorf("registries/api %w: header \"%s\" is empty for tag %s of image %s", UnknownAPIResponseError, contentDigestHeader, tag, c.Image.GetNameWithoutRegistry())
+	}
+	return digest, nil
+}
+
+func (c *OciAPIClient) generateGetManifestURL(tag string) string {
+	return fmt.Sprintf("https://%s/%s/%s/manifests/%s", c.Image.GetRegistryURL(), dockerRegistryVersion, c.Image.GetNameWithoutRegistry(), tag)
+}
+
 func (c *OciAPIClient) generateGetTagsURL() string {
 	return fmt.Sprintf("https://%s/%s/%s/tags/list", c.Image.GetRegistryURL(), dockerRegistryVersion, c.Image.GetNameWithoutRegistry())
 }
@@ -693,3 +693,72 @@ func TestOciAPIClient_GetTagsForImage(t *testing.T) {
 		})
 	}
 }
+
+func TestOciAPIClient_GetDigestForTag(t *testing.T) {
+	img := image{
+		withoutRegistry: "differ",
+		registryURL:     "docker.com",
+	}
+	manifestRequest := func(digest string) func(request *http.Request) (*http.Response, error) {
+		return func(request *http.Request) (*http.Response, error) {
+			if request.Method != http.MethodHead {
+				return nil, fmt.Errorf("manifest request has to use the HEAD method")
+			}
+			if request.Header.Get("Authorization") != fmt.Sprintf("Bearer "+testBearerToken) {
+				return nil, fmt.Errorf("authorization header is not valid")
+			}
+			header := http.Header{}
+			if digest != "" {
+				header.Set(contentDigestHeader, digest)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     header,
+				Body:       ioutil.NopCloser(&bytes.Buffer{}),
+				Request:    request,
+			}, nil
+		}
+	}
+
+	tests := []struct {
+		name    string
+		request func(request *http.Request) (*http.Response, error)
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "Digest",
+			request: manifestRequest("sha256:4f1b3a"),
+			want:    "sha256:4f1b3a",
+		},
+		{
+			name:    "MissingDigestHeader",
+			request: manifestRequest(""),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &OciAPIClient{
+				Image: img,
+				Client: http.Client{
+					Transport: roundTripper{
+						map[string]func(request *http.Request) (*http.Response, error){
+							fmt.Sprintf("%s/v2/", img.registryURL): validRealmRequest,
+							fmt.Sprintf("%s?service=%s&scope=repository:%s:pull", testRealm, testRealmService, img.withoutRegistry): validTokenRequest,
+							fmt.Sprintf("%s/%s/%s/manifests/%s", img.registryURL, "v2", img.withoutRegistry, "latest"):              tt.request,
+						},
+					},
+				},
+			}
+
+			got, err := c.GetDigestForTag(context.TODO(), nil, "latest")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetDigestForTag() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GetDigestForTag() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package scanning
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	appsV1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"github.com/fwiedmann/differ/pkg/observing"
+)
+
+const (
+	stdinSource       = "-"
+	documentSeparator = "---"
+)
+
+var manifestFileExtensions = map[string]bool{
+	".yaml": true,
+	".yml":  true,
+	".json": true,
+}
+
+// serializers maps the supported kubernetes objects to the serializers of the observing package, which only accept the
+// apps/v1 types
+var serializers = map[schema.GroupVersionKind]func(obj interface{}) (observing.KubernetesObjectSerializer, error){
+	appsV1.SchemeGroupVersion.WithKind("Deployment"):  observing.NewKubernetesAPPV1DeploymentSerializer,
+	appsV1.SchemeGroupVersion.WithKind("DaemonSet"):   observing.NewKubernetesAPPV1DaemonSetSerializer,
+	appsV1.SchemeGroupVersion.WithKind("StatefulSet"): observing.NewKubernetesAPPV1StatefulSetSerializer,
+}
+
+// isSupportedKind reports if any version of the kind is supported
+func isSupportedKind(kind string) bool {
+	for gvk := range serializers {
+		if gvk.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Manifest is a single kubernetes object which was read from a manifest source
+type Manifest struct {
+	Source     string
+	Line       int
+	Raw        []byte
+	Serializer observing.KubernetesObjectSerializer
+}
+
+// document is a single YAML document of a multi document stream
+type document struct {
+	line    int
+	content []byte
+}
+
+// ReadManifests reads all supported kubernetes objects from the given sources. A source can be a file, a directory
+// which will be walked recursively or "-" for the given stdin reader.
+func ReadManifests(sources []string, stdin io.Reader) ([]Manifest, error) {
+	var manifests []Manifest
+	for _, source := range sources {
+		if source == stdinSource {
+			m, err := readManifestsFromReader("stdin", stdin)
+			if err != nil {
+				return nil, err
+			}
+			manifests = append(manifests, m...)
+			continue
+		}
+
+		files, err := collectManifestFiles(source)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			m, err := readManifestsFromFile(file)
+			if err != nil {
+				return nil, err
+			}
+			manifests = append(manifests, m...)
+		}
+	}
+	return manifests, nil
+}
+
+func collectManifestFiles(source string) ([]string, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, fmt.Errorf("scanning/reader error: %w", err)
+	}
+
+	if !info.IsDir() {
+		return []string{source}, nil
+	}
+
+	var files []string
+	err = filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && manifestFileExtensions[strings.ToLower(filepath.Ext(path))] {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning/reader error: %w", err)
+	}
+	return files, nil
+}
+
+func readManifestsFromFile(file string) ([]Manifest, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("scanning/reader error: %w", err)
+	}
+	defer f.Close()
+	return readManifestsFromReader(file, f)
+}
+
+func readManifestsFromReader(source string, r io.Reader) ([]Manifest, error) {
+	documents, err := splitDocuments(r)
+	if err != nil {
+		return nil, fmt.Errorf("scanning/reader error: could not read %s: %w", source, err)
+	}
+
+	var manifests []Manifest
+	for _, doc := range documents {
+		obj, err := decodeDocument(doc.content)
+		if err != nil {
+			return nil, fmt.Errorf("scanning/reader error: could not decode document in %s at line %d: %w", source, doc.line, err)
+		}
+
+		if obj == nil {
+			continue
+		}
+
+		gvk := obj.GetObjectKind().GroupVersionKind()
+		newSerializer, ok := serializers[gvk]
+		if !ok {
+			// deprecated versions like apps/v1beta2 or extensions/v1beta1 are still found in old manifests
+			if isSupportedKind(gvk.Kind) {
+				log.Warnf("scanning/reader: skipping %s %s in %s at line %d, only apps/v1 is supported", gvk.GroupVersion(), gvk.Kind, source, doc.line)
+			}
+			continue
+		}
+
+		serializer, err := newSerializer(obj)
+		if err != nil {
+			return nil, fmt.Errorf("scanning/reader error: %s at line %d: %w", source, doc.line, err)
+		}
+
+		manifests = append(manifests, Manifest{
+			Source:     source,
+			Line:       doc.line,
+			Raw:        doc.content,
+			Serializer: serializer,
+		})
+	}
+	return manifests, nil
+}
+
+// decodeDocument returns nil without an error for empty documents and kinds which are unknown to the client-go scheme, e.g. custom resources
+func decodeDocument(content []byte) (runtime.Object, error) {
+	if len(bytes.TrimSpace(content)) == 0 {
+		return nil, nil
+	}
+
+	obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(content, nil, nil)
+	if runtime.IsNotRegisteredError(err) || runtime.IsMissingKind(err) {
+		return nil, nil
+	}
+	return obj, err
+}
+
+// splitDocuments splits a multi document YAML stream on the "---" separator and stores the line number of each document start
+func splitDocuments(r io.Reader) ([]document, error) {
+	var documents []document
+	current := document{line: 1}
+	var lineNumber int
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if strings.HasPrefix(line, documentSeparator) && strings.TrimSpace(strings.TrimPrefix(line, documentSeparator)) == "" {
+			documents = appendDocument(documents, current)
+			current = document{line: lineNumber + 1}
+			continue
+		}
+		current.content = append(current.content, line...)
+		current.content = append(current.content, '\n')
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return appendDocument(documents, current), nil
+}
+
+func appendDocument(documents []document, doc document) []document {
+	if len(bytes.TrimSpace(doc.content)) == 0 {
+		return documents
+	}
+	return append(documents, doc)
+}
+
+// lineOfImage returns the absolute line of the first occurrence of the raw image in the manifest, or the manifest start line if it could not be found
+func (m Manifest) lineOfImage(rawImage string) int {
+	for i, line := range strings.Split(string(m.Raw), "\n") {
+		if strings.Contains(line, rawImage) {
+			return m.Line + i
+		}
+	}
+	return m.Line
+}
@@ -0,0 +1,187 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package scanning
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const multiDocumentManifest = `# rendered by helm template
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: differ
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: differ
+  namespace: default
+spec:
+  template:
+    spec:
+      containers:
+        - name: differ
+          image: wiedmannfelix/differ:1.0.0
+---
+apiVersion: differ.io/v1
+kind: Unknown
+metadata:
+  name: custom
+---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: db
+spec:
+  template:
+    spec:
+      containers:
+        - name: postgres
+          image: postgres:12.1
+`
+
+const deprecatedVersionsManifest = `apiVersion: apps/v1beta2
+kind: DaemonSet
+metadata:
+  name: agent
+spec:
+  template:
+    spec:
+      containers:
+        - name: agent
+          image: agent:1.0.0
+---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: legacy
+spec:
+  template:
+    spec:
+      containers:
+        - name: legacy
+          image: legacy:1.0.0
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: agent
+spec:
+  template:
+    spec:
+      containers:
+        - name: agent
+          image: agent:1.0.0
+`
+
+func TestReadManifests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "differ-scan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "nested"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "nested", "app.yaml"), []byte(multiDocumentManifest), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("# not a manifest"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	type want struct {
+		kinds []string
+		lines []int
+	}
+	tests := []struct {
+		name    string
+		sources []string
+		stdin   string
+		want    want
+		wantErr bool
+	}{
+		{
+			name:    "Stdin",
+			sources: []string{"-"},
+			stdin:   multiDocumentManifest,
+			want:    want{kinds: []string{"Deployment", "StatefulSet"}, lines: []int{8, 25}},
+		},
+		{
+			name:    "Directory",
+			sources: []string{dir},
+			want:    want{kinds: []string{"Deployment", "StatefulSet"}, lines: []int{8, 25}},
+		},
+		{
+			name:    "SkipDeprecatedVersions",
+			sources: []string{"-"},
+			stdin:   deprecatedVersionsManifest,
+			want:    want{kinds: []string{"DaemonSet"}, lines: []int{23}},
+		},
+		{
+			name:    "EmptyStdin",
+			sources: []string{"-"},
+			stdin:   "",
+			want:    want{},
+		},
+		{
+			name:    "InvalidDocument",
+			sources: []string{"-"},
+			stdin:   "apiVersion: apps/v1\nkind: Deployment\nspec: [",
+			wantErr: true,
+		},
+		{
+			name:    "MissingFile",
+			sources: []string{filepath.Join(dir, "missing.yaml")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadManifests(tt.sources, strings.NewReader(tt.stdin))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadManifests() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want.kinds) {
+				t.Fatalf("ReadManifests() got %d manifests, want %d", len(got), len(tt.want.kinds))
+			}
+			for i, m := range got {
+				if m.Serializer.GetObjectKind() != tt.want.kinds[i] {
+					t.Errorf("ReadManifests() kind = %s, want %s", m.Serializer.GetObjectKind(), tt.want.kinds[i])
+				}
+				if m.Line != tt.want.lines[i] {
+					t.Errorf("ReadManifests() line = %d, want %d", m.Line, tt.want.lines[i])
+				}
+			}
+		})
+	}
+}
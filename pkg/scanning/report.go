@@ -0,0 +1,228 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package scanning
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// Supported report formats
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatSARIF = "sarif"
+)
+
+const (
+	sarifSchema            = "https://raw.githubusercontent.com/oasis-tcs/sarif-spec/master/Schemata/sarif-schema-2.1.0.json"
+	sarifVersion           = "2.1.0"
+	sarifRuleOutdatedImage = "outdated-image"
+	sarifRuleCheckFailed   = "image-check-failed"
+	differInformationURI   = "https://github.com/fwiedmann/differ"
+)
+
+// WriteReport writes the report in the given format to w
+func WriteReport(w io.Writer, r Report, format, differVersion string) error {
+	switch format {
+	case FormatTable:
+		return writeTable(w, r)
+	case FormatJSON:
+		return writeJSON(w, r)
+	case FormatSARIF:
+		return writeSARIF(w, r, differVersion)
+	default:
+		return fmt.Errorf("scanning/report error: unknown report format \"%s\", valid formats are %s, %s and %s", format, FormatTable, FormatJSON, FormatSARIF)
+	}
+}
+
+func writeTable(w io.Writer, r Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "SOURCE\tNAMESPACE\tKIND\tWORKLOAD\tCONTAINER\tIMAGE\tTAG\tLATEST\tSEVERITY\tERROR"); err != nil {
+		return err
+	}
+	for _, f := range r.Findings {
+		if _, err := fmt.Fprintf(tw, "%s:%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", f.Source, f.Line, f.Namespace, f.Kind, f.Workload, f.Container, f.Image, f.Tag, f.LatestTag, f.Severity, f.Error); err != nil {
+			return err
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if err := writeVersionSkewTable(w, r); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\nscanned %d containers, %d findings, %d images with version skew\n", r.ScannedContainers, len(r.Findings), len(r.VersionSkew))
+	return err
+}
+
+func writeVersionSkewTable(w io.Writer, r Report) error {
+	if len(r.VersionSkew) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintln(w); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "IMAGE\tTAG\tSPREAD\tWORKLOADS"); err != nil {
+		return err
+	}
+	for _, skew := range r.VersionSkew {
+		for _, usage := range skew.Tags {
+			workloads := make([]string, 0, len(usage.Workloads))
+			for _, workload := range usage.Workloads {
+				workloads = append(workloads, fmt.Sprintf("%s/%s/%s", workload.Namespace, workload.Kind, workload.Name))
+			}
+			if _, err := fmt.Fprintf(tw, "%s/%s\t%s\t%s\t%s\n", skew.Registry, skew.Name, usage.Tag, skew.Spread, strings.Join(workloads, ",")); err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+func writeJSON(w io.Writer, r Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+func writeSARIF(w io.Writer, r Report, differVersion string) error {
+	results := make([]sarifResult, 0)
+	for _, f := range r.Findings {
+		result := sarifResult{
+			RuleID: sarifRuleOutdatedImage,
+			Level:  sarifLevel(f.Severity),
+			Message: sarifMessage{
+				Text: fmt.Sprintf("Container %s of %s %s uses image %s:%s, newer tag %s is available", f.Container, f.Kind, f.Workload, f.Image, f.Tag, f.LatestTag),
+			},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(f.Source)},
+					Region:           sarifRegion{StartLine: f.Line},
+				},
+			}},
+		}
+
+		if f.Error != "" {
+			result.RuleID = sarifRuleCheckFailed
+			result.Level = "warning"
+			result.Message.Text = fmt.Sprintf("Container %s of %s %s: could not check image %s: %s", f.Container, f.Kind, f.Workload, f.Image, strings.TrimSpace(f.Error))
+		}
+		results = append(results, result)
+	}
+
+	log := sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "differ",
+				Version:        differVersion,
+				InformationURI: differInformationURI,
+				Rules: []sarifRule{
+					{ID: sarifRuleOutdatedImage, ShortDescription: sarifMessage{Text: "A newer tag of the container image is available"}},
+					{ID: sarifRuleCheckFailed, ShortDescription: sarifMessage{Text: "The container image could not be checked against its registry"}},
+				},
+			}},
+			Results: results,
+		}},
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
+
+func sarifLevel(s Severity) string {
+	switch s {
+	case SeverityHigh:
+		return "error"
+	case SeverityMedium:
+		return "warning"
+	default:
+		return "note"
+	}
+}
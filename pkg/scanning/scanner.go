@@ -0,0 +1,210 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package scanning
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/fwiedmann/differ/pkg/analyzing"
+	"github.com/fwiedmann/differ/pkg/differentiating"
+	"github.com/fwiedmann/differ/pkg/observing"
+	"github.com/fwiedmann/differ/pkg/registry"
+)
+
+// TagLister lists all available tags of an image. It is implemented by the registry.OciAPIClient
+type TagLister interface {
+	GetTagsForImage(ctx context.Context, secret registry.OciPullSecret) ([]string, error)
+}
+
+// NewRegistryTagLister creates a registry.OciAPIClient for the given image
+func NewRegistryTagLister(timeout time.Duration) func(img registry.OciImage) TagLister {
+	return func(img registry.OciImage) TagLister {
+		return &registry.OciAPIClient{
+			Image: img,
+			Client: http.Client{
+				Timeout: timeout,
+			},
+		}
+	}
+}
+
+// Finding describes a container image of a scanned manifest which is outdated or could not be checked
+type Finding struct {
+	Source    string   `json:"source"`
+	Line      int      `json:"line"`
+	Namespace string   `json:"namespace,omitempty"`
+	Kind      string   `json:"kind"`
+	Workload  string   `json:"workload"`
+	Container string   `json:"container"`
+	Image     string   `json:"image"`
+	Tag       string   `json:"tag"`
+	LatestTag string   `json:"latestTag,omitempty"`
+	Severity  Severity `json:"severity"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// Report is the result of a scan
+type Report struct {
+	ScannedContainers int       `json:"scannedContainers"`
+	Findings          []Finding `json:"findings"`
+	// VersionSkew lists the images which run with more than one tag across the scanned manifests
+	VersionSkew []differentiating.VersionSkew `json:"versionSkew,omitempty"`
+}
+
+type tagsResult struct {
+	tags []string
+	err  error
+}
+
+// Scanner checks the images of manifests against their source registries
+type Scanner struct {
+	newTagLister func(img registry.OciImage) TagLister
+	tagPolicy    analyzing.Policy
+	tags         map[string]tagsResult
+}
+
+// NewScanner creates a Scanner which uses the given function to create a TagLister per image
+func NewScanner(newTagLister func(img registry.OciImage) TagLister, tagPolicy analyzing.Policy) *Scanner {
+	return &Scanner{
+		newTagLister: newTagLister,
+		tagPolicy:    tagPolicy,
+		tags:         make(map[string]tagsResult),
+	}
+}
+
+// Scan checks each container image of the given manifests. The registry tags for an image are only requested once per scanner.
+func (s *Scanner) Scan(ctx context.Context, manifests []Manifest) (Report, error) {
+	report := Report{Findings: make([]Finding, 0)}
+	var images []differentiating.Image
+
+	for _, manifest := range manifests {
+		for _, container := range manifest.Serializer.GetPodSpec().Containers {
+			if err := ctx.Err(); err != nil {
+				return report, err
+			}
+			report.ScannedContainers++
+
+			finding := Finding{
+				Source:    manifest.Source,
+				Line:      manifest.lineOfImage(container.Image),
+				Namespace: manifest.Serializer.GetNamespace(),
+				Kind:      manifest.Serializer.GetObjectKind(),
+				Workload:  manifest.Serializer.GetName(),
+				Container: container.Name,
+				Image:     container.Image,
+			}
+
+			img, err := observing.NewImage(container.Image, container.Name)
+			if err != nil {
+				finding.Error = err.Error()
+				report.Findings = append(report.Findings, finding)
+				continue
+			}
+			finding.Image = img.GetNameWithRegistry()
+			finding.Tag = img.GetTag()
+			images = append(images, differentiating.Image{
+				Registry: img.GetRegistryURL(),
+				Name:     img.GetNameWithoutRegistry(),
+				Tag:      img.GetTag(),
+				Workload: differentiating.Workload{Namespace: finding.Namespace, Kind: finding.Kind, Name: finding.Workload, Container: finding.Container},
+			})
+
+			policy, err := s.policyForContainer(manifest.Serializer.GetAnnotations(), container.Name)
+			if err != nil {
+				finding.Error = err.Error()
+				report.Findings = append(report.Findings, finding)
+				continue
+			}
+
+			result, err := s.analyze(ctx, &img, img.GetTag(), policy)
+			if err != nil {
+				finding.Error = err.Error()
+				report.Findings = append(report.Findings, finding)
+				continue
+			}
+
+			if !result.IsOutdated() {
+				continue
+			}
+			finding.LatestTag = result.Latest
+			finding.Severity = severityForUpdate(result.Bump)
+			report.Findings = append(report.Findings, finding)
+		}
+	}
+	report.VersionSkew = skewedImages(images)
+	return report, nil
+}
+
+func skewedImages(images []differentiating.Image) []differentiating.VersionSkew {
+	var skewed []differentiating.VersionSkew
+	for _, skew := range differentiating.AnalyzeVersionSkew(images) {
+		if skew.IsSkewed() {
+			skewed = append(skewed, skew)
+		}
+	}
+	return skewed
+}
+
+// policyForContainer overrides the constraint of the scanner policy with the constraint annotation of the workload
+func (s *Scanner) policyForContainer(annotations map[string]string, container string) (analyzing.Policy, error) {
+	policy := s.tagPolicy
+	expression := observing.ConstraintForContainer(annotations, container)
+	if expression == "" {
+		return policy, nil
+	}
+
+	constraint, err := analyzing.ParseConstraint(expression)
+	if err != nil {
+		return analyzing.Policy{}, err
+	}
+	policy.Constraint = constraint
+	return policy, nil
+}
+
+// analyze returns the analysis of the current tag, which classifies the bump like the controller does
+func (s *Scanner) analyze(ctx context.Context, img registry.OciImage, currentTag string, policy analyzing.Policy) (analyzing.Result, error) {
+	tags, err := s.getTags(ctx, img)
+	if err != nil {
+		return analyzing.Result{}, err
+	}
+	return analyzing.Analyze(currentTag, tags, policy)
+}
+
+func (s *Scanner) getTags(ctx context.Context, img registry.OciImage) ([]string, error) {
+	key := fmt.Sprintf("%s/%s", img.GetRegistryURL(), img.GetNameWithoutRegistry())
+	if result, ok := s.tags[key]; ok {
+		return result.tags, result.err
+	}
+
+	log.Debugf("scanning/scanner: requesting tags for image %s", key)
+	tags, err := s.newTagLister(img).GetTagsForImage(ctx, nil)
+	s.tags[key] = tagsResult{tags: tags, err: err}
+	return tags, err
+}
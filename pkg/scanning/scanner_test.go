@@ -0,0 +1,327 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package scanning
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fwiedmann/differ/pkg/analyzing"
+	"github.com/fwiedmann/differ/pkg/registry"
+)
+
+type tagListerMock struct {
+	tags  map[string][]string
+	calls map[string]int
+}
+
+func (m *tagListerMock) newTagLister(img registry.OciImage) TagLister {
+	return tagListerFunc(func() ([]string, error) {
+		name := img.GetNameWithoutRegistry()
+		m.calls[name]++
+		tags, ok := m.tags[name]
+		if !ok {
+			return nil, fmt.Errorf("registries/api error: 404")
+		}
+		return tags, nil
+	})
+}
+
+type tagListerFunc func() ([]string, error)
+
+func (f tagListerFunc) GetTagsForImage(_ context.Context, _ registry.OciPullSecret) ([]string, error) {
+	return f()
+}
+
+func TestScanner_Scan(t *testing.T) {
+	manifests, err := ReadManifests([]string{"-"}, strings.NewReader(multiDocumentManifest+`---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: agent
+  annotations:
+    differ/constraint.sidecar: "^1"
+spec:
+  template:
+    spec:
+      containers:
+        - name: agent
+          image: wiedmannfelix/agent:1.0.0
+        - name: sidecar
+          image: wiedmannfelix/differ:1.0.0
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock := &tagListerMock{
+		tags: map[string][]string{
+			"wiedmannfelix/differ": {"1.0.0", "1.0.1", "2.0.0", "latest"},
+			"library/postgres":     {"12.1", "12.4", "13.0"},
+		},
+		calls: make(map[string]int),
+	}
+
+	report, err := NewScanner(mock.newTagLister, analyzing.Policy{}).Scan(context.Background(), manifests)
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	if report.ScannedContainers != 4 {
+		t.Errorf("Scan() scanned containers = %d, want 4", report.ScannedContainers)
+	}
+
+	if mock.calls["wiedmannfelix/differ"] != 1 {
+		t.Errorf("Scan() requested tags of wiedmannfelix/differ %d times, want 1", mock.calls["wiedmannfelix/differ"])
+	}
+
+	want := []Finding{
+		{Container: "differ", Tag: "1.0.0", LatestTag: "2.0.0", Severity: SeverityHigh, Line: 18},
+		{Container: "postgres", Tag: "12.1", LatestTag: "13.0", Severity: SeverityHigh, Line: 34},
+		{Container: "agent", Tag: "1.0.0", Severity: SeverityNone, Line: 47},
+		{Container: "sidecar", Tag: "1.0.0", LatestTag: "1.0.1", Severity: SeverityLow, Line: 49},
+	}
+	if len(report.Findings) != len(want) {
+		t.Fatalf("Scan() got %d findings, want %d: %+v", len(report.Findings), len(want), report.Findings)
+	}
+	for i, f := range report.Findings {
+		if f.Container != want[i].Container || f.Tag != want[i].Tag || f.LatestTag != want[i].LatestTag || f.Severity != want[i].Severity || f.Line != want[i].Line {
+			t.Errorf("Scan() finding = %+v, want %+v", f, want[i])
+		}
+	}
+
+	if report.Findings[2].Error == "" {
+		t.Errorf("Scan() expected an error for the agent container")
+	}
+}
+
+func TestScanner_Scan_VersionSkew(t *testing.T) {
+	manifests, err := ReadManifests([]string{"-"}, strings.NewReader(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+  namespace: a
+spec:
+  template:
+    spec:
+      containers:
+        - name: proxy
+          image: istio/proxyv2:1.8.1
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: b
+spec:
+  template:
+    spec:
+      containers:
+        - name: proxy
+          image: istio/proxyv2:1.7.4
+        - name: web
+          image: nginx:1.19.6
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock := &tagListerMock{tags: map[string][]string{}, calls: make(map[string]int)}
+	report, err := NewScanner(mock.newTagLister, analyzing.Policy{}).Scan(context.Background(), manifests)
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	if len(report.VersionSkew) != 1 {
+		t.Fatalf("Scan() version skew = %+v, want only istio/proxyv2", report.VersionSkew)
+	}
+	skew := report.VersionSkew[0]
+	if skew.Name != "istio/proxyv2" || skew.Oldest() != "1.7.4" || skew.Newest() != "1.8.1" {
+		t.Errorf("Scan() version skew = %+v", skew)
+	}
+	if workload := skew.Tags[0].Workloads[0]; workload.Namespace != "b" || workload.Name != "web" || workload.Container != "proxy" {
+		t.Errorf("Scan() workload of tag 1.7.4 = %+v", workload)
+	}
+}
+
+func TestSeverityForUpdate(t *testing.T) {
+	tests := []struct {
+		name      string
+		bump      analyzing.BumpType
+		want      Severity
+		threshold Severity
+		exceeds   bool
+	}{
+		{name: "Major", bump: analyzing.BumpMajor, want: SeverityHigh, threshold: SeverityHigh, exceeds: true},
+		{name: "Minor", bump: analyzing.BumpMinor, want: SeverityMedium, threshold: SeverityHigh, exceeds: false},
+		{name: "Patch", bump: analyzing.BumpPatch, want: SeverityLow, threshold: SeverityLow, exceeds: true},
+		{name: "ReleaseCandidate", bump: analyzing.BumpPreRelease, want: SeverityLow, threshold: SeverityMedium, exceeds: false},
+		{name: "UpToDate", bump: analyzing.BumpNone, want: SeverityNone, threshold: SeverityLow, exceeds: false},
+		{name: "VariantOnly", bump: analyzing.BumpVariant, want: SeverityLow, threshold: SeverityLow, exceeds: true},
+		{name: "Date", bump: analyzing.BumpDate, want: SeverityLow, threshold: SeverityMedium, exceeds: false},
+		{name: "Unknown", bump: analyzing.BumpUnknown, want: SeverityLow, threshold: SeverityLow, exceeds: true},
+		{name: "ThresholdNone", bump: analyzing.BumpMajor, want: SeverityHigh, threshold: SeverityNone, exceeds: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := severityForUpdate(tt.bump)
+			if got != tt.want {
+				t.Errorf("severityForUpdate() = %s, want %s", got, tt.want)
+			}
+			r := Report{Findings: []Finding{{Severity: got}}}
+			if r.ExceedsThreshold(tt.threshold) != tt.exceeds {
+				t.Errorf("ExceedsThreshold() = %v, want %v", !tt.exceeds, tt.exceeds)
+			}
+		})
+	}
+}
+
+func TestScanner_Scan_Severity(t *testing.T) {
+	manifests, err := ReadManifests([]string{"-"}, strings.NewReader(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+spec:
+  template:
+    spec:
+      containers:
+        - name: ubuntu
+          image: ubuntu:focal-20201008
+        - name: nginx
+          image: nginx:1.19.3-alpine3.12
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock := &tagListerMock{
+		tags: map[string][]string{
+			"library/ubuntu": {"focal-20201008", "focal-20210115"},
+			"library/nginx":  {"1.19.3-alpine3.12", "1.20.0-alpine3.12"},
+		},
+		calls: make(map[string]int),
+	}
+	report, err := NewScanner(mock.newTagLister, analyzing.Policy{}).Scan(context.Background(), manifests)
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	// the severity follows the bump of the analysis, so a new date-stamped tag is not rated as a major bump
+	want := map[string]Severity{"ubuntu": SeverityLow, "nginx": SeverityMedium}
+	if len(report.Findings) != len(want) {
+		t.Fatalf("Scan() got %d findings, want %d: %+v", len(report.Findings), len(want), report.Findings)
+	}
+	for _, f := range report.Findings {
+		if f.Severity != want[f.Container] {
+			t.Errorf("Scan() severity of %s = %s, want %s", f.Container, f.Severity, want[f.Container])
+		}
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	report := Report{
+		ScannedContainers: 1,
+		Findings: []Finding{{
+			Source:    "k8s/app.yaml",
+			Line:      18,
+			Kind:      "Deployment",
+			Workload:  "differ",
+			Container: "differ",
+			Image:     "registry-1.docker.io/wiedmannfelix/differ",
+			Tag:       "1.0.0",
+			LatestTag: "2.0.0",
+			Severity:  SeverityHigh,
+		}},
+	}
+
+	tests := []struct {
+		name    string
+		format  string
+		check   func(t *testing.T, out []byte)
+		wantErr bool
+	}{
+		{
+			name:   "Table",
+			format: FormatTable,
+			check: func(t *testing.T, out []byte) {
+				if !strings.Contains(string(out), "k8s/app.yaml:18") || !strings.Contains(string(out), "high") {
+					t.Errorf("WriteReport() table output is missing the finding: %s", out)
+				}
+			},
+		},
+		{
+			name:   "JSON",
+			format: FormatJSON,
+			check: func(t *testing.T, out []byte) {
+				var got Report
+				if err := json.Unmarshal(out, &got); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, report) {
+					t.Errorf("WriteReport() invalid json output: %s", out)
+				}
+			},
+		},
+		{
+			name:   "SARIF",
+			format: FormatSARIF,
+			check: func(t *testing.T, out []byte) {
+				var got sarifLog
+				if err := json.Unmarshal(out, &got); err != nil {
+					t.Fatal(err)
+				}
+				if got.Version != sarifVersion || len(got.Runs) != 1 || len(got.Runs[0].Results) != 1 {
+					t.Fatalf("WriteReport() invalid sarif output: %s", out)
+				}
+				result := got.Runs[0].Results[0]
+				if result.Level != "error" || result.Locations[0].PhysicalLocation.Region.StartLine != 18 {
+					t.Errorf("WriteReport() invalid sarif result: %+v", result)
+				}
+			},
+		},
+		{
+			name:    "UnknownFormat",
+			format:  "xml",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := WriteReport(&out, report, tt.format, "1.0.0")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WriteReport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, out.Bytes())
+			}
+		})
+	}
+}
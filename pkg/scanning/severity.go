@@ -0,0 +1,110 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package scanning
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fwiedmann/differ/pkg/analyzing"
+)
+
+// Severity of an outdated image, derived from the bump between the running and the latest tag
+type Severity int
+
+const (
+	SeverityNone Severity = iota
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+)
+
+var severityNames = map[Severity]string{
+	SeverityNone:   "none",
+	SeverityLow:    "low",
+	SeverityMedium: "medium",
+	SeverityHigh:   "high",
+}
+
+// ParseSeverity parses the given severity name case insensitive
+func ParseSeverity(name string) (Severity, error) {
+	for severity, severityName := range severityNames {
+		if strings.EqualFold(name, severityName) {
+			return severity, nil
+		}
+	}
+	return SeverityNone, fmt.Errorf("scanning/severity error: unknown severity \"%s\", valid values are none, low, medium and high", name)
+}
+
+// String implements the stringer interface
+func (s Severity) String() string {
+	return severityNames[s]
+}
+
+// MarshalText implements the encoding.TextMarshaler interface
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface
+func (s *Severity) UnmarshalText(text []byte) error {
+	parsed, err := ParseSeverity(string(text))
+	if err != nil {
+		return err
+	}
+	*s = parsed
+	return nil
+}
+
+// severityForUpdate rates an update by the analyzing.BumpType of the analysis: a major bump is high, a minor bump medium
+// and every other change, e.g. a patch, pre-release or variant bump, low
+func severityForUpdate(bump analyzing.BumpType) Severity {
+	switch bump {
+	case analyzing.BumpNone:
+		return SeverityNone
+	case analyzing.BumpMajor:
+		return SeverityHigh
+	case analyzing.BumpMinor:
+		return SeverityMedium
+	case analyzing.BumpDate:
+		// date-stamped and CalVer tags have no major releases, their bumps are routine
+		return SeverityLow
+	default:
+		return SeverityLow
+	}
+}
+
+// ExceedsThreshold reports if any finding has a severity greater or equal to the threshold. SeverityNone as threshold never exceeds.
+func (r Report) ExceedsThreshold(threshold Severity) bool {
+	if threshold == SeverityNone {
+		return false
+	}
+	for _, f := range r.Findings {
+		if f.Severity >= threshold {
+			return true
+		}
+	}
+	return false
+}
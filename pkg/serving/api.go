@@ -0,0 +1,408 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package serving
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/differentiating"
+	log "github.com/sirupsen/logrus"
+)
+
+// APIPathPrefix is the path of all API endpoints
+const APIPathPrefix = "/api/"
+
+// maxBodySize limits the request body of the API
+const maxBodySize = 1 << 20
+
+// checkSuffix of a worker path runs its check immediately
+const checkSuffix = "/check"
+
+// API serves the state of the differentiating.Service as JSON
+type API struct {
+	service differentiating.Service
+	token   string
+	mux     *http.ServeMux
+}
+
+// NewAPI creates the API and registers all endpoints. Requests which change the state, e.g. snoozes and on-demand
+// checks, require the token as bearer token and are forbidden without token.
+func NewAPI(service differentiating.Service, token string) *API {
+	a := &API{
+		service: service,
+		token:   token,
+		mux:     http.NewServeMux(),
+	}
+	a.mux.HandleFunc(APIPathPrefix+"v1/images", a.images)
+	a.mux.HandleFunc(APIPathPrefix+"v1/version-skew", a.versionSkew)
+	a.mux.HandleFunc(APIPathPrefix+"v1/snoozes", a.snoozes)
+	a.mux.HandleFunc(APIPathPrefix+"v1/snoozes/", a.snooze)
+	a.mux.HandleFunc(APIPathPrefix+"v1/workers", a.workers)
+	a.mux.HandleFunc(APIPathPrefix+"v1/workers/", a.worker)
+	a.mux.HandleFunc(APIPathPrefix+"v1/history", a.history)
+	a.mux.HandleFunc(APIPathPrefix+"v1/history/time-to-update", a.timeToUpdate)
+	return a
+}
+
+// ServeHTTP implements the http.Handler interface
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mux.ServeHTTP(w, r)
+}
+
+// images lists the images filtered, sorted and paginated by the query parameters, see listOptions
+func (a *API) images(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	opts, err := listOptions(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	images, err := a.service.ListImages(r.Context(), opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if images == nil {
+		images = []differentiating.Image{}
+	}
+	writeJSON(w, http.StatusOK, images)
+}
+
+// listOptions parses the query parameters image, registry, namespace, kind, workload, container, tag, hasNewerTag,
+// selector, sort, order (asc or desc), offset and limit
+func listOptions(query url.Values) (differentiating.ListOptions, error) {
+	opts := differentiating.ListOptions{
+		ImageName:     query.Get("image"),
+		Registry:      query.Get("registry"),
+		Namespace:     query.Get("namespace"),
+		WorkloadKind:  query.Get("kind"),
+		WorkloadName:  query.Get("workload"),
+		Container:     query.Get("container"),
+		Tag:           query.Get("tag"),
+		LabelSelector: query.Get("selector"),
+		SortBy:        differentiating.SortField(query.Get("sort")),
+	}
+
+	switch order := query.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		opts.Descending = true
+	default:
+		return differentiating.ListOptions{}, fmt.Errorf("serving/api error: invalid order %q, expected asc or desc", order)
+	}
+
+	if value := query.Get("hasNewerTag"); value != "" {
+		hasNewerTag, err := strconv.ParseBool(value)
+		if err != nil {
+			return differentiating.ListOptions{}, fmt.Errorf("serving/api error: invalid hasNewerTag: %w", err)
+		}
+		opts.HasNewerTag = &hasNewerTag
+	}
+
+	for _, param := range []struct {
+		name  string
+		value *int
+	}{{name: "offset", value: &opts.Offset}, {name: "limit", value: &opts.Limit}} {
+		if value := query.Get(param.name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return differentiating.ListOptions{}, fmt.Errorf("serving/api error: invalid %s: %w", param.name, err)
+			}
+			*param.value = parsed
+		}
+	}
+	return opts, opts.Validate()
+}
+
+// history lists the recorded tag changes and notifications filtered by the query parameters, see historyQuery
+func (a *API) history(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	query, err := historyQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	entries, err := a.service.History(r.Context(), query)
+	if err != nil {
+		writeHistoryError(w, err)
+		return
+	}
+	if entries == nil {
+		entries = []differentiating.HistoryEntry{}
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// timeToUpdate returns the mean time to update by namespace of the tag changes matching the query parameters
+func (a *API) timeToUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	query, err := historyQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	timeToUpdate, err := a.service.TimeToUpdate(r.Context(), query)
+	if err != nil {
+		writeHistoryError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, timeToUpdate)
+}
+
+// historyQuery parses the query parameters type, image, imageID, cluster, namespace, kind, workload, container, since
+// and until as RFC 3339 timestamps and limit
+func historyQuery(values url.Values) (differentiating.HistoryQuery, error) {
+	query := differentiating.HistoryQuery{
+		Type:         differentiating.HistoryEntryType(values.Get("type")),
+		Image:        values.Get("image"),
+		ImageID:      values.Get("imageID"),
+		Cluster:      values.Get("cluster"),
+		Namespace:    values.Get("namespace"),
+		WorkloadKind: values.Get("kind"),
+		WorkloadName: values.Get("workload"),
+		Container:    values.Get("container"),
+	}
+
+	for _, param := range []struct {
+		name  string
+		value *time.Time
+	}{{name: "since", value: &query.Since}, {name: "until", value: &query.Until}} {
+		if value := values.Get(param.name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return differentiating.HistoryQuery{}, fmt.Errorf("serving/api error: invalid %s: %w", param.name, err)
+			}
+			*param.value = parsed
+		}
+	}
+
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return differentiating.HistoryQuery{}, fmt.Errorf("serving/api error: invalid limit: %w", err)
+		}
+		query.Limit = limit
+	}
+	return query, query.Validate()
+}
+
+func writeHistoryError(w http.ResponseWriter, err error) {
+	if errors.Is(err, differentiating.ErrHistoryDisabled) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err)
+}
+
+// versionSkew lists the running tags of each image. The query parameter skewed=true only lists images with more than one tag.
+func (a *API) versionSkew(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	skewedOnly := false
+	if value := r.URL.Query().Get("skewed"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		skewedOnly = parsed
+	}
+
+	images, err := a.service.ListImages(r.Context(), differentiating.ListOptions{
+		ImageName: r.URL.Query().Get("image"),
+		Registry:  r.URL.Query().Get("registry"),
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	skews := make([]differentiating.VersionSkew, 0)
+	for _, skew := range differentiating.AnalyzeVersionSkew(images) {
+		if skewedOnly && !skew.IsSkewed() {
+			continue
+		}
+		skews = append(skews, skew)
+	}
+	writeJSON(w, http.StatusOK, skews)
+}
+
+// snoozes lists all snoozes or creates a snooze from the JSON body
+func (a *API) snoozes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, a.service.ListSnoozes())
+	case http.MethodPost:
+		if !a.authorize(w, r) {
+			return
+		}
+		var snooze differentiating.Snooze
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxBodySize)).Decode(&snooze); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		created, err := a.service.AddSnooze(snooze)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, created)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// snooze deletes the snooze with the ID of the last path element
+func (a *API) snooze(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.authorize(w, r) {
+		return
+	}
+
+	err := a.service.DeleteSnooze(path.Base(r.URL.Path))
+	switch {
+	case errors.Is(err, differentiating.ErrSnoozeNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// workers lists the status of all workers
+func (a *API) workers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, a.service.WorkerStatuses())
+}
+
+// worker returns the status of the worker for the image name with registry of the path. POST on the path with the
+// suffix /check runs the check immediately and returns the status afterwards.
+func (a *API) worker(w http.ResponseWriter, r *http.Request) {
+	imageName := strings.TrimPrefix(r.URL.Path, APIPathPrefix+"v1/workers/")
+	if strings.HasSuffix(imageName, checkSuffix) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !a.authorize(w, r) {
+			return
+		}
+		a.writeWorkerStatus(w, func() (differentiating.WorkerStatus, error) {
+			return a.service.CheckNow(r.Context(), strings.TrimSuffix(imageName, checkSuffix))
+		})
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	a.writeWorkerStatus(w, func() (differentiating.WorkerStatus, error) {
+		return a.service.WorkerStatus(imageName)
+	})
+}
+
+func (a *API) writeWorkerStatus(w http.ResponseWriter, status func() (differentiating.WorkerStatus, error)) {
+	s, err := status()
+	var busy *differentiating.RegistryBusyError
+	switch {
+	case errors.Is(err, differentiating.ErrWorkerNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.As(err, &busy):
+		w.Header().Set("Retry-After", strconv.Itoa(int((busy.RetryAfter+time.Second-1)/time.Second)))
+		writeError(w, http.StatusTooManyRequests, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		writeJSON(w, http.StatusOK, s)
+	}
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// authorize compares the bearer token of a request, which changes the state, in constant time
+func (a *API) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if a.token == "" {
+		writeError(w, http.StatusForbidden, errors.New("serving/api error: endpoint is disabled without API token"))
+		return false
+	}
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") || subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, "Bearer ")), []byte(a.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="differ"`)
+		writeError(w, http.StatusUnauthorized, errors.New("serving/api error: invalid bearer token"))
+		return false
+	}
+	return true
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	log.Warnf("serving/api error: %s", err)
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("serving/api error: could not encode response: %s", err)
+	}
+}
@@ -0,0 +1,286 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package serving
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/differentiating"
+)
+
+func TestAPI_versionSkew(t *testing.T) {
+	images := []differentiating.Image{
+		{Registry: "docker.io", Name: "istio/proxyv2", Tag: "1.8.1"},
+		{Registry: "docker.io", Name: "istio/proxyv2", Tag: "1.7.4"},
+		{Registry: "docker.io", Name: "fluent/fluent-bit", Tag: "1.6.8"},
+	}
+	service := differentiating.MockService{
+		List: func(_ differentiating.ListOptions) ([]differentiating.Image, error) {
+			return images, nil
+		},
+	}
+	failing := differentiating.MockService{
+		List: func(_ differentiating.ListOptions) ([]differentiating.Image, error) {
+			return nil, fmt.Errorf("error")
+		},
+	}
+
+	tests := []struct {
+		name       string
+		service    differentiating.Service
+		method     string
+		target     string
+		wantStatus int
+		wantImages int
+	}{
+		{name: "All", service: service, method: http.MethodGet, target: "/api/v1/version-skew", wantStatus: http.StatusOK, wantImages: 2},
+		{name: "SkewedOnly", service: service, method: http.MethodGet, target: "/api/v1/version-skew?skewed=true", wantStatus: http.StatusOK, wantImages: 1},
+		{name: "InvalidQuery", service: service, method: http.MethodGet, target: "/api/v1/version-skew?skewed=maybe", wantStatus: http.StatusBadRequest},
+		{name: "RepositoryError", service: failing, method: http.MethodGet, target: "/api/v1/version-skew", wantStatus: http.StatusInternalServerError},
+		{name: "MethodNotAllowed", service: service, method: http.MethodPost, target: "/api/v1/version-skew", wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			NewAPI(tt.service, testToken).ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("versionSkew() status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var skews []differentiating.VersionSkew
+			if err := json.NewDecoder(w.Body).Decode(&skews); err != nil {
+				t.Fatal(err)
+			}
+			if len(skews) != tt.wantImages {
+				t.Errorf("versionSkew() returned %d images, want %d", len(skews), tt.wantImages)
+			}
+		})
+	}
+}
+
+const testToken = "token"
+
+// authorizedRequest sets the token as bearer token, it defaults to the test token and "-" omits it
+func authorizedRequest(method, target string, body io.Reader, token string) *http.Request {
+	r := httptest.NewRequest(method, target, body)
+	switch token {
+	case "":
+		r.Header.Set("Authorization", "Bearer "+testToken)
+	case "-":
+	default:
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+func TestAPI_disabledWithoutToken(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewAPI(differentiating.MockService{}, "").ServeHTTP(w, authorizedRequest(http.MethodPost, "/api/v1/snoozes", strings.NewReader(`{"image":"library/postgres","tag":"13.1"}`), ""))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("snoozes() status = %d, want %d: %s", w.Code, http.StatusForbidden, w.Body)
+	}
+}
+
+func TestAPI_snoozes(t *testing.T) {
+	service := differentiating.MockService{
+		Snoozes: []differentiating.Snooze{{ID: "1", Image: "library/postgres", Tag: "13.1"}},
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		token      string
+		wantStatus int
+	}{
+		{name: "List", method: http.MethodGet, target: "/api/v1/snoozes", token: "-", wantStatus: http.StatusOK},
+		{name: "Create", method: http.MethodPost, target: "/api/v1/snoozes", body: `{"image":"library/postgres","tag":"13.1","reason":"migration pending"}`, wantStatus: http.StatusCreated},
+		{name: "CreateInvalid", method: http.MethodPost, target: "/api/v1/snoozes", body: `{"image":"library/postgres"}`, wantStatus: http.StatusBadRequest},
+		{name: "CreateMalformed", method: http.MethodPost, target: "/api/v1/snoozes", body: `{`, wantStatus: http.StatusBadRequest},
+		{name: "Delete", method: http.MethodDelete, target: "/api/v1/snoozes/1", wantStatus: http.StatusNoContent},
+		{name: "DeleteNotFound", method: http.MethodDelete, target: "/api/v1/snoozes/2", wantStatus: http.StatusNotFound},
+		{name: "MethodNotAllowed", method: http.MethodPut, target: "/api/v1/snoozes", wantStatus: http.StatusMethodNotAllowed},
+		{name: "CreateWithoutToken", method: http.MethodPost, target: "/api/v1/snoozes", body: `{"image":"library/postgres","tag":"13.1"}`, token: "-", wantStatus: http.StatusUnauthorized},
+		{name: "DeleteWithInvalidToken", method: http.MethodDelete, target: "/api/v1/snoozes/1", token: "invalid", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			NewAPI(service, testToken).ServeHTTP(w, authorizedRequest(tt.method, tt.target, strings.NewReader(tt.body), tt.token))
+			if w.Code != tt.wantStatus {
+				t.Errorf("snoozes() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
+
+func TestAPI_workers(t *testing.T) {
+	var checked string
+	service := differentiating.MockService{
+		Workers: []differentiating.WorkerStatus{{Image: "registry-1.docker.io/library/postgres", Registry: "registry-1.docker.io", Name: "library/postgres"}},
+		Check: func(registry, imageName string) bool {
+			checked = registry + "/" + imageName
+			return true
+		},
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		token       string
+		wantStatus  int
+		wantChecked string
+	}{
+		{name: "List", method: http.MethodGet, target: "/api/v1/workers", wantStatus: http.StatusOK},
+		{name: "Status", method: http.MethodGet, target: "/api/v1/workers/registry-1.docker.io/library/postgres", wantStatus: http.StatusOK},
+		{name: "StatusNotFound", method: http.MethodGet, target: "/api/v1/workers/registry-1.docker.io/library/redis", wantStatus: http.StatusNotFound},
+		{name: "CheckNow", method: http.MethodPost, target: "/api/v1/workers/registry-1.docker.io/library/postgres/check", wantStatus: http.StatusOK, wantChecked: "registry-1.docker.io/library/postgres"},
+		{name: "CheckNowNotFound", method: http.MethodPost, target: "/api/v1/workers/registry-1.docker.io/library/redis/check", wantStatus: http.StatusNotFound},
+		{name: "CheckNowMethodNotAllowed", method: http.MethodGet, target: "/api/v1/workers/registry-1.docker.io/library/postgres/check", wantStatus: http.StatusMethodNotAllowed},
+		{name: "MethodNotAllowed", method: http.MethodPost, target: "/api/v1/workers", wantStatus: http.StatusMethodNotAllowed},
+		{name: "CheckNowWithoutToken", method: http.MethodPost, target: "/api/v1/workers/registry-1.docker.io/library/postgres/check", token: "-", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checked = ""
+			w := httptest.NewRecorder()
+			NewAPI(service, testToken).ServeHTTP(w, authorizedRequest(tt.method, tt.target, nil, tt.token))
+			if w.Code != tt.wantStatus {
+				t.Errorf("workers() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if checked != tt.wantChecked {
+				t.Errorf("workers() checked %q, want %q", checked, tt.wantChecked)
+			}
+		})
+	}
+}
+
+func TestAPI_images(t *testing.T) {
+	var gotOpts differentiating.ListOptions
+	service := differentiating.MockService{
+		List: func(opts differentiating.ListOptions) ([]differentiating.Image, error) {
+			gotOpts = opts
+			return []differentiating.Image{{ID: "1"}}, nil
+		},
+	}
+	hasNewerTag := true
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantOpts   differentiating.ListOptions
+	}{
+		{name: "All", target: "/api/v1/images", wantStatus: http.StatusOK},
+		{
+			name:       "Query",
+			target:     "/api/v1/images?namespace=web&kind=Deployment&workload=frontend&container=nginx&tag=1.18.0&hasNewerTag=true&selector=app%3Dfrontend&sort=tag&order=desc&offset=10&limit=5",
+			wantStatus: http.StatusOK,
+			wantOpts:   differentiating.ListOptions{Namespace: "web", WorkloadKind: "Deployment", WorkloadName: "frontend", Container: "nginx", Tag: "1.18.0", HasNewerTag: &hasNewerTag, LabelSelector: "app=frontend", SortBy: differentiating.SortByTag, Descending: true, Offset: 10, Limit: 5},
+		},
+		{name: "InvalidSort", target: "/api/v1/images?sort=size", wantStatus: http.StatusBadRequest},
+		{name: "InvalidOrder", target: "/api/v1/images?order=random", wantStatus: http.StatusBadRequest},
+		{name: "InvalidLimit", target: "/api/v1/images?limit=ten", wantStatus: http.StatusBadRequest},
+		{name: "InvalidHasNewerTag", target: "/api/v1/images?hasNewerTag=maybe", wantStatus: http.StatusBadRequest},
+		{name: "InvalidSelector", target: "/api/v1/images?selector=app+in+(web", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotOpts = differentiating.ListOptions{}
+			w := httptest.NewRecorder()
+			NewAPI(service, testToken).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("images() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus == http.StatusOK && !reflect.DeepEqual(gotOpts, tt.wantOpts) {
+				t.Errorf("images() options = %+v, want %+v", gotOpts, tt.wantOpts)
+			}
+		})
+	}
+}
+
+func TestAPI_history(t *testing.T) {
+	start := time.Date(2020, 12, 1, 8, 0, 0, 0, time.UTC)
+	service := differentiating.MockService{
+		HistoryEntries: []differentiating.HistoryEntry{
+			{Type: differentiating.HistoryOutdated, Time: start, Image: "docker.io/library/nginx", ImageID: "1", Workload: &differentiating.Workload{Namespace: "web"}},
+			{Type: differentiating.HistoryTagChanged, Time: start.Add(time.Hour), Image: "docker.io/library/nginx", ImageID: "1", Workload: &differentiating.Workload{Namespace: "web"}, OutdatedSince: &start},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		service     differentiating.Service
+		method      string
+		target      string
+		wantStatus  int
+		wantEntries int
+	}{
+		{name: "All", service: service, method: http.MethodGet, target: "/api/v1/history", wantStatus: http.StatusOK, wantEntries: 2},
+		{name: "Query", service: service, method: http.MethodGet, target: "/api/v1/history?type=tag-changed&namespace=web&since=2020-12-01T08:30:00Z&limit=1", wantStatus: http.StatusOK, wantEntries: 1},
+		{name: "Until", service: service, method: http.MethodGet, target: "/api/v1/history?until=2020-12-01T08:30:00Z", wantStatus: http.StatusOK, wantEntries: 1},
+		{name: "TimeToUpdate", service: service, method: http.MethodGet, target: "/api/v1/history/time-to-update?namespace=web", wantStatus: http.StatusOK, wantEntries: 1},
+		{name: "InvalidType", service: service, method: http.MethodGet, target: "/api/v1/history?type=deleted", wantStatus: http.StatusBadRequest},
+		{name: "InvalidSince", service: service, method: http.MethodGet, target: "/api/v1/history?since=yesterday", wantStatus: http.StatusBadRequest},
+		{name: "InvalidLimit", service: service, method: http.MethodGet, target: "/api/v1/history?limit=-1", wantStatus: http.StatusBadRequest},
+		{name: "Disabled", service: differentiating.MockService{}, method: http.MethodGet, target: "/api/v1/history", wantStatus: http.StatusNotFound},
+		{name: "TimeToUpdateDisabled", service: differentiating.MockService{}, method: http.MethodGet, target: "/api/v1/history/time-to-update", wantStatus: http.StatusNotFound},
+		{name: "MethodNotAllowed", service: service, method: http.MethodPost, target: "/api/v1/history", wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			NewAPI(tt.service, testToken).ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("history() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var entries []json.RawMessage
+			if err := json.NewDecoder(w.Body).Decode(&entries); err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != tt.wantEntries {
+				t.Errorf("history() returned %d entries, want %d", len(entries), tt.wantEntries)
+			}
+		})
+	}
+}
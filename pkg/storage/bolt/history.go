@@ -0,0 +1,126 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/differentiating"
+	"go.etcd.io/bbolt"
+)
+
+// AddHistoryEntry implements the differentiating.HistoryRepository interface. The keys start with the time of the
+// entry, so that the entries are ordered by time.
+func (s *Storage) AddHistoryEntry(_ context.Context, entry differentiating.HistoryEntry) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(historyBucket)
+		sequence, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		return bucket.Put(historyKey(entry.Time, sequence), value)
+	})
+}
+
+// ListHistory implements the differentiating.HistoryRepository interface
+func (s *Storage) ListHistory(_ context.Context, query differentiating.HistoryQuery) ([]differentiating.HistoryEntry, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	var entries []differentiating.HistoryEntry
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		cursor := tx.Bucket(historyBucket).Cursor()
+		var until []byte
+		if !query.Until.IsZero() {
+			until = historyKey(query.Until, 0)
+		}
+		for key, value := cursor.Seek(historyKey(query.Since, 0)); key != nil; key, value = cursor.Next() {
+			if until != nil && bytes.Compare(key, until) >= 0 {
+				break
+			}
+			var entry differentiating.HistoryEntry
+			if err := json.Unmarshal(value, &entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return query.Apply(entries)
+}
+
+// PruneHistory implements the differentiating.HistoryRepository interface
+func (s *Storage) PruneHistory(_ context.Context, before time.Time, keep func(differentiating.HistoryEntry) bool) (int, error) {
+	pruned := 0
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(historyBucket)
+		end := historyKey(before, 0)
+		// deleting while iterating with the cursor skips keys
+		var expired [][]byte
+		cursor := bucket.Cursor()
+		for key, value := cursor.First(); key != nil && bytes.Compare(key, end) < 0; key, value = cursor.Next() {
+			if keep != nil {
+				var entry differentiating.HistoryEntry
+				if err := json.Unmarshal(value, &entry); err != nil {
+					return err
+				}
+				if keep(entry) {
+					continue
+				}
+			}
+			expired = append(expired, key)
+		}
+		for _, key := range expired {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		pruned = len(expired)
+		return nil
+	})
+	return pruned, err
+}
+
+// historyKey is the big endian unix time in nanoseconds followed by the sequence, times before 1970 are stored as zero
+func historyKey(t time.Time, sequence uint64) []byte {
+	key := make([]byte, 16)
+	if nanos := t.UnixNano(); !t.IsZero() && nanos > 0 {
+		binary.BigEndian.PutUint64(key, uint64(nanos))
+	}
+	binary.BigEndian.PutUint64(key[8:], sequence)
+	return key
+}
@@ -0,0 +1,154 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bolt
+
+import (
+	"fmt"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+)
+
+var (
+	metaBucket          = []byte("meta")
+	imagesBucket        = []byte("images")
+	imagesByNameBucket  = []byte("imagesByName")
+	tagsBucket          = []byte("tags")
+	trackedStatesBucket = []byte("trackedStates")
+	snoozesBucket       = []byte("snoozes")
+	historyBucket       = []byte("history")
+
+	schemaVersionKey = []byte("schemaVersion")
+)
+
+// migration upgrades the schema of the database to its version
+type migration struct {
+	version     int
+	description string
+	migrate     func(tx *bbolt.Tx) error
+}
+
+// migrations ordered by version. Released migrations must never be changed, a schema change requires a new migration.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "create the buckets of the images and the state",
+		migrate: func(tx *bbolt.Tx) error {
+			for _, name := range [][]byte{imagesBucket, imagesByNameBucket, tagsBucket, trackedStatesBucket, snoozesBucket} {
+				if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version:     2,
+		description: "create the bucket of the history",
+		migrate: func(tx *bbolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(historyBucket)
+			return err
+		},
+	},
+}
+
+// migrate runs all migrations newer than the schema version of the database, each in its own transaction
+func migrate(db *bbolt.DB, migrations []migration) error {
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	latest := migrations[len(migrations)-1].version
+	if current > latest {
+		return fmt.Errorf("storage/bolt error: schema version %d of %s is newer than the supported version %d", current, db.Path(), latest)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		log.Infof("Migrating %s to schema version %d: %s", db.Path(), m.version, m.description)
+		err := db.Update(func(tx *bbolt.Tx) error {
+			if err := m.migrate(tx); err != nil {
+				return err
+			}
+			meta, err := tx.CreateBucketIfNotExists(metaBucket)
+			if err != nil {
+				return err
+			}
+			return meta.Put(schemaVersionKey, []byte(strconv.Itoa(m.version)))
+		})
+		if err != nil {
+			return fmt.Errorf("storage/bolt error: migration to schema version %d failed: %w", m.version, err)
+		}
+	}
+	return nil
+}
+
+// schemaVersion returns the version of the database, which is zero for new databases
+func schemaVersion(db *bbolt.DB) (int, error) {
+	version := 0
+	err := db.View(func(tx *bbolt.Tx) error {
+		meta := tx.Bucket(metaBucket)
+		if meta == nil {
+			return nil
+		}
+		value := meta.Get(schemaVersionKey)
+		if value == nil {
+			return nil
+		}
+		parsed, err := strconv.Atoi(string(value))
+		if err != nil {
+			return fmt.Errorf("storage/bolt error: invalid schema version %q: %w", value, err)
+		}
+		version = parsed
+		return nil
+	})
+	return version, err
+}
+
+func addToIndex(index *bbolt.Bucket, name string, id []byte) error {
+	ids, err := index.CreateBucketIfNotExists([]byte(name))
+	if err != nil {
+		return err
+	}
+	return ids.Put(id, nil)
+}
+
+func removeFromIndex(index *bbolt.Bucket, name string, id []byte) error {
+	ids := index.Bucket([]byte(name))
+	if ids == nil {
+		return nil
+	}
+	if err := ids.Delete(id); err != nil {
+		return err
+	}
+	if k, _ := ids.Cursor().First(); k == nil {
+		return index.DeleteBucket([]byte(name))
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bolt
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/differentiating"
+	"go.etcd.io/bbolt"
+)
+
+func TestMigrate(t *testing.T) {
+	latest := migrations[len(migrations)-1].version
+	tests := []struct {
+		name string
+		// setup creates the database of the previous version
+		setup      func(db *bbolt.DB) error
+		wantImages int
+		wantErr    bool
+	}{
+		{
+			name:  "NewDatabase",
+			setup: func(_ *bbolt.DB) error { return nil },
+		},
+		{
+			name: "FromVersion1",
+			setup: func(db *bbolt.DB) error {
+				if err := migrate(db, migrations[:1]); err != nil {
+					return err
+				}
+				return db.Update(func(tx *bbolt.Tx) error {
+					if err := tx.Bucket(imagesBucket).Put([]byte("1"), []byte(`{"id":"1","registry":"docker.com","name":"differ","tag":"1.0.0"}`)); err != nil {
+						return err
+					}
+					return addToIndex(tx.Bucket(imagesByNameBucket), "docker.com/differ", []byte("1"))
+				})
+			},
+			wantImages: 1,
+		},
+		{
+			name: "NewerVersion",
+			setup: func(db *bbolt.DB) error {
+				return db.Update(func(tx *bbolt.Tx) error {
+					meta, err := tx.CreateBucketIfNotExists(metaBucket)
+					if err != nil {
+						return err
+					}
+					return meta.Put(schemaVersionKey, []byte(strconv.Itoa(latest+1)))
+				})
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tempPath(t)
+			db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.setup(db); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := NewBoltStorage(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewBoltStorage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			defer s.Close()
+
+			if version, err := schemaVersion(s.db); err != nil || version != latest {
+				t.Errorf("schemaVersion() = %d, %v, want %d", version, err, latest)
+			}
+
+			images, err := s.ListImages(context.Background(), differentiating.ListOptions{ImageName: "differ", Registry: "docker.com"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(images) != tt.wantImages {
+				t.Errorf("ListImages() from the index = %+v, want %d images", images, tt.wantImages)
+			}
+
+			if err := s.db.View(func(tx *bbolt.Tx) error {
+				if tx.Bucket(historyBucket) == nil {
+					t.Error("history bucket is missing")
+				}
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
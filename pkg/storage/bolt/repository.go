@@ -0,0 +1,306 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bolt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/differentiating"
+	"go.etcd.io/bbolt"
+)
+
+// Storage persists the images, the state and the history of the differentiating.Service in a bbolt database file. It
+// implements differentiating.Repository, differentiating.StateRepository and differentiating.HistoryRepository. Pull
+// secrets are only kept in memory, they are added again by the observers after a restart.
+type Storage struct {
+	db        *bbolt.DB
+	authMutex sync.RWMutex
+	auth      map[string][]*differentiating.PullSecret
+}
+
+// NewBoltStorage opens or creates the database file and migrates it to the latest schema version
+func NewBoltStorage(path string) (*Storage, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second * 5})
+	if err != nil {
+		return nil, fmt.Errorf("storage/bolt error: could not open %s: %w", path, err)
+	}
+	if err := migrate(db, migrations); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &Storage{
+		db:   db,
+		auth: make(map[string][]*differentiating.PullSecret),
+	}, nil
+}
+
+// Close the database file
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+func (s *Storage) AddImage(_ context.Context, img differentiating.Image) error {
+	if img.ID == "" {
+		return fmt.Errorf("storage/bolt: image ID is empty: %+v", img)
+	}
+
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		images := tx.Bucket(imagesBucket)
+		if images.Get([]byte(img.ID)) != nil {
+			return fmt.Errorf("storage/bolt: image with ID \"%s\": %w", img.ID, differentiating.ErrImageExists)
+		}
+		return putImage(tx, img)
+	})
+	if err != nil {
+		return err
+	}
+	s.setAuth(img)
+	return nil
+}
+
+func (s *Storage) DeleteImage(_ context.Context, img differentiating.Image) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		stored, err := getImage(tx, img.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(imagesBucket).Delete([]byte(img.ID)); err != nil {
+			return err
+		}
+		return removeFromIndex(tx.Bucket(imagesByNameBucket), stored.GetNameWithRegistry(), []byte(img.ID))
+	})
+	if err != nil {
+		return err
+	}
+
+	s.authMutex.Lock()
+	defer s.authMutex.Unlock()
+	delete(s.auth, img.ID)
+	return nil
+}
+
+func (s *Storage) UpdateImage(_ context.Context, img differentiating.Image) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		stored, err := getImage(tx, img.ID)
+		if err != nil {
+			return err
+		}
+		if stored.GetNameWithRegistry() != img.GetNameWithRegistry() {
+			if err := removeFromIndex(tx.Bucket(imagesByNameBucket), stored.GetNameWithRegistry(), []byte(img.ID)); err != nil {
+				return err
+			}
+		}
+		return putImage(tx, img)
+	})
+	if err != nil {
+		return err
+	}
+	s.setAuth(img)
+	return nil
+}
+
+// ListImages uses the index if the image name and the registry are set, all other options are applied to the result
+func (s *Storage) ListImages(_ context.Context, opts differentiating.ListOptions) ([]differentiating.Image, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	var matchedImages []differentiating.Image
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		images := tx.Bucket(imagesBucket)
+		if opts.ImageName != "" && opts.Registry != "" {
+			ids := tx.Bucket(imagesByNameBucket).Bucket([]byte(differentiating.Image{Registry: opts.Registry, Name: opts.ImageName}.GetNameWithRegistry()))
+			if ids == nil {
+				return nil
+			}
+			return ids.ForEach(func(id, _ []byte) error {
+				img, err := decodeImage(images.Get(id))
+				if err != nil {
+					return err
+				}
+				matchedImages = append(matchedImages, img)
+				return nil
+			})
+		}
+
+		return images.ForEach(func(_, value []byte) error {
+			img, err := decodeImage(value)
+			if err != nil {
+				return err
+			}
+			if (opts.ImageName == "" || opts.ImageName == img.Name) && (opts.Registry == "" || opts.Registry == img.Registry) {
+				matchedImages = append(matchedImages, img)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.authMutex.RLock()
+	for i := range matchedImages {
+		matchedImages[i].Auth = s.auth[matchedImages[i].ID]
+	}
+	s.authMutex.RUnlock()
+	return opts.Apply(matchedImages)
+}
+
+// SaveTags implements the differentiating.StateRepository interface
+func (s *Storage) SaveTags(_ context.Context, tags differentiating.ImageTags) error {
+	return s.put(tagsBucket, tags.Image, tags)
+}
+
+// ListTags implements the differentiating.StateRepository interface
+func (s *Storage) ListTags(_ context.Context) ([]differentiating.ImageTags, error) {
+	var list []differentiating.ImageTags
+	err := s.forEach(tagsBucket, func(value []byte) error {
+		var tags differentiating.ImageTags
+		if err := json.Unmarshal(value, &tags); err != nil {
+			return err
+		}
+		list = append(list, tags)
+		return nil
+	})
+	return list, err
+}
+
+// SaveTrackedState implements the differentiating.StateRepository interface
+func (s *Storage) SaveTrackedState(_ context.Context, state differentiating.TrackedState) error {
+	return s.put(trackedStatesBucket, state.ImageID, state)
+}
+
+// DeleteTrackedState implements the differentiating.StateRepository interface
+func (s *Storage) DeleteTrackedState(_ context.Context, imageID string) error {
+	return s.delete(trackedStatesBucket, imageID)
+}
+
+// ListTrackedStates implements the differentiating.StateRepository interface
+func (s *Storage) ListTrackedStates(_ context.Context) ([]differentiating.TrackedState, error) {
+	var list []differentiating.TrackedState
+	err := s.forEach(trackedStatesBucket, func(value []byte) error {
+		var state differentiating.TrackedState
+		if err := json.Unmarshal(value, &state); err != nil {
+			return err
+		}
+		list = append(list, state)
+		return nil
+	})
+	return list, err
+}
+
+// SaveSnooze implements the differentiating.StateRepository interface
+func (s *Storage) SaveSnooze(_ context.Context, snooze differentiating.Snooze) error {
+	return s.put(snoozesBucket, snooze.ID, snooze)
+}
+
+// DeleteSnooze implements the differentiating.StateRepository interface
+func (s *Storage) DeleteSnooze(_ context.Context, id string) error {
+	return s.delete(snoozesBucket, id)
+}
+
+// ListSnoozes implements the differentiating.StateRepository interface
+func (s *Storage) ListSnoozes(_ context.Context) ([]differentiating.Snooze, error) {
+	var list []differentiating.Snooze
+	err := s.forEach(snoozesBucket, func(value []byte) error {
+		var snooze differentiating.Snooze
+		if err := json.Unmarshal(value, &snooze); err != nil {
+			return err
+		}
+		list = append(list, snooze)
+		return nil
+	})
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list, err
+}
+
+func (s *Storage) setAuth(img differentiating.Image) {
+	s.authMutex.Lock()
+	defer s.authMutex.Unlock()
+	if len(img.Auth) == 0 {
+		delete(s.auth, img.ID)
+		return
+	}
+	s.auth[img.ID] = img.Auth
+}
+
+func (s *Storage) put(bucket []byte, key string, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(key), value)
+	})
+}
+
+func (s *Storage) delete(bucket []byte, key string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucket).Delete([]byte(key))
+	})
+}
+
+func (s *Storage) forEach(bucket []byte, fn func(value []byte) error) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucket).ForEach(func(_, value []byte) error {
+			return fn(value)
+		})
+	})
+}
+
+// putImage stores the image and adds it to the index
+func putImage(tx *bbolt.Tx, img differentiating.Image) error {
+	value, err := json.Marshal(img)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(imagesBucket).Put([]byte(img.ID), value); err != nil {
+		return err
+	}
+	return addToIndex(tx.Bucket(imagesByNameBucket), img.GetNameWithRegistry(), []byte(img.ID))
+}
+
+func getImage(tx *bbolt.Tx, id string) (differentiating.Image, error) {
+	value := tx.Bucket(imagesBucket).Get([]byte(id))
+	if value == nil {
+		return differentiating.Image{}, fmt.Errorf("storage/bolt: image with ID \"%s\" not found", id)
+	}
+	return decodeImage(value)
+}
+
+func decodeImage(value []byte) (differentiating.Image, error) {
+	var img differentiating.Image
+	if err := json.Unmarshal(value, &img); err != nil {
+		return differentiating.Image{}, fmt.Errorf("storage/bolt: could not decode image: %w", err)
+	}
+	return img, nil
+}
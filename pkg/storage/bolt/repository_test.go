@@ -0,0 +1,216 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bolt
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/differentiating"
+	"github.com/fwiedmann/differ/pkg/storage/storagetest"
+)
+
+// tempPath returns the path of a database file in a temporary directory, which is removed after the test
+func tempPath(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "differ-bolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+	return filepath.Join(dir, "differ.db")
+}
+
+func newTestStorage(t *testing.T, path string) *Storage {
+	t.Helper()
+	s, err := NewBoltStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+	return s
+}
+
+func TestStorage_Images(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, tempPath(t))
+
+	images := []differentiating.Image{
+		{ID: "1", Registry: "docker.com", Name: "differ", Tag: "1.0.0", Auth: []*differentiating.PullSecret{{Username: "admin", Password: "admin"}}},
+		{ID: "2", Registry: "docker.com", Name: "differ", Tag: "1.1.0"},
+		{ID: "3", Registry: "gitlab.com", Name: "differ", Tag: "2.0.0"},
+	}
+	for _, img := range images {
+		if err := s.AddImage(ctx, img); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.AddImage(ctx, images[0]); !errors.Is(err, differentiating.ErrImageExists) {
+		t.Errorf("AddImage() error = %v, want ErrImageExists", err)
+	}
+	if err := s.AddImage(ctx, differentiating.Image{}); err == nil {
+		t.Errorf("AddImage() without ID did not return an error")
+	}
+
+	tests := []struct {
+		name    string
+		opts    differentiating.ListOptions
+		wantIDs []string
+	}{
+		{name: "All", opts: differentiating.ListOptions{}, wantIDs: []string{"1", "2", "3"}},
+		{name: "Index", opts: differentiating.ListOptions{ImageName: "differ", Registry: "docker.com"}, wantIDs: []string{"1", "2"}},
+		{name: "IndexMiss", opts: differentiating.ListOptions{ImageName: "health", Registry: "docker.com"}},
+		{name: "Name", opts: differentiating.ListOptions{ImageName: "differ"}, wantIDs: []string{"1", "2", "3"}},
+		{name: "Registry", opts: differentiating.ListOptions{Registry: "gitlab.com"}, wantIDs: []string{"3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.ListImages(ctx, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := imageIDs(got); !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("ListImages() = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+
+	moved := images[1]
+	moved.Registry = "gitlab.com"
+	if err := s.UpdateImage(ctx, moved); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteImage(ctx, images[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteImage(ctx, images[0]); err == nil {
+		t.Errorf("DeleteImage() of a deleted image did not return an error")
+	}
+	if err := s.UpdateImage(ctx, images[0]); err == nil {
+		t.Errorf("UpdateImage() of a deleted image did not return an error")
+	}
+
+	got, err := s.ListImages(ctx, differentiating.ListOptions{ImageName: "differ", Registry: "gitlab.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := imageIDs(got); !reflect.DeepEqual(ids, []string{"2", "3"}) {
+		t.Errorf("ListImages() after update = %v, want [2 3]", ids)
+	}
+	if got, _ := s.ListImages(ctx, differentiating.ListOptions{ImageName: "differ", Registry: "docker.com"}); len(got) != 0 {
+		t.Errorf("ListImages() of the old registry = %v, want none", got)
+	}
+}
+
+func TestStorage_reopen(t *testing.T) {
+	ctx := context.Background()
+	path := tempPath(t)
+	until := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	img := differentiating.Image{ID: "1", Registry: "docker.com", Name: "differ", Tag: "1.0.0", Auth: []*differentiating.PullSecret{{Username: "admin", Password: "admin"}}}
+	tags := differentiating.ImageTags{Image: "docker.com/differ", Tags: []string{"1.0.0", "1.1.0"}, Credential: "basic:admin", CheckedAt: until}
+	state := differentiating.TrackedState{
+		ImageID:      "1",
+		Event:        &differentiating.NotificationEvent{Type: differentiating.EventTypeOutdated, Image: differentiating.Image{ID: "1", Registry: "docker.com", Name: "differ", Tag: "1.0.0"}, NewTag: "1.1.0", LatestTag: "1.1.0"},
+		MetricLabels: []string{"docker.com/differ", "1.0.0", "1.1.0", "false"},
+		NotifiedAt:   until,
+	}
+	snooze := differentiating.Snooze{ID: "a1", Image: "docker.com/differ", Until: &until, Reason: "migration pending"}
+
+	s, err := NewBoltStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range []error{
+		s.AddImage(ctx, img),
+		s.SaveTags(ctx, tags),
+		s.SaveTrackedState(ctx, state),
+		s.SaveTrackedState(ctx, differentiating.TrackedState{ImageID: "2"}),
+		s.DeleteTrackedState(ctx, "2"),
+		s.SaveSnooze(ctx, snooze),
+		s.SaveSnooze(ctx, differentiating.Snooze{ID: "b2", Image: "*", Tag: "1.0.0"}),
+		s.DeleteSnooze(ctx, "b2"),
+		s.Close(),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s = newTestStorage(t, path)
+	images, err := s.ListImages(ctx, differentiating.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img.Auth = nil
+	if !reflect.DeepEqual(images, []differentiating.Image{img}) {
+		t.Errorf("ListImages() = %+v, want %+v without pull secrets", images, img)
+	}
+
+	gotTags, err := s.ListTags(ctx)
+	if err != nil || !reflect.DeepEqual(gotTags, []differentiating.ImageTags{tags}) {
+		t.Errorf("ListTags() = %+v, %v, want %+v", gotTags, err, tags)
+	}
+	gotStates, err := s.ListTrackedStates(ctx)
+	if err != nil || !reflect.DeepEqual(gotStates, []differentiating.TrackedState{state}) {
+		t.Errorf("ListTrackedStates() = %+v, %v, want %+v", gotStates, err, state)
+	}
+	gotSnoozes, err := s.ListSnoozes(ctx)
+	if err != nil || !reflect.DeepEqual(gotSnoozes, []differentiating.Snooze{snooze}) {
+		t.Errorf("ListSnoozes() = %+v, %v, want %+v", gotSnoozes, err, snooze)
+	}
+}
+
+func imageIDs(images []differentiating.Image) []string {
+	var ids []string
+	for _, img := range images {
+		ids = append(ids, img.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestStorage_Conformance(t *testing.T) {
+	storagetest.TestRepository(t, func(t *testing.T) differentiating.Repository {
+		return newTestStorage(t, tempPath(t))
+	})
+}
+
+func TestStorage_HistoryConformance(t *testing.T) {
+	storagetest.TestHistoryRepository(t, func(t *testing.T) differentiating.HistoryRepository {
+		return newTestStorage(t, tempPath(t))
+	})
+}
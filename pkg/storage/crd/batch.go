@@ -0,0 +1,219 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package crd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/differentiating"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// shutdownFlushTimeout limits the last flush on Close
+const shutdownFlushTimeout = time.Second * 10
+
+// pendingWrite is the latest change of a report. Only the latest change is written, so that repeated updates of the
+// same report within the flush interval cause a single request.
+type pendingWrite struct {
+	img     differentiating.Image
+	deleted bool
+	status  *ReportStatus
+}
+
+// batch collects the pending writes by report name
+type batch struct {
+	mutex   sync.Mutex
+	pending map[string]*pendingWrite
+	size    int
+	full    chan struct{}
+}
+
+func newBatch(size int) *batch {
+	return &batch{
+		pending: make(map[string]*pendingWrite),
+		size:    size,
+		full:    make(chan struct{}, 1),
+	}
+}
+
+func (b *batch) upsert(img differentiating.Image) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	write := b.write(img)
+	write.img = img
+	write.deleted = false
+}
+
+func (b *batch) delete(img differentiating.Image) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	write := b.write(img)
+	write.img = img
+	write.deleted = true
+	write.status = nil
+}
+
+func (b *batch) status(img differentiating.Image, status ReportStatus) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	write := b.write(img)
+	write.status = &status
+}
+
+// write returns the pending write of the report and has to be called with the locked mutex
+func (b *batch) write(img differentiating.Image) *pendingWrite {
+	name := reportName(img)
+	write, ok := b.pending[name]
+	if !ok {
+		write = &pendingWrite{img: img}
+		b.pending[name] = write
+		if len(b.pending) >= b.size {
+			select {
+			case b.full <- struct{}{}:
+			default:
+			}
+		}
+	}
+	return write
+}
+
+// take removes and returns all pending writes
+func (b *batch) take() map[string]*pendingWrite {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	pending := b.pending
+	b.pending = make(map[string]*pendingWrite)
+	return pending
+}
+
+// retry re-queues a failed write, unless the report changed in the meantime
+func (b *batch) retry(name string, write *pendingWrite) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if _, ok := b.pending[name]; !ok {
+		b.pending[name] = write
+	}
+}
+
+// run flushes the batch periodically and whenever it is full. The last flush waits for Close, so that the writes of
+// the subscribers during the shutdown are not lost.
+func (s *Storage) run(ctx context.Context) {
+	defer close(s.done)
+	ticker := time.NewTicker(s.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush(ctx)
+		case <-s.batch.full:
+			s.Flush(ctx)
+		case <-ctx.Done():
+			<-s.stop
+			s.flushOnShutdown()
+			return
+		case <-s.stop:
+			s.flushOnShutdown()
+			return
+		}
+	}
+}
+
+func (s *Storage) flushOnShutdown() {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownFlushTimeout)
+	defer cancel()
+	s.Flush(shutdownCtx)
+}
+
+// Flush writes all pending changes to the API server. Failed writes are retried with the next flush.
+func (s *Storage) Flush(ctx context.Context) {
+	for name, write := range s.batch.take() {
+		if err := s.flushWrite(ctx, name, write); err != nil {
+			log.Warnf("storage/crd error: could not write image report %s/%s: %s", s.opts.Namespace, name, err)
+			s.batch.retry(name, write)
+		}
+	}
+}
+
+func (s *Storage) flushWrite(ctx context.Context, name string, write *pendingWrite) error {
+	if write.deleted {
+		err := s.client.Delete(ctx, name, metaV1.DeleteOptions{})
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	if err := s.upsertSpec(ctx, name, write.img); err != nil {
+		return err
+	}
+	if write.status == nil {
+		return nil
+	}
+	patch, err := addPatch("/status", write.status)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.Patch(ctx, name, types.JSONPatchType, patch, metaV1.PatchOptions{}, "status")
+	return err
+}
+
+// upsertSpec replaces the spec of the report or creates the report if it does not exist
+func (s *Storage) upsertSpec(ctx context.Context, name string, img differentiating.Image) error {
+	spec, err := imageSpec(img)
+	if err != nil {
+		return err
+	}
+	patch, err := addPatch("/spec", spec)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.Patch(ctx, name, types.JSONPatchType, patch, metaV1.PatchOptions{})
+	if !errors.IsNotFound(err) {
+		return err
+	}
+
+	report, err := newReport(s.opts.Namespace, img)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.Create(ctx, report, metaV1.CreateOptions{})
+	return err
+}
+
+// addPatch returns a JSON patch which adds or replaces the value of the path
+func addPatch(path string, value interface{}) ([]byte, error) {
+	patch, err := json.Marshal([]map[string]interface{}{{"op": "add", "path": path, "value": value}})
+	if err != nil {
+		return nil, fmt.Errorf("storage/crd error: could not encode patch of %s: %w", path, err)
+	}
+	return patch, nil
+}
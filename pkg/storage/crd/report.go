@@ -0,0 +1,147 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package crd
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/differentiating"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// Kind of the custom resource, see local-dev/k8s/imagereport-crd.yaml
+	Kind = "ImageReport"
+
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedByValue = "differ"
+
+	// maxNamePrefixLength leaves room for the hash suffix in the 63 characters of a label compatible name
+	maxNamePrefixLength = 50
+)
+
+var (
+	// GroupVersionResource of the ImageReport custom resource
+	GroupVersionResource = schema.GroupVersionResource{Group: "differ.io", Version: "v1alpha1", Resource: "imagereports"}
+
+	invalidNameCharacters = regexp.MustCompile("[^a-z0-9-]+")
+)
+
+// ReportStatus is the result of the last checks of the image, it is updated from the notification events
+type ReportStatus struct {
+	Outdated           bool   `json:"outdated"`
+	NewTag             string `json:"newTag,omitempty"`
+	LatestTag          string `json:"latestTag,omitempty"`
+	NewVariantTag      string `json:"newVariantTag,omitempty"`
+	Bump               string `json:"bump,omitempty"`
+	LastEvent          string `json:"lastEvent,omitempty"`
+	LastTransitionTime string `json:"lastTransitionTime,omitempty"`
+}
+
+// newReportStatus returns the status of the event and if the event changes the status
+func newReportStatus(event differentiating.NotificationEvent, now time.Time) (ReportStatus, bool) {
+	status := ReportStatus{
+		LastEvent:          string(event.Type),
+		LastTransitionTime: now.UTC().Format(time.RFC3339),
+	}
+	switch event.Type {
+	case differentiating.EventTypeOutdated, differentiating.EventTypeChanged, differentiating.EventTypeReminder:
+		status.Outdated = true
+		status.NewTag = event.NewTag
+		status.LatestTag = event.LatestTag
+		status.NewVariantTag = event.NewVariantTag
+		status.Bump = string(event.Bump)
+	case differentiating.EventTypeResolved:
+		status.LatestTag = event.LatestTag
+	default:
+		return ReportStatus{}, false
+	}
+	return status, true
+}
+
+// reportName is derived from the workload and container of the image. The hash of the image ID keeps names of different
+// clusters or kinds unique.
+func reportName(img differentiating.Image) string {
+	parts := make([]string, 0, 3)
+	for _, part := range []string{img.Workload.Kind, img.Workload.Name, img.Workload.Container} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	prefix := "image"
+	if len(parts) > 0 {
+		prefix = strings.Join(parts, "-")
+	}
+	prefix = strings.Trim(invalidNameCharacters.ReplaceAllString(strings.ToLower(prefix), "-"), "-")
+	if len(prefix) > maxNamePrefixLength {
+		prefix = strings.TrimRight(prefix[:maxNamePrefixLength], "-")
+	}
+
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(img.ID))
+	return fmt.Sprintf("%s-%08x", prefix, hash.Sum32())
+}
+
+// newReport converts the image into the spec of a report. Pull secrets are never stored.
+func newReport(namespace string, img differentiating.Image) (*unstructured.Unstructured, error) {
+	spec, err := imageSpec(img)
+	if err != nil {
+		return nil, err
+	}
+	report := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	report.SetAPIVersion(GroupVersionResource.GroupVersion().String())
+	report.SetKind(Kind)
+	report.SetNamespace(namespace)
+	report.SetName(reportName(img))
+	report.SetLabels(map[string]string{managedByLabel: managedByValue})
+	return report, nil
+}
+
+func imageSpec(img differentiating.Image) (map[string]interface{}, error) {
+	spec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&img)
+	if err != nil {
+		return nil, fmt.Errorf("storage/crd error: could not convert image %s: %w", img.ID, err)
+	}
+	return spec, nil
+}
+
+// imageFromReport returns the image of the report spec
+func imageFromReport(report unstructured.Unstructured) (differentiating.Image, error) {
+	spec, ok, err := unstructured.NestedMap(report.Object, "spec")
+	if err != nil || !ok {
+		return differentiating.Image{}, fmt.Errorf("storage/crd error: report %s/%s has no spec: %v", report.GetNamespace(), report.GetName(), err)
+	}
+	var img differentiating.Image
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(spec, &img); err != nil {
+		return differentiating.Image{}, fmt.Errorf("storage/crd error: could not convert report %s/%s: %w", report.GetNamespace(), report.GetName(), err)
+	}
+	return img, nil
+}
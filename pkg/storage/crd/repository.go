@@ -0,0 +1,200 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package crd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/differentiating"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// DefaultFlushInterval between two batches of writes to the API server
+	DefaultFlushInterval = time.Second * 5
+	// DefaultBatchSize of pending writes which flushes the batch before the interval ends
+	DefaultBatchSize = 50
+)
+
+// Options configures the Storage. Zero values are replaced by the defaults.
+type Options struct {
+	// Namespace of the reports
+	Namespace     string
+	FlushInterval time.Duration
+	BatchSize     int
+}
+
+func (o Options) withDefaults() Options {
+	if o.Namespace == "" {
+		o.Namespace = "default"
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = DefaultFlushInterval
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = DefaultBatchSize
+	}
+	return o
+}
+
+// Storage persists the images as ImageReport custom resources. It implements differentiating.Repository with a write
+// behind cache: reads are served from memory and writes are sent to the API server in batches. Pull secrets are only
+// kept in memory, they are added again by the observers after a restart.
+type Storage struct {
+	client dynamic.ResourceInterface
+	opts   Options
+	mtx    sync.RWMutex
+	images map[string]differentiating.Image
+	batch  *batch
+	now    func() time.Time
+	// stop triggers the last flush of run, which closes done afterwards
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewCRDStorage loads the existing reports of the namespace and writes the changes until the context is done. The
+// changes after the last flush are written by Close.
+func NewCRDStorage(ctx context.Context, client dynamic.Interface, opts Options) (*Storage, error) {
+	opts = opts.withDefaults()
+	s := &Storage{
+		client: client.Resource(GroupVersionResource).Namespace(opts.Namespace),
+		opts:   opts,
+		images: make(map[string]differentiating.Image),
+		batch:  newBatch(opts.BatchSize),
+		now:    time.Now,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	reports, err := s.client.List(ctx, metaV1.ListOptions{LabelSelector: managedByLabel + "=" + managedByValue})
+	if err != nil {
+		return nil, fmt.Errorf("storage/crd error: could not list image reports in namespace %s: %w", opts.Namespace, err)
+	}
+	for _, report := range reports.Items {
+		img, err := imageFromReport(report)
+		if err != nil {
+			return nil, err
+		}
+		s.images[img.ID] = img
+	}
+
+	go s.run(ctx)
+	return s, nil
+}
+
+// Close writes the pending changes and blocks until they are written or the shutdown flush timeout exceeded. Changes
+// after Close are not written anymore.
+func (s *Storage) Close() error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+	return nil
+}
+
+func (s *Storage) AddImage(_ context.Context, img differentiating.Image) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if img.ID == "" {
+		return fmt.Errorf("storage/crd: image ID is empty: %+v", img)
+	}
+
+	if _, ok := s.images[img.ID]; ok {
+		return fmt.Errorf("storage/crd: image with ID \"%s\": %w", img.ID, differentiating.ErrImageExists)
+	}
+
+	s.images[img.ID] = img
+	s.batch.upsert(img)
+	return nil
+}
+
+func (s *Storage) DeleteImage(_ context.Context, img differentiating.Image) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	stored, ok := s.images[img.ID]
+	if !ok {
+		return fmt.Errorf("storage/crd: image not found %+v", img)
+	}
+
+	delete(s.images, img.ID)
+	s.batch.delete(stored)
+	return nil
+}
+
+func (s *Storage) UpdateImage(_ context.Context, img differentiating.Image) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	stored, ok := s.images[img.ID]
+	if !ok {
+		return fmt.Errorf("storage/crd: image not found %+v", img)
+	}
+
+	s.images[img.ID] = img
+	// the report name depends on the workload, a renamed report is replaced
+	if reportName(stored) != reportName(img) {
+		s.batch.delete(stored)
+	}
+	s.batch.upsert(img)
+	return nil
+}
+
+func (s *Storage) ListImages(_ context.Context, opts differentiating.ListOptions) ([]differentiating.Image, error) {
+	s.mtx.RLock()
+	images := make([]differentiating.Image, 0, len(s.images))
+	for _, image := range s.images {
+		images = append(images, image)
+	}
+	s.mtx.RUnlock()
+	return opts.Apply(images)
+}
+
+// SyncStatus updates the report status with the events of the subscription until it is unsubscribed
+func (s *Storage) SyncStatus(subscription *differentiating.Subscription) {
+	for event := range subscription.Events() {
+		s.updateStatus(event)
+	}
+}
+
+func (s *Storage) updateStatus(event differentiating.NotificationEvent) {
+	status, ok := newReportStatus(event, s.now())
+	if !ok {
+		return
+	}
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	img, ok := s.images[event.Image.ID]
+	if !ok {
+		return
+	}
+	s.batch.status(img, status)
+}
@@ -0,0 +1,254 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package crd
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/analyzing"
+	"github.com/fwiedmann/differ/pkg/differentiating"
+	"github.com/fwiedmann/differ/pkg/storage/storagetest"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+var testImage = differentiating.Image{
+	ID:       "local_default_apps/v1_uid_nginx_Deployment_nginx",
+	Registry: "registry-1.docker.io",
+	Name:     "library/nginx",
+	Tag:      "1.18.0",
+	Auth:     []*differentiating.PullSecret{{Username: "admin", Password: "admin"}},
+	Workload: differentiating.Workload{Cluster: "local", Namespace: "default", APIVersion: "apps/v1", Kind: "Deployment", Name: "nginx", UID: "uid", Container: "nginx"},
+}
+
+func newTestStorage(t *testing.T, objects ...runtime.Object) (*Storage, *fake.FakeDynamicClient) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), objects...)
+	s, err := NewCRDStorage(ctx, client, Options{Namespace: "differ", FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, client
+}
+
+func getReport(t *testing.T, client *fake.FakeDynamicClient, img differentiating.Image) (*unstructured.Unstructured, bool) {
+	t.Helper()
+	report, err := client.Resource(GroupVersionResource).Namespace("differ").Get(context.Background(), reportName(img), metaV1.GetOptions{})
+	if err != nil {
+		return nil, false
+	}
+	return report, true
+}
+
+func TestStorage_Images(t *testing.T) {
+	ctx := context.Background()
+	s, client := newTestStorage(t)
+
+	if err := s.AddImage(ctx, testImage); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddImage(ctx, testImage); !errors.Is(err, differentiating.ErrImageExists) {
+		t.Errorf("AddImage() error = %v, want ErrImageExists", err)
+	}
+	if _, ok := getReport(t, client, testImage); ok {
+		t.Fatal("AddImage() wrote the report before the flush")
+	}
+
+	images, err := s.ListImages(ctx, differentiating.ListOptions{ImageName: "library/nginx", Registry: "registry-1.docker.io"})
+	if err != nil || len(images) != 1 || len(images[0].Auth) != 1 {
+		t.Errorf("ListImages() = %+v, %v, want the cached image with pull secrets", images, err)
+	}
+
+	updated := testImage
+	updated.Tag = "1.19.0"
+	if err := s.UpdateImage(ctx, updated); err != nil {
+		t.Fatal(err)
+	}
+	s.Flush(ctx)
+
+	report, ok := getReport(t, client, testImage)
+	if !ok {
+		t.Fatal("Flush() did not create the report")
+	}
+	if tag, _, _ := unstructured.NestedString(report.Object, "spec", "tag"); tag != "1.19.0" {
+		t.Errorf("Flush() report tag = %s, want 1.19.0", tag)
+	}
+	if _, found, _ := unstructured.NestedFieldNoCopy(report.Object, "spec", "auth"); found {
+		t.Error("Flush() stored the pull secrets")
+	}
+
+	updated.Constraint = "~1.19"
+	if err := s.UpdateImage(ctx, updated); err != nil {
+		t.Fatal(err)
+	}
+	s.Flush(ctx)
+	report, _ = getReport(t, client, testImage)
+	if constraint, _, _ := unstructured.NestedString(report.Object, "spec", "constraint"); constraint != "~1.19" {
+		t.Errorf("Flush() report constraint = %q, want ~1.19", constraint)
+	}
+
+	if err := s.DeleteImage(ctx, updated); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteImage(ctx, updated); err == nil {
+		t.Error("DeleteImage() of a deleted image did not return an error")
+	}
+	s.Flush(ctx)
+	if _, ok := getReport(t, client, testImage); ok {
+		t.Error("Flush() did not delete the report")
+	}
+}
+
+func TestNewCRDStorage_loadsReports(t *testing.T) {
+	stored := testImage
+	stored.Auth = nil
+	report, err := newReport("differ", stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign := report.DeepCopy()
+	foreign.SetName("foreign")
+	foreign.SetLabels(nil)
+
+	s, _ := newTestStorage(t, report, foreign)
+	images, err := s.ListImages(context.Background(), differentiating.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(images, []differentiating.Image{stored}) {
+		t.Errorf("ListImages() = %+v, want %+v", images, stored)
+	}
+	if err := s.AddImage(context.Background(), testImage); !errors.Is(err, differentiating.ErrImageExists) {
+		t.Errorf("AddImage() of a loaded image error = %v, want ErrImageExists", err)
+	}
+}
+
+func TestStorage_Close(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme())
+	s, err := NewCRDStorage(ctx, client, Options{Namespace: "differ", FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	// writes of the subscribers after the context is done are written by the last flush
+	if err := s.AddImage(context.Background(), testImage); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, ok := getReport(t, client, testImage); !ok {
+		t.Error("Close() did not write the pending report")
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Close() a second time error = %v", err)
+	}
+}
+
+func TestStorage_updateStatus(t *testing.T) {
+	ctx := context.Background()
+	s, client := newTestStorage(t)
+	now := time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	if err := s.AddImage(ctx, testImage); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		event differentiating.NotificationEvent
+		want  map[string]interface{}
+	}{
+		{
+			name:  "Outdated",
+			event: differentiating.NotificationEvent{Type: differentiating.EventTypeOutdated, Image: testImage, NewTag: "1.19.0", LatestTag: "1.20.0", Bump: analyzing.BumpMinor},
+			want:  map[string]interface{}{"outdated": true, "newTag": "1.19.0", "latestTag": "1.20.0", "bump": "minor", "lastEvent": "outdated", "lastTransitionTime": "2020-12-01T00:00:00Z"},
+		},
+		{
+			name:  "RecommendationIsIgnored",
+			event: differentiating.NotificationEvent{Type: differentiating.EventTypeRecommendation, Image: testImage},
+			want:  map[string]interface{}{"outdated": true, "newTag": "1.19.0", "latestTag": "1.20.0", "bump": "minor", "lastEvent": "outdated", "lastTransitionTime": "2020-12-01T00:00:00Z"},
+		},
+		{
+			name:  "Resolved",
+			event: differentiating.NotificationEvent{Type: differentiating.EventTypeResolved, Image: testImage, NewTag: "1.20.0", LatestTag: "1.20.0"},
+			want:  map[string]interface{}{"outdated": false, "latestTag": "1.20.0", "lastEvent": "resolved", "lastTransitionTime": "2020-12-01T00:00:00Z"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.updateStatus(tt.event)
+			s.Flush(ctx)
+
+			report, ok := getReport(t, client, testImage)
+			if !ok {
+				t.Fatal("Flush() did not create the report")
+			}
+			status, _, _ := unstructured.NestedMap(report.Object, "status")
+			if !reflect.DeepEqual(status, tt.want) {
+				t.Errorf("status = %v, want %v", status, tt.want)
+			}
+		})
+	}
+}
+
+func TestReportName(t *testing.T) {
+	tests := []struct {
+		name       string
+		img        differentiating.Image
+		wantPrefix string
+	}{
+		{name: "Workload", img: testImage, wantPrefix: "deployment-nginx-nginx-"},
+		{name: "WithoutWorkload", img: differentiating.Image{ID: "1"}, wantPrefix: "image-"},
+		{name: "InvalidCharacters", img: differentiating.Image{ID: "1", Workload: differentiating.Workload{Kind: "StatefulSet", Name: "db_primary.1", Container: "Postgres"}}, wantPrefix: "statefulset-db-primary-1-postgres-"},
+		{name: "Truncated", img: differentiating.Image{ID: "1", Workload: differentiating.Workload{Kind: "Deployment", Name: "a-very-long-workload-name-which-exceeds-the-limit-of-names", Container: "app"}}, wantPrefix: "deployment-a-very-long-workload-name-which-exceeds-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := reportName(tt.img)
+			if len(got) != len(tt.wantPrefix)+8 || got[:len(tt.wantPrefix)] != tt.wantPrefix {
+				t.Errorf("reportName() = %s, want prefix %s with hash", got, tt.wantPrefix)
+			}
+		})
+	}
+}
+
+func TestStorage_Conformance(t *testing.T) {
+	storagetest.TestRepository(t, func(t *testing.T) differentiating.Repository {
+		s, _ := newTestStorage(t)
+		return s
+	})
+}
@@ -28,6 +28,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/fwiedmann/differ/pkg/differentiating"
 )
@@ -39,8 +40,9 @@ func NewMemoryStorage() *Storage {
 }
 
 type Storage struct {
-	mtx    sync.RWMutex
-	images map[string]differentiating.Image
+	mtx     sync.RWMutex
+	images  map[string]differentiating.Image
+	history []differentiating.HistoryEntry
 }
 
 func (s *Storage) AddImage(_ context.Context, img differentiating.Image) error {
@@ -51,7 +53,7 @@ func (s *Storage) AddImage(_ context.Context, img differentiating.Image) error {
 	}
 
 	if _, ok := s.images[img.ID]; ok {
-		return fmt.Errorf("storage/memory: image with ID \"%s\" already exists", img.ID)
+		return fmt.Errorf("storage/memory: image with ID \"%s\": %w", img.ID, differentiating.ErrImageExists)
 	}
 
 	s.images[img.ID] = img
@@ -83,11 +85,41 @@ func (s *Storage) UpdateImage(_ context.Context, img differentiating.Image) erro
 }
 
 func (s *Storage) ListImages(_ context.Context, opts differentiating.ListOptions) ([]differentiating.Image, error) {
-	var matchedImages []differentiating.Image
+	s.mtx.RLock()
+	images := make([]differentiating.Image, 0, len(s.images))
 	for _, image := range s.images {
-		if (opts.ImageName == "" || opts.ImageName == image.Name) && (opts.Registry == "" || opts.Registry == image.Registry) {
-			matchedImages = append(matchedImages, image)
+		images = append(images, image)
+	}
+	s.mtx.RUnlock()
+	return opts.Apply(images)
+}
+
+// AddHistoryEntry implements the differentiating.HistoryRepository interface
+func (s *Storage) AddHistoryEntry(_ context.Context, entry differentiating.HistoryEntry) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.history = append(s.history, entry)
+	return nil
+}
+
+// ListHistory implements the differentiating.HistoryRepository interface
+func (s *Storage) ListHistory(_ context.Context, query differentiating.HistoryQuery) ([]differentiating.HistoryEntry, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return query.Apply(s.history)
+}
+
+// PruneHistory implements the differentiating.HistoryRepository interface
+func (s *Storage) PruneHistory(_ context.Context, before time.Time, keep func(differentiating.HistoryEntry) bool) (int, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	kept := s.history[:0]
+	for _, entry := range s.history {
+		if !entry.Time.Before(before) || (keep != nil && keep(entry)) {
+			kept = append(kept, entry)
 		}
 	}
-	return matchedImages, nil
+	pruned := len(s.history) - len(kept)
+	s.history = kept
+	return pruned, nil
 }
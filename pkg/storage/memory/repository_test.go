@@ -31,6 +31,7 @@ import (
 	"testing"
 
 	"github.com/fwiedmann/differ/pkg/differentiating"
+	"github.com/fwiedmann/differ/pkg/storage/storagetest"
 )
 
 func TestNewMemoryStorage(t *testing.T) {
@@ -409,3 +410,15 @@ func TestStorage_ListImages(t *testing.T) {
 		})
 	}
 }
+
+func TestStorage_Conformance(t *testing.T) {
+	storagetest.TestRepository(t, func(_ *testing.T) differentiating.Repository {
+		return NewMemoryStorage()
+	})
+}
+
+func TestStorage_HistoryConformance(t *testing.T) {
+	storagetest.TestHistoryRepository(t, func(_ *testing.T) differentiating.HistoryRepository {
+		return NewMemoryStorage()
+	})
+}
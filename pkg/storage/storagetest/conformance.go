@@ -0,0 +1,211 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+// Package storagetest provides the conformance tests, which every differentiating.Repository implementation must pass
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/fwiedmann/differ/pkg/differentiating"
+)
+
+// NewRepository creates an empty repository for a single test
+type NewRepository func(t *testing.T) differentiating.Repository
+
+// Images are stored by the list tests
+var Images = []differentiating.Image{
+	{ID: "1", Registry: "registry-1.docker.io", Name: "library/nginx", Tag: "1.18.0", Workload: differentiating.Workload{Namespace: "web", Kind: "Deployment", Name: "frontend", Container: "nginx", Labels: map[string]string{"app": "frontend", "tier": "web"}}},
+	{ID: "2", Registry: "registry-1.docker.io", Name: "library/nginx", Tag: "1.9.0", Workload: differentiating.Workload{Namespace: "web", Kind: "Deployment", Name: "backend", Container: "proxy", Labels: map[string]string{"app": "backend", "tier": "web"}}},
+	{ID: "3", Registry: "registry-1.docker.io", Name: "library/redis", Tag: "6.0.9", Workload: differentiating.Workload{Namespace: "cache", Kind: "StatefulSet", Name: "redis", Container: "redis", Labels: map[string]string{"app": "redis", "tier": "cache"}}},
+	{ID: "4", Registry: "quay.io", Name: "prometheus/node-exporter", Tag: "v1.0.1", Workload: differentiating.Workload{Namespace: "monitoring", Kind: "DaemonSet", Name: "node-exporter", Container: "node-exporter"}},
+	{ID: "5", Registry: "registry-1.docker.io", Name: "library/nginx", Tag: "1.18.0", Workload: differentiating.Workload{Namespace: "admin", Kind: "Deployment", Name: "frontend", Container: "nginx", Labels: map[string]string{"app": "frontend"}}},
+}
+
+// TestRepository runs the conformance tests against the repositories created by newRepository
+func TestRepository(t *testing.T, newRepository NewRepository) {
+	t.Run("AddImage", func(t *testing.T) { testAddImage(t, newRepository(t)) })
+	t.Run("UpdateImage", func(t *testing.T) { testUpdateImage(t, newRepository(t)) })
+	t.Run("DeleteImage", func(t *testing.T) { testDeleteImage(t, newRepository(t)) })
+	t.Run("ListImages", func(t *testing.T) { testListImages(t, newRepository(t)) })
+	t.Run("Concurrency", func(t *testing.T) { testConcurrency(t, newRepository(t)) })
+}
+
+func testAddImage(t *testing.T, rp differentiating.Repository) {
+	ctx := context.Background()
+	if err := rp.AddImage(ctx, Images[0]); err != nil {
+		t.Fatalf("AddImage() error = %v", err)
+	}
+	if err := rp.AddImage(ctx, Images[0]); !errors.Is(err, differentiating.ErrImageExists) {
+		t.Errorf("AddImage() of an existing image error = %v, want ErrImageExists", err)
+	}
+	if err := rp.AddImage(ctx, differentiating.Image{Name: "library/nginx"}); err == nil {
+		t.Error("AddImage() without ID did not return an error")
+	}
+	assertIDs(t, rp, differentiating.ListOptions{}, "1")
+}
+
+func testUpdateImage(t *testing.T, rp differentiating.Repository) {
+	ctx := context.Background()
+	if err := rp.UpdateImage(ctx, Images[0]); err == nil {
+		t.Error("UpdateImage() of a missing image did not return an error")
+	}
+	mustAdd(t, rp, Images[0])
+
+	updated := Images[0]
+	updated.Tag = "1.19.0"
+	updated.Workload.Name = "web"
+	if err := rp.UpdateImage(ctx, updated); err != nil {
+		t.Fatalf("UpdateImage() error = %v", err)
+	}
+	assertIDs(t, rp, differentiating.ListOptions{Tag: "1.19.0", WorkloadName: "web"}, "1")
+	assertIDs(t, rp, differentiating.ListOptions{Tag: "1.18.0"})
+}
+
+func testDeleteImage(t *testing.T, rp differentiating.Repository) {
+	ctx := context.Background()
+	if err := rp.DeleteImage(ctx, Images[0]); err == nil {
+		t.Error("DeleteImage() of a missing image did not return an error")
+	}
+	mustAdd(t, rp, Images[0], Images[1])
+	if err := rp.DeleteImage(ctx, Images[0]); err != nil {
+		t.Fatalf("DeleteImage() error = %v", err)
+	}
+	assertIDs(t, rp, differentiating.ListOptions{}, "2")
+	assertIDs(t, rp, differentiating.ListOptions{ImageName: "library/nginx", Registry: "registry-1.docker.io"}, "2")
+}
+
+func testListImages(t *testing.T, rp differentiating.Repository) {
+	mustAdd(t, rp, Images...)
+
+	tests := []struct {
+		name    string
+		opts    differentiating.ListOptions
+		wantIDs []string
+	}{
+		{name: "All", opts: differentiating.ListOptions{}, wantIDs: []string{"1", "2", "3", "4", "5"}},
+		{name: "NameAndRegistry", opts: differentiating.ListOptions{ImageName: "library/nginx", Registry: "registry-1.docker.io"}, wantIDs: []string{"1", "2", "5"}},
+		{name: "Registry", opts: differentiating.ListOptions{Registry: "quay.io"}, wantIDs: []string{"4"}},
+		{name: "Namespace", opts: differentiating.ListOptions{Namespace: "web"}, wantIDs: []string{"1", "2"}},
+		{name: "WorkloadKind", opts: differentiating.ListOptions{WorkloadKind: "Deployment"}, wantIDs: []string{"1", "2", "5"}},
+		{name: "WorkloadName", opts: differentiating.ListOptions{WorkloadKind: "Deployment", WorkloadName: "frontend"}, wantIDs: []string{"1", "5"}},
+		{name: "Container", opts: differentiating.ListOptions{Container: "proxy"}, wantIDs: []string{"2"}},
+		{name: "Tag", opts: differentiating.ListOptions{Tag: "1.18.0"}, wantIDs: []string{"1", "5"}},
+		{name: "LabelSelector", opts: differentiating.ListOptions{LabelSelector: "app=frontend"}, wantIDs: []string{"1", "5"}},
+		{name: "LabelSelectorSet", opts: differentiating.ListOptions{LabelSelector: "tier in (web,cache),app!=backend"}, wantIDs: []string{"1", "3"}},
+		{name: "LabelSelectorExists", opts: differentiating.ListOptions{LabelSelector: "!tier"}, wantIDs: []string{"4", "5"}},
+		{name: "NoMatch", opts: differentiating.ListOptions{Namespace: "kube-system"}, wantIDs: nil},
+		{name: "SortByName", opts: differentiating.ListOptions{SortBy: differentiating.SortByName}, wantIDs: []string{"4", "1", "2", "5", "3"}},
+		{name: "SortByNamespace", opts: differentiating.ListOptions{SortBy: differentiating.SortByNamespace}, wantIDs: []string{"5", "3", "4", "2", "1"}},
+		{name: "SortByWorkload", opts: differentiating.ListOptions{SortBy: differentiating.SortByWorkload}, wantIDs: []string{"4", "2", "1", "5", "3"}},
+		{name: "SortByTag", opts: differentiating.ListOptions{SortBy: differentiating.SortByTag}, wantIDs: []string{"4", "2", "1", "5", "3"}},
+		{name: "SortDescending", opts: differentiating.ListOptions{SortBy: differentiating.SortByTag, Descending: true}, wantIDs: []string{"3", "5", "1", "2", "4"}},
+		{name: "FirstPage", opts: differentiating.ListOptions{Limit: 2}, wantIDs: []string{"1", "2"}},
+		{name: "SecondPage", opts: differentiating.ListOptions{Offset: 2, Limit: 2}, wantIDs: []string{"3", "4"}},
+		{name: "LastPage", opts: differentiating.ListOptions{Offset: 4, Limit: 2}, wantIDs: []string{"5"}},
+		{name: "OffsetBeyondEnd", opts: differentiating.ListOptions{Offset: 10}, wantIDs: nil},
+		{name: "FilteredPage", opts: differentiating.ListOptions{ImageName: "library/nginx", SortBy: differentiating.SortByNamespace, Offset: 1, Limit: 1}, wantIDs: []string{"2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertIDs(t, rp, tt.opts, tt.wantIDs...)
+		})
+	}
+
+	for _, invalid := range []differentiating.ListOptions{
+		{SortBy: "size"},
+		{Offset: -1},
+		{Limit: -1},
+		{LabelSelector: "app in (web"},
+	} {
+		if _, err := rp.ListImages(context.Background(), invalid); err == nil {
+			t.Errorf("ListImages(%+v) did not return an error", invalid)
+		}
+	}
+}
+
+// testConcurrency has to be run with the race detector to find unsynchronized access
+func testConcurrency(t *testing.T, rp differentiating.Repository) {
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			img := Images[0]
+			img.ID = fmt.Sprintf("concurrent-%d", i)
+			if err := rp.AddImage(ctx, img); err != nil {
+				errs <- err
+				return
+			}
+			img.Tag = "1.19.0"
+			if err := rp.UpdateImage(ctx, img); err != nil {
+				errs <- err
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			if _, err := rp.ListImages(ctx, differentiating.ListOptions{ImageName: "library/nginx", Registry: "registry-1.docker.io"}); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent access error = %v", err)
+	}
+	assertIDs(t, rp, differentiating.ListOptions{Tag: "1.19.0"}, "concurrent-0", "concurrent-1", "concurrent-2", "concurrent-3", "concurrent-4", "concurrent-5", "concurrent-6", "concurrent-7", "concurrent-8", "concurrent-9")
+}
+
+func mustAdd(t *testing.T, rp differentiating.Repository, images ...differentiating.Image) {
+	t.Helper()
+	for _, img := range images {
+		if err := rp.AddImage(context.Background(), img); err != nil {
+			t.Fatalf("AddImage() error = %v", err)
+		}
+	}
+}
+
+// assertIDs compares the IDs of the listed images in the order of the options, which defaults to the ID
+func assertIDs(t *testing.T, rp differentiating.Repository, opts differentiating.ListOptions, wantIDs ...string) {
+	t.Helper()
+	images, err := rp.ListImages(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("ListImages(%+v) error = %v", opts, err)
+	}
+	var ids []string
+	for _, img := range images {
+		ids = append(ids, img.ID)
+	}
+	if !reflect.DeepEqual(ids, wantIDs) {
+		t.Errorf("ListImages(%+v) = %v, want %v", opts, ids, wantIDs)
+	}
+}
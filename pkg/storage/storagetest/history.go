@@ -0,0 +1,164 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2019 Felix Wiedmann
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package storagetest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fwiedmann/differ/pkg/differentiating"
+)
+
+// NewHistoryRepository creates an empty history repository for a single test
+type NewHistoryRepository func(t *testing.T) differentiating.HistoryRepository
+
+var historyStart = time.Date(2020, 12, 1, 8, 0, 0, 0, time.UTC)
+
+// History is stored by the history tests, the entries are ordered by time
+var History = []differentiating.HistoryEntry{
+	{Type: differentiating.HistoryNewerTag, Time: historyStart, Image: "registry-1.docker.io/library/nginx", NewTag: "1.19.0"},
+	{Type: differentiating.HistoryOutdated, Time: historyStart.Add(time.Minute), Image: "registry-1.docker.io/library/nginx", ImageID: "1", Workload: &differentiating.Workload{Namespace: "web", Kind: "Deployment", Name: "frontend", Container: "nginx"}, OldTag: "1.18.0", NewTag: "1.19.0"},
+	{Type: differentiating.HistoryOutdated, Time: historyStart.Add(2 * time.Minute), Image: "registry-1.docker.io/library/nginx", ImageID: "5", Workload: &differentiating.Workload{Namespace: "admin", Kind: "Deployment", Name: "frontend", Container: "nginx"}, OldTag: "1.18.0", NewTag: "1.19.0"},
+	{Type: differentiating.HistoryTagChanged, Time: historyStart.Add(time.Hour), Image: "registry-1.docker.io/library/nginx", ImageID: "1", Workload: &differentiating.Workload{Namespace: "web", Kind: "Deployment", Name: "frontend", Container: "nginx"}, OldTag: "1.18.0", NewTag: "1.19.0", OutdatedSince: timePtr(historyStart.Add(time.Minute))},
+	{Type: differentiating.HistoryTagChanged, Time: historyStart.Add(2 * time.Hour), Image: "registry-1.docker.io/library/redis", ImageID: "3", Workload: &differentiating.Workload{Namespace: "cache", Kind: "StatefulSet", Name: "redis", Container: "redis"}, OldTag: "6.0.8", NewTag: "6.0.9"},
+}
+
+// TestHistoryRepository runs the conformance tests against the history repositories created by newRepository
+func TestHistoryRepository(t *testing.T, newRepository NewHistoryRepository) {
+	t.Run("ListHistory", func(t *testing.T) { testListHistory(t, newRepository(t)) })
+	t.Run("PruneHistory", func(t *testing.T) { testPruneHistory(t, newRepository) })
+}
+
+func testListHistory(t *testing.T, rp differentiating.HistoryRepository) {
+	// the entries are added in reverse order to verify the sorting
+	for i := len(History) - 1; i >= 0; i-- {
+		if err := rp.AddHistoryEntry(context.Background(), History[i]); err != nil {
+			t.Fatalf("AddHistoryEntry() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		query       differentiating.HistoryQuery
+		wantEntries []int
+		wantErr     bool
+	}{
+		{name: "All", query: differentiating.HistoryQuery{}, wantEntries: []int{0, 1, 2, 3, 4}},
+		{name: "Type", query: differentiating.HistoryQuery{Type: differentiating.HistoryTagChanged}, wantEntries: []int{3, 4}},
+		{name: "Image", query: differentiating.HistoryQuery{Image: "registry-1.docker.io/library/redis"}, wantEntries: []int{4}},
+		{name: "ImageID", query: differentiating.HistoryQuery{ImageID: "1"}, wantEntries: []int{1, 3}},
+		{name: "Namespace", query: differentiating.HistoryQuery{Namespace: "admin"}, wantEntries: []int{2}},
+		{name: "Workload", query: differentiating.HistoryQuery{WorkloadKind: "Deployment", WorkloadName: "frontend", Container: "nginx"}, wantEntries: []int{1, 2, 3}},
+		{name: "Since", query: differentiating.HistoryQuery{Since: historyStart.Add(time.Hour)}, wantEntries: []int{3, 4}},
+		{name: "Until", query: differentiating.HistoryQuery{Until: historyStart.Add(time.Hour)}, wantEntries: []int{0, 1, 2}},
+		{name: "Range", query: differentiating.HistoryQuery{Since: historyStart.Add(time.Minute), Until: historyStart.Add(2 * time.Hour)}, wantEntries: []int{1, 2, 3}},
+		{name: "LimitKeepsNewest", query: differentiating.HistoryQuery{Limit: 2}, wantEntries: []int{3, 4}},
+		{name: "InvalidType", query: differentiating.HistoryQuery{Type: "deleted"}, wantErr: true},
+		{name: "InvalidRange", query: differentiating.HistoryQuery{Since: historyStart.Add(time.Hour), Until: historyStart}, wantErr: true},
+		{name: "InvalidLimit", query: differentiating.HistoryQuery{Limit: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rp.ListHistory(context.Background(), tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ListHistory() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			assertEntries(t, got, tt.wantEntries...)
+		})
+	}
+}
+
+func testPruneHistory(t *testing.T, newRepository NewHistoryRepository) {
+	tests := []struct {
+		name        string
+		keep        func(differentiating.HistoryEntry) bool
+		wantPruned  int
+		wantEntries []int
+	}{
+		{
+			name:        "Expired",
+			wantPruned:  3,
+			wantEntries: []int{3, 4},
+		},
+		{
+			name: "KeepOpenOutdated",
+			keep: func(entry differentiating.HistoryEntry) bool {
+				return entry.Type == differentiating.HistoryOutdated && entry.ImageID == "5"
+			},
+			wantPruned:  2,
+			wantEntries: []int{2, 3, 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := newRepository(t)
+			ctx := context.Background()
+			for _, entry := range History {
+				if err := rp.AddHistoryEntry(ctx, entry); err != nil {
+					t.Fatalf("AddHistoryEntry() error = %v", err)
+				}
+			}
+
+			pruned, err := rp.PruneHistory(ctx, historyStart.Add(time.Hour), tt.keep)
+			if err != nil {
+				t.Fatalf("PruneHistory() error = %v", err)
+			}
+			if pruned != tt.wantPruned {
+				t.Errorf("PruneHistory() pruned %d entries, want %d", pruned, tt.wantPruned)
+			}
+
+			got, err := rp.ListHistory(ctx, differentiating.HistoryQuery{})
+			if err != nil {
+				t.Fatalf("ListHistory() error = %v", err)
+			}
+			assertEntries(t, got, tt.wantEntries...)
+		})
+	}
+}
+
+func assertEntries(t *testing.T, got []differentiating.HistoryEntry, wantEntries ...int) {
+	t.Helper()
+	want := make([]differentiating.HistoryEntry, 0, len(wantEntries))
+	for _, i := range wantEntries {
+		want = append(want, History[i])
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ListHistory() returned %d entries, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if !got[i].Time.Equal(want[i].Time) || got[i].Type != want[i].Type || got[i].ImageID != want[i].ImageID || !reflect.DeepEqual(got[i].Workload, want[i].Workload) {
+			t.Errorf("ListHistory()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}